@@ -0,0 +1,32 @@
+/*
+dtdgen is a tool to automatically generate Go type declarations and
+associated methods based on one or more XML Document Type Definitions.
+
+Usage:
+
+	dtdgen [-o file] [-ns xmlns] [-pkg name] [-r rule] file ...
+
+Given a set of files containing DTD declarations, such as the external
+subset named by a document's DOCTYPE, dtdgen will create a new Go source
+file containing a type declaration for each element type declared in
+the DTDs. The declarations are translated to an XML Schema, and the Go
+source is generated as with the xsdgen command.
+
+DTDs are not aware of XML namespaces. The -ns flag sets the namespace
+of the declared elements, which is empty by default. Prefixes in
+element and attribute names are removed.
+
+External parameter entities are read from the local file system,
+relative to the directory of the DTD that references them.
+
+The default package name and output file are "ws" and "dtdgen_output.go",
+and can be overridden by the -pkg and -o flags, respectively. The -r
+flag specifies replacement rules for identifiers, as with the xsdgen
+command.
+
+The dtdgen command may be used with the go generate command. Simply
+embed a comment in your go source like so:
+
+	//go:generate dtdgen -pkg partner partner.dtd
+*/
+package main
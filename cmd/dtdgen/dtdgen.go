@@ -0,0 +1,19 @@
+package main
+
+import (
+	"log"
+	"os"
+
+	"github.com/m29h/go-xml/dtdgen"
+)
+
+func main() {
+	log.SetFlags(0)
+	var cfg dtdgen.Config
+	cfg.XSDOption(dtdgen.DefaultXSDOptions...)
+	cfg.Option(dtdgen.LogOutput(log.New(os.Stderr, "", 0)))
+
+	if err := cfg.GenCLI(os.Args[1:]...); err != nil {
+		log.Fatal(err)
+	}
+}
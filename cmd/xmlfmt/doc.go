@@ -0,0 +1,31 @@
+/*
+xmlfmt formats XML documents, much like gofmt formats Go source.
+
+Usage:
+
+	xmlfmt [-l] [-w] [-check] [-indent str] [-sortattrs] [-ns=false] [path ...]
+
+Without an explicit path, xmlfmt formats its standard input. Given a
+file, it formats the file; given a directory, it formats all files with
+the extensions .xml, .xsd, .wsdl, .xsl and .xslt in the directory and
+its subdirectories. By default, xmlfmt prints the formatted documents
+to standard output.
+
+Formatting places each element, comment and processing instruction on
+its own line, indented by two spaces, or the string given by the -indent
+flag, per level of nesting. Elements containing text are left as they
+are, so that mixed content is not changed. Namespace declarations are
+moved to the document element, and declarations that are not used are
+removed, unless the -ns=false flag is given. A declaration is used if
+its prefix appears in an element or attribute name, or in front of a
+colon in an attribute value or text, where it may be part of a QName.
+The -sortattrs flag sorts the attributes of each element by name.
+
+The -l flag lists files whose formatting differs from xmlfmt's, and the
+-w flag writes the result back to the file instead of to standard
+output. The -check flag is like -l, but also exits with a non-zero
+status if any file needs formatting, for use in continuous integration:
+
+	xmlfmt -check schemas/
+*/
+package main
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/m29h/go-xml/xmltree"
+)
+
+var (
+	list      = flag.Bool("l", false, "list files whose formatting differs from xmlfmt's")
+	write     = flag.Bool("w", false, "write result to (source) file instead of stdout")
+	check     = flag.Bool("check", false, "list files whose formatting differs, and exit with status 1 if there are any")
+	indent    = flag.String("indent", "  ", "indentation for each level of nesting")
+	sortAttrs = flag.Bool("sortattrs", false, "sort attributes by name")
+	normNS    = flag.Bool("ns", true, "hoist namespace declarations to the document element and remove unused ones")
+)
+
+// File extensions formatted when walking directories.
+var extensions = map[string]bool{
+	".xml":  true,
+	".xsd":  true,
+	".wsdl": true,
+	".xsl":  true,
+	".xslt": true,
+}
+
+func main() {
+	log.SetFlags(0)
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags] [path ...]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Flags:\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		if *write {
+			log.Fatal("cannot use -w with standard input")
+		}
+		changed, err := process("<standard input>", os.Stdin, os.Stdout)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if changed && *check {
+			os.Exit(1)
+		}
+		return
+	}
+
+	failed, unformatted := false, false
+	for _, path := range flag.Args() {
+		err := filepath.WalkDir(path, func(filename string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() || (filename != path && !extensions[strings.ToLower(filepath.Ext(filename))]) {
+				return nil
+			}
+			changed, err := processFile(filename)
+			if err != nil {
+				log.Print(err)
+				failed = true
+			}
+			unformatted = unformatted || changed
+			return nil
+		})
+		if err != nil {
+			log.Print(err)
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(2)
+	}
+	if unformatted && *check {
+		os.Exit(1)
+	}
+}
+
+func processFile(filename string) (bool, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	return process(filename, f, os.Stdout)
+}
+
+// process formats the document read from in, and reports whether
+// its formatting changed.
+func process(filename string, in io.Reader, out io.Writer) (bool, error) {
+	src, err := io.ReadAll(in)
+	if err != nil {
+		return false, err
+	}
+	res, err := format(src)
+	if err != nil {
+		return false, fmt.Errorf("%s: %v", filename, err)
+	}
+	changed := !bytes.Equal(src, res)
+	if *list || *check {
+		if changed {
+			fmt.Fprintln(out, filename)
+		}
+	}
+	if *write {
+		if changed {
+			info, err := os.Stat(filename)
+			if err != nil {
+				return changed, err
+			}
+			if err := os.WriteFile(filename, res, info.Mode().Perm()); err != nil {
+				return changed, err
+			}
+		}
+	} else if !*list && !*check {
+		if _, err := out.Write(res); err != nil {
+			return changed, err
+		}
+	}
+	return changed, nil
+}
+
+func format(src []byte) ([]byte, error) {
+	doc, err := xmltree.ParseDocument(src)
+	if err != nil {
+		return nil, err
+	}
+	if *normNS {
+		doc.Root.NormalizeNamespaces()
+	}
+	if *sortAttrs {
+		doc.Root.SortAttrs()
+	}
+	return xmltree.MarshalDocumentIndent(doc, *indent), nil
+}
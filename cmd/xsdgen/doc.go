@@ -5,6 +5,8 @@ associated methods based on one or more XML Schema.
 Usage:
 
 	xsdgen [-o file] [-ns xmlns] [-pkg name] [-r rule] file ...
+	xsdgen -split namespace|file|size [-maxlines n] [-o dir] file ...
+	xsdgen -pkgpath xmlns=importpath ... [-o dir] file ...
 
 Given a set of XML files containing <xsd:schema> declarations,
 xsdgen will create a new self-contained Go source file containing
@@ -12,6 +14,11 @@ a type declaration for each type defined in the schema. The generated
 source file is self-contained and only depends on the Go standard
 library.
 
+Files whose names end in .rng or .rnc are read as RELAX NG schema, in
+the XML or compact syntax, and translated to XML Schema as described
+in the documentation of the rng package. Their includes and external
+references are read from the local file system.
+
 If the -ns flag is used, only types defined in schema with the specified
 target namespace will be declared in the Go source. The -ns flag may
 be used more than once. If -ns is not specified, types for all schema in
@@ -21,6 +28,34 @@ The default package name and output file are "ws" and "xsdgen_output.go",
 and can be overridden by the -pkg and -o flags, respectively. The xsdgen
 command will try to fetch any schema dependencies before parsing.
 
+Code generated from large schema may be split across multiple files
+with the -split flag. Types are grouped into one file per target
+namespace with -split namespace, one file per schema file with -split
+file, or into files of at most -maxlines lines each with -split size.
+The -maxlines flag may also be combined with the other groupings to
+split files that are too long. When splitting, the -o flag names the
+output directory, which defaults to the current directory, and the
+helper types and functions shared by the generated types are written
+to helpers.go.
+
+If types in different namespaces map to the same Go name, xsdgen
+reports the collision and generates nothing. The -nsprefix flag, of
+the form "xmlns=Prefix", adds a prefix to the names of all types in a
+namespace, and the -rename flag, of the form "xmlns:name=GoName",
+sets the Go name of a single type. Both flags may be used more than
+once.
+
+The -pkgpath flag maps a target namespace to the import path of a Go
+package, and may be used more than once. Each target namespace that
+is mapped to an import path is generated into its own package, in a
+subdirectory of the output directory named after the package, and
+types from the namespaces of other packages are referred to by
+qualified identifiers, such as common.Address. Packages for mapped
+namespaces that are not target namespaces are not generated again,
+so a package of common types can be generated once and shared by the
+packages of several schema. Types from namespaces that are not mapped
+are declared in every package that uses them.
+
 The -r flag can be used to specify a series of replacement rules. A replacement
 rule is a string of the form
 
@@ -33,6 +68,75 @@ For example, the rule
 will transform the identifier Array_Of_soapenc_boolean to booleanArray.
 All identifiers are passed through the defined substitution rules.
 
+The -bind flag, of the form "xmlns:name=import/path.Type", uses an
+existing Go type for an XML type, built-in or declared in a schema,
+instead of the type xsdgen would choose or generate. For example,
+
+	-bind http://www.w3.org/2001/XMLSchema:decimal=github.com/shopspring/decimal.Decimal
+
+declares all xs:decimal fields as decimal.Decimal values. No type is
+generated for bound types. The flag may be used more than once.
+
+Fields of type xs:duration, and of the xs:dayTimeDuration and
+xs:yearMonthDuration types of XML Schema 1.1, are declared with helper
+types that hold the years, months, days, hours, minutes and seconds
+of a duration. They are marshalled in canonical form, and can be
+converted to and from a time.Duration with their Duration and
+SetDuration methods, as long as the duration has no years or months.
+A zero duration is marshalled as PT0S; optional durations are
+declared as pointers, so that they are left out when absent.
+
+Optional elements and attributes of simple types are declared as plain
+values with the omitempty option, so that a zero value cannot be told
+apart from an absent one. The -optional flag changes this: with
+-optional pointer, the fields of optional and nillable elements and
+of optional attributes are declared as pointers, and with -optional
+generic, they are declared with the generic type Optional[T], which is
+generated alongside the schema types. Both handle xsi:nil="true" on
+nillable elements. With -optional pointer, nillable elements are
+declared with the generic type Nillable[T], which holds a pointer and
+marshals a nil one as xsi:nil="true"; if they are also optional, they
+are declared as a *Nillable[T], which is nil if the element is absent.
+
+Elements and attributes with a default or fixed value of a type that
+can be a Go constant, such as a string or a number, are given a
+constant named after their type and field, such as RecordCountDefault,
+and their type is given a SetDefaults method that sets those fields.
+As in XML Schema, empty elements and absent attributes are
+unmarshalled as the default or fixed value, while absent elements
+are not. Zero values of optional attributes, which would be omitted,
+are marshalled as the default or fixed value; zero values of optional
+elements are omitted, and those of required fields are marshalled as
+they are. Any other value of a field with a fixed value is an error.
+Such fields are always declared as plain values.
+
+Date and time types, such as xs:dateTime and xs:gYear, are declared
+as time.Time, and marshalled with a time zone and at most six
+fractional digits. With the -exacttimes flag, they are declared with
+helper types that embed a time.Time and remember whether the value had
+a time zone, how UTC was written, and how many fractional digits its
+seconds had, so that values are marshalled in the form they were
+unmarshalled in. These types also accept negative years, years of
+more than four digits, and the time 24:00:00.
+
+By default, xs:decimal is declared as float64 and xs:integer and the
+unbounded types derived from it, such as xs:nonNegativeInteger, as
+int, which cannot hold every value allowed by the schema. With the
+-lossless flag, they are declared as the unexported types xsdDecimal
+and xsdInteger, which are generated alongside the schema types and
+hold the text of a value. Both types check their value when
+unmarshalled, including the totalDigits and fractionDigits facets of
+types derived from them, and convert it to a *big.Rat or *big.Int on
+request, as do the types derived from them. An empty value is zero.
+Fixed values of these types are compared numerically, so that 1.00
+matches a fixed value of 1.0.
+
+The -config flag reads options from a JSON file, as described by the
+ConfigFile type of the xsdgen package, so that namespaces, package
+paths, prefixes, renames, type bindings, replacement rules, ignored elements and
+attributes, and the settings of the other flags can be kept in one
+place. Flags given on the command line override the file.
+
 The xsdgen command may be used with the go generate command. Simply
 embed a comment in your go source like so:
 
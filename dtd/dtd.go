@@ -0,0 +1,377 @@
+// Package dtd parses XML Document Type Definitions.
+//
+// A DTD declares the elements and attributes that may appear in a
+// document, and the entities that may be referenced from it. The dtd
+// package parses the declarations of the internal and external subsets
+// of a document type declaration, expanding parameter entities and
+// conditional sections, and records them in a DTD value. It does not
+// validate documents.
+//
+// DTDs are not aware of XML namespaces; element and attribute names are
+// recorded as they are written, including any prefix.
+//
+// https://www.w3.org/TR/xml/#sec-prolog-dtd
+package dtd
+
+import (
+	"errors"
+	"fmt"
+)
+
+// A DTD contains the declarations of a document type definition, in the
+// order they were declared. As in XML, the first declaration of an
+// entity or attribute is binding, and later declarations of the same
+// name are ignored.
+type DTD struct {
+	// The name of the document element, as given in the
+	// document type declaration. Name is empty for a DTD parsed
+	// with Parse.
+	Name string
+	// The public and system identifiers of the external subset,
+	// if any.
+	PublicID, SystemID string
+	Elements           []*Element
+	Attributes         []*Attribute
+	Entities           []*Entity
+	Notations          []*Notation
+
+	elements   map[string]*Element
+	attributes map[string][]*Attribute
+	entities   map[string]*Entity
+	params     map[string]*Entity
+}
+
+// Element returns the declaration of the named element, or nil if
+// there is none.
+func (d *DTD) Element(name string) *Element {
+	return d.elements[name]
+}
+
+// AttributesOf returns the attributes declared for the named element,
+// in the order they were declared.
+func (d *DTD) AttributesOf(element string) []*Attribute {
+	return d.attributes[element]
+}
+
+// Entity returns the declaration of the general entity name, or nil if
+// there is none.
+func (d *DTD) Entity(name string) *Entity {
+	return d.entities[name]
+}
+
+// ParamEntity returns the declaration of the parameter entity name, or
+// nil if there is none.
+func (d *DTD) ParamEntity(name string) *Entity {
+	return d.params[name]
+}
+
+// ContentType is the type of the content of an element.
+type ContentType int
+
+const (
+	// The element must be empty.
+	Empty ContentType = iota
+	// The element may contain any declared elements and text.
+	Any
+	// The element may contain text, and the elements listed in
+	// its Model, in any order.
+	Mixed
+	// The element may contain only the elements described by its
+	// Model, and white space.
+	Children
+)
+
+func (t ContentType) String() string {
+	switch t {
+	case Empty:
+		return "EMPTY"
+	case Any:
+		return "ANY"
+	case Mixed:
+		return "Mixed"
+	case Children:
+		return "Children"
+	}
+	return fmt.Sprintf("ContentType(%d)", int(t))
+}
+
+// An Element is an <!ELEMENT> declaration.
+type Element struct {
+	Name    string
+	Content ContentType
+	// For Mixed content, a Choice of the elements that may appear
+	// in the content, which may have no Children. For Children
+	// content, the content model. Model is nil for Empty and Any
+	// content.
+	Model *Particle
+}
+
+// A ParticleKind distinguishes the particles of a content model.
+type ParticleKind int
+
+const (
+	// An element name.
+	Name ParticleKind = iota
+	// A sequence of particles, separated by commas.
+	Seq
+	// A choice between particles, separated by bars.
+	Choice
+)
+
+// Occurs is the number of times a particle may occur.
+type Occurs int
+
+const (
+	// Exactly once.
+	Once Occurs = iota
+	// Zero or one times, written "?".
+	Optional
+	// Zero or more times, written "*".
+	ZeroOrMore
+	// One or more times, written "+".
+	OneOrMore
+)
+
+// A Particle is part of the content model of an element.
+type Particle struct {
+	Kind ParticleKind
+	// For Name particles, the element name.
+	Name string
+	// For Seq and Choice particles, their members.
+	Children []*Particle
+	Occurs   Occurs
+}
+
+// Plural returns true if the particle may occur more than once.
+func (p *Particle) Plural() bool {
+	return p.Occurs == ZeroOrMore || p.Occurs == OneOrMore
+}
+
+// Optional returns true if the particle may be absent.
+func (p *Particle) Optional() bool {
+	return p.Occurs == Optional || p.Occurs == ZeroOrMore
+}
+
+// AttrType is the declared type of an attribute.
+type AttrType int
+
+const (
+	CDATA AttrType = iota
+	ID
+	IDREF
+	IDREFS
+	ENTITY
+	ENTITIES
+	NMTOKEN
+	NMTOKENS
+	NOTATION
+	// The value must be one of the Enum of the Attribute.
+	Enumeration
+)
+
+var attrTypes = [...]string{
+	CDATA:       "CDATA",
+	ID:          "ID",
+	IDREF:       "IDREF",
+	IDREFS:      "IDREFS",
+	ENTITY:      "ENTITY",
+	ENTITIES:    "ENTITIES",
+	NMTOKEN:     "NMTOKEN",
+	NMTOKENS:    "NMTOKENS",
+	NOTATION:    "NOTATION",
+	Enumeration: "Enumeration",
+}
+
+func (t AttrType) String() string {
+	if t >= 0 && int(t) < len(attrTypes) {
+		return attrTypes[t]
+	}
+	return fmt.Sprintf("AttrType(%d)", int(t))
+}
+
+// DefaultKind describes the default declaration of an attribute.
+type DefaultKind int
+
+const (
+	// The attribute is optional, and has no default value.
+	Implied DefaultKind = iota
+	// The attribute must be present.
+	Required
+	// The attribute has a default value, used if it is absent.
+	Default
+	// The attribute always has its default value.
+	Fixed
+)
+
+// An Attribute is an attribute definition in an <!ATTLIST> declaration.
+type Attribute struct {
+	// The element the attribute is declared for.
+	Element string
+	Name    string
+	Type    AttrType
+	// For NOTATION and Enumeration attributes, the allowed values.
+	Enum        []string
+	DefaultKind DefaultKind
+	// For Default and Fixed attributes, the default value, with
+	// references expanded but not normalized.
+	Value string
+}
+
+// Normalize applies attribute value normalization to a value of the
+// attribute: for attributes of any type other than CDATA, leading and
+// trailing spaces are removed, and sequences of spaces are collapsed
+// to a single space.
+func (a *Attribute) Normalize(value string) string {
+	if a.Type == CDATA {
+		return value
+	}
+	buf := make([]byte, 0, len(value))
+	space := false
+	for i := 0; i < len(value); i++ {
+		if value[i] == ' ' {
+			space = true
+			continue
+		}
+		if space && len(buf) > 0 {
+			buf = append(buf, ' ')
+		}
+		space = false
+		buf = append(buf, value[i])
+	}
+	return string(buf)
+}
+
+// An Entity is an <!ENTITY> declaration.
+type Entity struct {
+	Name string
+	// True for parameter entities, which are referenced within
+	// the DTD itself.
+	Parameter bool
+	// For internal entities, the replacement text, with character
+	// references and parameter entity references expanded.
+	// General entity references are not expanded.
+	Value string
+	// For external entities, the public and system identifiers.
+	PublicID, SystemID string
+	// For unparsed entities, the name of their notation.
+	Notation string
+}
+
+// External returns true if the entity is an external entity, whose
+// replacement text must be retrieved using its system identifier.
+func (e *Entity) External() bool {
+	return e.SystemID != "" || e.PublicID != ""
+}
+
+// A Notation is a <!NOTATION> declaration.
+type Notation struct {
+	Name               string
+	PublicID, SystemID string
+}
+
+// ErrExpansionLimit is returned, possibly wrapped, when expanding
+// entities would exceed the limits of Options.
+var ErrExpansionLimit = errors.New("dtd: entity expansion limit exceeded")
+
+// A Resolver retrieves the content of an external subset or external
+// entity, given its public and system identifiers.
+type Resolver func(publicID, systemID string) ([]byte, error)
+
+// DefaultMaxExpansion is the default limit on the number of bytes
+// produced by expanding parameter entities.
+const DefaultMaxExpansion = 1 << 20
+
+// maxEntityDepth is the maximum nesting depth of entity references.
+const maxEntityDepth = 64
+
+// Options control the parsing of a DTD. The zero value does not load
+// external subsets or external parameter entities, and limits entity
+// expansion to DefaultMaxExpansion bytes.
+type Options struct {
+	// If not nil, Resolver is used to load the external subset
+	// and external parameter entities. Otherwise, they are
+	// ignored.
+	Resolver Resolver
+	// Maximum number of bytes of parameter entity replacement
+	// text that may be included in the DTD. If zero,
+	// DefaultMaxExpansion is used.
+	MaxExpansion int64
+}
+
+func (opts *Options) maxExpansion() int64 {
+	if opts == nil || opts.MaxExpansion <= 0 {
+		return DefaultMaxExpansion
+	}
+	return opts.MaxExpansion
+}
+
+func (opts *Options) resolver() Resolver {
+	if opts == nil {
+		return nil
+	}
+	return opts.Resolver
+}
+
+func newDTD() *DTD {
+	return &DTD{
+		elements:   make(map[string]*Element),
+		attributes: make(map[string][]*Attribute),
+		entities:   make(map[string]*Entity),
+		params:     make(map[string]*Entity),
+	}
+}
+
+// Parse parses an external subset: a DTD stored in its own file.
+// The opts argument may be nil.
+func Parse(data []byte, opts *Options) (*DTD, error) {
+	d := newDTD()
+	p := newParser(d, opts)
+	if err := p.subset(data, "", false); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// ParseDoctype parses a document type declaration, as returned in an
+// xml.Directive by the encoding/xml package: the text between "<!" and
+// ">", beginning with "DOCTYPE". The declarations in the internal
+// subset are parsed first, followed by the external subset, if
+// opts.Resolver is not nil. The opts argument may be nil.
+func ParseDoctype(decl []byte, opts *Options) (*DTD, error) {
+	d := newDTD()
+	p := newParser(d, opts)
+	if err := p.doctype(decl); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func (d *DTD) addElement(el *Element) {
+	if _, ok := d.elements[el.Name]; ok {
+		return
+	}
+	d.elements[el.Name] = el
+	d.Elements = append(d.Elements, el)
+}
+
+func (d *DTD) addAttribute(a *Attribute) {
+	for _, prev := range d.attributes[a.Element] {
+		if prev.Name == a.Name {
+			return
+		}
+	}
+	d.attributes[a.Element] = append(d.attributes[a.Element], a)
+	d.Attributes = append(d.Attributes, a)
+}
+
+func (d *DTD) addEntity(e *Entity) {
+	m := d.entities
+	if e.Parameter {
+		m = d.params
+	}
+	if _, ok := m[e.Name]; ok {
+		return
+	}
+	m[e.Name] = e
+	d.Entities = append(d.Entities, e)
+}
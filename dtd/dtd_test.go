@@ -0,0 +1,160 @@
+package dtd
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+const book = `<?xml version="1.0" encoding="UTF-8"?>
+<!-- a book -->
+<!ENTITY % inline "em | code">
+<!ENTITY % yes "INCLUDE">
+<!ENTITY publisher "ACME &amp; Sons">
+<!ENTITY logo SYSTEM "logo.png" NDATA png>
+<!NOTATION png PUBLIC "image/png">
+<!ELEMENT book (title, author+, (chapter | appendix)*, note?)>
+<!ELEMENT title (#PCDATA)>
+<!ELEMENT author (#PCDATA)>
+<!ELEMENT chapter (#PCDATA | %inline;)*>
+<!ELEMENT appendix ANY>
+<!ELEMENT note EMPTY>
+<!ELEMENT em (#PCDATA)>
+<!ELEMENT code (#PCDATA)>
+<![%yes;[
+<!ATTLIST book
+	id ID #REQUIRED
+	lang NMTOKEN "en"
+	kind (novel|manual) #IMPLIED
+	by CDATA #FIXED "&publisher;">
+]]>
+<![IGNORE[ <!ELEMENT ignored EMPTY> <![INCLUDE[ ]]> ]]>
+<!ATTLIST book lang CDATA "de">
+`
+
+func TestParse(t *testing.T) {
+	d, err := Parse([]byte(book), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(d.Elements) != 8 || d.Element("ignored") != nil {
+		t.Errorf("got %d elements, want 8", len(d.Elements))
+	}
+	model := d.Element("book").Model
+	if model.Kind != Seq || len(model.Children) != 4 {
+		t.Fatalf("unexpected model for book: %+v", model)
+	}
+	if c := model.Children[1]; c.Name != "author" || c.Occurs != OneOrMore {
+		t.Errorf("got %+v, want author+", c)
+	}
+	if c := model.Children[2]; c.Kind != Choice || c.Occurs != ZeroOrMore || c.Children[1].Name != "appendix" {
+		t.Errorf("got %+v, want (chapter | appendix)*", c)
+	}
+	if c := model.Children[3]; !c.Optional() || c.Plural() {
+		t.Errorf("got %+v, want note?", c)
+	}
+	chapter := d.Element("chapter")
+	if chapter.Content != Mixed || len(chapter.Model.Children) != 2 || chapter.Model.Children[1].Name != "code" {
+		t.Errorf("unexpected model for chapter: %+v", chapter.Model)
+	}
+	if d.Element("note").Content != Empty || d.Element("appendix").Content != Any {
+		t.Error("wrong content types for note and appendix")
+	}
+	attrs := d.AttributesOf("book")
+	if len(attrs) != 4 {
+		t.Fatalf("got %d attributes for book, want 4", len(attrs))
+	}
+	if attrs[0].Type != ID || attrs[0].DefaultKind != Required {
+		t.Errorf("unexpected attribute %+v", attrs[0])
+	}
+	if attrs[1].Type != NMTOKEN || attrs[1].Value != "en" {
+		t.Errorf("first declaration of lang should be binding, got %+v", attrs[1])
+	}
+	if attrs[2].Type != Enumeration || strings.Join(attrs[2].Enum, ",") != "novel,manual" {
+		t.Errorf("unexpected attribute %+v", attrs[2])
+	}
+	if attrs[3].DefaultKind != Fixed || attrs[3].Value != "ACME & Sons" {
+		t.Errorf("unexpected attribute %+v", attrs[3])
+	}
+	if e := d.Entity("publisher"); e == nil || e.Value != "ACME &amp; Sons" {
+		t.Errorf("unexpected entity %+v", e)
+	}
+	if e := d.Entity("logo"); e == nil || !e.External() || e.Notation != "png" {
+		t.Errorf("unexpected entity %+v", e)
+	}
+	if e := d.ParamEntity("inline"); e == nil || e.Value != "em | code" {
+		t.Errorf("unexpected parameter entity %+v", e)
+	}
+	if len(d.Notations) != 1 || d.Notations[0].PublicID != "image/png" {
+		t.Errorf("unexpected notations %+v", d.Notations)
+	}
+}
+
+func TestParseDoctype(t *testing.T) {
+	resolver := func(publicID, systemID string) ([]byte, error) {
+		switch systemID {
+		case "book.dtd":
+			return []byte(book), nil
+		case "extra.ent":
+			return []byte(`<?xml encoding="UTF-8"?><!ELEMENT extra EMPTY>`), nil
+		}
+		return nil, errors.New("not found")
+	}
+	decl := `DOCTYPE book SYSTEM "book.dtd" [
+  <!ENTITY publisher "Internal">
+  <!ENTITY % extra SYSTEM "extra.ent">
+  %extra;
+]`
+	d, err := ParseDoctype([]byte(decl), &Options{Resolver: resolver})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Name != "book" || d.SystemID != "book.dtd" {
+		t.Errorf("got name %q system ID %q", d.Name, d.SystemID)
+	}
+	if d.Element("extra") == nil || d.Element("title") == nil {
+		t.Error("external subset or entity not loaded")
+	}
+	// The internal subset takes precedence
+	if e := d.Entity("publisher"); e.Value != "Internal" {
+		t.Errorf("got publisher %q, want Internal", e.Value)
+	}
+	d, err = ParseDoctype([]byte(decl), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Element("extra") != nil || d.Element("title") != nil {
+		t.Error("external declarations loaded without a Resolver")
+	}
+}
+
+func TestErrors(t *testing.T) {
+	laughs := `<!ENTITY % l0 "lollollollollollollollollollol">`
+	for i := 1; i < 10; i++ {
+		laughs += "<!ENTITY % l" + string(rune('0'+i)) + ` "` +
+			strings.Repeat("%l"+string(rune('0'+i-1))+";", 10) + `">`
+	}
+	tests := []struct {
+		name, dtd string
+		limit     bool
+	}{
+		{"billion laughs", laughs, true},
+		{"recursion", `<!ENTITY % a "&#37;b;"><!ENTITY % b "&#37;a;"> %a;`, false},
+		{"bad model", `<!ELEMENT a (b, c | d)>`, false},
+		{"unterminated", `<!ELEMENT a (b)`, false},
+		{"bad default", `<!ATTLIST a b CDATA "<">`, false},
+		{"undeclared entity", `<!ATTLIST a b CDATA "&nope;">`, false},
+		{"unknown declaration", `<!FOO>`, false},
+	}
+	for _, tt := range tests {
+		_, err := Parse([]byte(tt.dtd), &Options{MaxExpansion: 1 << 16})
+		if err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+			continue
+		}
+		t.Logf("%s: %v", tt.name, err)
+		if limit := errors.Is(err, ErrExpansionLimit); limit != tt.limit {
+			t.Errorf("%s: got error %v", tt.name, err)
+		}
+	}
+}
@@ -0,0 +1,890 @@
+package dtd
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// The parser reads declarations from a stack of inputs. The bottom of
+// the stack is the subset being parsed; a parameter entity reference
+// pushes the entity's replacement text on to the stack, and it is
+// popped once it has been consumed.
+type parser struct {
+	dtd      *DTD
+	opts     *Options
+	in       []*input
+	expanded int64
+	// The first error from expanding a parameter entity
+	// reference while skipping white space.
+	err error
+}
+
+type input struct {
+	data string
+	pos  int
+	// The name of the parameter entity this input is the
+	// replacement text of, or "" for a subset.
+	entity string
+}
+
+func newParser(d *DTD, opts *Options) *parser {
+	return &parser{dtd: d, opts: opts}
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	in := p.in[len(p.in)-1]
+	where := fmt.Sprintf("line %d", 1+strings.Count(in.data[:in.pos], "\n"))
+	if in.entity != "" {
+		where += " of entity %" + in.entity + ";"
+	}
+	return fmt.Errorf("dtd: %s: "+format, append([]interface{}{where}, args...)...)
+}
+
+// subset parses the declarations of an internal or external subset.
+func (p *parser) subset(data []byte, entity string, external bool) error {
+	if external {
+		data = stripTextDecl(data)
+	}
+	p.in = []*input{{data: string(data), entity: entity}}
+	return p.decls("")
+}
+
+// doctype parses a document type declaration.
+func (p *parser) doctype(decl []byte) error {
+	p.in = []*input{{data: string(decl)}}
+	if !p.hasPrefix("DOCTYPE") {
+		return p.errorf("not a document type declaration")
+	}
+	p.advance(len("DOCTYPE"))
+	if err := p.requireSpace(); err != nil {
+		return err
+	}
+	name, err := p.name()
+	if err != nil {
+		return err
+	}
+	p.dtd.Name = name
+	p.skipSpace()
+	if p.hasPrefix("SYSTEM") || p.hasPrefix("PUBLIC") {
+		if p.dtd.PublicID, p.dtd.SystemID, err = p.externalID(false); err != nil {
+			return err
+		}
+		p.skipSpace()
+	}
+	if p.peek() == '[' {
+		in := p.in[0]
+		end := strings.LastIndexByte(in.data, ']')
+		if end < in.pos {
+			return p.errorf("unterminated internal subset")
+		}
+		internal := in.data[in.pos+1 : end]
+		if err := p.subset([]byte(internal), "", false); err != nil {
+			return err
+		}
+	} else if !p.eof() {
+		return p.errorf("unexpected %s in document type declaration", p.found())
+	}
+	if p.dtd.SystemID == "" {
+		return nil
+	}
+	if resolve := p.opts.resolver(); resolve != nil {
+		data, err := resolve(p.dtd.PublicID, p.dtd.SystemID)
+		if err != nil {
+			return fmt.Errorf("dtd: loading external subset %s: %w", p.dtd.SystemID, err)
+		}
+		return p.subset(data, "", true)
+	}
+	return nil
+}
+
+// stripTextDecl removes the byte order mark and text declaration
+// that may begin an external subset or entity.
+func stripTextDecl(data []byte) []byte {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	if bytes.HasPrefix(data, []byte("<?xml")) && len(data) > 5 && isSpace(data[5]) {
+		if i := bytes.Index(data, []byte("?>")); i >= 0 {
+			data = data[i+2:]
+		}
+	}
+	return data
+}
+
+// decls parses declarations until the end of the subset, or until
+// term, if it is not empty.
+func (p *parser) decls(term string) error {
+	for {
+		p.skipSpace()
+		if p.err != nil {
+			return p.err
+		}
+		if term != "" && p.hasPrefix(term) {
+			p.advance(len(term))
+			return nil
+		}
+		if p.eof() {
+			if term != "" {
+				return p.errorf("unterminated conditional section")
+			}
+			return nil
+		}
+		var err error
+		switch {
+		case p.hasPrefix("<!--"):
+			err = p.skipPast("-->")
+		case p.hasPrefix("<?"):
+			err = p.skipPast("?>")
+		case p.hasPrefix("<!["):
+			err = p.conditional()
+		case p.hasPrefix("<!ELEMENT"):
+			p.advance(len("<!ELEMENT"))
+			err = p.elementDecl()
+		case p.hasPrefix("<!ATTLIST"):
+			p.advance(len("<!ATTLIST"))
+			err = p.attlistDecl()
+		case p.hasPrefix("<!ENTITY"):
+			p.advance(len("<!ENTITY"))
+			err = p.entityDecl()
+		case p.hasPrefix("<!NOTATION"):
+			p.advance(len("<!NOTATION"))
+			err = p.notationDecl()
+		default:
+			err = p.errorf("unexpected %s", p.found())
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (p *parser) top() *input {
+	return p.in[len(p.in)-1]
+}
+
+// eof pops any parameter entities that have been consumed, and
+// returns true if the subset has been consumed.
+func (p *parser) eof() bool {
+	for {
+		in := p.top()
+		if in.pos < len(in.data) {
+			return false
+		}
+		if len(p.in) == 1 {
+			return true
+		}
+		p.in = p.in[:len(p.in)-1]
+	}
+}
+
+func (p *parser) peek() byte {
+	if p.eof() {
+		return 0
+	}
+	in := p.top()
+	return in.data[in.pos]
+}
+
+// found describes the next character, for error messages.
+func (p *parser) found() string {
+	if p.eof() {
+		return "end of input"
+	}
+	return strconv.QuoteRune(rune(p.peek()))
+}
+
+func (p *parser) hasPrefix(s string) bool {
+	if p.eof() {
+		return false
+	}
+	in := p.top()
+	return strings.HasPrefix(in.data[in.pos:], s)
+}
+
+func (p *parser) advance(n int) {
+	p.top().pos += n
+}
+
+func (p *parser) skipPast(s string) error {
+	in := p.top()
+	i := strings.Index(in.data[in.pos:], s)
+	if i < 0 {
+		return p.errorf("missing %q", s)
+	}
+	in.pos += i + len(s)
+	return nil
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n'
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || c == ':' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || c >= 0x80
+}
+
+func isNameChar(c byte) bool {
+	return isNameStart(c) || c == '-' || c == '.' || '0' <= c && c <= '9'
+}
+
+// skipSpace skips white space and parameter entity references, which
+// are replaced by their replacement text. It returns true if anything
+// was skipped.
+func (p *parser) skipSpace() bool {
+	skipped := false
+	for !p.eof() {
+		in := p.top()
+		c := in.data[in.pos]
+		if isSpace(c) {
+			in.pos++
+			skipped = true
+			continue
+		}
+		if c == '%' && in.pos+1 < len(in.data) && isNameStart(in.data[in.pos+1]) {
+			if err := p.paramRef(); err != nil {
+				// Reported when the next token is read.
+				if p.err == nil {
+					p.err = err
+				}
+				return skipped
+			}
+			skipped = true
+			continue
+		}
+		return skipped
+	}
+	return skipped
+}
+
+func (p *parser) requireSpace() error {
+	if !p.skipSpace() && p.err == nil {
+		return p.errorf("expected white space, found %s", p.found())
+	}
+	return nil
+}
+
+// paramRef reads a parameter entity reference and pushes its
+// replacement text, surrounded by spaces, on to the input stack.
+func (p *parser) paramRef() error {
+	p.advance(1)
+	name, err := p.name()
+	if err != nil {
+		return err
+	}
+	if p.peek() != ';' {
+		return p.errorf("missing ';' after parameter entity reference %%%s", name)
+	}
+	p.advance(1)
+	text, ok, err := p.paramText(name)
+	if err != nil || !ok {
+		return err
+	}
+	p.in = append(p.in, &input{data: " " + text + " ", entity: name})
+	return nil
+}
+
+// paramText returns the replacement text of a parameter entity. It
+// returns false if the entity is not declared, or is external and
+// cannot be loaded. A non-validating parser is not required to read
+// such entities, so references to them are ignored.
+func (p *parser) paramText(name string) (string, bool, error) {
+	e := p.dtd.params[name]
+	if e == nil {
+		return "", false, nil
+	}
+	for _, in := range p.in {
+		if in.entity == name {
+			return "", false, p.errorf("recursive reference to parameter entity %%%s;", name)
+		}
+	}
+	if len(p.in) > maxEntityDepth {
+		return "", false, p.errorf("parameter entities nested too deeply: %w", ErrExpansionLimit)
+	}
+	text := e.Value
+	if e.External() {
+		resolve := p.opts.resolver()
+		if resolve == nil {
+			return "", false, nil
+		}
+		data, err := resolve(e.PublicID, e.SystemID)
+		if err != nil {
+			return "", false, fmt.Errorf("dtd: loading parameter entity %%%s;: %w", name, err)
+		}
+		text = string(stripTextDecl(data))
+	}
+	p.expanded += int64(len(text))
+	if max := p.opts.maxExpansion(); p.expanded > max {
+		return "", false, p.errorf("expanding %%%s;: %w", name, ErrExpansionLimit)
+	}
+	return text, true, nil
+}
+
+func (p *parser) name() (string, error) {
+	if p.err != nil {
+		return "", p.err
+	}
+	if p.eof() || !isNameStart(p.peek()) {
+		return "", p.errorf("expected a name, found %s", p.found())
+	}
+	in := p.top()
+	start := in.pos
+	for in.pos < len(in.data) && isNameChar(in.data[in.pos]) {
+		in.pos++
+	}
+	return in.data[start:in.pos], nil
+}
+
+func (p *parser) nmtoken() (string, error) {
+	if p.err != nil {
+		return "", p.err
+	}
+	in := p.top()
+	start := in.pos
+	for in.pos < len(in.data) && isNameChar(in.data[in.pos]) {
+		in.pos++
+	}
+	if start == in.pos {
+		return "", p.errorf("expected a name token, found %s", p.found())
+	}
+	return in.data[start:in.pos], nil
+}
+
+func (p *parser) expect(s string) error {
+	if p.err != nil {
+		return p.err
+	}
+	if !p.hasPrefix(s) {
+		return p.errorf("expected %q, found %s", s, p.found())
+	}
+	p.advance(len(s))
+	return nil
+}
+
+// literal reads a quoted string. Unlike other tokens, a literal
+// cannot span parameter entities.
+func (p *parser) literal() (string, error) {
+	if p.err != nil {
+		return "", p.err
+	}
+	q := p.peek()
+	if q != '"' && q != '\'' {
+		return "", p.errorf("expected a quoted string, found %s", p.found())
+	}
+	in := p.top()
+	end := strings.IndexByte(in.data[in.pos+1:], q)
+	if end < 0 {
+		return "", p.errorf("unterminated string")
+	}
+	s := in.data[in.pos+1 : in.pos+1+end]
+	in.pos += end + 2
+	return s, nil
+}
+
+// externalID reads a SYSTEM or PUBLIC identifier. If publicOnly is
+// true, as in notation declarations, the system literal may be
+// omitted after a public identifier.
+func (p *parser) externalID(publicOnly bool) (pub, sys string, err error) {
+	switch {
+	case p.hasPrefix("SYSTEM"):
+		p.advance(len("SYSTEM"))
+		if err := p.requireSpace(); err != nil {
+			return "", "", err
+		}
+		sys, err = p.literal()
+		return "", sys, err
+	case p.hasPrefix("PUBLIC"):
+		p.advance(len("PUBLIC"))
+		if err := p.requireSpace(); err != nil {
+			return "", "", err
+		}
+		if pub, err = p.literal(); err != nil {
+			return "", "", err
+		}
+		space := p.skipSpace()
+		if q := p.peek(); q != '"' && q != '\'' {
+			if publicOnly {
+				return pub, "", nil
+			}
+			return "", "", p.errorf("missing system identifier")
+		}
+		if !space {
+			return "", "", p.errorf("expected white space before system identifier")
+		}
+		sys, err = p.literal()
+		return pub, sys, err
+	}
+	return "", "", p.errorf("expected SYSTEM or PUBLIC, found %s", p.found())
+}
+
+func (p *parser) conditional() error {
+	p.advance(len("<!["))
+	p.skipSpace()
+	keyword, err := p.name()
+	if err != nil {
+		return err
+	}
+	p.skipSpace()
+	if err := p.expect("["); err != nil {
+		return err
+	}
+	switch keyword {
+	case "INCLUDE":
+		return p.decls("]]>")
+	case "IGNORE":
+		in := p.top()
+		for depth := 1; depth > 0; {
+			open := strings.Index(in.data[in.pos:], "<![")
+			end := strings.Index(in.data[in.pos:], "]]>")
+			switch {
+			case end < 0:
+				return p.errorf("unterminated conditional section")
+			case open >= 0 && open < end:
+				depth++
+				in.pos += open + 3
+			default:
+				depth--
+				in.pos += end + 3
+			}
+		}
+		return nil
+	}
+	return p.errorf("unknown conditional section keyword %q", keyword)
+}
+
+func (p *parser) end() error {
+	p.skipSpace()
+	return p.expect(">")
+}
+
+func (p *parser) elementDecl() error {
+	if err := p.requireSpace(); err != nil {
+		return err
+	}
+	name, err := p.name()
+	if err != nil {
+		return err
+	}
+	if err := p.requireSpace(); err != nil {
+		return err
+	}
+	el := &Element{Name: name}
+	switch {
+	case p.hasPrefix("EMPTY"):
+		p.advance(len("EMPTY"))
+		el.Content = Empty
+	case p.hasPrefix("ANY"):
+		p.advance(len("ANY"))
+		el.Content = Any
+	default:
+		if err := p.expect("("); err != nil {
+			return err
+		}
+		p.skipSpace()
+		if p.hasPrefix("#PCDATA") {
+			p.advance(len("#PCDATA"))
+			el.Content = Mixed
+			el.Model, err = p.mixed()
+		} else {
+			el.Content = Children
+			el.Model, err = p.group()
+		}
+		if err != nil {
+			return err
+		}
+	}
+	p.dtd.addElement(el)
+	return p.end()
+}
+
+// mixed reads the remainder of a mixed content declaration, following
+// "(#PCDATA".
+func (p *parser) mixed() (*Particle, error) {
+	model := &Particle{Kind: Choice, Occurs: ZeroOrMore}
+	for {
+		p.skipSpace()
+		if p.peek() == ')' {
+			p.advance(1)
+			break
+		}
+		if err := p.expect("|"); err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		model.Children = append(model.Children, &Particle{Kind: Name, Name: name})
+	}
+	if p.peek() == '*' {
+		p.advance(1)
+	} else if len(model.Children) > 0 {
+		return nil, p.errorf("mixed content with elements must end with \")*\"")
+	}
+	return model, nil
+}
+
+// group reads a choice or sequence, following its opening
+// parenthesis.
+func (p *parser) group() (*Particle, error) {
+	group := &Particle{Kind: Seq}
+	var sep byte
+	for {
+		cp, err := p.cp()
+		if err != nil {
+			return nil, err
+		}
+		group.Children = append(group.Children, cp)
+		p.skipSpace()
+		c := p.peek()
+		if c == ')' {
+			p.advance(1)
+			break
+		}
+		if c != ',' && c != '|' {
+			return nil, p.errorf("expected ',', '|' or ')' in content model, found %s", p.found())
+		}
+		if sep != 0 && c != sep {
+			return nil, p.errorf("cannot mix ',' and '|' in a content model group")
+		}
+		sep = c
+		p.advance(1)
+	}
+	if sep == '|' {
+		group.Kind = Choice
+	}
+	group.Occurs = p.occurs()
+	return group, nil
+}
+
+func (p *parser) cp() (*Particle, error) {
+	p.skipSpace()
+	if p.peek() == '(' {
+		p.advance(1)
+		return p.group()
+	}
+	name, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	return &Particle{Kind: Name, Name: name, Occurs: p.occurs()}, nil
+}
+
+func (p *parser) occurs() Occurs {
+	var o Occurs
+	switch p.peek() {
+	case '?':
+		o = Optional
+	case '*':
+		o = ZeroOrMore
+	case '+':
+		o = OneOrMore
+	default:
+		return Once
+	}
+	p.advance(1)
+	return o
+}
+
+var attrTypeNames = map[string]AttrType{
+	"CDATA":    CDATA,
+	"ID":       ID,
+	"IDREF":    IDREF,
+	"IDREFS":   IDREFS,
+	"ENTITY":   ENTITY,
+	"ENTITIES": ENTITIES,
+	"NMTOKEN":  NMTOKEN,
+	"NMTOKENS": NMTOKENS,
+	"NOTATION": NOTATION,
+}
+
+func (p *parser) attlistDecl() error {
+	if err := p.requireSpace(); err != nil {
+		return err
+	}
+	element, err := p.name()
+	if err != nil {
+		return err
+	}
+	for {
+		p.skipSpace()
+		if p.peek() == '>' {
+			p.advance(1)
+			return nil
+		}
+		name, err := p.name()
+		if err != nil {
+			return err
+		}
+		if err := p.requireSpace(); err != nil {
+			return err
+		}
+		a := &Attribute{Element: element, Name: name}
+		if p.peek() == '(' {
+			a.Type = Enumeration
+		} else {
+			typ, err := p.name()
+			if err != nil {
+				return err
+			}
+			var ok bool
+			if a.Type, ok = attrTypeNames[typ]; !ok {
+				return p.errorf("unknown attribute type %q", typ)
+			}
+			if a.Type == NOTATION {
+				if err := p.requireSpace(); err != nil {
+					return err
+				}
+			}
+		}
+		if a.Type == Enumeration || a.Type == NOTATION {
+			if a.Enum, err = p.enumeration(); err != nil {
+				return err
+			}
+		}
+		if err := p.requireSpace(); err != nil {
+			return err
+		}
+		switch {
+		case p.hasPrefix("#REQUIRED"):
+			p.advance(len("#REQUIRED"))
+			a.DefaultKind = Required
+		case p.hasPrefix("#IMPLIED"):
+			p.advance(len("#IMPLIED"))
+			a.DefaultKind = Implied
+		default:
+			a.DefaultKind = Default
+			if p.hasPrefix("#FIXED") {
+				p.advance(len("#FIXED"))
+				a.DefaultKind = Fixed
+				if err := p.requireSpace(); err != nil {
+					return err
+				}
+			}
+			lit, err := p.literal()
+			if err != nil {
+				return err
+			}
+			if a.Value, err = p.attrValue(lit, 0); err != nil {
+				return err
+			}
+		}
+		p.dtd.addAttribute(a)
+	}
+}
+
+func (p *parser) enumeration() ([]string, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	var values []string
+	for {
+		p.skipSpace()
+		v, err := p.nmtoken()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+		p.skipSpace()
+		if p.peek() == ')' {
+			p.advance(1)
+			return values, nil
+		}
+		if err := p.expect("|"); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// attrValue expands the references in the literal value of a default
+// attribute value, and replaces white space with spaces.
+func (p *parser) attrValue(lit string, depth int) (string, error) {
+	if depth > maxEntityDepth {
+		return "", p.errorf("entities nested too deeply: %w", ErrExpansionLimit)
+	}
+	var buf strings.Builder
+	for i := 0; i < len(lit); i++ {
+		c := lit[i]
+		switch {
+		case isSpace(c):
+			buf.WriteByte(' ')
+		case c == '<':
+			return "", p.errorf("'<' in attribute value")
+		case c == '&':
+			end := strings.IndexByte(lit[i:], ';')
+			if end < 0 {
+				return "", p.errorf("unterminated reference in attribute value")
+			}
+			ref := lit[i+1 : i+end]
+			i += end
+			if strings.HasPrefix(ref, "#") {
+				r, err := p.charRef(ref)
+				if err != nil {
+					return "", err
+				}
+				buf.WriteRune(r)
+				continue
+			}
+			if s, ok := predefined[ref]; ok {
+				buf.WriteString(s)
+				continue
+			}
+			e := p.dtd.entities[ref]
+			if e == nil {
+				return "", p.errorf("undeclared entity &%s; in attribute value", ref)
+			}
+			if e.External() {
+				return "", p.errorf("reference to external entity &%s; in attribute value", ref)
+			}
+			p.expanded += int64(len(e.Value))
+			if p.expanded > p.opts.maxExpansion() {
+				return "", p.errorf("expanding &%s;: %w", ref, ErrExpansionLimit)
+			}
+			s, err := p.attrValue(e.Value, depth+1)
+			if err != nil {
+				return "", err
+			}
+			buf.WriteString(s)
+		default:
+			buf.WriteByte(c)
+		}
+	}
+	return buf.String(), nil
+}
+
+var predefined = map[string]string{
+	"lt":   "<",
+	"gt":   ">",
+	"amp":  "&",
+	"apos": "'",
+	"quot": `"`,
+}
+
+// charRef decodes the body of a character reference, such as "#x20".
+func (p *parser) charRef(ref string) (rune, error) {
+	var n uint64
+	var err error
+	if strings.HasPrefix(ref, "#x") {
+		n, err = strconv.ParseUint(ref[2:], 16, 32)
+	} else {
+		n, err = strconv.ParseUint(ref[1:], 10, 32)
+	}
+	if err != nil || !utf8.ValidRune(rune(n)) || n == 0 {
+		return 0, p.errorf("invalid character reference &%s;", ref)
+	}
+	return rune(n), nil
+}
+
+func (p *parser) entityDecl() error {
+	if err := p.requireSpace(); err != nil {
+		return err
+	}
+	e := new(Entity)
+	if p.peek() == '%' {
+		e.Parameter = true
+		p.advance(1)
+		if err := p.requireSpace(); err != nil {
+			return err
+		}
+	}
+	name, err := p.name()
+	if err != nil {
+		return err
+	}
+	e.Name = name
+	if err := p.requireSpace(); err != nil {
+		return err
+	}
+	if q := p.peek(); q == '"' || q == '\'' {
+		lit, err := p.literal()
+		if err != nil {
+			return err
+		}
+		if e.Value, err = p.entityValue(lit, 0); err != nil {
+			return err
+		}
+	} else {
+		if e.PublicID, e.SystemID, err = p.externalID(false); err != nil {
+			return err
+		}
+		if !e.Parameter && p.skipSpace() && p.hasPrefix("NDATA") {
+			p.advance(len("NDATA"))
+			if err := p.requireSpace(); err != nil {
+				return err
+			}
+			if e.Notation, err = p.name(); err != nil {
+				return err
+			}
+		}
+	}
+	p.dtd.addEntity(e)
+	return p.end()
+}
+
+// entityValue expands the parameter entity references and character
+// references in the literal value of an entity. General entity
+// references are left as they are.
+func (p *parser) entityValue(lit string, depth int) (string, error) {
+	if depth > maxEntityDepth {
+		return "", p.errorf("parameter entities nested too deeply: %w", ErrExpansionLimit)
+	}
+	var buf strings.Builder
+	for i := 0; i < len(lit); i++ {
+		c := lit[i]
+		if c != '%' && !(c == '&' && strings.HasPrefix(lit[i:], "&#")) {
+			buf.WriteByte(c)
+			continue
+		}
+		end := strings.IndexByte(lit[i:], ';')
+		if end < 0 {
+			return "", p.errorf("unterminated reference in entity value")
+		}
+		ref := lit[i+1 : i+end]
+		i += end
+		if c == '&' {
+			r, err := p.charRef(ref)
+			if err != nil {
+				return "", err
+			}
+			buf.WriteRune(r)
+			continue
+		}
+		text, ok, err := p.paramText(ref)
+		if err != nil {
+			return "", err
+		}
+		if !ok {
+			continue
+		}
+		// Mark the entity as being expanded, to detect
+		// recursion.
+		p.in = append(p.in, &input{data: text, pos: len(text), entity: ref})
+		s, err := p.entityValue(text, depth+1)
+		p.in = p.in[:len(p.in)-1]
+		if err != nil {
+			return "", err
+		}
+		buf.WriteString(s)
+	}
+	return buf.String(), nil
+}
+
+func (p *parser) notationDecl() error {
+	if err := p.requireSpace(); err != nil {
+		return err
+	}
+	name, err := p.name()
+	if err != nil {
+		return err
+	}
+	if err := p.requireSpace(); err != nil {
+		return err
+	}
+	n := &Notation{Name: name}
+	if n.PublicID, n.SystemID, err = p.externalID(true); err != nil {
+		return err
+	}
+	p.dtd.Notations = append(p.dtd.Notations, n)
+	return p.end()
+}
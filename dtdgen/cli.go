@@ -0,0 +1,155 @@
+package dtdgen
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"go/ast"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/m29h/go-xml/dtd"
+	"github.com/m29h/go-xml/internal/commandline"
+	"github.com/m29h/go-xml/internal/gen"
+	"github.com/m29h/go-xml/xsdgen"
+)
+
+// GenCode translates the DTDs to a single XML Schema, and generates
+// type declarations for it using the xsdgen package.
+func (cfg *Config) GenCode(dtds ...*dtd.DTD) (*xsdgen.Code, error) {
+	docs := make([][]byte, 0, len(dtds))
+	for _, d := range dtds {
+		docs = append(docs, XSD(d, cfg.namespace))
+	}
+	cfg.xsdgen.Option(xsdgen.Namespaces(cfg.namespace))
+	return cfg.xsdgen.GenCode(docs...)
+}
+
+// GenAST creates an *ast.File containing type declarations and
+// associated methods based on a set of DTD files.
+func (cfg *Config) GenAST(files ...string) (*ast.File, error) {
+	if len(files) == 0 {
+		return nil, errors.New("must provide at least one file name")
+	}
+	dtds := make([]*dtd.DTD, 0, len(files))
+	for _, filename := range files {
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		cfg.debugf("read %s", filename)
+		opts := &dtd.Options{Resolver: cfg.resolver}
+		if opts.Resolver == nil {
+			opts.Resolver = fileResolver(filepath.Dir(filename))
+		}
+		d, err := dtd.Parse(data, opts)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", filename, err)
+		}
+		dtds = append(dtds, d)
+	}
+	code, err := cfg.GenCode(dtds...)
+	if err != nil {
+		return nil, err
+	}
+	return code.GenAST()
+}
+
+// fileResolver returns a dtd.Resolver that reads external entities
+// from the local file system, relative to dir.
+func fileResolver(dir string) dtd.Resolver {
+	return func(publicID, systemID string) ([]byte, error) {
+		if strings.Contains(systemID, "://") {
+			return nil, fmt.Errorf("cannot retrieve %s", systemID)
+		}
+		path := strings.TrimPrefix(systemID, "file:")
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		return os.ReadFile(path)
+	}
+}
+
+// The GenSource method converts the AST returned by GenAST to formatted
+// Go source code.
+func (cfg *Config) GenSource(files ...string) ([]byte, error) {
+	file, err := cfg.GenAST(files...)
+	if err != nil {
+		return nil, err
+	}
+	return gen.FormattedSource(file, "fixme.go")
+}
+
+// GenCLI creates a file containing Go source generated from one or
+// more DTDs. It is intended to be called from the main function of any
+// command-line interfaces to the dtdgen package.
+func (cfg *Config) GenCLI(arguments ...string) error {
+	var (
+		err          error
+		replaceRules commandline.ReplaceRuleList
+		fs           = flag.NewFlagSet("dtdgen", flag.ExitOnError)
+		packageName  = fs.String("pkg", "", "name of the generated package")
+		output       = fs.String("o", "dtdgen_output.go", "name of the output file")
+		namespace    = fs.String("ns", "", "namespace of the declared elements")
+		addJSONTags  = fs.Bool("json", false, "add json tags to struct tag so that the json name equals the xml name")
+		xmlpkg       = fs.String("xmlpkg", "encoding/xml", "name of the go xml package to use")
+		verbose      = fs.Bool("v", false, "print verbose output")
+		debug        = fs.Bool("vv", false, "print debug output")
+	)
+	fs.Var(&replaceRules, "r", "replacement rule 'regex -> repl' (can be used multiple times)")
+
+	// Usage is a replacement usage function for the flags package.
+	fs.Usage = func() {
+		prog := os.Args[0]
+		fmt.Fprintf(fs.Output(), "Usage of %s:\n", prog)
+		fmt.Fprintf(fs.Output(), "\t%s [flags] file(s)... # files must contain DTD declarations\n", prog)
+		fmt.Fprintf(fs.Output(), "Flags:\n")
+		fs.PrintDefaults()
+	}
+	if err = fs.Parse(arguments); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return nil
+	}
+
+	if *debug {
+		cfg.Option(LogLevel(5))
+	} else if *verbose {
+		cfg.Option(LogLevel(1))
+	}
+	if *packageName != "" {
+		cfg.XSDOption(xsdgen.PackageName(*packageName))
+	}
+	if *xmlpkg != "encoding/xml" {
+		cfg.XSDOption(xsdgen.XMLPackage(*xmlpkg))
+	}
+	cfg.XSDOption(xsdgen.AddJSONTags(*addJSONTags))
+	cfg.Option(Namespace(*namespace))
+	for _, r := range replaceRules {
+		cfg.XSDOption(xsdgen.Replace(r.From.String(), r.To))
+	}
+	file, err := cfg.GenAST(fs.Args()...)
+	if err != nil {
+		return err
+	}
+
+	data, err := gen.FormattedSource(file, *output)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(*output, data, 0666)
+}
+
+// The GenCLI function generates Go source code using the default
+// options chosen by the dtdgen package. It is meant to be used from
+// the main package of a command-line program.
+func GenCLI(args ...string) error {
+	var cfg Config
+	cfg.XSDOption(DefaultXSDOptions...)
+	cfg.Option(LogOutput(log.New(os.Stderr, "", 0)))
+	return cfg.GenCLI(args...)
+}
@@ -0,0 +1,109 @@
+package dtdgen
+
+import (
+	"github.com/m29h/go-xml/dtd"
+	"github.com/m29h/go-xml/xsdgen"
+)
+
+// Types conforming to the Logger interface can receive information about
+// the code generation process.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// A Config contains parameters for the various code generation processes.
+// Users may modify the output of the dtdgen package's code generation
+// by using a Config's Option method to change these parameters.
+type Config struct {
+	logger    Logger
+	loglevel  int
+	namespace string
+	resolver  dtd.Resolver
+	xsdgen    xsdgen.Config
+}
+
+func (cfg *Config) logf(format string, args ...interface{}) {
+	if cfg.logger != nil {
+		cfg.logger.Printf(format, args...)
+	}
+}
+
+func (cfg *Config) debugf(format string, args ...interface{}) {
+	if cfg.loglevel > 2 {
+		cfg.logf(format, args...)
+	}
+}
+
+// Option applies the provides Options to a Config, modifying the
+// code generation process. The return value of Option can be
+// used to revert the effects of the final parameter.
+func (cfg *Config) Option(opts ...Option) (previous Option) {
+	for _, opt := range opts {
+		previous = opt(cfg)
+	}
+	return previous
+}
+
+// XSDOption controls the generation of type declarations according
+// to the xsdgen package.
+func (cfg *Config) XSDOption(opts ...xsdgen.Option) (previous xsdgen.Option) {
+	return cfg.xsdgen.Option(opts...)
+}
+
+// An Option modifies code generation parameters. The return value of an
+// Option can be used to undo its effect.
+type Option func(*Config) Option
+
+// DefaultXSDOptions are the default options passed to the xsdgen
+// package. They differ from xsdgen.DefaultOptions in keeping id and
+// other attributes that are common in DTDs, and in leaving out the
+// options that only apply to SOAP.
+var DefaultXSDOptions = []xsdgen.Option{
+	xsdgen.ApplyXMLNameToTopLevelElementTypes(true),
+	xsdgen.Replace(`[._ \s-]`, ""),
+	xsdgen.PackageName("ws"),
+}
+
+// Namespace sets the target namespace of the elements declared in
+// a DTD. The default is the empty namespace.
+func Namespace(tns string) Option {
+	return func(cfg *Config) Option {
+		prev := cfg.namespace
+		cfg.namespace = tns
+		return Namespace(prev)
+	}
+}
+
+// Resolver sets the function used to load the external parameter
+// entities referenced by a DTD. If no Resolver is set, GenAST reads
+// them from the files named by their system identifiers, relative to
+// the directory of the DTD.
+func Resolver(r dtd.Resolver) Option {
+	return func(cfg *Config) Option {
+		prev := cfg.resolver
+		cfg.resolver = r
+		return Resolver(prev)
+	}
+}
+
+// LogLevel sets the level of verbosity for log messages generated during
+// the code generation process.
+func LogLevel(level int) Option {
+	return func(cfg *Config) Option {
+		prev := cfg.loglevel
+		cfg.loglevel = level
+		cfg.xsdgen.Option(xsdgen.LogLevel(level))
+		return LogLevel(prev)
+	}
+}
+
+// LogOutput sets the destination for log messages generated during
+// code generation.
+func LogOutput(dest Logger) Option {
+	return func(cfg *Config) Option {
+		prev := cfg.logger
+		cfg.logger = dest
+		cfg.xsdgen.Option(xsdgen.LogOutput(dest))
+		return LogOutput(prev)
+	}
+}
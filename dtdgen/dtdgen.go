@@ -0,0 +1,279 @@
+// Package dtdgen generates Go type declarations from XML Document Type
+// Definitions.
+//
+// The element and attribute list declarations of a DTD are translated
+// to an equivalent XML Schema, which is passed to the xsdgen package to
+// generate Go source code. Each element type declared in the DTD becomes
+// a complex type with the same name, and a top-level element of that
+// type. Content models are flattened: the elements of a content model
+// become the fields of a struct, which are repeated if they may appear
+// more than once, in any group, and optional if they may be absent.
+// The text of mixed content, such as (#PCDATA|em)*, is collected in a
+// string field named Value; its position among the child elements is
+// not kept, so it is marshalled before them.
+//
+// DTDs are not aware of XML namespaces. Any prefix in the name of an
+// element or attribute is removed, and all elements are placed in a
+// single target namespace, which is empty by default. Attributes that
+// declare namespaces are ignored.
+package dtdgen
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"strings"
+
+	"github.com/m29h/go-xml/dtd"
+	"github.com/m29h/go-xml/xsd"
+)
+
+const schemaNS = "http://www.w3.org/2001/XMLSchema"
+
+// XSD translates the element and attribute list declarations of d to
+// an XML Schema document with the target namespace tns.
+func XSD(d *dtd.DTD, tns string) []byte {
+	var buf bytes.Buffer
+	w := &schemaWriter{w: &buf, d: d}
+	buf.WriteString(`<xs:schema xmlns:xs="` + schemaNS + `"`)
+	if tns != "" {
+		w.attr("xmlns", tns)
+		w.attr("targetNamespace", tns)
+		w.attr("elementFormDefault", "qualified")
+	}
+	buf.WriteString(">\n")
+	seen := make(map[string]bool)
+	for _, el := range d.Elements {
+		name := localName(el.Name)
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		w.element(el)
+	}
+	buf.WriteString("</xs:schema>\n")
+	return buf.Bytes()
+}
+
+// Schema translates d to an XML Schema with the target namespace tns,
+// as with the XSD function, and parses it.
+func Schema(d *dtd.DTD, tns string) (xsd.Schema, error) {
+	schemas, err := xsd.Parse(XSD(d, tns))
+	if err != nil {
+		return xsd.Schema{}, err
+	}
+	for _, s := range schemas {
+		if s.TargetNS == tns {
+			return s, nil
+		}
+	}
+	return xsd.Schema{}, fmt.Errorf("dtdgen: no schema for namespace %q", tns)
+}
+
+// localName removes any prefix from a name in a DTD.
+func localName(name string) string {
+	if i := strings.IndexByte(name, ':'); i >= 0 {
+		return name[i+1:]
+	}
+	return name
+}
+
+type schemaWriter struct {
+	w *bytes.Buffer
+	d *dtd.DTD
+}
+
+func (w *schemaWriter) attr(name, value string) {
+	w.w.WriteString(" " + name + `="`)
+	xml.EscapeText(w.w, []byte(value))
+	w.w.WriteString(`"`)
+}
+
+// A field is an element that may appear in the content of another.
+type field struct {
+	name             string
+	optional, plural bool
+}
+
+// fields flattens the content model of el.
+func (w *schemaWriter) fields(el *dtd.Element) []field {
+	var result []field
+	add := func(name string, optional, plural bool) {
+		name = localName(name)
+		for i := range result {
+			if result[i].name == name {
+				result[i].plural = true
+				result[i].optional = result[i].optional && optional
+				return
+			}
+		}
+		result = append(result, field{name, optional, plural})
+	}
+	var walk func(p *dtd.Particle, optional, plural bool)
+	walk = func(p *dtd.Particle, optional, plural bool) {
+		optional = optional || p.Optional()
+		plural = plural || p.Plural()
+		switch p.Kind {
+		case dtd.Name:
+			add(p.Name, optional, plural)
+		case dtd.Seq:
+			for _, c := range p.Children {
+				walk(c, optional, plural)
+			}
+		case dtd.Choice:
+			for _, c := range p.Children {
+				walk(c, optional || len(p.Children) > 1, plural)
+			}
+		}
+	}
+	switch el.Content {
+	case dtd.Any:
+		for _, child := range w.d.Elements {
+			add(child.Name, true, true)
+		}
+	case dtd.Mixed:
+		for _, c := range el.Model.Children {
+			add(c.Name, true, true)
+		}
+	case dtd.Children:
+		walk(el.Model, false, false)
+	}
+	return result
+}
+
+// typeName returns the name of the type of elements called name.
+func (w *schemaWriter) typeName(name string) string {
+	el := w.d.Element(name)
+	if el == nil {
+		// Find declarations that differ only in their prefix.
+		for _, v := range w.d.Elements {
+			if localName(v.Name) == localName(name) {
+				el = v
+				break
+			}
+		}
+	}
+	switch {
+	case el == nil:
+		return "xs:anyType"
+	case w.simple(el):
+		return "xs:string"
+	}
+	return localName(el.Name)
+}
+
+// simple returns true if el may only contain text, and has no attributes.
+func (w *schemaWriter) simple(el *dtd.Element) bool {
+	return w.textOnly(el) && len(w.attributes(el)) == 0
+}
+
+func (w *schemaWriter) textOnly(el *dtd.Element) bool {
+	return el.Content == dtd.Mixed && len(el.Model.Children) == 0
+}
+
+// attributes returns the attributes of el, less namespace declarations
+// and attributes whose names differ only in their prefix.
+func (w *schemaWriter) attributes(el *dtd.Element) []*dtd.Attribute {
+	var result []*dtd.Attribute
+	seen := make(map[string]bool)
+	for _, a := range w.d.AttributesOf(el.Name) {
+		if a.Name == "xmlns" || strings.HasPrefix(a.Name, "xmlns:") {
+			continue
+		}
+		if name := localName(a.Name); !seen[name] {
+			seen[name] = true
+			result = append(result, a)
+		}
+	}
+	return result
+}
+
+func (w *schemaWriter) element(el *dtd.Element) {
+	name := localName(el.Name)
+	w.w.WriteString("  <xs:element")
+	w.attr("name", name)
+	w.attr("type", w.typeName(el.Name))
+	w.w.WriteString("/>\n")
+	if w.simple(el) {
+		return
+	}
+
+	w.w.WriteString("  <xs:complexType")
+	w.attr("name", name)
+	if el.Content == dtd.Mixed && !w.textOnly(el) || el.Content == dtd.Any {
+		w.attr("mixed", "true")
+	}
+	w.w.WriteString(">\n")
+	if w.textOnly(el) {
+		w.w.WriteString("    <xs:simpleContent>\n")
+		w.w.WriteString(`      <xs:extension base="xs:string">` + "\n")
+		w.attributeList(el, "        ")
+		w.w.WriteString("      </xs:extension>\n")
+		w.w.WriteString("    </xs:simpleContent>\n")
+	} else {
+		if fields := w.fields(el); len(fields) > 0 {
+			w.w.WriteString("    <xs:sequence>\n")
+			for _, f := range fields {
+				w.w.WriteString("      <xs:element")
+				w.attr("name", f.name)
+				w.attr("type", w.typeName(f.name))
+				if f.optional {
+					w.attr("minOccurs", "0")
+				}
+				if f.plural {
+					w.attr("maxOccurs", "unbounded")
+				}
+				w.w.WriteString("/>\n")
+			}
+			w.w.WriteString("    </xs:sequence>\n")
+		}
+		w.attributeList(el, "    ")
+	}
+	w.w.WriteString("  </xs:complexType>\n")
+}
+
+var attrTypes = map[dtd.AttrType]string{
+	dtd.CDATA:    "xs:string",
+	dtd.ID:       "xs:ID",
+	dtd.IDREF:    "xs:IDREF",
+	dtd.IDREFS:   "xs:IDREFS",
+	dtd.ENTITY:   "xs:ENTITY",
+	dtd.ENTITIES: "xs:ENTITIES",
+	dtd.NMTOKEN:  "xs:NMTOKEN",
+	dtd.NMTOKENS: "xs:NMTOKENS",
+}
+
+func (w *schemaWriter) attributeList(el *dtd.Element, indent string) {
+	for _, a := range w.attributes(el) {
+		w.w.WriteString(indent + "<xs:attribute")
+		w.attr("name", localName(a.Name))
+		typ, ok := attrTypes[a.Type]
+		if ok {
+			w.attr("type", typ)
+		}
+		switch a.DefaultKind {
+		case dtd.Required:
+			w.attr("use", "required")
+		case dtd.Default:
+			w.attr("default", a.Normalize(a.Value))
+		case dtd.Fixed:
+			w.attr("fixed", a.Normalize(a.Value))
+		}
+		if ok {
+			w.w.WriteString("/>\n")
+			continue
+		}
+		// NOTATION and enumerated attributes
+		w.w.WriteString(">\n")
+		w.w.WriteString(indent + "  <xs:simpleType>\n")
+		w.w.WriteString(indent + `    <xs:restriction base="xs:NMTOKEN">` + "\n")
+		for _, v := range a.Enum {
+			w.w.WriteString(indent + "      <xs:enumeration")
+			w.attr("value", v)
+			w.w.WriteString("/>\n")
+		}
+		w.w.WriteString(indent + "    </xs:restriction>\n")
+		w.w.WriteString(indent + "  </xs:simpleType>\n")
+		w.w.WriteString(indent + "</xs:attribute>\n")
+	}
+}
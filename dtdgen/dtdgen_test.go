@@ -0,0 +1,125 @@
+package dtdgen
+
+import (
+	"encoding/xml"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/m29h/go-xml/dtd"
+	"github.com/m29h/go-xml/xsd"
+)
+
+type testLogger struct {
+	*testing.T
+}
+
+func (t testLogger) Printf(format string, args ...interface{}) { t.Logf(format, args...) }
+
+func TestSchema(t *testing.T) {
+	d, err := dtd.Parse([]byte(`
+		<!ELEMENT book (title, (author|editor)+, chapter*, note?)>
+		<!ATTLIST book isbn ID #REQUIRED
+			status (draft|final) "draft"
+			xmlns CDATA #FIXED "urn:books">
+		<!ELEMENT title (#PCDATA)>
+		<!ELEMENT author (#PCDATA)>
+		<!ATTLIST author ref IDREF #IMPLIED>
+		<!ELEMENT editor EMPTY>
+		<!ELEMENT chapter (#PCDATA|b:em)*>
+		<!ELEMENT b:em (#PCDATA)>`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const tns = "urn:books"
+	s, err := Schema(d, tns)
+	if err != nil {
+		t.Log(string(XSD(d, tns)))
+		t.Fatal(err)
+	}
+	book, ok := s.Types[xml.Name{Space: tns, Local: "book"}].(*xsd.ComplexType)
+	if !ok {
+		t.Fatalf("book is %T, want complex type", s.Types[xml.Name{Space: tns, Local: "book"}])
+	}
+	want := map[string][2]bool{ // plural, optional
+		"title":   {false, false},
+		"author":  {true, true},
+		"editor":  {true, true},
+		"chapter": {true, true},
+		"note":    {false, true},
+	}
+	if len(book.Elements) != len(want) {
+		t.Errorf("book has %d elements, want %d", len(book.Elements), len(want))
+	}
+	for _, el := range book.Elements {
+		w, ok := want[el.Name.Local]
+		if !ok {
+			t.Errorf("unexpected element %s", el.Name.Local)
+		} else if el.Plural != w[0] || el.Optional != w[1] {
+			t.Errorf("%s: plural, optional = %v, %v, want %v, %v",
+				el.Name.Local, el.Plural, el.Optional, w[0], w[1])
+		}
+		if el.Name.Space != tns {
+			t.Errorf("%s is in namespace %q, want %q", el.Name.Local, el.Name.Space, tns)
+		}
+	}
+	if len(book.Attributes) != 2 {
+		t.Fatalf("book has %d attributes, want 2", len(book.Attributes))
+	}
+	if isbn := book.Attributes[0]; isbn.Optional || isbn.Type != xsd.ID {
+		t.Errorf("isbn is %v optional=%v, want required ID", isbn.Type, isbn.Optional)
+	}
+	status := book.Attributes[1]
+	if status.Default != "draft" {
+		t.Errorf("default status is %q, want %q", status.Default, "draft")
+	}
+	if st, ok := status.Type.(*xsd.SimpleType); !ok || len(st.Restriction.Enum) != 2 {
+		t.Errorf("status has type %#v, want enumeration", status.Type)
+	}
+	if title := book.Elements[0]; title.Type != xsd.String {
+		t.Errorf("title has type %v, want xs:string", title.Type)
+	}
+	if chapter, ok := s.Types[xml.Name{Space: tns, Local: "chapter"}].(*xsd.ComplexType); !ok || !chapter.Mixed {
+		t.Errorf("chapter should be a mixed complex type")
+	} else if len(chapter.Elements) != 1 || chapter.Elements[0].Name.Local != "em" {
+		t.Errorf("chapter should contain em elements, has %v", chapter.Elements)
+	}
+}
+
+func TestGenCLI(t *testing.T) {
+	output, err := os.CreateTemp("", "dtdgen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	output.Close()
+	defer os.Remove(output.Name())
+
+	var cfg Config
+	cfg.XSDOption(DefaultXSDOptions...)
+	cfg.Option(LogOutput(testLogger{t}))
+	if err := cfg.GenCLI("-vv", "-pkg", "notes", "-o", output.Name(), "testdata/note.dtd"); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(output.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("\n%s\n", data)
+	src := strings.Join(strings.Fields(string(data)), " ")
+	for _, want := range []string{
+		"package notes",
+		"type Note struct",
+		"To []string `xml:\"to\"`",
+		"From From `xml:\"from\"`",
+		"Email string `xml:\"email,attr\"`",
+		"Attach []*Attach `xml:\"attach,omitempty\"`",
+		// declared in the external parameter entity
+		"type Heading struct { Value string `xml:\",chardata\"` Em []string",
+		// mixed content keeps its text
+		"type Para struct { Value string `xml:\",chardata\"`",
+	} {
+		if !strings.Contains(src, want) {
+			t.Errorf("generated source does not contain %q", want)
+		}
+	}
+}
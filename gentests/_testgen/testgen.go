@@ -31,16 +31,16 @@ func glob(pat string) string {
 
 func main() {
 	var errorsEncountered bool
-	cfg := new(xsdgen.Config)
 
 	xsdTestCases, err := findXSDTestCases()
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	cfg.Option(xsdgen.DefaultOptions...)
-
 	for _, testCase := range xsdTestCases {
+		cfg := new(xsdgen.Config)
+		cfg.Option(xsdgen.DefaultOptions...)
+		cfg.Option(testCase.opts...)
 		code, tests, err := genXSDTests(*cfg, testCase.doc, testCase.pkg)
 		if err != nil {
 			errorsEncountered = true
@@ -206,13 +206,16 @@ func topLevelElements(root *xmltree.Element) []Element {
 }
 
 type testCase struct {
-	pkg string
-	doc []byte
+	pkg  string
+	doc  []byte
+	opts []xsdgen.Option
 }
 
 // Looks for subdirectories containing pairs of (xml, xsd) files
 // that should contain an xml document and the schema it conforms to,
-// respectively. Returns slice of the directory names
+// respectively. Options for the code generator are read from the
+// xsdgen.json file in the subdirectory, if there is one. Returns
+// slice of the directory names
 func findXSDTestCases() ([]testCase, error) {
 	filenames, err := filepath.Glob("*/*.xsd")
 	if err != nil {
@@ -220,14 +223,26 @@ func findXSDTestCases() ([]testCase, error) {
 	}
 	result := make([]testCase, 0, len(filenames))
 	for _, xsdfile := range filenames {
-		if data, err := os.ReadFile(xsdfile); err != nil {
+		data, err := os.ReadFile(xsdfile)
+		if err != nil {
 			return nil, err
-		} else {
-			result = append(result, testCase{
-				pkg: filepath.Base(filepath.Dir(xsdfile)),
-				doc: data,
-			})
 		}
+		var opts []xsdgen.Option
+		conf := filepath.Join(filepath.Dir(xsdfile), "xsdgen.json")
+		if _, err := os.Stat(conf); err == nil {
+			file, err := xsdgen.ReadConfigFile(conf)
+			if err != nil {
+				return nil, err
+			}
+			if opts, err = file.Options(); err != nil {
+				return nil, fmt.Errorf("%s: %v", conf, err)
+			}
+		}
+		result = append(result, testCase{
+			pkg:  filepath.Base(filepath.Dir(xsdfile)),
+			doc:  data,
+			opts: opts,
+		})
 	}
 	return result, nil
 }
@@ -0,0 +1,24 @@
+// Code generated by testgen. DO NOT EDIT.
+
+package bindtype
+
+import (
+	"net/netip"
+	"time"
+
+	semver "github.com/m29h/go-xml/gentests/bindtype/internal/semver/v2"
+	time2 "github.com/m29h/go-xml/gentests/bindtype/internal/time"
+)
+
+type Host struct {
+	Name    string         `xml:"urn:hosts name"`
+	Address []netip.Addr   `xml:"urn:hosts address"`
+	Seen    time.Time      `xml:"urn:hosts seen"`
+	Uptime  time2.Seconds  `xml:"urn:hosts uptime"`
+	Gateway netip.Addr     `xml:"gateway,attr,omitempty"`
+	Version semver.Version `xml:"version,attr,omitempty"`
+}
+
+type Hosts struct {
+	Host []Host `xml:"urn:hosts host"`
+}
@@ -0,0 +1,23 @@
+// Package semver holds a type for the bindtype tests whose import
+// path ends in a major version suffix.
+package semver
+
+import "fmt"
+
+// A Version is a version number of the form major.minor.patch.
+type Version struct {
+	Major, Minor, Patch int
+}
+
+func (v Version) MarshalText() ([]byte, error) {
+	return fmt.Appendf(nil, "%d.%d.%d", v.Major, v.Minor, v.Patch), nil
+}
+
+func (v *Version) UnmarshalText(text []byte) error {
+	var r Version
+	if n, err := fmt.Sscanf(string(text), "%d.%d.%d", &r.Major, &r.Minor, &r.Patch); err != nil || n != 3 {
+		return fmt.Errorf("invalid version %q", text)
+	}
+	*v = r
+	return nil
+}
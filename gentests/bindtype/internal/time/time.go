@@ -0,0 +1,7 @@
+// Package time holds a type for the bindtype tests whose package
+// name is the same as that of a standard package the generated code
+// uses.
+package time
+
+// Seconds is a length of time in whole seconds.
+type Seconds int64
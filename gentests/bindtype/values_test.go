@@ -0,0 +1,43 @@
+package bindtype
+
+import (
+	"encoding/xml"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/m29h/go-xml/gentests/bindtype/internal/semver/v2"
+)
+
+func TestBoundValues(t *testing.T) {
+	var h Host
+	err := xml.Unmarshal([]byte(`<host xmlns="urn:hosts" gateway="192.0.2.1" version="2.14.1">
+		<name>alpha</name>
+		<address>2001:db8::10</address>
+		<seen>2024-03-01T12:30:00+01:00</seen>
+		<uptime>86400</uptime>
+	</host>`), &h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := netip.MustParseAddr("2001:db8::10"); len(h.Address) != 1 || h.Address[0] != want {
+		t.Errorf("got addresses %v, want [%v]", h.Address, want)
+	}
+	if want := time.Date(2024, 3, 1, 11, 30, 0, 0, time.UTC); !h.Seen.Equal(want) {
+		t.Errorf("got time %v, want %v", h.Seen, want)
+	}
+	if !h.Gateway.Is4() {
+		t.Errorf("got gateway %v, want an IPv4 address", h.Gateway)
+	}
+	if want := (semver.Version{Major: 2, Minor: 14, Patch: 1}); h.Version != want {
+		t.Errorf("got version %v, want %v", h.Version, want)
+	}
+	if h.Uptime != 86400 {
+		t.Errorf("got uptime %d, want 86400", h.Uptime)
+	}
+
+	err = xml.Unmarshal([]byte(`<host xmlns="urn:hosts"><address>192.0.2.300</address></host>`), &h)
+	if err == nil {
+		t.Error("expected an error unmarshalling an invalid address")
+	}
+}
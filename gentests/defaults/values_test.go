@@ -0,0 +1,70 @@
+package defaults
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+)
+
+func TestDefaultValues(t *testing.T) {
+	// Attributes take their default or fixed value when absent, and
+	// elements when present and empty.
+	var o Order
+	if err := xml.Unmarshal([]byte(`<order xmlns="urn:orders"><qty/><note></note><ver/></order>`), &o); err != nil {
+		t.Fatal(err)
+	}
+	want := Order{Qty: 5, Note: "none", Ver: "1.0", Currency: "EUR", Priority: "3"}
+	if o != want {
+		t.Errorf("got %+v, want %+v", o, want)
+	}
+
+	// Absent elements have no value.
+	o = Order{}
+	if err := xml.Unmarshal([]byte(`<order xmlns="urn:orders"><qty>2</qty></order>`), &o); err != nil {
+		t.Fatal(err)
+	}
+	want = Order{Qty: 2, Currency: "EUR", Priority: "3"}
+	if o != want {
+		t.Errorf("got %+v, want %+v", o, want)
+	}
+
+	// The fixed value is compared numerically.
+	if err := xml.Unmarshal([]byte(`<order xmlns="urn:orders"><ver>1.00</ver></order>`), &o); err != nil {
+		t.Errorf("unmarshal 1.00 for fixed value 1.0: %v", err)
+	}
+
+	for _, doc := range []string{
+		`<order xmlns="urn:orders"><ver>1.1</ver></order>`,
+		`<order xmlns="urn:orders" currency="USD"></order>`,
+	} {
+		var o Order
+		if err := xml.Unmarshal([]byte(doc), &o); err == nil {
+			t.Errorf("unmarshal %s: expected a fixed value error", doc)
+		}
+	}
+	if _, err := xml.Marshal(&Order{Ver: "2"}); err == nil {
+		t.Error("marshal ver 2: expected a fixed value error")
+	}
+	if _, err := xml.Marshal(&Order{}); err == nil {
+		t.Error("marshal required ver with the zero value: expected a fixed value error")
+	}
+}
+
+func TestDefaultValuesMarshal(t *testing.T) {
+	// A zero in a required field is kept, and an optional element
+	// with the zero value is left out, while the zero values of
+	// optional attributes are filled in with their default or fixed
+	// value.
+	b, err := xml.Marshal(&Order{Qty: 0, Ver: "1.0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{`>0</qty>`, `currency="EUR"`, `priority="3"`} {
+		if !strings.Contains(string(b), s) {
+			t.Errorf("got %s, want %s", b, s)
+		}
+	}
+	if strings.Contains(string(b), "note") {
+		t.Errorf("got %s, want no note", b)
+	}
+}
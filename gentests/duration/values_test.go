@@ -0,0 +1,93 @@
+package duration
+
+import (
+	"encoding/xml"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDurationValues(t *testing.T) {
+	var job Job
+	err := xml.Unmarshal([]byte(`<job xmlns="urn:jobs" retry="PT30M">
+		<period>P1Y2M3DT4H5M6.7S</period>
+		<timeout>PT90S</timeout>
+		<steps>PT1H -PT0.5S</steps>
+	</job>`), &job)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := xsdDuration{Years: 1, Months: 2, Days: 3, Hours: 4, Minutes: 5, Seconds: 6, Nanoseconds: 7e8}
+	if job.Period != want {
+		t.Errorf("got period %+v, want %+v", job.Period, want)
+	}
+	if text, _ := job.Period.MarshalText(); string(text) != "P1Y2M3DT4H5M6.7S" {
+		t.Errorf("period marshalled as %s", text)
+	}
+	if d, ok := job.Timeout.Duration(); !ok || d != 90*time.Second {
+		t.Errorf("got timeout %v, %v, want 1m30s", d, ok)
+	}
+	if d, ok := job.Steps[1].Duration(); !ok || d != -500*time.Millisecond {
+		t.Errorf("got step %v, %v, want -500ms", d, ok)
+	}
+	if _, ok := job.Period.Duration(); ok {
+		t.Error("a duration with years and months converted to a time.Duration")
+	}
+	if job.Retry == nil || *job.Retry != (xsdDuration{Minutes: 30}) {
+		t.Errorf("got retry %+v, want PT30M", job.Retry)
+	}
+
+	for _, doc := range []string{
+		`<job xmlns="urn:jobs"><period>P</period></job>`,
+		`<job xmlns="urn:jobs"><period>PT</period></job>`,
+		`<job xmlns="urn:jobs"><period>P1S</period></job>`,
+		`<job xmlns="urn:jobs"><period>P1D2Y</period></job>`,
+		`<job xmlns="urn:jobs"><period>PT1.S</period></job>`,
+		`<job xmlns="urn:jobs"><term>P1Y2D</term></job>`,
+		`<job xmlns="urn:jobs"><steps>P1M</steps></job>`,
+		`<job xmlns="urn:jobs" retry="1H"/>`,
+	} {
+		if err := xml.Unmarshal([]byte(doc), new(Job)); err == nil {
+			t.Errorf("expected an error unmarshalling %s", doc)
+		}
+	}
+}
+
+func TestZeroDuration(t *testing.T) {
+	// Required durations are marshalled even if they are zero;
+	// optional ones are left out if they are absent.
+	out, err := xml.Marshal(Job{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `<Job><period xmlns="urn:jobs">PT0S</period><timeout xmlns="urn:jobs">PT0S</timeout>` +
+		`<term xmlns="urn:jobs">PT0S</term></Job>`
+	if string(out) != want {
+		t.Errorf("got %s, want %s", out, want)
+	}
+	out, err = xml.Marshal(Job{Retry: new(xsdDuration)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out), `retry="PT0S"`) {
+		t.Errorf("a present zero retry was left out: %s", out)
+	}
+}
+
+func TestDurationOverflow(t *testing.T) {
+	for _, d := range []xsdDuration{
+		{Years: math.MaxInt / 12, Months: 12},
+		{Days: math.MaxInt / 24},
+		{Minutes: math.MaxInt / 60, Seconds: 60},
+		{Seconds: math.MaxInt, Nanoseconds: 1e9},
+	} {
+		if text, err := d.MarshalText(); err == nil {
+			t.Errorf("%+v marshalled as %s, want an error", d, text)
+		}
+	}
+	d := xsdDuration{Years: math.MaxInt / 12, Seconds: math.MaxInt - 1, Nanoseconds: 1e9}
+	if _, err := d.MarshalText(); err != nil {
+		t.Errorf("%+v: %v", d, err)
+	}
+}
@@ -0,0 +1,97 @@
+package exacttimes
+
+import (
+	"encoding/xml"
+	"testing"
+	"time"
+)
+
+func TestExactTimeValues(t *testing.T) {
+	var ev Event
+	err := xml.Unmarshal([]byte(`<event xmlns="urn:events" logged="2024-03-02+05:30">
+		<at>2024-03-01T10:00:00.250</at>
+		<day>2024-03-01</day>
+		<years>2024Z</years>
+	</event>`), &ev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ev.Day.NoZone || ev.Day.Time != time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC) {
+		t.Errorf("got day %+v, want 2024-03-01 with no time zone", ev.Day)
+	}
+	if _, offset := ev.Logged.Zone(); ev.Logged.NoZone || offset != 5*3600+30*60 {
+		t.Errorf("got logged %+v, want 2024-03-02 in +05:30", ev.Logged)
+	}
+	if !ev.At.NoZone || ev.At.Digits != 3 {
+		t.Errorf("got at %+v, want 3 fractional digits and no time zone", ev.At)
+	}
+	if ev.Years[0].NoZone {
+		t.Errorf("got year %+v, want UTC", ev.Years[0])
+	}
+
+	out, err := xml.Marshal(ev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var back Event
+	if err := xml.Unmarshal(out, &back); err != nil {
+		t.Fatal(err)
+	}
+	if back.Day != ev.Day || back.At != ev.At || back.Logged.String() != ev.Logged.String() {
+		t.Errorf("%s unmarshalled as %+v, want %+v", out, back, ev)
+	}
+
+	for _, doc := range []string{
+		`<event xmlns="urn:events"><day>2024-02-30</day></event>`,
+		`<event xmlns="urn:events"><day>2024-03-01T00:00:00</day></event>`,
+		`<event xmlns="urn:events"><at>2024-03-01</at></event>`,
+		`<event xmlns="urn:events" logged="01/03/2024"/>`,
+		`<event xmlns="urn:events"><day>044-03-15</day></event>`,
+		`<event xmlns="urn:events"><years>012345</years></event>`,
+		`<event xmlns="urn:events"><at>2024-03-01T24:00:01</at></event>`,
+		`<event xmlns="urn:events"><start>24:30:00</start></event>`,
+	} {
+		if err := xml.Unmarshal([]byte(doc), new(Event)); err == nil {
+			t.Errorf("expected an error unmarshalling %s", doc)
+		}
+	}
+}
+
+func TestExactTimeForms(t *testing.T) {
+	var ev Event
+	err := xml.Unmarshal([]byte(`<event xmlns="urn:events" logged="-0044-03-15">
+		<at>2024-12-31T24:00:00+00:00</at>
+		<day>2024-03-01-00:00</day>
+		<start>24:00:00.000Z</start>
+		<years>12345 -0001 0000</years>
+		<month>-12345-06</month>
+	</event>`), &ev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(-44, 3, 15, 0, 0, 0, 0, time.UTC); ev.Logged.Time != want {
+		t.Errorf("got logged %v, want %v", ev.Logged.Time, want)
+	}
+	if want := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC); !ev.At.Equal(want) {
+		t.Errorf("got at %v, want %v", ev.At.Time, want)
+	}
+	if len(ev.Years) != 3 || ev.Years[0].Year() != 12345 || ev.Years[1].Year() != -1 || ev.Years[2].Year() != 0 {
+		t.Errorf("got years %v, want 12345, -1 and 0", ev.Years)
+	}
+	for _, tt := range []struct {
+		v    interface{ MarshalText() ([]byte, error) }
+		want string
+	}{
+		{ev.Logged, "-0044-03-15"},
+		{ev.At, "2025-01-01T00:00:00+00:00"},
+		{ev.Day, "2024-03-01-00:00"},
+		{ev.Start, "00:00:00.000Z"},
+		{ev.Years[0], "12345"},
+		{ev.Years[1], "-0001"},
+		{ev.Month, "-12345-06"},
+	} {
+		if text, err := tt.v.MarshalText(); err != nil || string(text) != tt.want {
+			t.Errorf("marshalled %+v as %s, %v, want %s", tt.v, text, err, tt.want)
+		}
+	}
+}
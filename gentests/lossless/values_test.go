@@ -0,0 +1,76 @@
+package lossless
+
+import (
+	"encoding/xml"
+	"math/big"
+	"testing"
+)
+
+func TestLosslessValues(t *testing.T) {
+	var e Entry
+	err := xml.Unmarshal([]byte(`<entry xmlns="urn:ledger" serial="123456789012345678901234567890">
+		<amount>12345678.90</amount>
+		<rate>0.100000000000000000000000000001</rate>
+		<rates>1.10 2.0</rates>
+		<units>98765432109876543210</units>
+	</entry>`), &e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Rate != "0.100000000000000000000000000001" {
+		t.Errorf("got rate %s, want the digits of the document", e.Rate)
+	}
+	if r, ok := e.Rate.Rat(); !ok || r.Cmp(big.NewRat(1, 10)) <= 0 {
+		t.Errorf("got rate %v, %v, want a value just above 1/10", r, ok)
+	}
+	want, _ := new(big.Int).SetString("123456789012345678901234567890", 10)
+	if n, ok := e.Serial.BigInt(); !ok || n.Cmp(want) != 0 {
+		t.Errorf("got serial %v, %v, want %v", n, ok, want)
+	}
+	if len(e.Rates) != 2 || e.Rates[0] != "1.10" {
+		t.Errorf("got rates %q, want [1.10 2.0]", e.Rates)
+	}
+
+	for _, doc := range []string{
+		// totalDigits is 10
+		`<entry xmlns="urn:ledger"><amount>123456789.01</amount></entry>`,
+		// fractionDigits is 2
+		`<entry xmlns="urn:ledger"><amount>1.001</amount></entry>`,
+		`<entry xmlns="urn:ledger"><rate>1e5</rate></entry>`,
+		`<entry xmlns="urn:ledger"><units>1.0</units></entry>`,
+		`<entry xmlns="urn:ledger" serial="--1"/>`,
+	} {
+		if err := xml.Unmarshal([]byte(doc), new(Entry)); err == nil {
+			t.Errorf("expected an error unmarshalling %s", doc)
+		}
+	}
+	// Trailing zeros are not significant digits.
+	if err := xml.Unmarshal([]byte(`<entry xmlns="urn:ledger"><amount>12345678.9000</amount></entry>`), &e); err != nil {
+		t.Error(err)
+	}
+	// Types derived from the helper types have their methods.
+	if r, ok := e.Amount.Rat(); !ok || r.Cmp(big.NewRat(123456789, 10)) != 0 {
+		t.Errorf("got amount %v, %v, want 12345678.9", r, ok)
+	}
+	if !e.Amount.Equal("12345678.90") {
+		t.Errorf("amount %s is not equal to 12345678.90", e.Amount)
+	}
+}
+
+func TestLosslessZero(t *testing.T) {
+	// Empty values are zero, and required elements are not left
+	// empty.
+	out, err := xml.Marshal(Entry{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `<Entry><amount xmlns="urn:ledger">0</amount><rate xmlns="urn:ledger">0</rate>` +
+		`<units xmlns="urn:ledger">0</units></Entry>`
+	if string(out) != want {
+		t.Errorf("got %s, want %s", out, want)
+	}
+	var e Entry
+	if n, ok := e.Units.BigInt(); !ok || n.Sign() != 0 {
+		t.Errorf("got units %v, %v, want 0", n, ok)
+	}
+}
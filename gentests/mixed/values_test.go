@@ -0,0 +1,25 @@
+package mixed
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+)
+
+func TestMixedText(t *testing.T) {
+	var p Para
+	if err := xml.Unmarshal([]byte(`<para xmlns="urn:notes">Some <em>emphasized</em> text</para>`), &p); err != nil {
+		t.Fatal(err)
+	}
+	if p.Value != "Some  text" || len(p.Em) != 1 || p.Em[0] != "emphasized" {
+		t.Errorf("got %+v, want the text and the em element", p)
+	}
+	b, err := xml.Marshal(&p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The text is kept, but not its position among the child elements.
+	if !strings.Contains(string(b), "Some  text") || !strings.Contains(string(b), ">emphasized</em>") {
+		t.Errorf("marshalled %s, want the text and the em element", b)
+	}
+}
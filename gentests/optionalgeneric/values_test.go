@@ -0,0 +1,78 @@
+package optionalgeneric
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+)
+
+// childNames returns the names of the child elements of the root
+// element of doc, in order.
+func childNames(t *testing.T, doc []byte) []string {
+	var names []string
+	d := xml.NewDecoder(strings.NewReader(string(doc)))
+	depth := 0
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return names
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			if depth++; depth == 2 {
+				names = append(names, tok.Name.Local)
+			}
+		case xml.EndElement:
+			depth--
+		}
+	}
+}
+
+func TestOptionalValues(t *testing.T) {
+	var r Record
+	err := xml.Unmarshal([]byte(`<record xmlns="urn:records" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" flag="false">
+		<id>r1</id>
+		<count>0</count>
+		<rate xsi:nil="true"/>
+		<addr><street>Main Street</street></addr>
+		<last>end</last>
+	</record>`), &r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.Count.Valid || r.Count.Value != 0 {
+		t.Errorf("got count %+v, want a valid 0", r.Count)
+	}
+	if !r.Rate.Nil || r.Rate.Valid {
+		t.Errorf("got rate %+v, want nil", r.Rate)
+	}
+	if r.Note.Valid || r.Note.Nil {
+		t.Errorf("got note %+v, want an absent value", r.Note)
+	}
+	if !r.Flag.Valid || r.Flag.Value {
+		t.Errorf("got flag %+v, want a valid false", r.Flag)
+	}
+
+	r = Record{
+		Id:   "r2",
+		Rate: Optional[float64]{Value: 2.5, Valid: true},
+		Note: Optional[string]{Nil: true},
+		Addr: Optional[Address]{Nil: true},
+		Last: "end",
+	}
+	out, err := xml.Marshal(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "id rate note addr last"
+	if got := strings.Join(childNames(t, out), " "); got != want {
+		t.Errorf("elements of %s are in the order %s, want %s", out, got, want)
+	}
+	var back Record
+	if err := xml.Unmarshal(out, &back); err != nil {
+		t.Fatal(err)
+	}
+	if back != r {
+		t.Errorf("%s unmarshalled as %+v, want %+v", out, back, r)
+	}
+}
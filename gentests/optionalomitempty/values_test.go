@@ -0,0 +1,31 @@
+package optionalomitempty
+
+import (
+	"encoding/xml"
+	"testing"
+)
+
+func TestOmitEmptyValues(t *testing.T) {
+	// Without pointers or Optional, a nil element cannot be told
+	// apart from a zero value.
+	var r Record
+	err := xml.Unmarshal([]byte(`<record xmlns="urn:records" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">
+		<id>r1</id>
+		<rate xsi:nil="true"/>
+		<note xsi:nil="true"/>
+		<last>end</last>
+	</record>`), &r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Rate != 0 || r.Note != "" || r.Addr != nil {
+		t.Errorf("got %+v, want zero rate, note and address", r)
+	}
+	out, err := xml.Marshal(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `<Record><id xmlns="urn:records">r1</id><last xmlns="urn:records">end</last></Record>`; string(out) != want {
+		t.Errorf("got %s, want %s", out, want)
+	}
+}
@@ -0,0 +1,89 @@
+package optionalpointer
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+)
+
+// childNames returns the names of the child elements of the root
+// element of doc, in order.
+func childNames(t *testing.T, doc []byte) []string {
+	var names []string
+	d := xml.NewDecoder(strings.NewReader(string(doc)))
+	depth := 0
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return names
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			if depth++; depth == 2 {
+				names = append(names, tok.Name.Local)
+			}
+		case xml.EndElement:
+			depth--
+		}
+	}
+}
+
+func TestNillableValues(t *testing.T) {
+	var r Record
+	err := xml.Unmarshal([]byte(`<record xmlns="urn:records" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">
+		<id>r1</id>
+		<rate xsi:nil="true"/>
+		<note xsi:nil="true"/>
+		<addr><street>Main Street</street></addr>
+		<last>end</last>
+	</record>`), &r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Count != nil || r.Rate.Value != nil || r.Flag != nil {
+		t.Errorf("got %+v, want nil count, rate and flag", r)
+	}
+	if r.Note == nil || r.Note.Value != nil {
+		t.Errorf("got note %+v, want a nil note that is present", r.Note)
+	}
+	if r.Addr.Value == nil || r.Addr.Value.Street != "Main Street" {
+		t.Errorf("got address %+v, want Main Street", r.Addr.Value)
+	}
+
+	count, rate, note := 0, 2.5, ""
+	r = Record{Id: "r2", Count: &count, Rate: Nillable[float64]{&rate}, Note: &Nillable[string]{&note}, Last: "end"}
+	out, err := xml.Marshal(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "id count rate note addr last"
+	if got := strings.Join(childNames(t, out), " "); got != want {
+		t.Errorf("elements of %s are in the order %s, want %s", out, got, want)
+	}
+	if !strings.Contains(string(out), `nil="true"></addr>`) {
+		t.Errorf("nil address not marshalled with xsi:nil: %s", out)
+	}
+	var back Record
+	if err := xml.Unmarshal(out, &back); err != nil {
+		t.Fatal(err)
+	}
+	if *back.Count != 0 || *back.Rate.Value != 2.5 || back.Note == nil || *back.Note.Value != "" || back.Addr.Value != nil {
+		t.Errorf("%s unmarshalled as %+v", out, back)
+	}
+
+	// An absent note is left out, and a nil one is kept.
+	for _, note := range []*Nillable[string]{nil, {}} {
+		r := Record{Id: "r3", Note: note, Last: "end"}
+		out, err := xml.Marshal(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var back Record
+		if err := xml.Unmarshal(out, &back); err != nil {
+			t.Fatal(err)
+		}
+		if (back.Note == nil) != (note == nil) || back.Note != nil && back.Note.Value != nil {
+			t.Errorf("note %+v marshalled as %s and unmarshalled as %+v", note, out, back.Note)
+		}
+	}
+}
@@ -0,0 +1,691 @@
+package rng
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/m29h/go-xml/xmltree"
+)
+
+// The compact syntax is translated to an equivalent schema in the XML
+// syntax, which is then simplified in the same way as schema written
+// in the XML syntax. Names are resolved while translating, so the
+// elements of the translation do not need namespace declarations.
+
+const xmlNS = "http://www.w3.org/XML/1998/namespace"
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	// an identifier or keyword
+	tokName
+	// an identifier escaped with a backslash, which is never a keyword
+	tokEscaped
+	// prefix:local
+	tokCName
+	// prefix:*
+	tokNsName
+	tokLiteral
+	tokOp
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  xmltree.Pos
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of input"
+	case tokLiteral:
+		return fmt.Sprintf("literal %q", t.text)
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+var keywords = map[string]bool{
+	"attribute": true, "default": true, "datatypes": true, "div": true,
+	"element": true, "empty": true, "external": true, "grammar": true,
+	"include": true, "inherit": true, "list": true, "mixed": true,
+	"namespace": true, "notAllowed": true, "parent": true, "start": true,
+	"string": true, "text": true, "token": true,
+}
+
+type lexer struct {
+	src       []byte
+	off       int
+	line, col int
+}
+
+type compactError struct {
+	pos xmltree.Pos
+	msg string
+}
+
+func (e *compactError) Error() string {
+	return fmt.Sprintf("%d:%d: %s", e.pos.Line, e.pos.Column, e.msg)
+}
+
+func (l *lexer) pos() xmltree.Pos {
+	return xmltree.Pos{Offset: int64(l.off), Line: l.line, Column: l.col}
+}
+
+func (l *lexer) peekRune() (rune, int) {
+	if l.off >= len(l.src) {
+		return -1, 0
+	}
+	return utf8.DecodeRune(l.src[l.off:])
+}
+
+func (l *lexer) advance(n int) {
+	for _, b := range l.src[l.off : l.off+n] {
+		if b == '\n' {
+			l.line++
+			l.col = 1
+		} else {
+			l.col++
+		}
+	}
+	l.off += n
+}
+
+func isNameStart(r rune) bool {
+	return r == '_' || unicode.IsLetter(r)
+}
+
+func isNameChar(r rune) bool {
+	return isNameStart(r) || r == '-' || r == '.' || unicode.IsDigit(r) ||
+		unicode.IsMark(r) || r == '·'
+}
+
+// ncname reads an NCName, if one begins at the current offset.
+func (l *lexer) ncname() string {
+	start := l.off
+	r, n := l.peekRune()
+	if !isNameStart(r) {
+		return ""
+	}
+	for isNameChar(r) {
+		l.advance(n)
+		r, n = l.peekRune()
+	}
+	return string(l.src[start:l.off])
+}
+
+var operators = []string{"|=", "&=", ">>", "=", "{", "}", "(", ")", "[", "]", ",", "&", "|", "?", "*", "+", "-", "~"}
+
+func (l *lexer) next() (token, error) {
+	for l.off < len(l.src) {
+		c := l.src[l.off]
+		if c == ' ' || c == '\t' || c == '\r' || c == '\n' {
+			l.advance(1)
+		} else if c == '#' {
+			for l.off < len(l.src) && l.src[l.off] != '\n' {
+				l.advance(1)
+			}
+		} else {
+			break
+		}
+	}
+	tok := token{pos: l.pos()}
+	if l.off >= len(l.src) {
+		return tok, nil
+	}
+	rest := l.src[l.off:]
+	switch c := rest[0]; {
+	case c == '"' || c == '\'':
+		delim := string(c)
+		if len(rest) >= 3 && rest[1] == c && rest[2] == c {
+			delim = strings.Repeat(delim, 3)
+		}
+		end := strings.Index(string(rest[len(delim):]), delim)
+		if end < 0 {
+			return tok, &compactError{tok.pos, "unterminated literal"}
+		}
+		tok.kind = tokLiteral
+		tok.text = string(rest[len(delim) : len(delim)+end])
+		if len(delim) == 1 && strings.ContainsAny(tok.text, "\n\r") {
+			return tok, &compactError{tok.pos, "newline in literal"}
+		}
+		l.advance(len(delim) + end + len(delim))
+		return tok, nil
+	case c == '\\':
+		l.advance(1)
+		tok.kind = tokEscaped
+		if tok.text = l.ncname(); tok.text == "" {
+			return tok, &compactError{tok.pos, "expected an identifier after \\"}
+		}
+		return tok, nil
+	}
+	if name := l.ncname(); name != "" {
+		tok.kind, tok.text = tokName, name
+		if l.off+1 < len(l.src) && l.src[l.off] == ':' {
+			if l.src[l.off+1] == '*' {
+				l.advance(2)
+				tok.kind = tokNsName
+				return tok, nil
+			}
+			save := *l
+			l.advance(1)
+			if local := l.ncname(); local != "" {
+				tok.kind, tok.text = tokCName, name+":"+local
+			} else {
+				*l = save
+			}
+		}
+		return tok, nil
+	}
+	for _, op := range operators {
+		if strings.HasPrefix(string(rest), op) {
+			l.advance(len(op))
+			tok.kind, tok.text = tokOp, op
+			return tok, nil
+		}
+	}
+	r, _ := l.peekRune()
+	return tok, &compactError{tok.pos, fmt.Sprintf("unexpected character %q", r)}
+}
+
+// compactParser translates the compact syntax to the XML syntax.
+type compactParser struct {
+	lex  lexer
+	toks []token
+	// namespace prefixes and datatype library prefixes
+	namespaces, datatypes map[string]string
+	defaultNS             string
+	hasDefault            bool
+}
+
+func compactToXML(data []byte) (root *xmltree.Element, err error) {
+	c := &compactParser{
+		lex:        lexer{src: data, line: 1, col: 1},
+		namespaces: map[string]string{"xml": xmlNS},
+		datatypes:  map[string]string{"xsd": XSDDatatypes},
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			e, ok := r.(*compactError)
+			if !ok {
+				panic(r)
+			}
+			err = e
+		}
+	}()
+	return c.topLevel(), nil
+}
+
+func (c *compactParser) fail(tok token, format string, args ...interface{}) {
+	panic(&compactError{tok.pos, fmt.Sprintf(format, args...)})
+}
+
+// peek returns the token n tokens ahead of the current one.
+func (c *compactParser) peekN(n int) token {
+	for len(c.toks) <= n {
+		tok, err := c.lex.next()
+		if err != nil {
+			panic(err)
+		}
+		c.toks = append(c.toks, tok)
+	}
+	return c.toks[n]
+}
+
+func (c *compactParser) peek() token { return c.peekN(0) }
+
+func (c *compactParser) next() token {
+	tok := c.peek()
+	c.toks = c.toks[1:]
+	return tok
+}
+
+func (c *compactParser) isOp(op string) bool {
+	tok := c.peek()
+	return tok.kind == tokOp && tok.text == op
+}
+
+func (c *compactParser) isKeyword(kw string) bool {
+	tok := c.peek()
+	return tok.kind == tokName && tok.text == kw
+}
+
+func (c *compactParser) expect(op string) token {
+	tok := c.next()
+	if tok.kind != tokOp || tok.text != op {
+		c.fail(tok, "expected %q, found %s", op, tok)
+	}
+	return tok
+}
+
+func (c *compactParser) literal() string {
+	tok := c.next()
+	if tok.kind != tokLiteral {
+		c.fail(tok, "expected a literal, found %s", tok)
+	}
+	s := tok.text
+	for c.isOp("~") {
+		c.next()
+		tok = c.next()
+		if tok.kind != tokLiteral {
+			c.fail(tok, "expected a literal, found %s", tok)
+		}
+		s += tok.text
+	}
+	return s
+}
+
+// identifier reads an identifier or keyword.
+func (c *compactParser) identifier() string {
+	tok := c.next()
+	if tok.kind != tokName && tok.kind != tokEscaped {
+		c.fail(tok, "expected an identifier, found %s", tok)
+	}
+	return tok.text
+}
+
+// skipAnnotations skips any annotations in square brackets.
+func (c *compactParser) skipAnnotations() {
+	for c.isOp("[") {
+		c.skipBrackets()
+	}
+}
+
+func (c *compactParser) skipBrackets() {
+	open := c.expect("[")
+	for depth := 1; depth > 0; {
+		tok := c.next()
+		switch {
+		case tok.kind == tokEOF:
+			c.fail(open, "unterminated annotation")
+		case tok.kind == tokOp && tok.text == "[":
+			depth++
+		case tok.kind == tokOp && tok.text == "]":
+			depth--
+		}
+	}
+}
+
+// skipFollowing skips annotations that follow a pattern or name class.
+func (c *compactParser) skipFollowing() {
+	for c.isOp(">>") {
+		c.next()
+		if tok := c.next(); tok.kind != tokName && tok.kind != tokCName && tok.kind != tokEscaped {
+			c.fail(tok, "expected an annotation element, found %s", tok)
+		}
+		c.skipBrackets()
+	}
+}
+
+func elem(local string, pos xmltree.Pos, attrs ...string) *xmltree.Element {
+	el := &xmltree.Element{Start: pos}
+	el.Name = xml.Name{Space: Namespace, Local: local}
+	for i := 0; i+1 < len(attrs); i += 2 {
+		el.StartElement.Attr = append(el.StartElement.Attr, xml.Attr{Name: xml.Name{Local: attrs[i]}, Value: attrs[i+1]})
+	}
+	return el
+}
+
+func appendChild(el, child *xmltree.Element) *xmltree.Element {
+	el.Children = append(el.Children, *child)
+	return el
+}
+
+func (c *compactParser) topLevel() *xmltree.Element {
+	for {
+		c.skipAnnotations()
+		tok := c.peek()
+		switch {
+		case c.isKeyword("namespace"):
+			c.next()
+			prefix := c.identifier()
+			c.expect("=")
+			c.namespaces[prefix] = c.namespaceURI()
+		case c.isKeyword("default"):
+			c.next()
+			if !c.isKeyword("namespace") {
+				c.fail(c.peek(), "expected namespace, found %s", c.peek())
+			}
+			c.next()
+			prefix := ""
+			if !c.isOp("=") {
+				prefix = c.identifier()
+			}
+			c.expect("=")
+			if c.isKeyword("inherit") {
+				c.next()
+				continue
+			}
+			uri := c.literal()
+			c.defaultNS, c.hasDefault = uri, true
+			if prefix != "" {
+				c.namespaces[prefix] = uri
+			}
+		case c.isKeyword("datatypes"):
+			c.next()
+			prefix := c.identifier()
+			c.expect("=")
+			c.datatypes[prefix] = c.literal()
+		default:
+			var root *xmltree.Element
+			if c.grammarFollows() {
+				root = c.grammarContent(elem("grammar", tok.pos), tokEOF)
+			} else {
+				root = c.pattern()
+				if tok := c.peek(); tok.kind != tokEOF {
+					c.fail(tok, "unexpected %s", tok)
+				}
+			}
+			if c.hasDefault {
+				root.SetAttr("", "ns", c.defaultNS)
+			}
+			return root
+		}
+	}
+}
+
+func (c *compactParser) namespaceURI() string {
+	if c.isKeyword("inherit") {
+		c.next()
+		return ""
+	}
+	return c.literal()
+}
+
+// grammarFollows returns true if the next tokens begin the content of
+// a grammar, rather than a pattern.
+func (c *compactParser) grammarFollows() bool {
+	tok := c.peek()
+	switch tok.kind {
+	case tokEOF:
+		return true
+	case tokName, tokEscaped:
+		if tok.kind == tokName && (tok.text == "start" || tok.text == "div" || tok.text == "include") {
+			return true
+		}
+		next := c.peekN(1)
+		return next.kind == tokOp && (next.text == "=" || next.text == "|=" || next.text == "&=")
+	case tokCName:
+		next := c.peekN(1)
+		return next.kind == tokOp && next.text == "["
+	}
+	return false
+}
+
+// grammarContent reads definitions into el until the end token.
+func (c *compactParser) grammarContent(el *xmltree.Element, end tokenKind) *xmltree.Element {
+	for {
+		c.skipAnnotations()
+		tok := c.peek()
+		switch {
+		case end == tokEOF && tok.kind == tokEOF:
+			return el
+		case end == tokOp && c.isOp("}"):
+			c.next()
+			return el
+		case tok.kind == tokEOF:
+			c.fail(tok, "unexpected end of input")
+		case c.isKeyword("start"):
+			c.next()
+			child := elem("start", tok.pos)
+			c.assign(child)
+			appendChild(el, appendChild(child, c.pattern()))
+		case c.isKeyword("div"):
+			c.next()
+			c.expect("{")
+			appendChild(el, c.grammarContent(elem("div", tok.pos), tokOp))
+		case c.isKeyword("include"):
+			c.next()
+			child := elem("include", tok.pos, "href", c.literal())
+			c.inherit(child)
+			if c.isOp("{") {
+				c.next()
+				c.grammarContent(child, tokOp)
+			}
+			appendChild(el, child)
+		case tok.kind == tokCName:
+			// an annotation element
+			c.next()
+			c.skipBrackets()
+		case tok.kind == tokName || tok.kind == tokEscaped:
+			c.next()
+			child := elem("define", tok.pos, "name", tok.text)
+			c.assign(child)
+			appendChild(el, appendChild(child, c.pattern()))
+		default:
+			c.fail(tok, "unexpected %s in grammar", tok)
+		}
+	}
+}
+
+func (c *compactParser) assign(el *xmltree.Element) {
+	tok := c.next()
+	switch {
+	case tok.kind == tokOp && tok.text == "=":
+	case tok.kind == tokOp && tok.text == "|=":
+		el.SetAttr("", "combine", "choice")
+	case tok.kind == tokOp && tok.text == "&=":
+		el.SetAttr("", "combine", "interleave")
+	default:
+		c.fail(tok, "expected an assignment, found %s", tok)
+	}
+}
+
+// inherit reads the optional inherit clause of an include or external
+// pattern, setting the namespace that unprefixed names in the
+// referenced schema inherit.
+func (c *compactParser) inherit(el *xmltree.Element) {
+	if !c.isKeyword("inherit") {
+		if c.hasDefault {
+			el.SetAttr("", "ns", c.defaultNS)
+		}
+		return
+	}
+	c.next()
+	c.expect("=")
+	tok := c.peek()
+	prefix := c.identifier()
+	uri, ok := c.namespaces[prefix]
+	if !ok {
+		c.fail(tok, "undeclared namespace prefix %s", prefix)
+	}
+	el.SetAttr("", "ns", uri)
+}
+
+var binaryOps = map[string]string{",": "group", "|": "choice", "&": "interleave"}
+
+func (c *compactParser) pattern() *xmltree.Element {
+	first := c.particle()
+	tok := c.peek()
+	kind, ok := binaryOps[tok.text]
+	if tok.kind != tokOp || !ok {
+		return first
+	}
+	el := appendChild(elem(kind, first.Start), first)
+	for c.isOp(tok.text) {
+		c.next()
+		appendChild(el, c.particle())
+	}
+	if next := c.peek(); next.kind == tokOp && binaryOps[next.text] != "" {
+		c.fail(next, "mixing %q and %q without parentheses", tok.text, next.text)
+	}
+	return el
+}
+
+var postfix = map[string]string{"?": "optional", "*": "zeroOrMore", "+": "oneOrMore"}
+
+func (c *compactParser) particle() *xmltree.Element {
+	p := c.primary()
+	c.skipFollowing()
+	if tok := c.peek(); tok.kind == tokOp && postfix[tok.text] != "" {
+		c.next()
+		p = appendChild(elem(postfix[tok.text], p.Start), p)
+		c.skipFollowing()
+	}
+	return p
+}
+
+func (c *compactParser) primary() *xmltree.Element {
+	c.skipAnnotations()
+	tok := c.next()
+	switch tok.kind {
+	case tokLiteral:
+		c.toks = append([]token{tok}, c.toks...)
+		el := elem("value", tok.pos)
+		el.Content = []byte(c.literal())
+		return el
+	case tokCName:
+		return c.datatype(tok)
+	case tokEscaped:
+		return elem("ref", tok.pos, "name", tok.text)
+	case tokOp:
+		if tok.text == "(" {
+			p := c.pattern()
+			c.expect(")")
+			return p
+		}
+	case tokName:
+		switch tok.text {
+		case "element", "attribute":
+			el := elem(tok.text, tok.pos)
+			appendChild(el, c.nameClass(tok.text == "attribute"))
+			c.expect("{")
+			appendChild(el, c.pattern())
+			c.expect("}")
+			return el
+		case "list", "mixed":
+			el := elem(tok.text, tok.pos)
+			c.expect("{")
+			appendChild(el, c.pattern())
+			c.expect("}")
+			return el
+		case "empty", "text", "notAllowed":
+			return elem(tok.text, tok.pos)
+		case "parent":
+			return elem("parentRef", tok.pos, "name", c.identifier())
+		case "external":
+			el := elem("externalRef", tok.pos, "href", c.literal())
+			c.inherit(el)
+			return el
+		case "grammar":
+			c.expect("{")
+			return c.grammarContent(elem("grammar", tok.pos), tokOp)
+		case "string", "token":
+			return c.datatype(tok)
+		}
+		if !keywords[tok.text] {
+			return elem("ref", tok.pos, "name", tok.text)
+		}
+	}
+	c.fail(tok, "unexpected %s", tok)
+	return nil
+}
+
+// datatype reads a value or data pattern whose datatype is tok.
+func (c *compactParser) datatype(tok token) *xmltree.Element {
+	library, local := "", tok.text
+	if tok.kind == tokCName {
+		i := strings.IndexByte(tok.text, ':')
+		var ok bool
+		if library, ok = c.datatypes[tok.text[:i]]; !ok {
+			c.fail(tok, "undeclared datatypes prefix %s", tok.text[:i])
+		}
+		local = tok.text[i+1:]
+	}
+	if c.peek().kind == tokLiteral {
+		el := elem("value", tok.pos, "type", local, "datatypeLibrary", library)
+		el.Content = []byte(c.literal())
+		return el
+	}
+	el := elem("data", tok.pos, "type", local, "datatypeLibrary", library)
+	if c.isOp("{") {
+		c.next()
+		for !c.isOp("}") {
+			c.skipAnnotations()
+			ptok := c.peek()
+			name := c.identifier()
+			c.expect("=")
+			param := elem("param", ptok.pos, "name", name)
+			param.Content = []byte(c.literal())
+			appendChild(el, param)
+		}
+		c.next()
+	}
+	if c.isOp("-") {
+		minus := c.next()
+		except := elem("except", minus.pos)
+		appendChild(el, appendChild(except, c.primary()))
+	}
+	return el
+}
+
+// nameClass reads the name class of an element or attribute pattern.
+func (c *compactParser) nameClass(attribute bool) *xmltree.Element {
+	first := c.basicNameClass(attribute)
+	if !c.isOp("|") {
+		return first
+	}
+	el := appendChild(elem("choice", first.Start), first)
+	for c.isOp("|") {
+		c.next()
+		appendChild(el, c.basicNameClass(attribute))
+	}
+	return el
+}
+
+func (c *compactParser) basicNameClass(attribute bool) *xmltree.Element {
+	c.skipAnnotations()
+	tok := c.next()
+	var el *xmltree.Element
+	switch tok.kind {
+	case tokName, tokEscaped:
+		el = elem("name", tok.pos)
+		if attribute {
+			el.SetAttr("", "ns", "")
+		} else if c.hasDefault {
+			el.SetAttr("", "ns", c.defaultNS)
+		}
+		el.Content = []byte(tok.text)
+	case tokCName:
+		i := strings.IndexByte(tok.text, ':')
+		uri, ok := c.namespaces[tok.text[:i]]
+		if !ok {
+			c.fail(tok, "undeclared namespace prefix %s", tok.text[:i])
+		}
+		el = elem("name", tok.pos, "ns", uri)
+		el.Content = []byte(tok.text[i+1:])
+	case tokNsName:
+		uri, ok := c.namespaces[tok.text]
+		if !ok {
+			c.fail(tok, "undeclared namespace prefix %s", tok.text)
+		}
+		el = elem("nsName", tok.pos, "ns", uri)
+		c.except(el, attribute)
+	case tokOp:
+		switch tok.text {
+		case "*":
+			el = elem("anyName", tok.pos)
+			c.except(el, attribute)
+		case "(":
+			el = c.nameClass(attribute)
+			c.expect(")")
+		}
+	}
+	if el == nil {
+		c.fail(tok, "expected a name class, found %s", tok)
+	}
+	c.skipFollowing()
+	return el
+}
+
+func (c *compactParser) except(el *xmltree.Element, attribute bool) {
+	if !c.isOp("-") {
+		return
+	}
+	tok := c.next()
+	appendChild(el, appendChild(elem("except", tok.pos), c.basicNameClass(attribute)))
+}
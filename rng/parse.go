@@ -0,0 +1,606 @@
+package rng
+
+import (
+	"encoding/xml"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/m29h/go-xml/xmltree"
+)
+
+type parser struct {
+	opts    *Options
+	compact bool
+	g       *Grammar
+	// global names of definitions that are in use
+	used map[string]bool
+	refs []pendingRef
+	// locations of the schema being loaded, to detect loops
+	loading []string
+	depth   int
+}
+
+// A scope holds the definitions of a grammar.
+type scope struct {
+	parent *scope
+	// definitions, by their local names. The start pattern is
+	// stored with an empty name.
+	defs map[string]*define
+}
+
+type define struct {
+	global  string
+	combine string
+}
+
+// A pendingRef is a ref or parentRef pattern whose definition has
+// not been resolved yet, because it may come later in the grammar.
+type pendingRef struct {
+	pattern *Pattern
+	scope   *scope
+	name    string
+	loc     string
+}
+
+// context holds the values inherited by a pattern from the elements
+// surrounding it.
+type context struct {
+	ns, datatypes string
+	scope         *scope
+	// location of the current schema, and whether it is in the
+	// compact syntax
+	base    string
+	compact bool
+}
+
+func newParser(opts *Options, compact bool) *parser {
+	return &parser{
+		opts:    opts,
+		compact: compact,
+		g:       &Grammar{Defines: make(map[string]*Pattern)},
+		used:    make(map[string]bool),
+	}
+}
+
+func (p *parser) parse(data []byte) (*Grammar, error) {
+	root, err := p.load(data, p.opts.Location, p.compact)
+	if err != nil {
+		return nil, err
+	}
+	ctx := context{scope: &scope{defs: make(map[string]*define)}, base: p.opts.Location, compact: p.compact}
+	ctx = ctx.inherit(root)
+	if root.Name == (xml.Name{Space: Namespace, Local: "grammar"}) {
+		// The start pattern of the outermost grammar is not a
+		// definition.
+		if err := p.grammarContent(root, ctx, nil); err != nil {
+			return nil, err
+		}
+		start, ok := ctx.scope.defs[""]
+		if !ok {
+			return nil, p.errorf(ctx, root, "grammar has no start pattern")
+		}
+		if err := p.resolveRefs(); err != nil {
+			return nil, err
+		}
+		p.g.Start = p.g.Defines[start.global]
+		delete(p.g.Defines, start.global)
+		return p.g, nil
+	}
+	start, err := p.pattern(root, ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.resolveRefs(); err != nil {
+		return nil, err
+	}
+	p.g.Start = start
+	return p.g, nil
+}
+
+// load parses a schema document, in the compact syntax if compact is
+// true.
+func (p *parser) load(data []byte, loc string, compact bool) (*xmltree.Element, error) {
+	var (
+		root *xmltree.Element
+		err  error
+	)
+	if compact {
+		root, err = compactToXML(data)
+	} else {
+		root, err = xmltree.Parse(data)
+	}
+	if err != nil {
+		if loc != "" {
+			return nil, fmt.Errorf("rng: %s: %w", loc, err)
+		}
+		return nil, fmt.Errorf("rng: %w", err)
+	}
+	if root.Name.Space != Namespace {
+		return nil, fmt.Errorf("rng: %s is not a RELAX NG schema", root.Name.Local)
+	}
+	return root, nil
+}
+
+// external loads the schema referenced by the href attribute of el.
+func (p *parser) external(el *xmltree.Element, ctx context) (*xmltree.Element, context, error) {
+	href := el.Attr("", "href")
+	if href == "" {
+		return nil, ctx, p.errorf(ctx, el, "%s has no href", el.Name.Local)
+	}
+	if !strings.Contains(href, ":") && !path.IsAbs(href) && ctx.base != "" {
+		href = path.Join(path.Dir(ctx.base), href)
+	}
+	if p.opts.Resolver == nil {
+		return nil, ctx, p.errorf(ctx, el, "loading %s: %w", href, ErrNoResolver)
+	}
+	for _, loc := range p.loading {
+		if loc == href {
+			return nil, ctx, p.errorf(ctx, el, "%s references itself", href)
+		}
+	}
+	if len(p.loading) > maxDepth {
+		return nil, ctx, p.errorf(ctx, el, "schema nested too deeply")
+	}
+	data, err := p.opts.Resolver(href)
+	if err != nil {
+		return nil, ctx, p.errorf(ctx, el, "loading %s: %w", href, err)
+	}
+	compact := ctx.compact
+	switch strings.ToLower(path.Ext(href)) {
+	case ".rnc":
+		compact = true
+	case ".rng":
+		compact = false
+	}
+	root, err := p.load(data, href, compact)
+	if err != nil {
+		return nil, ctx, err
+	}
+	ctx.base, ctx.compact = href, compact
+	return root, ctx.inherit(root), nil
+}
+
+func (p *parser) errorf(ctx context, el *xmltree.Element, format string, args ...interface{}) error {
+	prefix := "rng: "
+	if ctx.base != "" {
+		prefix += ctx.base + ":"
+	}
+	if el != nil && el.Start.Line > 0 {
+		prefix += fmt.Sprintf("%d:%d:", el.Start.Line, el.Start.Column)
+	}
+	if prefix != "rng: " {
+		prefix += " "
+	}
+	return fmt.Errorf(prefix+format, args...)
+}
+
+// inherit returns the context of the content of el.
+func (ctx context) inherit(el *xmltree.Element) context {
+	for _, a := range el.StartElement.Attr {
+		if a.Name.Space != "" {
+			continue
+		}
+		switch a.Name.Local {
+		case "ns":
+			ctx.ns = a.Value
+		case "datatypeLibrary":
+			ctx.datatypes = a.Value
+		}
+	}
+	return ctx
+}
+
+// children returns the child elements of el in the RELAX NG namespace.
+func children(el *xmltree.Element) []*xmltree.Element {
+	var result []*xmltree.Element
+	for i := range el.Children {
+		if el.Children[i].Name.Space == Namespace {
+			result = append(result, &el.Children[i])
+		}
+	}
+	return result
+}
+
+func combine(kind Kind, patterns []*Pattern) *Pattern {
+	if len(patterns) == 1 {
+		return patterns[0]
+	}
+	return &Pattern{Kind: kind, Children: patterns}
+}
+
+// patterns parses the child patterns of el.
+func (p *parser) patterns(el *xmltree.Element, ctx context) ([]*Pattern, error) {
+	var result []*Pattern
+	for _, child := range children(el) {
+		pat, err := p.pattern(child, ctx)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, pat)
+	}
+	if len(result) == 0 {
+		return nil, p.errorf(ctx, el, "%s has no content", el.Name.Local)
+	}
+	return result, nil
+}
+
+func (p *parser) group(el *xmltree.Element, ctx context) (*Pattern, error) {
+	patterns, err := p.patterns(el, ctx)
+	if err != nil {
+		return nil, err
+	}
+	return combine(Group, patterns), nil
+}
+
+func (p *parser) pattern(el *xmltree.Element, ctx context) (*Pattern, error) {
+	if p.depth++; p.depth > maxDepth {
+		return nil, p.errorf(ctx, el, "patterns nested too deeply")
+	}
+	defer func() { p.depth-- }()
+
+	ctx = ctx.inherit(el)
+	switch el.Name.Local {
+	case "element":
+		nc, content, err := p.named(el, ctx, true)
+		if err != nil {
+			return nil, err
+		}
+		group, err := p.patterns(content, ctx)
+		if err != nil {
+			return nil, err
+		}
+		return &Pattern{Kind: Element, Name: nc, Children: []*Pattern{combine(Group, group)}}, nil
+	case "attribute":
+		nc, content, err := p.named(el, ctx, false)
+		if err != nil {
+			return nil, err
+		}
+		value := &Pattern{Kind: Text}
+		if len(children(content)) > 0 {
+			if value, err = p.group(content, ctx); err != nil {
+				return nil, err
+			}
+		}
+		return &Pattern{Kind: Attribute, Name: nc, Children: []*Pattern{value}}, nil
+	case "group", "interleave", "choice":
+		patterns, err := p.patterns(el, ctx)
+		if err != nil {
+			return nil, err
+		}
+		kind := map[string]Kind{"group": Group, "interleave": Interleave, "choice": Choice}[el.Name.Local]
+		return combine(kind, patterns), nil
+	case "optional":
+		group, err := p.group(el, ctx)
+		if err != nil {
+			return nil, err
+		}
+		return &Pattern{Kind: Choice, Children: []*Pattern{group, {Kind: Empty}}}, nil
+	case "zeroOrMore", "oneOrMore":
+		group, err := p.group(el, ctx)
+		if err != nil {
+			return nil, err
+		}
+		result := &Pattern{Kind: OneOrMore, Children: []*Pattern{group}}
+		if el.Name.Local == "zeroOrMore" {
+			result = &Pattern{Kind: Choice, Children: []*Pattern{result, {Kind: Empty}}}
+		}
+		return result, nil
+	case "mixed":
+		group, err := p.group(el, ctx)
+		if err != nil {
+			return nil, err
+		}
+		return &Pattern{Kind: Interleave, Children: []*Pattern{group, {Kind: Text}}}, nil
+	case "list":
+		group, err := p.group(el, ctx)
+		if err != nil {
+			return nil, err
+		}
+		return &Pattern{Kind: List, Children: []*Pattern{group}}, nil
+	case "ref", "parentRef":
+		name := strings.TrimSpace(el.Attr("", "name"))
+		if name == "" {
+			return nil, p.errorf(ctx, el, "%s has no name", el.Name.Local)
+		}
+		sc := ctx.scope
+		if el.Name.Local == "parentRef" {
+			if sc = sc.parent; sc == nil {
+				return nil, p.errorf(ctx, el, "parentRef %s outside of a nested grammar", name)
+			}
+		}
+		ref := &Pattern{Kind: Ref}
+		p.refs = append(p.refs, pendingRef{ref, sc, name, p.location(ctx, el)})
+		return ref, nil
+	case "empty":
+		return &Pattern{Kind: Empty}, nil
+	case "text":
+		return &Pattern{Kind: Text}, nil
+	case "notAllowed":
+		return &Pattern{Kind: NotAllowed}, nil
+	case "value":
+		result := &Pattern{Kind: Value, Type: xml.Name{Local: "token"}, Value: string(el.Content)}
+		if t := strings.TrimSpace(el.Attr("", "type")); t != "" {
+			result.Type = xml.Name{Space: ctx.datatypes, Local: t}
+		}
+		return result, nil
+	case "data":
+		result := &Pattern{Kind: Data, Type: xml.Name{Space: ctx.datatypes, Local: strings.TrimSpace(el.Attr("", "type"))}}
+		for _, child := range children(el) {
+			switch child.Name.Local {
+			case "param":
+				result.Params = append(result.Params, Param{child.Attr("", "name"), string(child.Content)})
+			case "except":
+				except, err := p.patterns(child, ctx.inherit(child))
+				if err != nil {
+					return nil, err
+				}
+				result.Children = []*Pattern{combine(Choice, except)}
+			default:
+				return nil, p.errorf(ctx, child, "unexpected %s in data", child.Name.Local)
+			}
+		}
+		return result, nil
+	case "externalRef":
+		root, ext, err := p.external(el, ctx)
+		if err != nil {
+			return nil, err
+		}
+		p.loading = append(p.loading, ext.base)
+		defer func() { p.loading = p.loading[:len(p.loading)-1] }()
+		return p.pattern(root, ext)
+	case "grammar":
+		ctx.scope = &scope{parent: ctx.scope, defs: make(map[string]*define)}
+		if err := p.grammarContent(el, ctx, nil); err != nil {
+			return nil, err
+		}
+		start, ok := ctx.scope.defs[""]
+		if !ok {
+			return nil, p.errorf(ctx, el, "grammar has no start pattern")
+		}
+		return &Pattern{Kind: Ref, Ref: start.global}, nil
+	}
+	return nil, p.errorf(ctx, el, "unexpected %s", el.Name.Local)
+}
+
+func (p *parser) location(ctx context, el *xmltree.Element) string {
+	loc := ctx.base
+	if el.Start.Line > 0 {
+		loc += fmt.Sprintf(":%d:%d", el.Start.Line, el.Start.Column)
+	}
+	return loc
+}
+
+// named parses the name class of an element or attribute pattern,
+// returning the element holding its remaining content.
+func (p *parser) named(el *xmltree.Element, ctx context, isElement bool) (*NameClass, *xmltree.Element, error) {
+	content := *el
+	content.Children = nil
+	if qname := strings.TrimSpace(el.Attr("", "name")); qname != "" {
+		name := xml.Name{Local: qname}
+		if strings.Contains(qname, ":") {
+			var ok bool
+			if name, ok = el.ResolveNS(qname); !ok {
+				return nil, nil, p.errorf(ctx, el, "unbound prefix in %s", qname)
+			}
+		} else if isElement {
+			name.Space = ctx.ns
+		} else {
+			for _, a := range el.StartElement.Attr {
+				if a.Name == (xml.Name{Local: "ns"}) {
+					name.Space = a.Value
+				}
+			}
+		}
+		content.Children = el.Children
+		return &NameClass{Kind: Name, Name: name}, &content, nil
+	}
+	list := children(el)
+	if len(list) == 0 {
+		return nil, nil, p.errorf(ctx, el, "%s has no name", el.Name.Local)
+	}
+	nc, err := p.nameClass(list[0], ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, child := range list[1:] {
+		content.Children = append(content.Children, *child)
+	}
+	return nc, &content, nil
+}
+
+func (p *parser) nameClass(el *xmltree.Element, ctx context) (*NameClass, error) {
+	ctx = ctx.inherit(el)
+	except := func() (*NameClass, error) {
+		for _, child := range children(el) {
+			if child.Name.Local != "except" {
+				return nil, p.errorf(ctx, child, "unexpected %s in %s", child.Name.Local, el.Name.Local)
+			}
+			return p.nameChoice(child, ctx.inherit(child))
+		}
+		return nil, nil
+	}
+	switch el.Name.Local {
+	case "name":
+		qname := strings.TrimSpace(string(el.Content))
+		name := xml.Name{Space: ctx.ns, Local: qname}
+		if strings.Contains(qname, ":") {
+			var ok bool
+			if name, ok = el.ResolveNS(qname); !ok {
+				return nil, p.errorf(ctx, el, "unbound prefix in %s", qname)
+			}
+		}
+		return &NameClass{Kind: Name, Name: name}, nil
+	case "anyName":
+		ex, err := except()
+		if err != nil {
+			return nil, err
+		}
+		return &NameClass{Kind: AnyName, Except: ex}, nil
+	case "nsName":
+		ex, err := except()
+		if err != nil {
+			return nil, err
+		}
+		return &NameClass{Kind: NsName, Name: xml.Name{Space: ctx.ns}, Except: ex}, nil
+	case "choice":
+		return p.nameChoice(el, ctx)
+	}
+	return nil, p.errorf(ctx, el, "unexpected %s in name class", el.Name.Local)
+}
+
+func (p *parser) nameChoice(el *xmltree.Element, ctx context) (*NameClass, error) {
+	var list []*NameClass
+	for _, child := range children(el) {
+		nc, err := p.nameClass(child, ctx)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, nc)
+	}
+	switch len(list) {
+	case 0:
+		return nil, p.errorf(ctx, el, "empty name class")
+	case 1:
+		return list[0], nil
+	}
+	return &NameClass{Kind: NameChoice, Children: list}, nil
+}
+
+// grammarContent parses the start patterns and definitions in el,
+// except for those named in skip, which have been overridden.
+func (p *parser) grammarContent(el *xmltree.Element, ctx context, skip map[string]bool) error {
+	for _, child := range children(el) {
+		cctx := ctx.inherit(child)
+		switch child.Name.Local {
+		case "start", "define":
+			name := ""
+			if child.Name.Local == "define" {
+				if name = strings.TrimSpace(child.Attr("", "name")); name == "" {
+					return p.errorf(cctx, child, "define has no name")
+				}
+			}
+			if skip[name] {
+				continue
+			}
+			pat, err := p.group(child, cctx)
+			if err != nil {
+				return err
+			}
+			if err := p.define(cctx, child, name, pat); err != nil {
+				return err
+			}
+		case "div":
+			if err := p.grammarContent(child, cctx, skip); err != nil {
+				return err
+			}
+		case "include":
+			root, ext, err := p.external(child, cctx)
+			if err != nil {
+				return err
+			}
+			if root.Name.Local != "grammar" {
+				return p.errorf(cctx, child, "included schema %s is not a grammar", ext.base)
+			}
+			overrides := make(map[string]bool)
+			for name := range skip {
+				overrides[name] = true
+			}
+			definedIn(child, overrides)
+			p.loading = append(p.loading, ext.base)
+			err = p.grammarContent(root, ext, overrides)
+			p.loading = p.loading[:len(p.loading)-1]
+			if err != nil {
+				return err
+			}
+			if err := p.grammarContent(child, cctx, skip); err != nil {
+				return err
+			}
+		default:
+			return p.errorf(cctx, child, "unexpected %s in grammar", child.Name.Local)
+		}
+	}
+	return nil
+}
+
+// definedIn adds the names of the definitions in the content of an
+// include element to names.
+func definedIn(el *xmltree.Element, names map[string]bool) {
+	for _, child := range children(el) {
+		switch child.Name.Local {
+		case "start":
+			names[""] = true
+		case "define":
+			names[strings.TrimSpace(child.Attr("", "name"))] = true
+		case "div":
+			definedIn(child, names)
+		}
+	}
+}
+
+func (p *parser) define(ctx context, el *xmltree.Element, name string, pat *Pattern) error {
+	method := strings.TrimSpace(el.Attr("", "combine"))
+	var kind Kind
+	switch method {
+	case "":
+	case "choice":
+		kind = Choice
+	case "interleave":
+		kind = Interleave
+	default:
+		return p.errorf(ctx, el, "invalid combine method %q", method)
+	}
+	d, ok := ctx.scope.defs[name]
+	if !ok {
+		global := name
+		if global == "" {
+			global = "start"
+		}
+		for i := 2; p.used[global]; i++ {
+			global = fmt.Sprintf("%s_%d", name, i)
+			if name == "" {
+				global = fmt.Sprintf("start_%d", i)
+			}
+		}
+		p.used[global] = true
+		ctx.scope.defs[name] = &define{global: global, combine: method}
+		p.g.Defines[global] = pat
+		return nil
+	}
+	if method == "" && d.combine == "" {
+		if name == "" {
+			return p.errorf(ctx, el, "start defined more than once")
+		}
+		return p.errorf(ctx, el, "%s defined more than once", name)
+	}
+	if method != "" && d.combine != "" && method != d.combine {
+		return p.errorf(ctx, el, "conflicting combine methods for %s", name)
+	}
+	if method == "" {
+		method = d.combine
+		if method == "choice" {
+			kind = Choice
+		} else {
+			kind = Interleave
+		}
+	}
+	d.combine = method
+	prev := p.g.Defines[d.global]
+	p.g.Defines[d.global] = &Pattern{Kind: kind, Children: []*Pattern{prev, pat}}
+	return nil
+}
+
+func (p *parser) resolveRefs() error {
+	for _, ref := range p.refs {
+		d, ok := ref.scope.defs[ref.name]
+		if !ok {
+			if ref.loc != "" {
+				return fmt.Errorf("rng: %s: reference to undefined pattern %s", ref.loc, ref.name)
+			}
+			return fmt.Errorf("rng: reference to undefined pattern %s", ref.name)
+		}
+		ref.pattern.Ref = d.global
+	}
+	p.refs = nil
+	return nil
+}
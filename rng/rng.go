@@ -0,0 +1,210 @@
+// Package rng parses RELAX NG schema, in either the XML or the compact
+// syntax, and translates them to XML Schema.
+//
+// Schema are simplified as they are parsed, following section 4 of the
+// RELAX NG specification: optional, zeroOrMore and mixed patterns are
+// replaced with their equivalents in terms of choice, oneOrMore and
+// interleave, includes and external references are resolved, and the
+// definitions of nested grammars are renamed so that every definition
+// of a schema has a unique name. Annotations and foreign elements are
+// discarded. Included and external schema are parsed in the compact
+// syntax if their location ends in .rnc, in the XML syntax if it ends
+// in .rng, and in the syntax of the schema referencing them otherwise.
+//
+// The XSD and Schemas functions translate a Grammar to XML Schema, so
+// that Go types can be generated for it with the xsdgen package, which
+// does so for files ending in .rng and .rnc.
+//
+// https://relaxng.org/spec-20011203.html
+// https://relaxng.org/compact-20021121.html
+package rng
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+)
+
+const (
+	// The namespace of RELAX NG schema in the XML syntax.
+	Namespace = "http://relaxng.org/ns/structure/1.0"
+	// The datatype library of XML Schema.
+	XSDDatatypes = "http://www.w3.org/2001/XMLSchema-datatypes"
+)
+
+// A Grammar is a simplified RELAX NG schema.
+type Grammar struct {
+	// The pattern that matches valid documents.
+	Start *Pattern
+	// The definitions referenced by Ref patterns.
+	Defines map[string]*Pattern
+}
+
+// A Kind is the kind of a Pattern.
+type Kind int
+
+const (
+	Empty Kind = iota
+	NotAllowed
+	Text
+	// A value of a datatype. Type holds the datatype.
+	Data
+	// A fixed value of a datatype. Type holds the datatype, and Value
+	// the value.
+	Value
+	// A whitespace-separated list, whose tokens match the child
+	// pattern.
+	List
+	// An element whose name matches Name and whose attributes and
+	// content match the child pattern.
+	Element
+	// An attribute whose name matches Name and whose value matches
+	// the child pattern.
+	Attribute
+	// A sequence of the child patterns.
+	Group
+	// The child patterns, in any order.
+	Interleave
+	// Any one of the child patterns.
+	Choice
+	// One or more repetitions of the child pattern.
+	OneOrMore
+	// The definition Ref of the Grammar.
+	Ref
+)
+
+var kinds = [...]string{
+	Empty:      "empty",
+	NotAllowed: "notAllowed",
+	Text:       "text",
+	Data:       "data",
+	Value:      "value",
+	List:       "list",
+	Element:    "element",
+	Attribute:  "attribute",
+	Group:      "group",
+	Interleave: "interleave",
+	Choice:     "choice",
+	OneOrMore:  "oneOrMore",
+	Ref:        "ref",
+}
+
+func (k Kind) String() string {
+	if k >= 0 && int(k) < len(kinds) {
+		return kinds[k]
+	}
+	return fmt.Sprintf("Kind(%d)", int(k))
+}
+
+// A Pattern is a node in the pattern tree of a Grammar.
+type Pattern struct {
+	Kind Kind
+	// For Element and Attribute patterns, the names that match.
+	Name *NameClass
+	// The patterns that this pattern is composed of. Element,
+	// Attribute, List and OneOrMore patterns have exactly one child.
+	// A Data pattern may have one child, of values that are excluded.
+	Children []*Pattern
+	// For Ref patterns, the name of the definition.
+	Ref string
+	// For Data and Value patterns, the datatype. The Space of the
+	// name is the URI of the datatype library, which is empty for
+	// the built-in string and token types.
+	Type xml.Name
+	// For Value patterns, the value.
+	Value string
+	// For Data patterns, the parameters of the datatype, in order.
+	Params []Param
+}
+
+// A Param is a parameter of a datatype, such as a facet of an
+// XML Schema type.
+type Param struct {
+	Name, Value string
+}
+
+// A NameKind is the kind of a NameClass.
+type NameKind int
+
+const (
+	// A single name.
+	Name NameKind = iota
+	// Any name, except those matching Except.
+	AnyName
+	// Any name in the namespace of Name, except those matching
+	// Except.
+	NsName
+	// Any name that matches one of Children.
+	NameChoice
+)
+
+// A NameClass is a set of element or attribute names.
+type NameClass struct {
+	Kind     NameKind
+	Name     xml.Name
+	Except   *NameClass
+	Children []*NameClass
+}
+
+// Contains returns true if name is a member of the name class.
+func (nc *NameClass) Contains(name xml.Name) bool {
+	switch nc.Kind {
+	case Name:
+		return nc.Name == name
+	case AnyName:
+		return nc.Except == nil || !nc.Except.Contains(name)
+	case NsName:
+		return nc.Name.Space == name.Space && (nc.Except == nil || !nc.Except.Contains(name))
+	case NameChoice:
+		for _, c := range nc.Children {
+			if c.Contains(name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// A Resolver retrieves the content of a schema referenced by an
+// include or externalRef. The href is resolved against the location of
+// the referencing schema, if it is relative.
+type Resolver func(href string) ([]byte, error)
+
+// Options control the parsing of a schema.
+type Options struct {
+	// Resolver loads included and external schema. If it is nil,
+	// schema containing include or externalRef patterns cannot be
+	// parsed.
+	Resolver Resolver
+	// The location of the schema being parsed, which relative
+	// references are resolved against.
+	Location string
+}
+
+// ErrNoResolver is returned, possibly wrapped, when a schema contains
+// include or externalRef patterns and Options.Resolver is nil.
+var ErrNoResolver = errors.New("rng: no resolver for external schema")
+
+// maxDepth is the maximum nesting depth of patterns and included
+// schema.
+const maxDepth = 1000
+
+// Parse parses a RELAX NG schema in the XML syntax. The opts argument
+// may be nil.
+func Parse(data []byte, opts *Options) (*Grammar, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+	p := newParser(opts, false)
+	return p.parse(data)
+}
+
+// ParseCompact parses a RELAX NG schema in the compact syntax. The
+// opts argument may be nil.
+func ParseCompact(data []byte, opts *Options) (*Grammar, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+	p := newParser(opts, true)
+	return p.parse(data)
+}
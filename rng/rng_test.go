@@ -0,0 +1,362 @@
+package rng
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/m29h/go-xml/xsd"
+)
+
+// dump renders a grammar in a form that is easy to compare.
+func dump(g *Grammar) string {
+	var buf strings.Builder
+	buf.WriteString("start = " + dumpPattern(g.Start) + "\n")
+	names := make([]string, 0, len(g.Defines))
+	for name := range g.Defines {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		buf.WriteString(name + " = " + dumpPattern(g.Defines[name]) + "\n")
+	}
+	return buf.String()
+}
+
+func dumpPattern(p *Pattern) string {
+	switch p.Kind {
+	case Ref:
+		return p.Ref
+	case Element, Attribute:
+		return fmt.Sprintf("%s %s { %s }", p.Kind, dumpName(p.Name), dumpPattern(p.Children[0]))
+	case Data:
+		s := fmt.Sprintf("data(%s %s", p.Type.Space, p.Type.Local)
+		for _, param := range p.Params {
+			s += fmt.Sprintf(" %s=%q", param.Name, param.Value)
+		}
+		if len(p.Children) > 0 {
+			s += " - " + dumpPattern(p.Children[0])
+		}
+		return s + ")"
+	case Value:
+		return fmt.Sprintf("value(%s %s %q)", p.Type.Space, p.Type.Local, p.Value)
+	case Empty, Text, NotAllowed:
+		return p.Kind.String()
+	}
+	var list []string
+	for _, c := range p.Children {
+		list = append(list, dumpPattern(c))
+	}
+	return fmt.Sprintf("%s(%s)", p.Kind, strings.Join(list, ", "))
+}
+
+func dumpName(nc *NameClass) string {
+	var s string
+	switch nc.Kind {
+	case Name:
+		return "{" + nc.Name.Space + "}" + nc.Name.Local
+	case AnyName:
+		s = "*"
+	case NsName:
+		s = "{" + nc.Name.Space + "}*"
+	case NameChoice:
+		var list []string
+		for _, c := range nc.Children {
+			list = append(list, dumpName(c))
+		}
+		return "(" + strings.Join(list, "|") + ")"
+	}
+	if nc.Except != nil {
+		s += "-" + dumpName(nc.Except)
+	}
+	return s
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name, xml, compact string
+	}{
+		{
+			name: "grammar",
+			xml: `<grammar xmlns="http://relaxng.org/ns/structure/1.0"
+				xmlns:a="http://example.org/a"
+				ns="http://example.org/doc"
+				datatypeLibrary="http://www.w3.org/2001/XMLSchema-datatypes">
+				<start><ref name="doc"/></start>
+				<define name="doc">
+					<element name="doc">
+						<optional><attribute name="a:lang"/></optional>
+						<zeroOrMore><ref name="para"/></zeroOrMore>
+					</element>
+				</define>
+				<define name="para">
+					<element name="para">
+						<attribute name="n"><data type="integer"><param name="minInclusive">1</param></data></attribute>
+						<mixed><ref name="inline"/></mixed>
+					</element>
+				</define>
+				<define name="inline">
+					<choice>
+						<element><name>em</name><text/></element>
+						<element><anyName><except><nsName ns="http://example.org/a"/></except></anyName><empty/></element>
+					</choice>
+				</define>
+				<define name="inline" combine="choice">
+					<element name="code"><list><oneOrMore><data type="token"/></oneOrMore></list></element>
+				</define>
+			</grammar>`,
+			compact: `
+				# comments and annotations are ignored
+				default namespace = "http://example.org/doc"
+				namespace a = "http://example.org/a"
+				start = doc
+				## documentation
+				doc = element doc { attribute a:lang { text }?, para* }
+				para = [ a:note [ "x" ] ] element para {
+					attribute n { xsd:integer { minInclusive = "1" } },
+					mixed { inline }
+				}
+				inline = element em { text } | element * - a:* { empty }
+				inline |= element code { list { xsd:token+ } }`,
+		},
+		{
+			name: "nested grammar",
+			xml: `<grammar xmlns="http://relaxng.org/ns/structure/1.0">
+				<start><ref name="x"/></start>
+				<define name="x">
+					<element name="outer">
+						<grammar>
+							<start><ref name="x"/></start>
+							<define name="x">
+								<element name="inner"><parentRef name="y"/></element>
+							</define>
+						</grammar>
+					</element>
+				</define>
+				<define name="y"><value type="string">a</value></define>
+			</grammar>`,
+			compact: `
+				start = x
+				x = element outer {
+					grammar {
+						start = x
+						x = element inner { parent y }
+					}
+				}
+				y = string "a"`,
+		},
+		{
+			name: "element",
+			xml: `<element name="root" xmlns="http://relaxng.org/ns/structure/1.0">
+				<interleave>
+					<element name="a"><value>x y</value></element>
+					<element name="b"><data type="string"/></element>
+				</interleave>
+			</element>`,
+			compact: `element root { element a { "x" ~ " y" } & element b { string } }`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g1, err := Parse([]byte(tt.xml), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			g2, err := ParseCompact([]byte(tt.compact), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d1, d2 := dump(g1), dump(g2); d1 != d2 {
+				t.Errorf("XML syntax parsed as\n%s\ncompact syntax parsed as\n%s", d1, d2)
+			} else {
+				t.Logf("\n%s", d1)
+			}
+		})
+	}
+}
+
+func TestSimplify(t *testing.T) {
+	g, err := ParseCompact([]byte(`
+		start = x
+		x = element x { y? & z* }
+		y = element y { empty }
+		z = element z { empty }`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const want = "interleave(choice(y, empty), choice(oneOrMore(z), empty))"
+	if got := dumpPattern(g.Defines["x"].Children[0]); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	if g.Start.Kind != Ref || g.Start.Ref != "x" {
+		t.Errorf("start pattern is %s, want x", dumpPattern(g.Start))
+	}
+}
+
+func TestInclude(t *testing.T) {
+	files := map[string]string{
+		"schema/main.rnc": `
+			include "common.rnc" {
+				title = element heading { text }
+				start = element doc { title, external "body.rng" }
+			}`,
+		"schema/common.rnc": `
+			title = element title { text }
+			start = notAllowed`,
+		"schema/body.rng": `<element name="body" xmlns="http://relaxng.org/ns/structure/1.0"><text/></element>`,
+	}
+	var loaded []string
+	opts := &Options{
+		Location: "schema/main.rnc",
+		Resolver: func(href string) ([]byte, error) {
+			loaded = append(loaded, href)
+			if data, ok := files[href]; ok {
+				return []byte(data), nil
+			}
+			return nil, fmt.Errorf("%s not found", href)
+		},
+	}
+	g, err := ParseCompact([]byte(files["schema/main.rnc"]), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const want = "start = element {}doc { group(title, element {}body { text }) }\n" +
+		"title = element {}heading { text }\n"
+	if got := dump(g); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+	if want := []string{"schema/common.rnc", "schema/body.rng"}; fmt.Sprint(loaded) != fmt.Sprint(want) {
+		t.Errorf("loaded %v, want %v", loaded, want)
+	}
+
+	if _, err := ParseCompact([]byte(files["schema/main.rnc"]), nil); !errors.Is(err, ErrNoResolver) {
+		t.Errorf("got error %v without a resolver, want %v", err, ErrNoResolver)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	tests := []struct {
+		compact bool
+		schema  string
+		err     string
+	}{
+		{true, `start = x`, "undefined pattern x"},
+		{true, `start = element a { empty } x = text x = empty`, "x defined more than once"},
+		{true, `start = element a { b, c | d } b = empty c = empty d = empty`, "without parentheses"},
+		{true, `start = element p:a { empty }`, "undeclared namespace prefix p"},
+		{true, `start = element a { "x }`, "unterminated literal"},
+		{true, `start = element a { empty `, `expected "}"`},
+		{true, `start = element a { parent x }`, "outside of a nested grammar"},
+		{false, `<grammar xmlns="http://relaxng.org/ns/structure/1.0"/>`, "no start pattern"},
+		{false, `<element xmlns="http://relaxng.org/ns/structure/1.0"><name>a</name><foo/></element>`, "unexpected foo"},
+		{false, `<element name="a"/>`, "not a RELAX NG schema"},
+	}
+	for _, tt := range tests {
+		var err error
+		if tt.compact {
+			_, err = ParseCompact([]byte(tt.schema), nil)
+		} else {
+			_, err = Parse([]byte(tt.schema), nil)
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: got error %v, want %q", tt.schema, err, tt.err)
+		}
+	}
+}
+
+func TestSchemas(t *testing.T) {
+	const ns = "http://example.org/doc"
+	g, err := ParseCompact([]byte(`
+		default namespace = "http://example.org/doc"
+		namespace x = "http://example.org/x"
+		namespace xlink = "http://www.w3.org/1999/xlink"
+		start = doc
+		doc = element doc {
+			attribute version { xsd:decimal }?,
+			attribute xml:lang { text }?,
+			element title { text },
+			(element para { text } | element list { attribute xlink:href { xsd:anyURI }, item+ })*,
+			element x:extra { attribute x:role { "main" | "aside" }?, empty }?
+		}
+		item = element item { attribute kind { "a" | "b" }, text }
+		`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	schemas, err := Schemas(g)
+	if err != nil {
+		for _, doc := range XSD(g) {
+			t.Logf("%s", doc)
+		}
+		t.Fatal(err)
+	}
+	var types, xtypes map[xml.Name]xsd.Type
+	for _, s := range schemas {
+		switch s.TargetNS {
+		case ns:
+			types = s.Types
+		case "http://example.org/x":
+			xtypes = s.Types
+		}
+	}
+	doc, ok := types[xml.Name{Space: ns, Local: "doc"}].(*xsd.ComplexType)
+	if !ok {
+		t.Fatalf("no complex type for doc in %v", types)
+	}
+	want := map[xml.Name][2]bool{ // plural, optional
+		{Space: ns, Local: "title"}:                     {false, false},
+		{Space: ns, Local: "para"}:                      {true, true},
+		{Space: ns, Local: "list"}:                      {true, true},
+		{Space: "http://example.org/x", Local: "extra"}: {false, true},
+	}
+	for _, el := range doc.Elements {
+		w, ok := want[el.Name]
+		if !ok {
+			t.Errorf("unexpected element %v", el.Name)
+			continue
+		}
+		delete(want, el.Name)
+		if el.Plural != w[0] || el.Optional != w[1] {
+			t.Errorf("%s: plural, optional = %v, %v, want %v, %v",
+				el.Name.Local, el.Plural, el.Optional, w[0], w[1])
+		}
+	}
+	for name := range want {
+		t.Errorf("doc is missing element %v", name)
+	}
+	if len(doc.Attributes) != 2 || doc.Attributes[0].Name != (xml.Name{Local: "version"}) || !doc.Attributes[0].Optional {
+		t.Errorf("doc should have an optional, unqualified version attribute, has %+v", doc.Attributes)
+	} else if lang := doc.Attributes[1]; lang.Name != (xml.Name{Space: "http://www.w3.org/XML/1998/namespace", Local: "lang"}) || !lang.Optional {
+		t.Errorf("doc should have an optional xml:lang attribute, has %+v", lang)
+	}
+	list, ok := types[xml.Name{Space: ns, Local: "list"}].(*xsd.ComplexType)
+	if !ok {
+		t.Fatalf("no complex type for list")
+	}
+	href := xml.Name{Space: "http://www.w3.org/1999/xlink", Local: "href"}
+	if len(list.Attributes) != 1 || list.Attributes[0].Name != href || list.Attributes[0].Optional {
+		t.Errorf("list should have a required xlink:href attribute, has %+v", list.Attributes)
+	}
+	extra, ok := xtypes[xml.Name{Space: "http://example.org/x", Local: "extra"}].(*xsd.ComplexType)
+	if !ok {
+		t.Fatalf("no complex type for extra in %v", xtypes)
+	}
+	if len(extra.Attributes) != 1 || extra.Attributes[0].Name != (xml.Name{Space: "http://example.org/x", Local: "role"}) {
+		t.Errorf("extra should have an x:role attribute, has %+v", extra.Attributes)
+	} else if role, ok := extra.Attributes[0].Type.(*xsd.SimpleType); !ok || len(role.Restriction.Enum) != 2 {
+		t.Errorf("role attribute has type %#v, want enumeration", extra.Attributes[0].Type)
+	}
+	item, ok := types[xml.Name{Space: ns, Local: "item"}].(*xsd.ComplexType)
+	if !ok {
+		t.Fatalf("no complex type for item")
+	}
+	if len(item.Attributes) != 1 {
+		t.Fatalf("item has %d attributes, want 1", len(item.Attributes))
+	}
+	if kind, ok := item.Attributes[0].Type.(*xsd.SimpleType); !ok || len(kind.Restriction.Enum) != 2 {
+		t.Errorf("kind attribute has type %#v, want enumeration", item.Attributes[0].Type)
+	}
+}
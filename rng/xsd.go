@@ -0,0 +1,781 @@
+package rng
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"sort"
+
+	"github.com/m29h/go-xml/xsd"
+)
+
+const schemaNS = "http://www.w3.org/2001/XMLSchema"
+
+// XSD translates g to XML Schema documents, one for each namespace
+// of the elements declared in g. The documents are meant to be parsed
+// together, and do not have schemaLocation hints for each other.
+//
+// Each element pattern becomes a complex type, named after the element,
+// or after its definition or a numbered variant if the name is in use
+// by another element pattern. Elements whose content is text or a
+// single datatype become elements of that type. Choice patterns become
+// xs:choice groups, and interleave patterns become xs:all groups where
+// XML Schema allows it, or sequences otherwise. The minOccurs and
+// maxOccurs of each element reflect the patterns that surround it, and
+// an element that may occur more than once in any branch of a content
+// model is repeatable. Elements matching a name class other than a
+// single name become wildcards. Attributes without a namespace are
+// declared locally. Attributes in a namespace are declared globally in
+// the document for that namespace and referenced from there; those in
+// the XML namespace refer to the declarations of the built-in xml.xsd.
+// Attributes whose name class is not a name are dropped. Datatypes from libraries other than the XML Schema datatypes
+// are translated to xs:string.
+func XSD(g *Grammar) [][]byte {
+	t := &translator{
+		g:        g,
+		types:    make(map[*Pattern]xml.Name),
+		models:   make(map[*Pattern]*model),
+		used:     make(map[xml.Name]bool),
+		prefixes: make(map[string]string),
+		docs:     make(map[string]*schemaDoc),
+	}
+	t.discover()
+	t.name()
+	return t.emit()
+}
+
+// Schemas translates g to XML Schema with the XSD function and parses
+// the result. The returned slice also contains the schema of the
+// built-in XML Schema types, as with xsd.Parse.
+func Schemas(g *Grammar) ([]xsd.Schema, error) {
+	return xsd.Parse(XSD(g)...)
+}
+
+type translator struct {
+	g *Grammar
+	// element patterns, in the order they were found
+	elements []*Pattern
+	// element patterns that may be the document element
+	top    []*Pattern
+	types  map[*Pattern]xml.Name
+	models map[*Pattern]*model
+	used   map[xml.Name]bool
+	// namespace prefixes of the schema documents
+	prefixes map[string]string
+	docs     map[string]*schemaDoc
+}
+
+type schemaDoc struct {
+	ns   string
+	body bytes.Buffer
+	// names of top-level elements
+	elements map[string]bool
+	// global attribute declarations, and their names
+	attrDecls  bytes.Buffer
+	attributes map[string]bool
+	// namespaces referenced from the document
+	imports map[string]bool
+}
+
+// a model is the analysed content of an element pattern.
+type model struct {
+	attrs []attr
+	root  *node
+	text  bool
+	// data, value and list patterns, and groups of them
+	values []*Pattern
+}
+
+type attr struct {
+	name     xml.Name
+	value    *Pattern
+	optional bool
+}
+
+type nodeKind int
+
+const (
+	leaf nodeKind = iota
+	wildcard
+	seq
+	choice
+	all
+)
+
+// a node is a particle of a content model.
+type node struct {
+	kind nodeKind
+	// for leaf nodes, the element pattern and its name. For
+	// wildcards, the namespace, if the wildcard is limited to one.
+	el       *Pattern
+	name     xml.Name
+	optional bool
+	plural   bool
+	children []*node
+}
+
+// elementsIn calls fn with each element pattern reachable from p,
+// without entering the content of element patterns.
+func (t *translator) elementsIn(p *Pattern, fn func(*Pattern), visiting map[string]bool) {
+	switch p.Kind {
+	case Element:
+		fn(p)
+	case Ref:
+		if visiting[p.Ref] {
+			return
+		}
+		visiting[p.Ref] = true
+		if def := t.g.Defines[p.Ref]; def != nil {
+			t.elementsIn(def, fn, visiting)
+		}
+	case Attribute, List, Data:
+	default:
+		for _, c := range p.Children {
+			t.elementsIn(c, fn, visiting)
+		}
+	}
+}
+
+// discover finds the element patterns reachable from the start pattern.
+func (t *translator) discover() {
+	seen := make(map[*Pattern]bool)
+	add := func(p *Pattern) {
+		if !seen[p] {
+			seen[p] = true
+			t.elements = append(t.elements, p)
+		}
+	}
+	if t.g.Start != nil {
+		t.elementsIn(t.g.Start, func(p *Pattern) {
+			if !seen[p] {
+				t.top = append(t.top, p)
+			}
+			add(p)
+		}, make(map[string]bool))
+	}
+	for i := 0; i < len(t.elements); i++ {
+		t.elementsIn(t.elements[i].Children[0], add, make(map[string]bool))
+	}
+}
+
+// name chooses type names for the element patterns, and analyses
+// their content.
+func (t *translator) name() {
+	defineOf := make(map[*Pattern]string)
+	names := make([]string, 0, len(t.g.Defines))
+	for name := range t.g.Defines {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if def := t.g.Defines[name]; def.Kind == Element {
+			if _, ok := defineOf[def]; !ok {
+				defineOf[def] = name
+			}
+		}
+	}
+	for _, el := range t.elements {
+		name, ok := firstName(el.Name)
+		if !ok {
+			continue
+		}
+		candidates := []string{name.Local}
+		if def, ok := defineOf[el]; ok {
+			candidates = append(candidates, def)
+		}
+		typ := xml.Name{Space: name.Space}
+		for _, c := range candidates {
+			if !t.used[xml.Name{Space: name.Space, Local: c}] {
+				typ.Local = c
+				break
+			}
+		}
+		for i := 2; typ.Local == ""; i++ {
+			if c := fmt.Sprintf("%s%d", name.Local, i); !t.used[xml.Name{Space: name.Space, Local: c}] {
+				typ.Local = c
+			}
+		}
+		t.used[typ] = true
+		t.types[el] = typ
+		t.docFor(typ.Space)
+
+		m := &model{}
+		m.root = t.content(m, el.Children[0], false, false, make(map[string]bool))
+		t.models[el] = m
+	}
+}
+
+// firstName returns the first name of a name class that matches
+// single names.
+func firstName(nc *NameClass) (xml.Name, bool) {
+	switch nc.Kind {
+	case Name:
+		return nc.Name, true
+	case NameChoice:
+		for _, c := range nc.Children {
+			if name, ok := firstName(c); ok {
+				return name, true
+			}
+		}
+	}
+	return xml.Name{}, false
+}
+
+// isSimple returns true if p only matches text that is constrained by
+// datatypes or values.
+func (t *translator) isSimple(p *Pattern, visiting map[string]bool) bool {
+	switch p.Kind {
+	case Data, Value, List:
+		return true
+	case Choice, Group:
+		simple := false
+		for _, c := range p.Children {
+			if c.Kind == Empty {
+				continue
+			}
+			if !t.isSimple(c, visiting) {
+				return false
+			}
+			simple = true
+		}
+		return simple
+	case Ref:
+		if visiting[p.Ref] {
+			return false
+		}
+		visiting[p.Ref] = true
+		defer delete(visiting, p.Ref)
+		if def := t.g.Defines[p.Ref]; def != nil {
+			return t.isSimple(def, visiting)
+		}
+	}
+	return false
+}
+
+func (t *translator) content(m *model, p *Pattern, optional, plural bool, visiting map[string]bool) *node {
+	if t.isSimple(p, make(map[string]bool)) {
+		m.values = append(m.values, p)
+		return nil
+	}
+	switch p.Kind {
+	case Element:
+		return elementNode(p, p.Name, optional, plural)
+	case Attribute:
+		switch p.Name.Kind {
+		case Name:
+			m.attrs = append(m.attrs, attr{p.Name.Name, p.Children[0], optional})
+		case NameChoice:
+			for _, c := range p.Name.Children {
+				if c.Kind == Name {
+					m.attrs = append(m.attrs, attr{c.Name, p.Children[0], true})
+				}
+			}
+		}
+	case Text:
+		m.text = true
+	case Group, Interleave:
+		n := &node{kind: seq}
+		if p.Kind == Interleave {
+			n.kind = all
+		}
+		for _, c := range p.Children {
+			if child := t.content(m, c, optional, plural, visiting); child != nil {
+				n.children = append(n.children, child)
+			}
+		}
+		return simplify(n)
+	case Choice:
+		var members []*Pattern
+		for _, c := range p.Children {
+			if c.Kind == Empty {
+				optional = true
+			} else {
+				members = append(members, c)
+			}
+		}
+		if len(members) == 1 {
+			return t.content(m, members[0], optional, plural, visiting)
+		}
+		n := &node{kind: choice}
+		for _, c := range members {
+			if child := t.content(m, c, true, plural, visiting); child != nil {
+				n.children = append(n.children, child)
+			}
+		}
+		return simplify(n)
+	case OneOrMore:
+		return t.content(m, p.Children[0], optional, true, visiting)
+	case Ref:
+		if visiting[p.Ref] {
+			return nil
+		}
+		visiting[p.Ref] = true
+		defer delete(visiting, p.Ref)
+		if def := t.g.Defines[p.Ref]; def != nil {
+			return t.content(m, def, optional, plural, visiting)
+		}
+	}
+	return nil
+}
+
+func elementNode(el *Pattern, nc *NameClass, optional, plural bool) *node {
+	switch nc.Kind {
+	case Name:
+		return &node{kind: leaf, el: el, name: nc.Name, optional: optional, plural: plural}
+	case NsName:
+		return &node{kind: wildcard, name: nc.Name, optional: optional, plural: plural}
+	case NameChoice:
+		n := &node{kind: choice}
+		for _, c := range nc.Children {
+			n.children = append(n.children, elementNode(el, c, true, plural))
+		}
+		return n
+	}
+	return &node{kind: wildcard, name: xml.Name{Local: "*"}, optional: optional, plural: plural}
+}
+
+func simplify(n *node) *node {
+	switch len(n.children) {
+	case 0:
+		return nil
+	case 1:
+		return n.children[0]
+	}
+	return n
+}
+
+// maxCount returns the number of times an element called name may
+// occur in n, up to 2.
+func maxCount(n *node, name xml.Name) int {
+	count := 0
+	switch n.kind {
+	case leaf:
+		if n.name == name {
+			count = 1
+			if n.plural {
+				count = 2
+			}
+		}
+	case choice:
+		for _, c := range n.children {
+			if m := maxCount(c, name); m > count {
+				count = m
+			}
+		}
+	default:
+		for _, c := range n.children {
+			count += maxCount(c, name)
+		}
+	}
+	if count > 2 {
+		count = 2
+	}
+	return count
+}
+
+func (t *translator) docFor(ns string) *schemaDoc {
+	doc, ok := t.docs[ns]
+	if !ok {
+		doc = &schemaDoc{
+			ns:         ns,
+			elements:   make(map[string]bool),
+			attributes: make(map[string]bool),
+			imports:    make(map[string]bool),
+		}
+		t.docs[ns] = doc
+		if ns != "" {
+			t.prefixes[ns] = fmt.Sprintf("ns%d", len(t.prefixes)+1)
+		}
+	}
+	return doc
+}
+
+// qname returns the QName of name in the schema documents.
+func (t *translator) qname(doc *schemaDoc, name xml.Name) string {
+	switch name.Space {
+	case "":
+		return name.Local
+	case schemaNS:
+		return "xs:" + name.Local
+	case xmlNS:
+		doc.imports[xmlNS] = true
+		return "xml:" + name.Local
+	}
+	if name.Space != doc.ns {
+		doc.imports[name.Space] = true
+	}
+	return t.prefixes[name.Space] + ":" + name.Local
+}
+
+// A simpleType is the XML Schema translation of a simple pattern.
+type simpleType struct {
+	base xml.Name
+	enum []string
+	list bool
+}
+
+func (s simpleType) builtin() bool {
+	return len(s.enum) == 0 && !s.list
+}
+
+func builtinType(name xml.Name) xml.Name {
+	switch name.Space {
+	case XSDDatatypes:
+		if _, err := xsd.ParseBuiltin(xml.Name{Space: schemaNS, Local: name.Local}); err == nil {
+			return xml.Name{Space: schemaNS, Local: name.Local}
+		}
+	case "":
+		if name.Local == "token" {
+			return xml.Name{Space: schemaNS, Local: "token"}
+		}
+	}
+	return xml.Name{Space: schemaNS, Local: "string"}
+}
+
+var stringType = simpleType{base: xml.Name{Space: schemaNS, Local: "string"}}
+
+func (t *translator) simpleOf(p *Pattern, visiting map[string]bool) simpleType {
+	switch p.Kind {
+	case Data:
+		return simpleType{base: builtinType(p.Type)}
+	case Value:
+		return simpleType{base: builtinType(p.Type), enum: []string{p.Value}}
+	case List:
+		item := p.Children[0]
+		for item.Kind == OneOrMore || item.Kind == Choice && len(item.Children) == 2 && item.Children[1].Kind == Empty {
+			item = item.Children[0]
+		}
+		s := t.simpleOf(item, visiting)
+		return simpleType{base: s.base, list: true}
+	case Choice:
+		var result simpleType
+		for _, c := range p.Children {
+			if c.Kind == Empty {
+				continue
+			}
+			s := t.simpleOf(c, visiting)
+			switch {
+			case result.base.Local == "":
+				result = s
+			case s.list || result.list || s.base != result.base:
+				return stringType
+			case len(s.enum) > 0 && len(result.enum) > 0:
+				result.enum = append(result.enum[:len(result.enum):len(result.enum)], s.enum...)
+			default:
+				result.enum = nil
+			}
+		}
+		if result.base.Local == "" {
+			return stringType
+		}
+		return result
+	case Ref:
+		if !visiting[p.Ref] && t.g.Defines[p.Ref] != nil {
+			visiting[p.Ref] = true
+			defer delete(visiting, p.Ref)
+			return t.simpleOf(t.g.Defines[p.Ref], visiting)
+		}
+	}
+	return stringType
+}
+
+// valueType returns the type of the text content of an element.
+func (t *translator) valueType(m *model) simpleType {
+	if len(m.values) == 1 && !m.text {
+		return t.simpleOf(m.values[0], make(map[string]bool))
+	}
+	return stringType
+}
+
+// simple returns true if elements matching el are translated to
+// elements of a simple type.
+func (t *translator) simple(el *Pattern) bool {
+	m := t.models[el]
+	return m.root == nil && len(m.attrs) == 0 && (m.text || len(m.values) > 0)
+}
+
+// typeRef returns the QName of the type of el.
+func (t *translator) typeRef(doc *schemaDoc, el *Pattern) string {
+	if t.simple(el) {
+		if s := t.valueType(t.models[el]); s.builtin() {
+			return t.qname(doc, s.base)
+		}
+	}
+	return t.qname(doc, t.types[el])
+}
+
+func (t *translator) emit() [][]byte {
+	for _, el := range t.elements {
+		if _, ok := t.types[el]; ok {
+			t.emitType(el)
+		}
+	}
+	for _, el := range t.top {
+		t.topLevel(el.Name, el)
+	}
+	namespaces := make([]string, 0, len(t.docs))
+	for ns := range t.docs {
+		namespaces = append(namespaces, ns)
+	}
+	sort.Strings(namespaces)
+	result := make([][]byte, 0, len(namespaces))
+	for _, ns := range namespaces {
+		doc := t.docs[ns]
+		var buf bytes.Buffer
+		w := writer{&buf}
+		buf.WriteString(`<xs:schema xmlns:xs="` + schemaNS + `"`)
+		for _, other := range namespaces {
+			if other != "" {
+				w.attr("xmlns:"+t.prefixes[other], other)
+			}
+		}
+		if ns != "" {
+			w.attr("targetNamespace", ns)
+			w.attr("elementFormDefault", "qualified")
+			w.attr("attributeFormDefault", "unqualified")
+		}
+		buf.WriteString(">\n")
+		imports := make([]string, 0, len(doc.imports))
+		for other := range doc.imports {
+			if other != ns {
+				imports = append(imports, other)
+			}
+		}
+		sort.Strings(imports)
+		for _, other := range imports {
+			buf.WriteString("  <xs:import")
+			if other != "" {
+				w.attr("namespace", other)
+			}
+			buf.WriteString("/>\n")
+		}
+		buf.Write(doc.body.Bytes())
+		buf.Write(doc.attrDecls.Bytes())
+		buf.WriteString("</xs:schema>\n")
+		result = append(result, buf.Bytes())
+	}
+	return result
+}
+
+type writer struct {
+	*bytes.Buffer
+}
+
+func (w writer) attr(name, value string) {
+	w.WriteString(" " + name + `="`)
+	xml.EscapeText(w, []byte(value))
+	w.WriteString(`"`)
+}
+
+// topLevel declares top-level elements for the names in nc.
+func (t *translator) topLevel(nc *NameClass, el *Pattern) {
+	switch nc.Kind {
+	case Name:
+		doc := t.docFor(nc.Name.Space)
+		if doc.elements[nc.Name.Local] {
+			return
+		}
+		doc.elements[nc.Name.Local] = true
+		w := writer{&doc.body}
+		w.WriteString("  <xs:element")
+		w.attr("name", nc.Name.Local)
+		w.attr("type", t.typeRef(doc, el))
+		w.WriteString("/>\n")
+	case NameChoice:
+		for _, c := range nc.Children {
+			t.topLevel(c, el)
+		}
+	}
+}
+
+func (t *translator) emitType(el *Pattern) {
+	name := t.types[el]
+	m := t.models[el]
+	doc := t.docFor(name.Space)
+	w := writer{&doc.body}
+	value := t.valueType(m)
+	if t.simple(el) {
+		if !value.builtin() {
+			t.simpleType(doc, &doc.body, name, value, "  ")
+		}
+		return
+	}
+	w.WriteString("  <xs:complexType")
+	w.attr("name", name.Local)
+	if m.text && m.root != nil {
+		w.attr("mixed", "true")
+	}
+	w.WriteString(">\n")
+	if m.root == nil && (m.text || len(m.values) > 0) {
+		base := value.base
+		if !value.builtin() {
+			base = name
+			for i := 1; t.used[base]; i++ {
+				base.Local = fmt.Sprintf("%sValue", name.Local)
+				if i > 1 {
+					base.Local += fmt.Sprint(i)
+				}
+			}
+			t.used[base] = true
+			defer t.simpleType(doc, &doc.body, base, value, "  ")
+		}
+		w.WriteString("    <xs:simpleContent>\n")
+		w.WriteString("      <xs:extension")
+		w.attr("base", t.qname(doc, base))
+		w.WriteString(">\n")
+		t.attributes(doc, m, "        ")
+		w.WriteString("      </xs:extension>\n")
+		w.WriteString("    </xs:simpleContent>\n")
+	} else {
+		if m.root != nil {
+			root := m.root
+			if root.kind == leaf || root.kind == wildcard {
+				root = &node{kind: seq, children: []*node{root}}
+			}
+			t.particle(doc, m.root, root, "    ", true)
+		}
+		t.attributes(doc, m, "    ")
+	}
+	w.WriteString("  </xs:complexType>\n")
+}
+
+func (t *translator) simpleType(doc *schemaDoc, buf *bytes.Buffer, name xml.Name, s simpleType, indent string) {
+	w := writer{buf}
+	w.WriteString(indent + "<xs:simpleType")
+	if name.Local != "" {
+		w.attr("name", name.Local)
+	}
+	w.WriteString(">\n")
+	if s.list {
+		w.WriteString(indent + "  <xs:list")
+		w.attr("itemType", t.qname(doc, s.base))
+		w.WriteString("/>\n")
+	} else {
+		w.WriteString(indent + "  <xs:restriction")
+		w.attr("base", t.qname(doc, s.base))
+		w.WriteString(">\n")
+		for _, v := range s.enum {
+			w.WriteString(indent + "    <xs:enumeration")
+			w.attr("value", v)
+			w.WriteString("/>\n")
+		}
+		w.WriteString(indent + "  </xs:restriction>\n")
+	}
+	w.WriteString(indent + "</xs:simpleType>\n")
+}
+
+func (t *translator) attributes(doc *schemaDoc, m *model, indent string) {
+	w := writer{&doc.body}
+	seen := make(map[xml.Name]bool)
+	for _, a := range m.attrs {
+		if seen[a.name] || a.name == (xml.Name{Local: "xmlns"}) {
+			continue
+		}
+		seen[a.name] = true
+		if a.name.Space != "" {
+			if a.name.Space != xmlNS {
+				t.globalAttribute(a)
+			}
+			w.WriteString(indent + "<xs:attribute")
+			w.attr("ref", t.qname(doc, a.name))
+			if !a.optional {
+				w.attr("use", "required")
+			}
+			w.WriteString("/>\n")
+			continue
+		}
+		s := t.simpleOf(a.value, make(map[string]bool))
+		w.WriteString(indent + "<xs:attribute")
+		w.attr("name", a.name.Local)
+		if s.builtin() {
+			w.attr("type", t.qname(doc, s.base))
+		}
+		if !a.optional {
+			w.attr("use", "required")
+		}
+		if s.builtin() {
+			w.WriteString("/>\n")
+			continue
+		}
+		w.WriteString(">\n")
+		t.simpleType(doc, &doc.body, xml.Name{}, s, indent+"  ")
+		w.WriteString(indent + "</xs:attribute>\n")
+	}
+}
+
+// globalAttribute declares the namespaced attribute a at the top level
+// of the document for its namespace, unless it is already declared.
+// The first pattern found for a name gives its type.
+func (t *translator) globalAttribute(a attr) {
+	doc := t.docFor(a.name.Space)
+	if doc.attributes[a.name.Local] {
+		return
+	}
+	doc.attributes[a.name.Local] = true
+	w := writer{&doc.attrDecls}
+	s := t.simpleOf(a.value, make(map[string]bool))
+	w.WriteString("  <xs:attribute")
+	w.attr("name", a.name.Local)
+	if s.builtin() {
+		w.attr("type", t.qname(doc, s.base))
+		w.WriteString("/>\n")
+		return
+	}
+	w.WriteString(">\n")
+	t.simpleType(doc, &doc.attrDecls, xml.Name{}, s, "    ")
+	w.WriteString("  </xs:attribute>\n")
+}
+
+// particle writes the content model n of an element whose content
+// model is root.
+func (t *translator) particle(doc *schemaDoc, root, n *node, indent string, outermost bool) {
+	w := writer{&doc.body}
+	switch n.kind {
+	case leaf, wildcard:
+		plural := n.plural
+		if n.kind == leaf && maxCount(root, n.name) > 1 {
+			plural = true
+		}
+		if n.kind == wildcard {
+			w.WriteString(indent + "<xs:any")
+			if n.name.Local == "*" {
+				w.attr("namespace", "##any")
+			} else if n.name.Space == "" {
+				w.attr("namespace", "##local")
+			} else {
+				w.attr("namespace", n.name.Space)
+			}
+			w.attr("processContents", "lax")
+		} else if n.name.Space == doc.ns {
+			w.WriteString(indent + "<xs:element")
+			w.attr("name", n.name.Local)
+			w.attr("type", t.typeRef(doc, n.el))
+		} else {
+			t.topLevel(&NameClass{Kind: Name, Name: n.name}, n.el)
+			w.WriteString(indent + "<xs:element")
+			w.attr("ref", t.qname(doc, n.name))
+		}
+		if n.optional {
+			w.attr("minOccurs", "0")
+		}
+		if plural {
+			w.attr("maxOccurs", "unbounded")
+		}
+		w.WriteString("/>\n")
+		return
+	}
+	group := map[nodeKind]string{seq: "xs:sequence", choice: "xs:choice", all: "xs:sequence"}[n.kind]
+	if n.kind == all && outermost {
+		group = "xs:all"
+		for _, c := range n.children {
+			if c.kind != leaf || c.plural || maxCount(root, c.name) > 1 {
+				group = "xs:sequence"
+			}
+		}
+	}
+	w.WriteString(indent + "<" + group + ">\n")
+	for _, c := range n.children {
+		t.particle(doc, root, c, indent+"  ", false)
+	}
+	w.WriteString(indent + "</" + group + ">\n")
+}
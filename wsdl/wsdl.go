@@ -200,8 +200,15 @@ func parseOperations(targetNS string, root, port *xmltree.Element) []Operation {
 
 // Parse reads the first WSDL definition from data.
 func Parse(data []byte) (*Definition, error) {
+	return ParseWithOptions(nil, data)
+}
+
+// ParseWithOptions is like Parse, but enforces the limits in opts,
+// for documents retrieved from untrusted sources. A nil opts uses
+// the default limits of xmltree.Parse.
+func ParseWithOptions(opts *xmltree.ParseOptions, data []byte) (*Definition, error) {
 	var def Definition
-	root, err := xmltree.Parse(data)
+	root, err := opts.Parse(data)
 	if err != nil {
 		return nil, err
 	}
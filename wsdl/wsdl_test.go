@@ -4,6 +4,8 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+
+	"github.com/m29h/go-xml/xmltree"
 )
 
 func glob(pat string) []string {
@@ -28,3 +30,16 @@ func TestParse(t *testing.T) {
 		t.Logf("\n%s", def)
 	}
 }
+
+func TestParseWithOptions(t *testing.T) {
+	for _, filename := range glob("testdata/*.wsdl") {
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = ParseWithOptions(&xmltree.ParseOptions{MaxElements: 10}, data)
+		if lerr, ok := err.(*xmltree.LimitError); !ok || lerr.Limit != xmltree.LimitElements {
+			t.Errorf("%s: got error %v, want element LimitError", filename, err)
+		}
+	}
+}
@@ -36,6 +36,7 @@ func (cfg *Config) GenCLI(arguments ...string) error {
 		xmlpkg       = fs.String("xmlpkg", "encoding/xml", "name of the go xml package to use")
 		verbose      = fs.Bool("v", false, "print verbose output")
 		debug        = fs.Bool("vv", false, "print debug output")
+		configFile   = fs.String("config", "", "read options from a JSON `file`; flags override the file")
 	)
 	fs.Var(&replaceRules, "r", "replacement rule 'regex -> repl' (can be used multiple times)")
 	fs.Var(&ports, "port", "gen code for this port (can be used multiple times)")
@@ -61,6 +62,17 @@ func (cfg *Config) GenCLI(arguments ...string) error {
 	} else if *verbose {
 		cfg.Option(LogLevel(1))
 	}
+	if *configFile != "" {
+		f, err := ReadConfigFile(*configFile)
+		if err != nil {
+			return err
+		}
+		opts, err := f.Options()
+		if err != nil {
+			return fmt.Errorf("%s: %v", *configFile, err)
+		}
+		cfg.Option(opts...)
+	}
 	if len(*packageName) > 0 {
 		cfg.Option(PackageName(*packageName))
 		cfg.XSDOption(xsdgen.PackageName(*packageName))
@@ -0,0 +1,90 @@
+package wsdlgen
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/m29h/go-xml/xsdgen"
+)
+
+// A ConfigFile describes a Config declaratively, for the -config flag
+// of the wsdlgen command. In addition to the settings for the
+// generation of type declarations described by xsdgen.ConfigFile, it
+// selects the ports to generate code for and the shape of the
+// generated functions. It is read from JSON by ReadConfigFile. The
+// packages field is rejected, as the wsdlgen package generates a
+// single package.
+type ConfigFile struct {
+	xsdgen.ConfigFile
+	// The first line of the package comment; see PackageComment.
+	Comment string `json:"comment,omitempty"`
+	// The ports to generate code for; see OnlyPorts.
+	Ports []string `json:"ports,omitempty"`
+	// See InputThreshold and OutputThreshold.
+	InputThreshold  *int `json:"inputThreshold,omitempty"`
+	OutputThreshold *int `json:"outputThreshold,omitempty"`
+}
+
+// ReadConfigFile reads a ConfigFile from the JSON file at path.
+// Unknown fields are reported as errors, to catch misspellings.
+func ReadConfigFile(path string) (*ConfigFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	var file ConfigFile
+	if err := dec.Decode(&file); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return &file, nil
+}
+
+// Options returns the Options described by the ConfigFile, or an
+// error if any of its values are invalid. The options for the xsdgen
+// package are applied to the Config's xsdgen.Config.
+func (f *ConfigFile) Options() ([]Option, error) {
+	if len(f.Packages) > 0 {
+		return nil, fmt.Errorf("wsdlgen: the packages field is not supported; " +
+			"all types are generated into a single package")
+	}
+	xsdOpts, err := f.ConfigFile.Options()
+	if err != nil {
+		return nil, err
+	}
+	var opts []Option
+	for _, o := range xsdOpts {
+		opts = append(opts, xsdOption(o))
+	}
+	if f.Package != "" {
+		opts = append(opts, PackageName(f.Package))
+	}
+	if f.Comment != "" {
+		opts = append(opts, PackageComment(f.Comment))
+	}
+	if len(f.Ports) > 0 {
+		opts = append(opts, OnlyPorts(f.Ports...))
+	}
+	if f.InputThreshold != nil {
+		opts = append(opts, InputThreshold(*f.InputThreshold))
+	}
+	if f.OutputThreshold != nil {
+		opts = append(opts, OutputThreshold(*f.OutputThreshold))
+	}
+	return opts, nil
+}
+
+// xsdOption wraps an xsdgen.Option so that it can be passed to the
+// Option method.
+func xsdOption(o xsdgen.Option) Option {
+	return func(cfg *Config) Option {
+		prev := cfg.XSDOption(o)
+		if prev == nil {
+			return nil
+		}
+		return xsdOption(prev)
+	}
+}
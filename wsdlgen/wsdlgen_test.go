@@ -2,6 +2,8 @@ package wsdlgen
 
 import (
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/m29h/go-xml/xsdgen"
@@ -54,3 +56,50 @@ func TestHello(t *testing.T) {
 func TestElementWisePart(t *testing.T) {
 	testGen(t, "testdata/ElementPart.wsdl")
 }
+
+func TestConfigFile(t *testing.T) {
+	conf := filepath.Join(t.TempDir(), "wsdlgen.json")
+	err := os.WriteFile(conf, []byte(`{
+		"package": "hello",
+		"comment": "Package hello is a client for the hello service.",
+		"replace": [{"pattern": "^Say", "replacement": "Send"}],
+		"inputThreshold": 1
+	}`), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := ReadConfigFile(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts, err := file.Options()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cfg Config
+	cfg.Option(DefaultOptions...)
+	cfg.Option(LogOutput(testLogger{t}))
+	cfg.XSDOption(xsdgen.DefaultOptions...)
+	cfg.Option(opts...)
+
+	src, err := cfg.GenSource("../testdata/hello.wsdl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"package hello", "Package hello is a client"} {
+		if !strings.Contains(string(src), want) {
+			t.Errorf("generated code does not contain %q:\n%s", want, src)
+		}
+	}
+	if cfg.maxArgs != 1 {
+		t.Errorf("input threshold is %d, want 1", cfg.maxArgs)
+	}
+
+	os.WriteFile(conf, []byte(`{"packages": {"urn:a": "example.org/a"}}`), 0666)
+	if file, err = ReadConfigFile(conf); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := file.Options(); err == nil {
+		t.Error("expected error for the packages field")
+	}
+}
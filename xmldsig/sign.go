@@ -0,0 +1,315 @@
+package xmldsig
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/m29h/go-xml/xmltree"
+)
+
+// A Signer creates XML signatures. The zero value of each field other
+// than Key selects a reasonable default, but NewSigner should be
+// preferred, as it selects exclusive canonicalization.
+type Signer struct {
+	// The private key used to sign. Must be an RSA or ECDSA key.
+	Key crypto.Signer
+	// Certificates to include in the KeyInfo of the signature. The
+	// certificate for Key should be first.
+	Certificates []*x509.Certificate
+	// The canonicalization method applied to the SignedInfo element.
+	Canonicalization xmltree.C14NMode
+	// The InclusiveNamespaces PrefixList used with exclusive
+	// canonicalization, for both SignedInfo and enveloped references.
+	InclusivePrefixes []string
+	// The algorithm identifier of the signature method. If empty,
+	// a method using SHA-256 is chosen based on the type of Key.
+	SignatureMethod string
+	// The algorithm identifier of the digest method used for
+	// references that do not specify one. If empty, SHA256 is used.
+	DigestMethod string
+	// The namespace prefix used for the elements of the signature.
+	// If empty, the XML Signature namespace is made the default
+	// namespace of the Signature element.
+	Prefix string
+}
+
+// NewSigner returns a Signer that uses key, and describes it with the
+// given certificates. The Signer uses exclusive canonicalization,
+// SHA-256 digests, and the "ds" prefix.
+func NewSigner(key crypto.Signer, certs ...*x509.Certificate) *Signer {
+	return &Signer{
+		Key:              key,
+		Certificates:     certs,
+		Canonicalization: xmltree.ExcC14N,
+		DigestMethod:     SHA256,
+		Prefix:           "ds",
+	}
+}
+
+// SignEnveloped signs el, and appends the resulting Signature element
+// to its children. If el has an ID attribute (ID, Id, id or xml:id),
+// the signature refers to el by its ID; otherwise it refers to the
+// entire document, and el should be the document element. The
+// reference uses the enveloped signature transform followed by the
+// Signer's canonicalization method.
+func (s *Signer) SignEnveloped(el *xmltree.Element) error {
+	ref := Reference{
+		Element:           el,
+		Transforms:        []string{EnvelopedSignature, s.Canonicalization.URI()},
+		InclusivePrefixes: s.InclusivePrefixes,
+	}
+	if id := elementID(el); id != "" {
+		ref.URI = "#" + id
+	}
+	sig, err := s.build([]Reference{ref})
+	if err != nil {
+		return err
+	}
+	// SignedInfo is canonicalized with the namespaces in scope
+	// at its final location.
+	rescope(sig, &el.Scope, 0)
+	if err := s.sign(sig); err != nil {
+		return err
+	}
+	nodes := el.ContentNodes()
+	el.Nodes = append(append(make([]xmltree.Node, 0, len(nodes)+1), nodes...), xmltree.Node{
+		Kind:  xmltree.ElementNode,
+		Child: len(el.Children),
+	})
+	el.Children = append(el.Children, *sig)
+	return nil
+}
+
+// SignDetached creates a Signature element over the given references.
+// The signature is not attached to any document. References to
+// Elements are canonicalized using exclusive canonicalization if they
+// do not specify any Transforms; references to Data are digested as-is.
+func (s *Signer) SignDetached(refs ...Reference) (*xmltree.Element, error) {
+	if len(refs) == 0 {
+		return nil, errors.New("xmldsig: no references to sign")
+	}
+	sig, err := s.build(refs)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.sign(sig); err != nil {
+		return nil, err
+	}
+	return sig, nil
+}
+
+// rescope adds outer to the Scope of el and its descendants, as if
+// el were a child of an element with the Scope outer.
+func rescope(el *xmltree.Element, outer *xmltree.Scope, depth int) {
+	if depth > 3000 {
+		return
+	}
+	el.Scope = *outer.JoinScope(&el.Scope)
+	for i := range el.Children {
+		rescope(&el.Children[i], outer, depth+1)
+	}
+}
+
+func (s *Signer) signatureMethod() (string, error) {
+	if s.SignatureMethod != "" {
+		return s.SignatureMethod, nil
+	}
+	if s.Key == nil {
+		return "", errors.New("xmldsig: no signing key")
+	}
+	switch s.Key.Public().(type) {
+	case *rsa.PublicKey:
+		return RSASHA256, nil
+	case *ecdsa.PublicKey:
+		return ECDSASHA256, nil
+	}
+	return "", fmt.Errorf("xmldsig: unsupported key type %T", s.Key.Public())
+}
+
+// build constructs a Signature element with an empty SignatureValue.
+func (s *Signer) build(refs []Reference) (*xmltree.Element, error) {
+	method, err := s.signatureMethod()
+	if err != nil {
+		return nil, err
+	}
+	var buf strings.Builder
+	q := func(local string) string {
+		if s.Prefix == "" {
+			return local
+		}
+		return s.Prefix + ":" + local
+	}
+	attr := func(name, value string) {
+		buf.WriteString(" " + name + `="`)
+		xml.EscapeText(&buf, []byte(value))
+		buf.WriteString(`"`)
+	}
+	inclusive := func(prefixes []string) {
+		if len(prefixes) > 0 {
+			buf.WriteString("<ec:InclusiveNamespaces")
+			attr("xmlns:ec", excC14NNamespace)
+			attr("PrefixList", strings.Join(prefixes, " "))
+			buf.WriteString("/>")
+		}
+	}
+
+	buf.WriteString("<" + q("Signature"))
+	if s.Prefix == "" {
+		attr("xmlns", Namespace)
+	} else {
+		attr("xmlns:"+s.Prefix, Namespace)
+	}
+	buf.WriteString("><" + q("SignedInfo") + "><" + q("CanonicalizationMethod"))
+	attr("Algorithm", s.Canonicalization.URI())
+	buf.WriteString(">")
+	if isExclusive(s.Canonicalization.URI()) {
+		inclusive(s.InclusivePrefixes)
+	}
+	buf.WriteString("</" + q("CanonicalizationMethod") + "><" + q("SignatureMethod"))
+	attr("Algorithm", method)
+	buf.WriteString("/>")
+
+	for _, ref := range refs {
+		value, err := s.digestReference(&ref)
+		if err != nil {
+			return nil, err
+		}
+		buf.WriteString("<" + q("Reference"))
+		attr("URI", ref.URI)
+		buf.WriteString(">")
+		if len(ref.Transforms) > 0 {
+			buf.WriteString("<" + q("Transforms") + ">")
+			for _, t := range ref.Transforms {
+				buf.WriteString("<" + q("Transform"))
+				attr("Algorithm", t)
+				buf.WriteString(">")
+				if isExclusive(t) {
+					inclusive(ref.InclusivePrefixes)
+				}
+				buf.WriteString("</" + q("Transform") + ">")
+			}
+			buf.WriteString("</" + q("Transforms") + ">")
+		}
+		buf.WriteString("<" + q("DigestMethod"))
+		attr("Algorithm", ref.DigestMethod)
+		buf.WriteString("/><" + q("DigestValue") + ">")
+		buf.WriteString(base64.StdEncoding.EncodeToString(value))
+		buf.WriteString("</" + q("DigestValue") + "></" + q("Reference") + ">")
+	}
+	buf.WriteString("</" + q("SignedInfo") + "><" + q("SignatureValue") + "></" + q("SignatureValue") + ">")
+
+	if len(s.Certificates) > 0 {
+		buf.WriteString("<" + q("KeyInfo") + "><" + q("X509Data") + ">")
+		for _, cert := range s.Certificates {
+			buf.WriteString("<" + q("X509Certificate") + ">")
+			buf.WriteString(base64.StdEncoding.EncodeToString(cert.Raw))
+			buf.WriteString("</" + q("X509Certificate") + ">")
+		}
+		buf.WriteString("</" + q("X509Data") + "></" + q("KeyInfo") + ">")
+	}
+	buf.WriteString("</" + q("Signature") + ">")
+	return xmltree.Parse([]byte(buf.String()))
+}
+
+// digestReference fills in the defaults for a Reference, and returns
+// the digest of the data it refers to.
+func (s *Signer) digestReference(ref *Reference) ([]byte, error) {
+	if ref.DigestMethod == "" {
+		ref.DigestMethod = s.DigestMethod
+		if ref.DigestMethod == "" {
+			ref.DigestMethod = SHA256
+		}
+	}
+	var t transformer
+	switch {
+	case ref.Element != nil:
+		if len(ref.Transforms) == 0 {
+			ref.Transforms = []string{xmltree.ExcC14N.URI()}
+		}
+		t.el = ref.Element
+		t.sameDocument = ref.URI == "" || strings.HasPrefix(ref.URI, "#")
+	case ref.Data != nil:
+		t.data = ref.Data
+	default:
+		return nil, fmt.Errorf("xmldsig: reference %q has no Element or Data", ref.URI)
+	}
+	for _, algorithm := range ref.Transforms {
+		// The Signature does not exist yet, so the enveloped
+		// signature transform has nothing to remove.
+		if err := t.apply(algorithm, ref.InclusivePrefixes, nil); err != nil {
+			return nil, err
+		}
+	}
+	return digest(ref.DigestMethod, t.octets())
+}
+
+// sign computes the SignatureValue of a Signature element.
+func (s *Signer) sign(sig *xmltree.Element) error {
+	signedInfo := child(sig, "SignedInfo")
+	value := child(sig, "SignatureValue")
+	if signedInfo == nil || value == nil {
+		return errors.New("xmldsig: malformed Signature element")
+	}
+	method, err := s.signatureMethod()
+	if err != nil {
+		return err
+	}
+	alg, ok := signatureMethods[method]
+	if !ok {
+		return fmt.Errorf("xmldsig: unsupported signature method %s", method)
+	}
+	h := alg.hash.New()
+	h.Write(xmltree.Canonicalize(signedInfo, s.Canonicalization, s.InclusivePrefixes...))
+	sum := h.Sum(nil)
+
+	raw, err := s.Key.Sign(rand.Reader, sum, alg.hash)
+	if err != nil {
+		return err
+	}
+	if alg.ecdsa {
+		pub, ok := s.Key.Public().(*ecdsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("xmldsig: %s requires an ECDSA key", method)
+		}
+		if raw, err = ecdsaRawSignature(raw, pub); err != nil {
+			return err
+		}
+	}
+	value.Content = []byte(base64.StdEncoding.EncodeToString(raw))
+	return nil
+}
+
+// XML signatures encode ECDSA signatures as the concatenation of
+// r and s, rather than in ASN.1.
+func ecdsaRawSignature(der []byte, pub *ecdsa.PublicKey) ([]byte, error) {
+	var sig struct{ R, S *big.Int }
+	if _, err := asn1.Unmarshal(der, &sig); err != nil {
+		return nil, err
+	}
+	size := (pub.Curve.Params().BitSize + 7) / 8
+	raw := make([]byte, 2*size)
+	sig.R.FillBytes(raw[:size])
+	sig.S.FillBytes(raw[size:])
+	return raw, nil
+}
+
+// child returns the first child of el in the XML Signature
+// namespace with the given local name.
+func child(el *xmltree.Element, local string) *xmltree.Element {
+	for i := range el.Children {
+		if el.Children[i].Name.Space == Namespace && el.Children[i].Name.Local == local {
+			return &el.Children[i]
+		}
+	}
+	return nil
+}
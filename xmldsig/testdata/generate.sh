@@ -0,0 +1,73 @@
+#!/bin/sh
+# generate.sh creates the interoperability test data for the xmldsig
+# package. The signatures are made with libxml2 (xmllint) for
+# canonicalization and OpenSSL for digests and RSA signatures, so
+# they do not depend on the xmldsig or xmltree packages.
+#
+# Each invoice-*.xml file is signed with a new key, whose self-signed
+# certificate is written to cert.pem and included in KeyInfo. The
+# tampered-*.xml files are copies with a changed total.
+set -e
+cd "$(dirname "$0")"
+tmp=$(mktemp -d)
+trap 'rm -rf "$tmp"' EXIT
+
+openssl req -x509 -newkey rsa:2048 -nodes -days 36500 \
+	-subj "/CN=xmldsig interop" -keyout "$tmp/key.pem" -out cert.pem 2>/dev/null
+certb64=$(openssl x509 -in cert.pem -outform der | openssl base64 -A)
+
+b64sha256() { openssl dgst -sha256 -binary | openssl base64 -A; }
+
+# The invoice, with $1 before its end tag. xmllint always keeps
+# comments, so the comment is removed before computing the digest,
+# as the same-document reference URI="" requires.
+invoice() {
+	cat <<XML
+<inv:Invoice xmlns:inv="urn:example:invoice" xmlns:cac="urn:example:cac" xmlns:unused="urn:example:unused">
+  <!-- generated by generate.sh -->
+  <inv:ID>INV-1</inv:ID>
+  <cac:Party name="ACME &amp; Sons" id="p1">Road Runner <![CDATA[<Traps>]]> Inc.</cac:Party>
+  <inv:Total currency="EUR">100.00</inv:Total>
+$1</inv:Invoice>
+XML
+}
+
+# sign NAME C14N-OPTION C14N-URI PREFIX NSDECLS
+#
+# NSDECLS are the namespace declarations in scope for SignedInfo, which
+# inclusive canonicalization renders on it.
+sign() {
+	name=$1 opt=$2 uri=$3 p=$4 nsdecls=$5
+	# The enveloped signature transform removes the Signature
+	# element, but not the line break after it.
+	invoice "
+" | sed 's|<!--.*-->||' >"$tmp/unsigned.xml"
+	digest=$(xmllint "$opt" "$tmp/unsigned.xml" | b64sha256)
+	signedinfo="<${p}SignedInfo>
+    <${p}CanonicalizationMethod Algorithm=\"$uri\"/>
+    <${p}SignatureMethod Algorithm=\"http://www.w3.org/2001/04/xmldsig-more#rsa-sha256\"/>
+    <${p}Reference URI=\"\">
+      <${p}Transforms>
+        <${p}Transform Algorithm=\"http://www.w3.org/2000/09/xmldsig#enveloped-signature\"/>
+        <${p}Transform Algorithm=\"$uri\"/>
+      </${p}Transforms>
+      <${p}DigestMethod Algorithm=\"http://www.w3.org/2001/04/xmlenc#sha256\"/>
+      <${p}DigestValue>$digest</${p}DigestValue>
+    </${p}Reference>
+  </${p}SignedInfo>"
+	echo "$signedinfo" | sed "1s|>| $nsdecls>|" >"$tmp/signedinfo.xml"
+	value=$(xmllint "$opt" "$tmp/signedinfo.xml" |
+		openssl dgst -sha256 -sign "$tmp/key.pem" | openssl base64 -A)
+	invoice "<${p}Signature xmlns${p:+:${p%:}}=\"http://www.w3.org/2000/09/xmldsig#\">
+  $signedinfo
+  <${p}SignatureValue>$value</${p}SignatureValue>
+  <${p}KeyInfo><${p}X509Data><${p}X509Certificate>$certb64</${p}X509Certificate></${p}X509Data></${p}KeyInfo>
+</${p}Signature>
+" >"invoice-$name.xml"
+	sed 's|>100.00<|>999.00<|' "invoice-$name.xml" >"tampered-$name.xml"
+}
+
+sign exc-c14n --exc-c14n "http://www.w3.org/2001/10/xml-exc-c14n#WithComments" "ds:" \
+	'xmlns:ds="http://www.w3.org/2000/09/xmldsig#"'
+sign c14n --c14n "http://www.w3.org/TR/2001/REC-xml-c14n-20010315#WithComments" "" \
+	'xmlns="http://www.w3.org/2000/09/xmldsig#" xmlns:cac="urn:example:cac" xmlns:inv="urn:example:invoice" xmlns:unused="urn:example:unused"'
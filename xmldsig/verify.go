@@ -0,0 +1,283 @@
+package xmldsig
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/subtle"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/m29h/go-xml/xmltree"
+)
+
+// ErrNotSigned is returned by Verify if a document does not contain
+// a Signature element.
+var ErrNotSigned = errors.New("xmldsig: no Signature element found")
+
+// A Verifier checks XML signatures. One of Key or Roots must be set;
+// a Verifier never trusts a key solely because it is present in the
+// KeyInfo of a signature.
+type Verifier struct {
+	// If set, signatures must be made with the private key
+	// corresponding to Key, and KeyInfo is ignored.
+	Key crypto.PublicKey
+	// If Key is not set, the first certificate in the X509Data of
+	// the signature's KeyInfo is used, and must chain to one of
+	// Roots. Any other certificates in X509Data are used as
+	// intermediates.
+	Roots *x509.CertPool
+	// The time at which certificates are checked for validity. If
+	// zero, the current time is used.
+	CurrentTime time.Time
+	// Resolve returns the data referred to by references that are
+	// not within the signed document, as in detached signatures.
+	// If nil, such references cannot be verified.
+	Resolve func(uri string) ([]byte, error)
+}
+
+// A Signature is the result of verifying an XML signature.
+type Signature struct {
+	// The Signature element.
+	Element *xmltree.Element
+	// The data covered by the signature. Callers should only
+	// trust data reachable from these references; for same-document
+	// references, the Element field refers to the element in the
+	// document that was verified.
+	References []Reference
+	// The certificate whose key verified the signature, if the key
+	// was taken from KeyInfo.
+	Certificate *x509.Certificate
+}
+
+// Verify checks the XML signature in doc. If doc is a Signature
+// element, it is verified as a detached signature; otherwise, the first
+// Signature element within doc is verified. Same-document references
+// are resolved within doc.
+func (v *Verifier) Verify(doc *xmltree.Element) (*Signature, error) {
+	sigEl := doc
+	if doc.Name.Space != Namespace || doc.Name.Local != "Signature" {
+		found := doc.Search(Namespace, "Signature")
+		if len(found) == 0 {
+			return nil, ErrNotSigned
+		}
+		sigEl = found[0]
+	}
+	signedInfo := child(sigEl, "SignedInfo")
+	valueEl := child(sigEl, "SignatureValue")
+	if signedInfo == nil || valueEl == nil {
+		return nil, errors.New("xmldsig: Signature is missing SignedInfo or SignatureValue")
+	}
+	c14nEl := child(signedInfo, "CanonicalizationMethod")
+	methodEl := child(signedInfo, "SignatureMethod")
+	if c14nEl == nil || methodEl == nil {
+		return nil, errors.New("xmldsig: SignedInfo is missing CanonicalizationMethod or SignatureMethod")
+	}
+	mode, ok := xmltree.C14NModeByURI(c14nEl.Attr("", "Algorithm"))
+	if !ok {
+		return nil, fmt.Errorf("xmldsig: unsupported canonicalization method %s", c14nEl.Attr("", "Algorithm"))
+	}
+	alg, ok := signatureMethods[methodEl.Attr("", "Algorithm")]
+	if !ok {
+		return nil, fmt.Errorf("xmldsig: unsupported signature method %s", methodEl.Attr("", "Algorithm"))
+	}
+	result := &Signature{Element: sigEl}
+	key, err := v.key(sigEl, result)
+	if err != nil {
+		return nil, err
+	}
+	value, err := decodeBase64(textOf(valueEl))
+	if err != nil {
+		return nil, fmt.Errorf("xmldsig: invalid SignatureValue: %v", err)
+	}
+	h := alg.hash.New()
+	h.Write(xmltree.Canonicalize(signedInfo, mode, inclusivePrefixes(c14nEl)...))
+	if err := verifySignature(key, alg, h.Sum(nil), value); err != nil {
+		return nil, err
+	}
+
+	// Only now that SignedInfo is known to be authentic are the
+	// references processed.
+	for i := range signedInfo.Children {
+		refEl := &signedInfo.Children[i]
+		if refEl.Name.Space != Namespace || refEl.Name.Local != "Reference" {
+			continue
+		}
+		ref, err := v.verifyReference(doc, sigEl, refEl)
+		if err != nil {
+			return nil, err
+		}
+		result.References = append(result.References, *ref)
+	}
+	if len(result.References) == 0 {
+		return nil, errors.New("xmldsig: SignedInfo contains no references")
+	}
+	return result, nil
+}
+
+func (v *Verifier) key(sigEl *xmltree.Element, result *Signature) (crypto.PublicKey, error) {
+	if v.Key != nil {
+		return v.Key, nil
+	}
+	if v.Roots == nil {
+		return nil, errors.New("xmldsig: Verifier has no Key or Roots")
+	}
+	var certs []*x509.Certificate
+	if keyInfo := child(sigEl, "KeyInfo"); keyInfo != nil {
+		for i := range keyInfo.Children {
+			data := &keyInfo.Children[i]
+			if data.Name.Space != Namespace || data.Name.Local != "X509Data" {
+				continue
+			}
+			for j := range data.Children {
+				el := &data.Children[j]
+				if el.Name.Space != Namespace || el.Name.Local != "X509Certificate" {
+					continue
+				}
+				der, err := decodeBase64(textOf(el))
+				if err != nil {
+					return nil, fmt.Errorf("xmldsig: invalid X509Certificate: %v", err)
+				}
+				cert, err := x509.ParseCertificate(der)
+				if err != nil {
+					return nil, err
+				}
+				certs = append(certs, cert)
+			}
+		}
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("xmldsig: no X509Certificate in KeyInfo")
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := certs[0].Verify(x509.VerifyOptions{
+		Roots:         v.Roots,
+		Intermediates: intermediates,
+		CurrentTime:   v.CurrentTime,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	if err != nil {
+		return nil, err
+	}
+	result.Certificate = certs[0]
+	return certs[0].PublicKey, nil
+}
+
+func verifySignature(key crypto.PublicKey, alg signatureMethod, sum, value []byte) error {
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		if alg.ecdsa {
+			break
+		}
+		if err := rsa.VerifyPKCS1v15(key, alg.hash, sum, value); err != nil {
+			return errors.New("xmldsig: signature verification failed")
+		}
+		return nil
+	case *ecdsa.PublicKey:
+		if !alg.ecdsa {
+			break
+		}
+		size := (key.Curve.Params().BitSize + 7) / 8
+		if len(value) != 2*size {
+			return errors.New("xmldsig: signature verification failed")
+		}
+		r := new(big.Int).SetBytes(value[:size])
+		s := new(big.Int).SetBytes(value[size:])
+		if !ecdsa.Verify(key, sum, r, s) {
+			return errors.New("xmldsig: signature verification failed")
+		}
+		return nil
+	default:
+		return fmt.Errorf("xmldsig: unsupported key type %T", key)
+	}
+	return fmt.Errorf("xmldsig: signature method does not match key type %T", key)
+}
+
+func (v *Verifier) verifyReference(doc, sigEl, refEl *xmltree.Element) (*Reference, error) {
+	ref := &Reference{URI: refEl.Attr("", "URI")}
+	var t transformer
+	switch {
+	case ref.URI == "":
+		ref.Element = doc
+	case strings.HasPrefix(ref.URI, "#"):
+		el, err := findID(doc, ref.URI[1:])
+		if err != nil {
+			return nil, err
+		}
+		ref.Element = el
+	default:
+		if v.Resolve == nil {
+			return nil, fmt.Errorf("xmldsig: cannot resolve reference %q", ref.URI)
+		}
+		data, err := v.Resolve(ref.URI)
+		if err != nil {
+			return nil, err
+		}
+		ref.Data = data
+	}
+	t.el, t.data = ref.Element, ref.Data
+	t.sameDocument = ref.Element != nil
+
+	if transforms := child(refEl, "Transforms"); transforms != nil {
+		for i := range transforms.Children {
+			el := &transforms.Children[i]
+			if el.Name.Space != Namespace || el.Name.Local != "Transform" {
+				continue
+			}
+			algorithm := el.Attr("", "Algorithm")
+			prefixes := inclusivePrefixes(el)
+			ref.Transforms = append(ref.Transforms, algorithm)
+			ref.InclusivePrefixes = append(ref.InclusivePrefixes, prefixes...)
+			if err := t.apply(algorithm, prefixes, sigEl); err != nil {
+				return nil, err
+			}
+		}
+	}
+	digestMethod := child(refEl, "DigestMethod")
+	digestValue := child(refEl, "DigestValue")
+	if digestMethod == nil || digestValue == nil {
+		return nil, fmt.Errorf("xmldsig: reference %q is missing DigestMethod or DigestValue", ref.URI)
+	}
+	ref.DigestMethod = digestMethod.Attr("", "Algorithm")
+	want, err := decodeBase64(textOf(digestValue))
+	if err != nil {
+		return nil, fmt.Errorf("xmldsig: invalid DigestValue: %v", err)
+	}
+	got, err := digest(ref.DigestMethod, t.octets())
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare(got, want) != 1 {
+		return nil, fmt.Errorf("xmldsig: digest mismatch for reference %q", ref.URI)
+	}
+	return ref, nil
+}
+
+// inclusivePrefixes returns the InclusiveNamespaces PrefixList of
+// a CanonicalizationMethod or Transform element.
+func inclusivePrefixes(el *xmltree.Element) []string {
+	for i := range el.Children {
+		c := &el.Children[i]
+		if c.Name.Space == excC14NNamespace && c.Name.Local == "InclusiveNamespaces" {
+			return strings.Fields(c.Attr("", "PrefixList"))
+		}
+	}
+	return nil
+}
+
+func textOf(el *xmltree.Element) string {
+	var buf strings.Builder
+	for _, n := range el.ContentNodes() {
+		if n.Kind == xmltree.TextNode || n.Kind == xmltree.CDATANode {
+			buf.Write(n.Data)
+		}
+	}
+	return buf.String()
+}
@@ -0,0 +1,275 @@
+// Package xmldsig creates and verifies XML Signatures.
+//
+// The xmldsig package implements a subset of the W3C XML Signature
+// Syntax and Processing recommendation, operating on documents parsed
+// with the xmltree package. Enveloped and detached signatures are
+// supported, using RSA or ECDSA keys with the SHA-2 family of digests.
+// Reference transforms are limited to the enveloped signature transform
+// and the canonicalization methods provided by xmltree.Canonicalize.
+// Signing keys may be described by X.509 certificates in KeyInfo.
+package xmldsig
+
+import (
+	"crypto"
+	_ "crypto/sha256" // register hash functions
+	_ "crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/m29h/go-xml/xmltree"
+)
+
+// Namespace is the XML namespace of the XML Signature vocabulary.
+const Namespace = "http://www.w3.org/2000/09/xmldsig#"
+
+// Algorithm identifiers for digest methods.
+const (
+	SHA256 = "http://www.w3.org/2001/04/xmlenc#sha256"
+	SHA384 = "http://www.w3.org/2001/04/xmldsig-more#sha384"
+	SHA512 = "http://www.w3.org/2001/04/xmlenc#sha512"
+)
+
+// Algorithm identifiers for signature methods.
+const (
+	RSASHA256   = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"
+	RSASHA384   = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha384"
+	RSASHA512   = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha512"
+	ECDSASHA256 = "http://www.w3.org/2001/04/xmldsig-more#ecdsa-sha256"
+	ECDSASHA384 = "http://www.w3.org/2001/04/xmldsig-more#ecdsa-sha384"
+	ECDSASHA512 = "http://www.w3.org/2001/04/xmldsig-more#ecdsa-sha512"
+)
+
+// EnvelopedSignature is the algorithm identifier of the enveloped
+// signature transform, which removes the Signature element from the
+// data being signed.
+const EnvelopedSignature = "http://www.w3.org/2000/09/xmldsig#enveloped-signature"
+
+// The namespace of the InclusiveNamespaces element used by the
+// exclusive canonicalization methods.
+const excC14NNamespace = "http://www.w3.org/2001/10/xml-exc-c14n#"
+
+var digestMethods = map[string]crypto.Hash{
+	SHA256: crypto.SHA256,
+	SHA384: crypto.SHA384,
+	SHA512: crypto.SHA512,
+}
+
+type signatureMethod struct {
+	hash  crypto.Hash
+	ecdsa bool
+}
+
+var signatureMethods = map[string]signatureMethod{
+	RSASHA256:   {crypto.SHA256, false},
+	RSASHA384:   {crypto.SHA384, false},
+	RSASHA512:   {crypto.SHA512, false},
+	ECDSASHA256: {crypto.SHA256, true},
+	ECDSASHA384: {crypto.SHA384, true},
+	ECDSASHA512: {crypto.SHA512, true},
+}
+
+// A Reference identifies data covered by a signature. When signing,
+// exactly one of Element and Data should be set. When returned from
+// Verify, Element is set for references to the signed document, and
+// Data for all other references.
+type Reference struct {
+	// The URI attribute of the reference. An empty URI refers to
+	// the entire document, and a URI of the form "#id" refers to
+	// the element with that ID.
+	URI string
+	// The element that is signed. The element is canonicalized
+	// according to Transforms before being digested.
+	Element *xmltree.Element
+	// Data that is signed as-is, for detached signatures over
+	// content that is not XML.
+	Data []byte
+	// Algorithm identifiers of the transforms applied to the
+	// Element. If empty when signing an Element, exclusive
+	// canonicalization is used.
+	Transforms []string
+	// Prefixes for the InclusiveNamespaces PrefixList of an
+	// exclusive canonicalization transform.
+	InclusivePrefixes []string
+	// The algorithm identifier of the digest method. If empty
+	// when signing, SHA256 is used.
+	DigestMethod string
+}
+
+// idAttrs are the unqualified attribute names that are considered
+// to hold IDs. The xml:id attribute is also recognized.
+var idAttrs = []string{"ID", "Id", "id"}
+
+func elementID(el *xmltree.Element) string {
+	for _, attr := range el.StartElement.Attr {
+		if attr.Name.Space == "http://www.w3.org/XML/1998/namespace" && attr.Name.Local == "id" {
+			return attr.Value
+		}
+		if attr.Name.Space != "" {
+			continue
+		}
+		for _, name := range idAttrs {
+			if attr.Name.Local == name {
+				return attr.Value
+			}
+		}
+	}
+	return ""
+}
+
+// findID returns the element in doc with the given ID. To thwart
+// signature wrapping attacks, it is an error for more than one
+// element to have the same ID.
+func findID(doc *xmltree.Element, id string) (*xmltree.Element, error) {
+	var found *xmltree.Element
+	candidates := append([]*xmltree.Element{doc}, doc.Flatten()...)
+	for _, el := range candidates {
+		if elementID(el) != id {
+			continue
+		}
+		if found != nil {
+			return nil, fmt.Errorf("xmldsig: ID %q is not unique", id)
+		}
+		found = el
+	}
+	if found == nil {
+		return nil, fmt.Errorf("xmldsig: no element with ID %q", id)
+	}
+	return found, nil
+}
+
+// withoutElement returns a copy of root with the element exclude
+// removed. Only the elements between root and exclude are copied.
+// If exclude is not a descendant of root, root is returned.
+func withoutElement(root, exclude *xmltree.Element) *xmltree.Element {
+	if root == exclude {
+		return nil
+	}
+	var walk func(el *xmltree.Element, depth int) (*xmltree.Element, bool)
+	walk = func(el *xmltree.Element, depth int) (*xmltree.Element, bool) {
+		if depth > 3000 {
+			return el, false
+		}
+		for i := range el.Children {
+			child := &el.Children[i]
+			var replacement *xmltree.Element
+			if child != exclude {
+				var found bool
+				if replacement, found = walk(child, depth+1); !found {
+					continue
+				}
+			}
+			dup := *el
+			dup.Children = append([]xmltree.Element(nil), el.Children...)
+			dup.Nodes = nil
+			for _, n := range el.ContentNodes() {
+				if n.Kind == xmltree.ElementNode && n.Child == i {
+					if replacement == nil {
+						continue
+					}
+					dup.Children[i] = *replacement
+				}
+				dup.Nodes = append(dup.Nodes, n)
+			}
+			if dup.Nodes == nil {
+				dup.Nodes = []xmltree.Node{}
+			}
+			return &dup, true
+		}
+		return el, false
+	}
+	result, _ := walk(root, 0)
+	return result
+}
+
+// A transformer applies the transforms of a Reference. The input is
+// either an element (a node-set in the terms of the XML Signature
+// recommendation) or octets.
+type transformer struct {
+	el   *xmltree.Element
+	data []byte
+	// a same-document reference, from which comments are removed
+	sameDocument bool
+}
+
+func (t *transformer) apply(algorithm string, prefixes []string, sig *xmltree.Element) error {
+	if algorithm == EnvelopedSignature {
+		if t.el == nil {
+			return errors.New("xmldsig: enveloped signature transform requires XML input")
+		}
+		t.el = withoutElement(t.el, sig)
+		if t.el == nil {
+			return errors.New("xmldsig: enveloped signature transform removes all data")
+		}
+		return nil
+	}
+	mode, ok := xmltree.C14NModeByURI(algorithm)
+	if !ok {
+		return fmt.Errorf("xmldsig: unsupported transform %s", algorithm)
+	}
+	if t.el == nil {
+		doc, err := xmltree.ParseDocument(t.data)
+		if err != nil {
+			return err
+		}
+		t.data = xmltree.CanonicalizeDocument(doc, mode, prefixes...)
+		return nil
+	}
+	if t.sameDocument {
+		mode = withoutComments(mode)
+	}
+	t.data = xmltree.Canonicalize(t.el, mode, prefixes...)
+	t.el = nil
+	return nil
+}
+
+// octets returns the result of the transforms. Elements that have not
+// been canonicalized are converted using Canonical XML 1.0.
+func (t *transformer) octets() []byte {
+	if t.el != nil {
+		t.data = xmltree.Canonicalize(t.el, xmltree.C14N10)
+		t.el = nil
+	}
+	return t.data
+}
+
+func withoutComments(mode xmltree.C14NMode) xmltree.C14NMode {
+	switch mode {
+	case xmltree.C14N10WithComments:
+		return xmltree.C14N10
+	case xmltree.C14N11WithComments:
+		return xmltree.C14N11
+	case xmltree.ExcC14NWithComments:
+		return xmltree.ExcC14N
+	}
+	return mode
+}
+
+func isExclusive(algorithm string) bool {
+	mode, ok := xmltree.C14NModeByURI(algorithm)
+	return ok && (mode == xmltree.ExcC14N || mode == xmltree.ExcC14NWithComments)
+}
+
+func digest(method string, data []byte) ([]byte, error) {
+	h, ok := digestMethods[method]
+	if !ok {
+		return nil, fmt.Errorf("xmldsig: unsupported digest method %s", method)
+	}
+	w := h.New()
+	w.Write(data)
+	return w.Sum(nil), nil
+}
+
+// decodeBase64 decodes the content of elements such as DigestValue,
+// which may contain white space.
+func decodeBase64(s string) ([]byte, error) {
+	s = strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '\t', '\r', '\n':
+			return -1
+		}
+		return r
+	}, s)
+	return base64.StdEncoding.DecodeString(s)
+}
@@ -0,0 +1,254 @@
+package xmldsig
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/m29h/go-xml/xmltree"
+)
+
+const invoice = `<inv:Invoice xmlns:inv="urn:example:invoice" xmlns:cac="urn:example:cac">
+  <!-- generated -->
+  <inv:ID>INV-1</inv:ID>
+  <cac:Party name="ACME &amp; Sons">Road Runner <![CDATA[<Traps>]]> Inc.</cac:Party>
+  <inv:Total currency="EUR">100.00</inv:Total>
+</inv:Invoice>`
+
+const assertion = `<Response xmlns="urn:example:protocol">
+  <Assertion xmlns="urn:example:assertion" ID="a1">
+    <Subject>alice</Subject>
+  </Assertion>
+</Response>`
+
+func selfSigned(t *testing.T, key crypto.Signer) (*x509.Certificate, *x509.CertPool) {
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "xmldsig test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return cert, pool
+}
+
+func keys(t *testing.T) map[string]crypto.Signer {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return map[string]crypto.Signer{"rsa": rsaKey, "ecdsa": ecKey}
+}
+
+func TestEnveloped(t *testing.T) {
+	for name, key := range keys(t) {
+		cert, roots := selfSigned(t, key)
+		for _, mode := range []xmltree.C14NMode{xmltree.ExcC14N, xmltree.C14N10, xmltree.C14N11WithComments} {
+			doc, err := xmltree.ParseDocument([]byte(invoice))
+			if err != nil {
+				t.Fatal(err)
+			}
+			signer := NewSigner(key, cert)
+			signer.Canonicalization = mode
+			if err := signer.SignEnveloped(doc.Root); err != nil {
+				t.Fatalf("%s %s: %v", name, mode, err)
+			}
+			v := &Verifier{Roots: roots}
+			if _, err := v.Verify(doc.Root); err != nil {
+				t.Errorf("%s %s: verifying in-memory document: %v", name, mode, err)
+			}
+
+			signed := xmltree.MarshalDocument(doc)
+			for _, parse := range []func([]byte) (*xmltree.Element, error){xmltree.Parse, parseDocumentRoot} {
+				root, err := parse(signed)
+				if err != nil {
+					t.Fatal(err)
+				}
+				sig, err := v.Verify(root)
+				if err != nil {
+					t.Errorf("%s %s: %v\n%s", name, mode, err, signed)
+					continue
+				}
+				if len(sig.References) != 1 || sig.References[0].Element != root || sig.Certificate == nil {
+					t.Errorf("%s %s: unexpected result %+v", name, mode, sig)
+				}
+			}
+
+			tampered := bytes.Replace(signed, []byte("100.00"), []byte("999.00"), 1)
+			root, err := xmltree.Parse(tampered)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := v.Verify(root); err == nil {
+				t.Errorf("%s %s: tampered document verified", name, mode)
+			}
+		}
+	}
+}
+
+func parseDocumentRoot(data []byte) (*xmltree.Element, error) {
+	doc, err := xmltree.ParseDocument(data)
+	if err != nil {
+		return nil, err
+	}
+	return doc.Root, nil
+}
+
+func TestEnvelopedID(t *testing.T) {
+	key := keys(t)["ecdsa"]
+	root, err := xmltree.Parse([]byte(assertion))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := NewSigner(key).SignEnveloped(&root.Children[0]); err != nil {
+		t.Fatal(err)
+	}
+	signed := xmltree.Marshal(root)
+	if root, err = xmltree.Parse(signed); err != nil {
+		t.Fatal(err)
+	}
+	v := &Verifier{Key: key.Public()}
+	sig, err := v.Verify(root)
+	if err != nil {
+		t.Fatalf("%v\n%s", err, signed)
+	}
+	if ref := sig.References[0]; ref.URI != "#a1" || ref.Element != &root.Children[0] {
+		t.Errorf("reference %q refers to %v", ref.URI, ref.Element)
+	}
+
+	// An attacker adds a second element with the same ID
+	wrapped := bytes.Replace(signed, []byte("<Response"),
+		[]byte(`<Response><Assertion xmlns="urn:example:assertion" ID="a1"><Subject>mallory</Subject></Assertion></Response><Response`), 1)
+	wrapped = append([]byte("<Wrapper>"), append(wrapped, "</Wrapper>"...)...)
+	if root, err = xmltree.Parse(wrapped); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := v.Verify(root); err == nil || !strings.Contains(err.Error(), "not unique") {
+		t.Errorf("expected duplicate ID error, got %v", err)
+	}
+}
+
+func TestDetached(t *testing.T) {
+	key := keys(t)["rsa"]
+	payload := []byte("not xml at all")
+	other := []byte(invoice)
+	sig, err := NewSigner(key).SignDetached(
+		Reference{URI: "payload.txt", Data: payload},
+		Reference{URI: "invoice.xml", Data: other, Transforms: []string{xmltree.C14N10.URI()}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string][]byte{"payload.txt": payload, "invoice.xml": other}
+	v := &Verifier{
+		Key:     key.Public(),
+		Resolve: func(uri string) ([]byte, error) { return files[uri], nil },
+	}
+	root, err := xmltree.Parse(xmltree.Marshal(sig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := v.Verify(root); err != nil {
+		t.Fatal(err)
+	}
+	files["payload.txt"] = []byte("changed")
+	if _, err := v.Verify(root); err == nil {
+		t.Error("signature verified over modified data")
+	}
+}
+
+func TestVerifierKeys(t *testing.T) {
+	ks := keys(t)
+	cert, _ := selfSigned(t, ks["rsa"])
+	_, otherRoots := selfSigned(t, ks["ecdsa"])
+	root, err := xmltree.Parse([]byte(invoice))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := NewSigner(ks["rsa"], cert).SignEnveloped(root); err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []*Verifier{
+		{},
+		{Roots: otherRoots},
+		{Key: ks["ecdsa"].Public()},
+	} {
+		if _, err := v.Verify(root); err == nil {
+			t.Errorf("verified with %+v", v)
+		}
+	}
+	unsigned, _ := xmltree.Parse([]byte(assertion))
+	if _, err := (&Verifier{Key: ks["rsa"].Public()}).Verify(unsigned); err != ErrNotSigned {
+		t.Errorf("got %v, want ErrNotSigned", err)
+	}
+}
+
+// The files in testdata were signed with xmllint and OpenSSL by
+// testdata/generate.sh, so they catch mistakes shared by Signer and
+// Verifier.
+func TestInterop(t *testing.T) {
+	data, err := os.ReadFile("testdata/cert.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		t.Fatal("no certificate in testdata/cert.pem")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	for _, v := range []*Verifier{
+		{Roots: roots, CurrentTime: cert.NotBefore.Add(time.Hour)},
+		{Key: cert.PublicKey},
+	} {
+		for _, name := range []string{"c14n", "exc-c14n"} {
+			for _, file := range []string{"invoice-" + name, "tampered-" + name} {
+				data, err := os.ReadFile("testdata/" + file + ".xml")
+				if err != nil {
+					t.Fatal(err)
+				}
+				root, err := xmltree.Parse(data)
+				if err != nil {
+					t.Fatal(err)
+				}
+				_, err = v.Verify(root)
+				if tampered := strings.HasPrefix(file, "tampered"); tampered && err == nil {
+					t.Errorf("%s: tampered document verified", file)
+				} else if !tampered && err != nil {
+					t.Errorf("%s: %v", file, err)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,545 @@
+package xmltree
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A C14NMode selects one of the W3C canonicalization algorithms
+// implemented by Canonicalize.
+type C14NMode int
+
+const (
+	// Canonical XML 1.0, without comments.
+	C14N10 C14NMode = iota
+	// Canonical XML 1.0, with comments.
+	C14N10WithComments
+	// Canonical XML 1.1, without comments.
+	C14N11
+	// Canonical XML 1.1, with comments.
+	C14N11WithComments
+	// Exclusive XML Canonicalization 1.0, without comments.
+	ExcC14N
+	// Exclusive XML Canonicalization 1.0, with comments.
+	ExcC14NWithComments
+)
+
+var c14nURIs = [...]string{
+	C14N10:              "http://www.w3.org/TR/2001/REC-xml-c14n-20010315",
+	C14N10WithComments:  "http://www.w3.org/TR/2001/REC-xml-c14n-20010315#WithComments",
+	C14N11:              "http://www.w3.org/2006/12/xml-c14n11",
+	C14N11WithComments:  "http://www.w3.org/2006/12/xml-c14n11#WithComments",
+	ExcC14N:             "http://www.w3.org/2001/10/xml-exc-c14n#",
+	ExcC14NWithComments: "http://www.w3.org/2001/10/xml-exc-c14n#WithComments",
+}
+
+// URI returns the algorithm identifier of a canonicalization method,
+// as used in XML signatures.
+func (m C14NMode) URI() string {
+	if m < 0 || int(m) >= len(c14nURIs) {
+		return ""
+	}
+	return c14nURIs[m]
+}
+
+func (m C14NMode) String() string {
+	switch m {
+	case C14N10:
+		return "C14N10"
+	case C14N10WithComments:
+		return "C14N10WithComments"
+	case C14N11:
+		return "C14N11"
+	case C14N11WithComments:
+		return "C14N11WithComments"
+	case ExcC14N:
+		return "ExcC14N"
+	case ExcC14NWithComments:
+		return "ExcC14NWithComments"
+	}
+	return "C14NMode(" + strconv.Itoa(int(m)) + ")"
+}
+
+// C14NModeByURI returns the canonicalization method identified by
+// uri. The second return value is false if uri does not identify a
+// method supported by Canonicalize.
+func C14NModeByURI(uri string) (C14NMode, bool) {
+	for m, s := range c14nURIs {
+		if s == uri {
+			return C14NMode(m), true
+		}
+	}
+	return 0, false
+}
+
+func (m C14NMode) comments() bool {
+	return m == C14N10WithComments || m == C14N11WithComments || m == ExcC14NWithComments
+}
+
+func (m C14NMode) exclusive() bool {
+	return m == ExcC14N || m == ExcC14NWithComments
+}
+
+// Canonicalize returns the canonical form of the document subset
+// consisting of el and all of its descendants, using the given
+// method. For the exclusive methods, inclusivePrefixes lists the
+// prefixes that are handled as in the inclusive methods (the
+// InclusiveNamespaces PrefixList); the default namespace is named
+// "#default". inclusivePrefixes is ignored by the other methods.
+//
+// Namespace declarations in the Scope of el are treated as if they
+// were declared by el's ancestors. The original prefixes of el and
+// its descendants are used where they are still in scope. Because an
+// Element does not record its ancestors, attributes in the xml
+// namespace declared by ancestors of el are not inherited; use
+// CanonicalizeSubset with InSubtree to canonicalize el as part of
+// its document.
+//
+// The content of elements is taken from Nodes, if present, or else
+// recovered from Content. If the Content of an Element is not
+// consistent with its Children, only its child elements are included.
+func Canonicalize(el *Element, mode C14NMode, inclusivePrefixes ...string) []byte {
+	var buf bytes.Buffer
+	if err := EncodeCanonical(&buf, el, mode, inclusivePrefixes...); err != nil {
+		// bytes.Buffer.Write should never return an error
+		panic(err)
+	}
+	return buf.Bytes()
+}
+
+// EncodeCanonical writes the canonical form of el and its descendants
+// to w. See Canonicalize for details. EncodeCanonical returns any errors
+// encountered writing to w.
+func EncodeCanonical(w io.Writer, el *Element, mode C14NMode, inclusivePrefixes ...string) error {
+	c := newCanonicalizer(w, mode, inclusivePrefixes)
+	c.element(el.XPathNode(), nil, 0)
+	return c.flush()
+}
+
+// CanonicalizeSubset returns the canonical form of a document subset:
+// the nodes of the document whose document element is root for which
+// include returns true. include is called with element, attribute,
+// text, comment and processing instruction nodes. The children of an
+// element that is not in the subset may still be in it. Namespace
+// nodes are not part of the XPathNode model, so the namespaces in scope
+// of an element in the subset are treated as if they were in it too.
+//
+// An element in the subset whose parent is not inherits attributes in
+// the xml namespace from its ancestors, up to the nearest one in the
+// subset. Canonical XML 1.0 inherits all of them. Canonical XML 1.1
+// inherits xml:lang and xml:space, and joins the xml:base values of
+// those ancestors with the element's own; xml:id is not inherited.
+// The exclusive methods inherit none.
+func CanonicalizeSubset(root *Element, include func(*XPathNode) bool, mode C14NMode, inclusivePrefixes ...string) []byte {
+	var buf bytes.Buffer
+	c := newCanonicalizer(&buf, mode, inclusivePrefixes)
+	c.include = include
+	c.element(root.XPathNode(), nil, 0)
+	if err := c.flush(); err != nil {
+		panic(err)
+	}
+	return buf.Bytes()
+}
+
+// InSubtree returns a function for CanonicalizeSubset that selects
+// el, which must be the document element or one of its descendants,
+// and all of the nodes it contains.
+func InSubtree(el *Element) func(*XPathNode) bool {
+	return func(n *XPathNode) bool {
+		for ; n != nil; n = n.parent {
+			if n.kind == ElementNode && n.el == el {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// CanonicalizeDocument returns the canonical form of an entire
+// document. Unlike Canonicalize, the processing instructions and (if
+// requested) comments outside of the document element are included.
+func CanonicalizeDocument(doc *Document, mode C14NMode, inclusivePrefixes ...string) []byte {
+	var buf bytes.Buffer
+	c := newCanonicalizer(&buf, mode, inclusivePrefixes)
+	seenRoot := false
+	for _, n := range doc.Nodes {
+		switch n.Kind {
+		case ElementNode:
+			if doc.Root != nil {
+				c.element(doc.Root.XPathNode(), nil, 0)
+				seenRoot = true
+			}
+			continue
+		case ProcInstNode:
+			if n.Target == "xml" {
+				continue
+			}
+		case CommentNode:
+			if !mode.comments() {
+				continue
+			}
+		default:
+			continue
+		}
+		if seenRoot {
+			c.w.WriteByte('\n')
+		}
+		c.node(n)
+		if !seenRoot {
+			c.w.WriteByte('\n')
+		}
+	}
+	if err := c.flush(); err != nil {
+		panic(err)
+	}
+	return buf.Bytes()
+}
+
+type canonicalizer struct {
+	w    *bufio.Writer
+	mode C14NMode
+	// InclusiveNamespaces PrefixList, for exclusive methods
+	inclusive map[string]bool
+	// selects the nodes of a document subset; nil selects all
+	include func(*XPathNode) bool
+}
+
+func (c *canonicalizer) included(n *XPathNode) bool {
+	return c.include == nil || c.include(n)
+}
+
+func newCanonicalizer(w io.Writer, mode C14NMode, inclusivePrefixes []string) *canonicalizer {
+	c := &canonicalizer{w: bufio.NewWriter(w), mode: mode}
+	if mode.exclusive() {
+		c.inclusive = make(map[string]bool, len(inclusivePrefixes))
+		for _, p := range inclusivePrefixes {
+			if p == "#default" {
+				p = ""
+			}
+			c.inclusive[p] = true
+		}
+	}
+	return c
+}
+
+func (c *canonicalizer) flush() error { return c.w.Flush() }
+
+// qualify chooses a prefix for a namespace. The original prefix is
+// used if it is still bound to space. Otherwise, another prefix
+// bound to space is chosen, or a new binding is added to ns.
+func qualify(ns map[string]string, space, orig string, isAttr bool) string {
+	switch space {
+	case xmlLangURI:
+		return "xml"
+	case "":
+		if !isAttr && ns[""] != "" {
+			// no prefix can refer to the empty namespace
+			ns[""] = ""
+		}
+		return ""
+	}
+	if (orig != "" || !isAttr) && ns[orig] == space {
+		return orig
+	}
+	candidates := make([]string, 0, 1)
+	for p, s := range ns {
+		if s == space && (p != "" || !isAttr) {
+			candidates = append(candidates, p)
+		}
+	}
+	if len(candidates) > 0 {
+		sort.Strings(candidates)
+		return candidates[0]
+	}
+	if !isAttr {
+		ns[""] = space
+		return ""
+	}
+	for i := 1; ; i++ {
+		p := "ns" + strconv.Itoa(i)
+		if _, ok := ns[p]; !ok {
+			ns[p] = space
+			return p
+		}
+	}
+}
+
+func (c *canonicalizer) element(n *XPathNode, rendered map[string]string, depth int) {
+	if depth > recursionLimit {
+		return
+	}
+	if !c.included(n) {
+		c.content(n, rendered, depth)
+		return
+	}
+	el := n.el
+	ns := el.Scope.Namespaces()
+	prefix := qualify(ns, el.Name.Space, el.prefix, false)
+
+	type attr struct {
+		name   xml.Name
+		prefix string
+		value  string
+	}
+	own := make([]xml.Attr, 0, len(el.StartElement.Attr))
+	var origPrefix []string
+	for _, a := range n.Attributes() {
+		xa := el.StartElement.Attr[a.index]
+		if xa.Name.Space == "xmlns" || (xa.Name.Space == "" && xa.Name.Local == "xmlns") {
+			continue
+		}
+		if !c.included(a) {
+			continue
+		}
+		var orig string
+		if a.index < len(el.attrSrc) {
+			orig = el.attrSrc[a.index].prefix
+		}
+		own = append(own, xa)
+		origPrefix = append(origPrefix, orig)
+	}
+	own = c.inherit(n, own)
+	attrs := make([]attr, 0, len(own))
+	for i, a := range own {
+		var orig string
+		if i < len(origPrefix) {
+			orig = origPrefix[i]
+		}
+		attrs = append(attrs, attr{
+			name:   a.Name,
+			prefix: qualify(ns, a.Name.Space, orig, true),
+			value:  a.Value,
+		})
+	}
+	sort.Slice(attrs, func(i, j int) bool {
+		if attrs[i].name.Space != attrs[j].name.Space {
+			return attrs[i].name.Space < attrs[j].name.Space
+		}
+		return attrs[i].name.Local < attrs[j].name.Local
+	})
+
+	// Decide which namespace declarations to output.
+	var candidates []string
+	if c.mode.exclusive() {
+		utilized := map[string]bool{prefix: true}
+		for _, a := range attrs {
+			if a.prefix != "" && a.prefix != "xml" {
+				utilized[a.prefix] = true
+			}
+		}
+		for p := range c.inclusive {
+			if _, ok := ns[p]; ok {
+				utilized[p] = true
+			}
+		}
+		for p := range utilized {
+			candidates = append(candidates, p)
+		}
+	} else {
+		for p := range ns {
+			candidates = append(candidates, p)
+		}
+	}
+	sort.Strings(candidates)
+	var decls []xml.Name
+	for _, p := range candidates {
+		uri := ns[p]
+		if p != "" && uri == "" {
+			continue
+		}
+		if uri != rendered[p] {
+			decls = append(decls, xml.Name{Local: p, Space: uri})
+		}
+	}
+	if len(decls) > 0 {
+		parent := rendered
+		rendered = make(map[string]string, len(parent)+len(decls))
+		for p, uri := range parent {
+			rendered[p] = uri
+		}
+		for _, d := range decls {
+			rendered[d.Local] = d.Space
+		}
+	}
+
+	qname := el.Name.Local
+	if prefix != "" {
+		qname = prefix + ":" + qname
+	}
+	c.w.WriteByte('<')
+	c.w.WriteString(qname)
+	for _, d := range decls {
+		if d.Local == "" {
+			c.w.WriteString(` xmlns="`)
+		} else {
+			c.w.WriteString(" xmlns:" + d.Local + `="`)
+		}
+		c.w.WriteString(escapeAttr(d.Space))
+		c.w.WriteByte('"')
+	}
+	for _, a := range attrs {
+		c.w.WriteByte(' ')
+		if a.prefix != "" {
+			c.w.WriteString(a.prefix + ":")
+		}
+		c.w.WriteString(a.name.Local + `="`)
+		c.w.WriteString(escapeAttr(a.value))
+		c.w.WriteByte('"')
+	}
+	c.w.WriteByte('>')
+	c.content(n, rendered, depth)
+	c.w.WriteString("</" + qname + ">")
+}
+
+// content writes the nodes contained by the element node n that are
+// in the document subset.
+func (c *canonicalizer) content(n *XPathNode, rendered map[string]string, depth int) {
+	for _, kid := range n.Children() {
+		if kid.kind == ElementNode {
+			c.element(kid, rendered, depth+1)
+		} else if c.included(kid) {
+			c.node(Node{Kind: kid.kind, Data: []byte(kid.data), Target: kid.target})
+		}
+	}
+}
+
+// inherit adds to attrs, the attributes of the element node n, the
+// attributes in the xml namespace that n inherits from its ancestors
+// that are not in the document subset, up to the nearest one that is.
+func (c *canonicalizer) inherit(n *XPathNode, attrs []xml.Attr) []xml.Attr {
+	if c.mode.exclusive() {
+		return attrs
+	}
+	v11 := c.mode == C14N11 || c.mode == C14N11WithComments
+	has := make(map[string]bool)
+	for _, a := range attrs {
+		if a.Name.Space == xmlLangURI {
+			has[a.Name.Local] = true
+		}
+	}
+	// xml:base values of the omitted ancestors, nearest first
+	var bases []string
+	for p := n.parent; p != nil && p.kind == ElementNode && !c.included(p); p = p.parent {
+		for _, a := range p.el.StartElement.Attr {
+			if a.Name.Space != xmlLangURI {
+				continue
+			}
+			switch {
+			case v11 && a.Name.Local == "base":
+				bases = append(bases, a.Value)
+				continue
+			case v11 && a.Name.Local != "lang" && a.Name.Local != "space":
+				continue
+			case has[a.Name.Local]:
+				continue
+			}
+			has[a.Name.Local] = true
+			attrs = append(attrs, a)
+		}
+	}
+	if len(bases) == 0 {
+		return attrs
+	}
+	base := ""
+	for i := len(bases) - 1; i >= 0; i-- {
+		base = joinURI(base, bases[i])
+	}
+	for i, a := range attrs {
+		if a.Name.Space == xmlLangURI && a.Name.Local == "base" {
+			attrs[i].Value = joinURI(base, a.Value)
+			return attrs
+		}
+	}
+	return append(attrs, xml.Attr{Name: xml.Name{Space: xmlLangURI, Local: "base"}, Value: base})
+}
+
+// joinURI joins the URI reference ref to base as described in
+// section 2.4 of Canonical XML 1.1. It resolves ref against base as
+// in RFC 3986, except that base may be relative, and leading ".."
+// segments of relative paths are kept.
+func joinURI(base, ref string) string {
+	if base == "" {
+		return ref
+	}
+	b, err := url.Parse(base)
+	if err != nil {
+		return ref
+	}
+	r, err := url.Parse(ref)
+	if err != nil || r.Opaque != "" || b.Opaque != "" {
+		return ref
+	}
+	t := *r
+	switch {
+	case r.Scheme != "" || r.Host != "":
+		t.Path = removeDotSegments(r.Path)
+	case r.Path == "":
+		t.Path = b.Path
+		if r.RawQuery == "" {
+			t.RawQuery = b.RawQuery
+		}
+	case strings.HasPrefix(r.Path, "/"):
+		t.Path = removeDotSegments(r.Path)
+	case b.Host != "" && b.Path == "":
+		t.Path = removeDotSegments("/" + r.Path)
+	default:
+		t.Path = removeDotSegments(b.Path[:strings.LastIndex(b.Path, "/")+1] + r.Path)
+	}
+	if r.Scheme == "" {
+		t.Scheme = b.Scheme
+		if r.Host == "" {
+			t.User, t.Host = b.User, b.Host
+		}
+	}
+	t.RawPath = ""
+	return t.String()
+}
+
+// removeDotSegments removes the "." and ".." segments of a path, as
+// in RFC 3986, except that ".." segments that would rise above the
+// start of a relative path are kept.
+func removeDotSegments(path string) string {
+	if path == "" {
+		return path
+	}
+	abs := strings.HasPrefix(path, "/")
+	segments := strings.Split(path, "/")
+	out := make([]string, 0, len(segments))
+	for i, s := range segments {
+		switch s {
+		case ".":
+		case "..":
+			if n := len(out); n > 0 && out[n-1] != ".." && !(abs && n == 1) {
+				out = out[:n-1]
+			} else if !abs {
+				out = append(out, "..")
+			}
+		default:
+			out = append(out, s)
+			continue
+		}
+		if i == len(segments)-1 {
+			out = append(out, "")
+		}
+	}
+	return strings.Join(out, "/")
+}
+
+func (c *canonicalizer) node(n Node) {
+	switch n.Kind {
+	case TextNode, CDATANode:
+		escapeText(c.w, n.Data)
+	case CommentNode:
+		if c.mode.comments() {
+			writeAll(c.w, "<!--", n.Data, "-->")
+		}
+	case ProcInstNode:
+		writeNode(c.w, n)
+	}
+}
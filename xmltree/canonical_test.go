@@ -0,0 +1,372 @@
+package xmltree
+
+import (
+	"fmt"
+	"testing"
+)
+
+// Examples from section 3 of the Canonical XML 1.0 recommendation,
+// and section 2.2 of the Exclusive XML Canonicalization
+// recommendation.
+func TestCanonicalizeDocument(t *testing.T) {
+	tests := []struct {
+		name, input string
+		mode        C14NMode
+		want        string
+	}{
+		{
+			name: "3.1 PIs, comments, and outside of document element",
+			mode: C14N10,
+			input: `<?xml version="1.0"?>
+
+<?xml-stylesheet   href="doc.xsl"
+   type="text/xsl"   ?>
+
+<!DOCTYPE doc SYSTEM "doc.dtd">
+
+<doc>Hello, world!<!-- Comment 1 --></doc>
+
+<?pi-without-data     ?>
+
+<!-- Comment 2 -->
+
+<!-- Comment 3 -->`,
+			want: `<?xml-stylesheet href="doc.xsl"
+   type="text/xsl"   ?>
+<doc>Hello, world!</doc>
+<?pi-without-data?>`,
+		},
+		{
+			name: "3.1 PIs, comments, and outside of document element (with comments)",
+			mode: C14N11WithComments,
+			input: `<?xml version="1.0"?>
+
+<?xml-stylesheet   href="doc.xsl"
+   type="text/xsl"   ?>
+
+<!DOCTYPE doc SYSTEM "doc.dtd">
+
+<doc>Hello, world!<!-- Comment 1 --></doc>
+
+<?pi-without-data     ?>
+
+<!-- Comment 2 -->
+
+<!-- Comment 3 -->`,
+			want: `<?xml-stylesheet href="doc.xsl"
+   type="text/xsl"   ?>
+<doc>Hello, world!<!-- Comment 1 --></doc>
+<?pi-without-data?>
+<!-- Comment 2 -->
+<!-- Comment 3 -->`,
+		},
+		{
+			name: "3.2 Whitespace in document content",
+			mode: C14N10,
+			input: `<doc>
+   <clean>   </clean>
+   <dirty>   A   B   </dirty>
+   <mixed>
+      A
+      <clean>   </clean>
+      B
+      <dirty>   A   B   </dirty>
+      C
+   </mixed>
+</doc>`,
+			want: `<doc>
+   <clean>   </clean>
+   <dirty>   A   B   </dirty>
+   <mixed>
+      A
+      <clean>   </clean>
+      B
+      <dirty>   A   B   </dirty>
+      C
+   </mixed>
+</doc>`,
+		},
+		{
+			name: "3.3 Start and end tags (without DTD)",
+			mode: C14N10,
+			input: `<!DOCTYPE doc>
+<doc>
+   <e1   />
+   <e2   ></e2>
+   <e3   name = "elem3"   id="elem3"   />
+   <e4   name="elem4"   id="elem4"   ></e4>
+   <e5 a:attr="out" b:attr="sorted" attr2="all" attr="I'm"
+      xmlns:b="http://www.ietf.org"
+      xmlns:a="http://www.w3.org"
+      xmlns="http://example.org"/>
+   <e6 xmlns="" xmlns:a="http://www.w3.org">
+      <e7 xmlns="http://www.ietf.org">
+         <e8 xmlns="" xmlns:a="http://www.w3.org">
+            <e9 xmlns="" xmlns:a="http://www.ietf.org"/>
+         </e8>
+      </e7>
+   </e6>
+</doc>`,
+			want: `<doc>
+   <e1></e1>
+   <e2></e2>
+   <e3 id="elem3" name="elem3"></e3>
+   <e4 id="elem4" name="elem4"></e4>
+   <e5 xmlns="http://example.org" xmlns:a="http://www.w3.org" xmlns:b="http://www.ietf.org" attr="I'm" attr2="all" b:attr="sorted" a:attr="out"></e5>
+   <e6 xmlns:a="http://www.w3.org">
+      <e7 xmlns="http://www.ietf.org">
+         <e8 xmlns="">
+            <e9 xmlns:a="http://www.ietf.org"></e9>
+         </e8>
+      </e7>
+   </e6>
+</doc>`,
+		},
+		{
+			name: "3.4 Character modifications and character references",
+			mode: C14N10,
+			input: `<doc>
+   <text>First line&#x0d;&#10;Second line</text>
+   <value>&#x32;</value>
+   <compute><![CDATA[value>"0" && value<"10" ?"valid":"error"]]></compute>
+   <compute expr='value>"0" &amp;&amp; value&lt;"10" ?"valid":"error"'>valid</compute>
+   <norm attrib=' &apos;   &#x20;&#13;&#xa;&#9;   &apos; '/>
+</doc>`,
+			want: `<doc>
+   <text>First line&#xD;
+Second line</text>
+   <value>2</value>
+   <compute>value&gt;"0" &amp;&amp; value&lt;"10" ?"valid":"error"</compute>
+   <compute expr="value>&quot;0&quot; &amp;&amp; value&lt;&quot;10&quot; ?&quot;valid&quot;:&quot;error&quot;">valid</compute>
+   <norm attrib=" '    &#xD;&#xA;&#x9;   ' "></norm>
+</doc>`,
+		},
+		{
+			name:  "3.6 UTF-8 encoding",
+			mode:  C14N10,
+			input: `<?xml version="1.0" encoding="ISO-8859-1"?>` + "\n<doc>&#169;</doc>",
+			want:  "<doc>©</doc>",
+		},
+	}
+	for _, tt := range tests {
+		doc, err := ParseDocument([]byte(tt.input))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got := string(CanonicalizeDocument(doc, tt.mode)); got != tt.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", tt.name, got, tt.want)
+		}
+	}
+}
+
+// Examples from section 3 of the Canonical XML recommendations that
+// depend on the DTD of the document.
+func TestCanonicalizeDocumentDTD(t *testing.T) {
+	opts := &ParseOptions{
+		ParseDTD: true,
+		DTDResolver: func(publicID, systemID string) ([]byte, error) {
+			if systemID == "world.txt" {
+				return []byte("world"), nil
+			}
+			return nil, fmt.Errorf("cannot resolve %s", systemID)
+		},
+	}
+	tests := []struct {
+		name, input, want string
+	}{
+		{
+			name: "3.3 Start and end tags (with DTD)",
+			input: `<!DOCTYPE doc [<!ATTLIST e9 attr CDATA "default">]>
+<doc>
+   <e6 xmlns="" xmlns:a="http://www.w3.org">
+      <e7 xmlns="http://www.ietf.org">
+         <e8 xmlns="" xmlns:a="http://www.w3.org">
+            <e9 xmlns="" xmlns:a="http://www.ietf.org"/>
+         </e8>
+      </e7>
+   </e6>
+</doc>`,
+			want: `<doc>
+   <e6 xmlns:a="http://www.w3.org">
+      <e7 xmlns="http://www.ietf.org">
+         <e8 xmlns="">
+            <e9 xmlns:a="http://www.ietf.org" attr="default"></e9>
+         </e8>
+      </e7>
+   </e6>
+</doc>`,
+		},
+		{
+			name: "3.5 Entity references",
+			input: `<!DOCTYPE doc [
+<!ATTLIST doc attrExtEnt ENTITY #IMPLIED>
+<!ENTITY ent1 "Hello">
+<!ENTITY ent2 SYSTEM "world.txt">
+<!ENTITY entExt SYSTEM "earth.gif" NDATA gif>
+<!NOTATION gif SYSTEM "viewgif.exe">
+]>
+<doc attrExtEnt="entExt">
+   &ent1;, &ent2;!
+</doc>
+
+<!-- Let world.txt contain "world" (excluding the quotes) -->`,
+			want: `<doc attrExtEnt="entExt">
+   Hello, world!
+</doc>`,
+		},
+	}
+	for _, tt := range tests {
+		doc, err := opts.ParseDocument([]byte(tt.input))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got := string(CanonicalizeDocument(doc, C14N10)); got != tt.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", tt.name, got, tt.want)
+		}
+	}
+}
+
+// Examples from section 3.7 of Canonical XML 1.0 and section 3.8 of
+// Canonical XML 1.1.
+func TestCanonicalizeSubset(t *testing.T) {
+	const filter = `self::ietf:e1 or (parent::ietf:e1 and not(self::text() or self::e2))
+		or count(id("E3")|ancestor-or-self::node()) = count(ancestor-or-self::node())`
+	tests := []struct {
+		name, input string
+		mode        C14NMode
+		want        string
+	}{
+		{
+			name: "3.7 Document subsets",
+			mode: C14N10,
+			input: `<!DOCTYPE doc [
+<!ATTLIST e2 xml:space (default|preserve) 'preserve'>
+<!ATTLIST e3 id ID #IMPLIED>
+]>
+<doc xmlns="http://www.ietf.org" xmlns:w3c="http://www.w3.org">
+   <e1>
+      <e2 xmlns="">
+         <e3 id="E3"/>
+      </e2>
+   </e1>
+</doc>`,
+			want: `<e1 xmlns="http://www.ietf.org" xmlns:w3c="http://www.w3.org"><e3 xmlns="" id="E3" xml:space="preserve"></e3></e1>`,
+		},
+		{
+			name: "3.8 Document subsets and XML attributes",
+			mode: C14N11,
+			input: `<!DOCTYPE doc [
+<!ATTLIST e2 xml:space (default|preserve) 'preserve'>
+<!ATTLIST e3 id ID #IMPLIED>
+]>
+<doc xmlns="http://www.ietf.org" xmlns:w3c="http://www.w3.org" xml:base="http://www.example.com/something/else">
+   <e1>
+      <e2 xmlns="" xml:id="abc" xml:base="../bar/">
+         <e3 id="E3" xml:base="foo"/>
+      </e2>
+   </e1>
+</doc>`,
+			want: `<e1 xmlns="http://www.ietf.org" xmlns:w3c="http://www.w3.org" xml:base="http://www.example.com/something/else"><e3 xmlns="" id="E3" xml:base="../bar/foo" xml:space="preserve"></e3></e1>`,
+		},
+	}
+	x := MustCompileXPath(filter)
+	env := &XPathEnv{Namespaces: map[string]string{"ietf": "http://www.ietf.org"}}
+	for _, tt := range tests {
+		root, err := (&ParseOptions{ParseDTD: true}).Parse([]byte(tt.input))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		include := func(n *XPathNode) bool {
+			v, err := x.EvalNode(n, env)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return XPathBool(v)
+		}
+		if got := string(CanonicalizeSubset(root, include, tt.mode)); got != tt.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCanonicalizeSubtree(t *testing.T) {
+	root := parseDoc(t, []byte(`<a xml:lang="en" xml:id="a1" xml:base="http://example.com/x/"><b xml:base="y/"><c/></b></a>`))
+	c := &root.Children[0].Children[0]
+	tests := []struct {
+		mode C14NMode
+		want string
+	}{
+		{C14N10, `<c xml:base="y/" xml:id="a1" xml:lang="en"></c>`},
+		{C14N11, `<c xml:base="http://example.com/x/y/" xml:lang="en"></c>`},
+		{ExcC14N, `<c></c>`},
+	}
+	for _, tt := range tests {
+		if got := string(CanonicalizeSubset(root, InSubtree(c), tt.mode)); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.mode, got, tt.want)
+		}
+	}
+	if got := string(Canonicalize(c, C14N10)); got != `<c></c>` {
+		t.Errorf("Canonicalize: got %s, want <c></c>", got)
+	}
+}
+
+func TestCanonicalize(t *testing.T) {
+	const input = `<n0:local xmlns:n0="foo:bar" xmlns:n3="ftp://example.org">
+  <n1:elem2 xmlns:n1="http://example.net" xml:lang="en">
+    <n3:stuff xmlns:n3="ftp://example.org"/>
+    <!-- comment -->
+    <n4:stuff xmlns:n4="http://example.com" n3:attr="x"/>
+  </n1:elem2>
+</n0:local>`
+	tests := []struct {
+		mode      C14NMode
+		inclusive []string
+		want      string
+	}{
+		{C14N10, nil, `<n1:elem2 xmlns:n0="foo:bar" xmlns:n1="http://example.net" xmlns:n3="ftp://example.org" xml:lang="en">
+    <n3:stuff></n3:stuff>
+    
+    <n4:stuff xmlns:n4="http://example.com" n3:attr="x"></n4:stuff>
+  </n1:elem2>`},
+		{ExcC14N, nil, `<n1:elem2 xmlns:n1="http://example.net" xml:lang="en">
+    <n3:stuff xmlns:n3="ftp://example.org"></n3:stuff>
+    
+    <n4:stuff xmlns:n3="ftp://example.org" xmlns:n4="http://example.com" n3:attr="x"></n4:stuff>
+  </n1:elem2>`},
+		{ExcC14NWithComments, []string{"n0", "n3"}, `<n1:elem2 xmlns:n0="foo:bar" xmlns:n1="http://example.net" xmlns:n3="ftp://example.org" xml:lang="en">
+    <n3:stuff></n3:stuff>
+    <!-- comment -->
+    <n4:stuff xmlns:n4="http://example.com" n3:attr="x"></n4:stuff>
+  </n1:elem2>`},
+	}
+	for _, useNodes := range []bool{false, true} {
+		var root *Element
+		if useNodes {
+			doc, err := ParseDocument([]byte(input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			root = doc.Root
+		} else {
+			root = parseDoc(t, []byte(input))
+		}
+		elem2 := &root.Children[0]
+		for _, tt := range tests {
+			got := string(Canonicalize(elem2, tt.mode, tt.inclusive...))
+			if got != tt.want {
+				t.Errorf("%s %v (nodes=%v): got\n%s\nwant\n%s", tt.mode, tt.inclusive, useNodes, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestC14NModeURI(t *testing.T) {
+	for m := C14N10; m <= ExcC14NWithComments; m++ {
+		if got, ok := C14NModeByURI(m.URI()); !ok || got != m {
+			t.Errorf("C14NModeByURI(%q) = %s, %v", m.URI(), got, ok)
+		}
+	}
+}
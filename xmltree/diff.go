@@ -0,0 +1,463 @@
+package xmltree
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/xml"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A DiffKind describes how two documents differ at a location.
+type DiffKind int
+
+const (
+	// Added indicates an element, attribute or text present
+	// only in the second document.
+	Added DiffKind = iota
+	// Removed indicates an element, attribute or text present
+	// only in the first document.
+	Removed
+	// Changed indicates a value that is present in both
+	// documents, but differs.
+	Changed
+)
+
+func (k DiffKind) String() string {
+	switch k {
+	case Added:
+		return "added"
+	case Removed:
+		return "removed"
+	case Changed:
+		return "changed"
+	}
+	return fmt.Sprintf("DiffKind(%d)", int(k))
+}
+
+// A Difference is a single difference between two Elements, as
+// reported by Diff.
+type Difference struct {
+	Kind DiffKind
+	// The location of the difference, as an XPath expression. Elements
+	// are numbered by their position among siblings of the same name,
+	// when there is more than one. Attributes are denoted by @name, and
+	// the text of an element by text(), or text()[n] for the nth run
+	// of text between its child elements, when there is more than one.
+	Path string
+	// The values in the first and second Element. For elements, the
+	// value is the element's qualified name, or, if the documents
+	// have different root elements, its {namespace}local name. For
+	// removed items, B is empty; for added items, A is empty.
+	A, B string
+}
+
+func (d Difference) String() string {
+	switch d.Kind {
+	case Added:
+		return fmt.Sprintf("added %s: %q", d.Path, d.B)
+	case Removed:
+		return fmt.Sprintf("removed %s: %q", d.Path, d.A)
+	}
+	return fmt.Sprintf("changed %s: %q != %q", d.Path, d.A, d.B)
+}
+
+// DiffOptions control the comparison performed by Diff. The zero
+// value compares everything except comments and processing
+// instructions.
+type DiffOptions struct {
+	// If true, the order of child elements is not significant.
+	IgnoreOrder bool
+	// If true, leading and trailing white space in text is ignored,
+	// and runs of white space are considered equal.
+	IgnoreWhitespace bool
+	// If true, differences in the namespace prefixes used for
+	// elements and attributes are ignored. Namespace URIs are
+	// always compared.
+	IgnorePrefixes bool
+	// Attributes to ignore. If the Space field of a name is
+	// empty, attributes with that local name are ignored in
+	// any namespace.
+	IgnoreAttrs []xml.Name
+}
+
+// Diff compares two Elements and returns their differences, in
+// document order. Diff returns nil if the Elements are equivalent.
+// opts may be nil, in which case the zero DiffOptions are used.
+//
+// Unlike Equal, Diff compares the text of elements that have children,
+// and does not modify its arguments.
+func Diff(a, b *Element, opts *DiffOptions) []Difference {
+	if opts == nil {
+		opts = new(DiffOptions)
+	}
+	d := differ{opts: opts}
+	if a.Name != b.Name {
+		return []Difference{{Kind: Changed, Path: "/" + a.qname(), A: expandedName(a.Name), B: expandedName(b.Name)}}
+	}
+	d.element(a, b, "/"+a.qname(), 0)
+	return d.result
+}
+
+func expandedName(name xml.Name) string {
+	if name.Space == "" {
+		return name.Local
+	}
+	return "{" + name.Space + "}" + name.Local
+}
+
+type differ struct {
+	opts   *DiffOptions
+	result []Difference
+	// the subtree hashes computed by hash
+	hashes map[*Element][sha256.Size]byte
+}
+
+func (d *differ) add(kind DiffKind, path, a, b string) {
+	d.result = append(d.result, Difference{Kind: kind, Path: path, A: a, B: b})
+}
+
+// qname returns the qualified name of an element, using the prefix
+// from the source document if it is still in scope.
+func (el *Element) qname() string {
+	if el.prefix != "" {
+		if name, ok := el.ResolveNS(el.prefix + ":" + el.Name.Local); ok && name.Space == el.Name.Space {
+			return el.prefix + ":" + el.Name.Local
+		}
+	}
+	if q := el.Prefix(el.Name); q != "" {
+		return q
+	}
+	return el.Name.Local
+}
+
+func (d *differ) ignoreAttr(name xml.Name) bool {
+	for _, n := range d.opts.IgnoreAttrs {
+		if n.Local == name.Local && (n.Space == "" || n.Space == name.Space) {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *differ) element(a, b *Element, path string, depth int) {
+	if depth > recursionLimit {
+		return
+	}
+	if !d.opts.IgnorePrefixes && a.qname() != b.qname() {
+		d.add(Changed, path, a.qname(), b.qname())
+	}
+	d.attrs(a, b, path)
+	d.text(a, b, path)
+	d.children(a, b, path, depth)
+}
+
+// text compares the text nodes directly contained by a and b by
+// their position.
+func (d *differ) text(a, b *Element, path string) {
+	ta, tb := d.texts(a), d.texts(b)
+	n := len(ta)
+	if len(tb) > n {
+		n = len(tb)
+	}
+	for i := 0; i < n; i++ {
+		p := path + "/text()"
+		if n > 1 {
+			p += fmt.Sprintf("[%d]", i+1)
+		}
+		switch {
+		case i >= len(ta):
+			d.add(Added, p, "", tb[i])
+		case i >= len(tb):
+			d.add(Removed, p, ta[i], "")
+		case ta[i] != tb[i]:
+			d.add(Changed, p, ta[i], tb[i])
+		}
+	}
+}
+
+type diffAttr struct {
+	qname, value string
+}
+
+// collectAttrs returns the attributes of el that are compared, and
+// their names in document order.
+func (d *differ) collectAttrs(el *Element) (map[xml.Name]diffAttr, []xml.Name) {
+	m := make(map[xml.Name]diffAttr, len(el.StartElement.Attr))
+	var order []xml.Name
+	for i, a := range el.StartElement.Attr {
+		if a.Name.Space == "xmlns" || (a.Name.Space == "" && a.Name.Local == "xmlns") || d.ignoreAttr(a.Name) {
+			continue
+		}
+		if _, ok := m[a.Name]; ok {
+			continue
+		}
+		q := a.Name.Local
+		if i < len(el.attrSrc) && el.attrSrc[i].prefix != "" {
+			q = el.attrSrc[i].prefix + ":" + q
+		} else if a.Name.Space != "" {
+			q = el.Prefix(a.Name)
+		}
+		m[a.Name] = diffAttr{q, a.Value}
+		order = append(order, a.Name)
+	}
+	return m, order
+}
+
+func (d *differ) attrs(a, b *Element, path string) {
+	am, aorder := d.collectAttrs(a)
+	bm, border := d.collectAttrs(b)
+	for _, name := range aorder {
+		x := am[name]
+		y, ok := bm[name]
+		switch {
+		case !ok:
+			d.add(Removed, path+"/@"+x.qname, x.value, "")
+		case x.value != y.value:
+			d.add(Changed, path+"/@"+x.qname, x.value, y.value)
+		case !d.opts.IgnorePrefixes && x.qname != y.qname:
+			d.add(Changed, path+"/@"+x.qname, x.qname, y.qname)
+		}
+	}
+	for _, name := range border {
+		if _, ok := am[name]; !ok {
+			y := bm[name]
+			d.add(Added, path+"/@"+y.qname, "", y.value)
+		}
+	}
+}
+
+// texts returns the text nodes directly contained by an element: the
+// runs of text between its child elements. Comments and processing
+// instructions, which Diff does not compare, do not split a run. If
+// whitespace is ignored, runs that are only whitespace are left out.
+func (d *differ) texts(el *Element) []string {
+	var (
+		result []string
+		buf    strings.Builder
+	)
+	flush := func() {
+		s := buf.String()
+		buf.Reset()
+		if d.opts.IgnoreWhitespace {
+			s = strings.Join(strings.Fields(s), " ")
+		}
+		if s != "" {
+			result = append(result, s)
+		}
+	}
+	for _, n := range el.ContentNodes() {
+		switch n.Kind {
+		case TextNode, CDATANode:
+			buf.Write(n.Data)
+		case ElementNode:
+			flush()
+		}
+	}
+	flush()
+	return result
+}
+
+// hash returns a hash of everything about el that Diff compares, so
+// that two elements have the same hash if and only if Diff finds no
+// differences between them. Hashes are computed once per element, so
+// that matching unordered children takes time proportional to the
+// size of the documents, rather than exponential in their depth.
+func (d *differ) hash(el *Element, depth int) [sha256.Size]byte {
+	if h, ok := d.hashes[el]; ok {
+		return h
+	}
+	if d.hashes == nil {
+		d.hashes = make(map[*Element][sha256.Size]byte)
+	}
+	h := sha256.New()
+	// Each field is length-prefixed, so that different elements
+	// cannot produce the same input.
+	write := func(s string) {
+		var n [binary.MaxVarintLen64]byte
+		h.Write(n[:binary.PutUvarint(n[:], uint64(len(s)))])
+		h.Write([]byte(s))
+	}
+	write(el.Name.Space)
+	write(el.Name.Local)
+	if depth <= recursionLimit {
+		if !d.opts.IgnorePrefixes {
+			write(el.qname())
+		}
+		m, order := d.collectAttrs(el)
+		sort.Slice(order, func(i, j int) bool {
+			if order[i].Space != order[j].Space {
+				return order[i].Space < order[j].Space
+			}
+			return order[i].Local < order[j].Local
+		})
+		write(strconv.Itoa(len(order)))
+		for _, name := range order {
+			write(name.Space)
+			write(name.Local)
+			write(m[name].value)
+			if !d.opts.IgnorePrefixes {
+				write(m[name].qname)
+			}
+		}
+		texts := d.texts(el)
+		write(strconv.Itoa(len(texts)))
+		for _, s := range texts {
+			write(s)
+		}
+		kids := make([][sha256.Size]byte, len(el.Children))
+		for i := range el.Children {
+			kids[i] = d.hash(&el.Children[i], depth+1)
+		}
+		if d.opts.IgnoreOrder {
+			sort.Slice(kids, func(i, j int) bool {
+				return bytes.Compare(kids[i][:], kids[j][:]) < 0
+			})
+		}
+		write(strconv.Itoa(len(kids)))
+		for _, k := range kids {
+			h.Write(k[:])
+		}
+	}
+	var sum [sha256.Size]byte
+	h.Sum(sum[:0])
+	d.hashes[el] = sum
+	return sum
+}
+
+// childPaths returns the path of each child element of el,
+// numbering children that share a name.
+func childPaths(el *Element, path string) []string {
+	count := make(map[xml.Name]int, len(el.Children))
+	for i := range el.Children {
+		count[el.Children[i].Name]++
+	}
+	seen := make(map[xml.Name]int, len(count))
+	paths := make([]string, len(el.Children))
+	for i := range el.Children {
+		c := &el.Children[i]
+		seen[c.Name]++
+		paths[i] = path + "/" + c.qname()
+		if count[c.Name] > 1 {
+			paths[i] += fmt.Sprintf("[%d]", seen[c.Name])
+		}
+	}
+	return paths
+}
+
+func (d *differ) children(a, b *Element, path string, depth int) {
+	apaths := childPaths(a, path)
+	bpaths := childPaths(b, path)
+	var pairs [][2]int
+	if d.opts.IgnoreOrder {
+		pairs = d.matchUnordered(a, b, depth)
+	} else {
+		pairs = matchOrdered(a, b)
+	}
+	// Report differences in the order of the first document,
+	// with added elements after the element they follow.
+	matchedB := make(map[int]bool, len(pairs))
+	matchOf := make(map[int]int, len(pairs))
+	for _, p := range pairs {
+		matchedB[p[1]] = true
+		matchOf[p[0]] = p[1]
+	}
+	nextB := 0
+	addedUntil := func(limit int) {
+		for ; nextB < limit; nextB++ {
+			if !matchedB[nextB] {
+				d.add(Added, bpaths[nextB], "", b.Children[nextB].qname())
+			}
+		}
+	}
+	for i := range a.Children {
+		j, ok := matchOf[i]
+		if !ok {
+			d.add(Removed, apaths[i], a.Children[i].qname(), "")
+			continue
+		}
+		if j >= nextB {
+			addedUntil(j)
+			nextB = j + 1
+		}
+		d.element(&a.Children[i], &b.Children[j], apaths[i], depth+1)
+	}
+	addedUntil(len(b.Children))
+}
+
+// matchOrdered pairs the children of a and b with the same name,
+// using the longest common subsequence of their names.
+func matchOrdered(a, b *Element) [][2]int {
+	n, m := len(a.Children), len(b.Children)
+	lcs := make([][]int, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if a.Children[i].Name == b.Children[j].Name {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	var pairs [][2]int
+	for i, j := 0, 0; i < n && j < m; {
+		switch {
+		case a.Children[i].Name == b.Children[j].Name:
+			pairs = append(pairs, [2]int{i, j})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			i++
+		default:
+			j++
+		}
+	}
+	return pairs
+}
+
+// matchUnordered pairs the children of a and b with the same name.
+// Children that are equal are paired first; the remaining children
+// with the same name are then paired in document order.
+func (d *differ) matchUnordered(a, b *Element, depth int) [][2]int {
+	var pairs [][2]int
+	usedA := make(map[int]bool)
+	usedB := make(map[int]bool)
+	equal := make(map[[sha256.Size]byte][]int)
+	for j := range b.Children {
+		h := d.hash(&b.Children[j], depth+1)
+		equal[h] = append(equal[h], j)
+	}
+	for i := range a.Children {
+		h := d.hash(&a.Children[i], depth+1)
+		if js := equal[h]; len(js) > 0 {
+			pairs = append(pairs, [2]int{i, js[0]})
+			usedA[i], usedB[js[0]] = true, true
+			equal[h] = js[1:]
+		}
+	}
+	byName := make(map[xml.Name][]int)
+	for j := range b.Children {
+		if !usedB[j] {
+			name := b.Children[j].Name
+			byName[name] = append(byName[name], j)
+		}
+	}
+	for i := range a.Children {
+		name := a.Children[i].Name
+		if js := byName[name]; !usedA[i] && len(js) > 0 {
+			pairs = append(pairs, [2]int{i, js[0]})
+			byName[name] = js[1:]
+		}
+	}
+	// order the pairs by their position in a
+	sort.Slice(pairs, func(i, j int) bool { return pairs[i][0] < pairs[j][0] })
+	return pairs
+}
@@ -0,0 +1,281 @@
+package xmltree
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+
+	"github.com/m29h/go-xml/dtd"
+)
+
+// A Node is an item of content within an Element or a Document, in
+// document order. Nodes allow the interleaving of text and child
+// elements, as well as comments, processing instructions and CDATA
+// sections, to be preserved.
+type Node struct {
+	Kind NodeKind
+	// For text nodes and CDATA sections, the character data, with
+	// any references already expanded. For comments and directives,
+	// the text between the delimiters. For processing instructions,
+	// the instruction, without the target.
+	Data []byte
+	// For processing instructions, the target.
+	Target string
+	// For element nodes, the index of the element in the Children
+	// of the containing Element. For a Document, element nodes
+	// refer to its Root.
+	Child int
+}
+
+// A Document is a complete XML document. Along with the document
+// element, a Document retains the XML declaration, document type
+// declaration, and any comments or processing instructions outside
+// the document element.
+type Document struct {
+	// Nodes outside of the document element, in document order.
+	// A Node of kind ElementNode marks the position of Root.
+	Nodes []Node
+	// The document element.
+	Root *Element
+	// The DTD of the document, if it was parsed with
+	// ParseOptions.ParseDTD set and has a document type
+	// declaration.
+	DTD *dtd.DTD
+}
+
+// ParseDocument is like Parse, but records the Nodes of every Element
+// in the document, so that text, comments, processing instructions
+// and CDATA sections are preserved in document order. The Document
+// returned by ParseDocument can be encoded with MarshalDocument to
+// reproduce the original document.
+func ParseDocument(doc []byte) (*Document, error) {
+	return newScanner(doc).parseDocument()
+}
+
+func (s *scanner) parseDocument() (*Document, error) {
+	s.nodes = true
+	result := new(Document)
+
+	for s.scan() {
+		if start, ok := s.tok.(xml.StartElement); ok && result.Root == nil {
+			result.Root = &Element{StartElement: start}
+			if err := result.Root.parse(s, 0); err != nil {
+				return nil, err
+			}
+			result.Nodes = append(result.Nodes, Node{Kind: ElementNode})
+			continue
+		}
+		result.Nodes = append(result.Nodes, s.node())
+	}
+	if s.err != io.EOF {
+		return nil, s.err
+	}
+	if result.Root == nil {
+		return nil, io.ErrUnexpectedEOF
+	}
+	if s.dtd != nil {
+		result.DTD = s.dtd
+		result.Root.applyDTD(s.dtd)
+	}
+	return result, nil
+}
+
+// ContentNodes returns the content of an Element as a list of Nodes,
+// in document order. If the Nodes field of el is set, it is returned.
+// Otherwise, the Nodes are recovered from el.Content; CDATA sections
+// are returned as text. If the Content of el is not consistent with its
+// Children, only its child elements are returned.
+func (el *Element) ContentNodes() []Node {
+	if el.Nodes != nil {
+		return el.Nodes
+	}
+	items := el.contentItems()
+	nodes := make([]Node, 0, len(items))
+	for _, item := range items {
+		nodes = append(nodes, Node{
+			Kind:   item.kind,
+			Data:   []byte(item.data),
+			Target: item.target,
+			Child:  item.child,
+		})
+	}
+	return nodes
+}
+
+// node converts the current token, which must not be an element
+// tag, to a Node.
+func (s *scanner) node() Node {
+	switch tok := s.tok.(type) {
+	case xml.CharData:
+		raw := s.data(s.pos.Offset, s.InputOffset())
+		if bytes.HasPrefix(raw, []byte("<![CDATA[")) {
+			return Node{Kind: CDATANode, Data: tok.Copy()}
+		}
+		return Node{Kind: TextNode, Data: tok.Copy()}
+	case xml.Comment:
+		return Node{Kind: CommentNode, Data: tok.Copy()}
+	case xml.ProcInst:
+		return Node{Kind: ProcInstNode, Target: tok.Target, Data: append([]byte(nil), tok.Inst...)}
+	case xml.Directive:
+		return Node{Kind: DirectiveNode, Data: tok.Copy()}
+	}
+	panic("xmltree: unexpected token in node")
+}
+
+// MarshalDocument produces the XML encoding of a Document. Text,
+// comments, processing instructions and CDATA sections recorded in the
+// Nodes of the Document and its Elements are reproduced in their
+// original order. As with Marshal, the output is encoded in UTF-8;
+// the encoding declared in the XML declaration is adjusted to match.
+func MarshalDocument(doc *Document) []byte {
+	var buf bytes.Buffer
+	if err := EncodeDocument(&buf, doc); err != nil {
+		// bytes.Buffer.Write should never return an error
+		panic(err)
+	}
+	return buf.Bytes()
+}
+
+// MarshalDocumentIndent is like MarshalDocument, but places each
+// element, comment and processing instruction on its own line,
+// indented by one copy of indent per level of nesting. White space
+// between them is discarded. Elements that contain text other than
+// white space, or CDATA sections, are written as-is, so that their
+// content is not changed.
+func MarshalDocumentIndent(doc *Document, indent string) []byte {
+	var buf bytes.Buffer
+	enc := encoder{w: &buf, indent: indent, pretty: true, indentNodes: true}
+	if err := enc.encodeDocument(doc); err != nil {
+		panic(err)
+	}
+	return buf.Bytes()
+}
+
+// EncodeDocument writes the XML encoding of a Document to w.
+// EncodeDocument returns any errors encountered writing to w.
+func EncodeDocument(w io.Writer, doc *Document) error {
+	enc := encoder{w: w}
+	return enc.encodeDocument(doc)
+}
+
+func (e *encoder) encodeDocument(doc *Document) error {
+	w := e.w
+	for _, n := range doc.Nodes {
+		if e.pretty && n.Kind == TextNode {
+			continue
+		}
+		if n.Kind == ElementNode {
+			if doc.Root == nil {
+				continue
+			}
+			if err := e.encode(doc.Root, nil, make(map[*Element]struct{})); err != nil {
+				return err
+			}
+			continue
+		}
+		if n.Kind == ProcInstNode && n.Target == "xml" {
+			n.Data = utf8Declaration(n.Data)
+		}
+		if err := writeNode(w, n); err != nil {
+			return err
+		}
+		if e.pretty {
+			if _, err := io.WriteString(w, "\n"); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// utf8Declaration replaces the encoding declared in the body of an
+// XML declaration with UTF-8.
+func utf8Declaration(decl []byte) []byte {
+	s := string(decl)
+	i := strings.Index(s, "encoding")
+	if i < 0 {
+		return decl
+	}
+	j := strings.IndexAny(s[i:], `"'`)
+	if j < 0 {
+		return decl
+	}
+	j += i
+	k := strings.IndexByte(s[j+1:], s[j])
+	if k < 0 {
+		return decl
+	}
+	k += j + 1
+	if strings.EqualFold(s[j+1:k], "utf-8") {
+		return decl
+	}
+	return []byte(s[:j+1] + "UTF-8" + s[k:])
+}
+
+// writeNode writes the XML encoding of any Node other than an
+// element node.
+func writeNode(w io.Writer, n Node) error {
+	var err error
+	switch n.Kind {
+	case TextNode:
+		err = escapeText(w, n.Data)
+	case CDATANode:
+		// "]]>" cannot appear in a CDATA section; split
+		// it across two sections.
+		data := bytes.ReplaceAll(n.Data, []byte("]]>"), []byte("]]]]><![CDATA[>"))
+		err = writeAll(w, "<![CDATA[", data, "]]>")
+	case CommentNode:
+		err = writeAll(w, "<!--", n.Data, "-->")
+	case ProcInstNode:
+		if len(n.Data) > 0 {
+			err = writeAll(w, "<?"+n.Target+" ", n.Data, "?>")
+		} else {
+			err = writeAll(w, "<?"+n.Target, nil, "?>")
+		}
+	case DirectiveNode:
+		err = writeAll(w, "<!", n.Data, ">")
+	}
+	return err
+}
+
+func writeAll(w io.Writer, open string, data []byte, close string) error {
+	if _, err := io.WriteString(w, open); err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, close)
+	return err
+}
+
+// escapeText writes character data, escaping only what is necessary
+// for it to be read back unchanged.
+func escapeText(w io.Writer, data []byte) error {
+	last := 0
+	for i, c := range data {
+		var esc string
+		switch c {
+		case '&':
+			esc = "&amp;"
+		case '<':
+			esc = "&lt;"
+		case '>':
+			esc = "&gt;"
+		case '\r':
+			esc = "&#xD;"
+		default:
+			continue
+		}
+		if _, err := w.Write(data[last:i]); err != nil {
+			return err
+		}
+		if _, err := io.WriteString(w, esc); err != nil {
+			return err
+		}
+		last = i + 1
+	}
+	_, err := w.Write(data[last:])
+	return err
+}
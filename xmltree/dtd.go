@@ -0,0 +1,517 @@
+package xmltree
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/m29h/go-xml/dtd"
+	"golang.org/x/net/html/charset"
+)
+
+// The encoding/xml package does not read document type declarations,
+// so xmltree processes the DTD of a document before parsing it, when
+// ParseOptions.ParseDTD is set. References to declared entities are
+// replaced by their replacement text, and default attribute values are
+// added to start tags, producing a document that encoding/xml can
+// parse. Because default attributes are added before namespaces are
+// resolved, defaults for xmlns attributes declare namespaces, as they
+// would for a namespace-aware XML processor.
+
+// ID returns the value of the ID attribute of el, or the empty string
+// if it has none. An ID attribute is an attribute declared with type ID
+// in the DTD of a document parsed with ParseOptions.ParseDTD, or an
+// xml:id attribute.
+func (el *Element) ID() string {
+	for _, a := range el.StartElement.Attr {
+		if a.Name == xmlIDName || (el.idAttr.Local != "" && a.Name == el.idAttr) {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+var encodingDecl = regexp.MustCompile(`^<\?xml[^>]*encoding\s*=\s*["']([^"']*)["']`)
+
+// expandDTD parses the document type declaration of doc, if any, and
+// returns the document with entity references expanded and default
+// attributes added, along with the DTD.
+func (opts *ParseOptions) expandDTD(doc []byte) ([]byte, *dtd.DTD, error) {
+	if m := encodingDecl.FindSubmatch(doc); m != nil {
+		label := strings.ToLower(string(m[1]))
+		if label != "utf-8" && label != "utf8" && label != "us-ascii" {
+			r, err := charset.NewReaderLabel(label, bytes.NewReader(doc))
+			if err != nil {
+				return nil, nil, err
+			}
+			utf8doc, err := io.ReadAll(r)
+			if err != nil {
+				return nil, nil, err
+			}
+			end := bytes.Index(utf8doc, []byte("?>"))
+			doc = append(append([]byte("<?"), utf8Declaration(utf8doc[2:end])...), utf8doc[end:]...)
+		}
+	}
+	start, end := findDoctype(doc)
+	if start < 0 {
+		return doc, nil, nil
+	}
+	max := opts.maxEntityExpansion()
+	types, err := dtd.ParseDoctype(doc[start+2:end-1], &dtd.Options{
+		Resolver:     opts.DTDResolver,
+		MaxExpansion: max,
+	})
+	if errors.Is(err, dtd.ErrExpansionLimit) {
+		return nil, nil, &LimitError{Limit: LimitEntityExpansion, Max: max}
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	x := expander{dtd: types, resolver: opts.DTDResolver, max: max}
+	x.buf.Grow(len(doc))
+	x.buf.Write(doc[:end])
+	if err := x.content(string(doc[end:])); err != nil {
+		return nil, nil, err
+	}
+	if !x.changed {
+		return doc, types, nil
+	}
+	return x.buf.Bytes(), types, nil
+}
+
+func (opts *ParseOptions) maxEntityExpansion() int64 {
+	if opts == nil || opts.MaxEntityExpansion <= 0 {
+		return dtd.DefaultMaxExpansion
+	}
+	return opts.MaxEntityExpansion
+}
+
+// findDoctype returns the offsets of the start and end of the document
+// type declaration in doc, or -1 if there is none.
+func findDoctype(doc []byte) (start, end int) {
+	i := 0
+	for i < len(doc) {
+		switch {
+		case isXMLSpace(rune(doc[i])):
+			i++
+		case bytes.HasPrefix(doc[i:], []byte("\xef\xbb\xbf")):
+			i += 3
+		case bytes.HasPrefix(doc[i:], []byte("<?")):
+			i = skipPast(doc, i, "?>")
+		case bytes.HasPrefix(doc[i:], []byte("<!--")):
+			i = skipPast(doc, i, "-->")
+		case bytes.HasPrefix(doc[i:], []byte("<!DOCTYPE")):
+			if end := doctypeEnd(doc, i); end > 0 {
+				return i, end
+			}
+			return -1, -1
+		default:
+			return -1, -1
+		}
+	}
+	return -1, -1
+}
+
+func skipPast(doc []byte, i int, s string) int {
+	j := bytes.Index(doc[i:], []byte(s))
+	if j < 0 {
+		return len(doc)
+	}
+	return i + j + len(s)
+}
+
+// doctypeEnd returns the offset following the document type
+// declaration starting at i, or -1 if it is not terminated.
+func doctypeEnd(doc []byte, i int) int {
+	subset := false
+	for i < len(doc) {
+		switch c := doc[i]; {
+		case c == '"' || c == '\'':
+			i = skipPast(doc, i+1, string(c))
+		case subset && bytes.HasPrefix(doc[i:], []byte("<!--")):
+			i = skipPast(doc, i, "-->")
+		case subset && bytes.HasPrefix(doc[i:], []byte("<?")):
+			i = skipPast(doc, i, "?>")
+		case c == '[':
+			subset = true
+			i++
+		case c == ']':
+			subset = false
+			i++
+		case c == '>' && !subset:
+			return i + 1
+		default:
+			i++
+		}
+	}
+	return -1
+}
+
+// An expander rewrites the content of a document, replacing entity
+// references and adding default attributes.
+type expander struct {
+	dtd      *dtd.DTD
+	resolver dtd.Resolver
+	buf      bytes.Buffer
+	// the entities being expanded
+	stack    []string
+	expanded int64
+	max      int64
+	changed  bool
+}
+
+// content copies the markup and character data in src, expanding
+// entity references and adding default attributes to start tags.
+// Malformed markup is copied as it is, to be reported by the parser.
+func (x *expander) content(src string) error {
+	for len(src) > 0 {
+		i := strings.IndexAny(src, "<&")
+		if i < 0 {
+			x.buf.WriteString(src)
+			return nil
+		}
+		x.buf.WriteString(src[:i])
+		src = src[i:]
+		var n int
+		var err error
+		switch {
+		case strings.HasPrefix(src, "<!--"):
+			n = copyPast(src, "-->")
+		case strings.HasPrefix(src, "<![CDATA["):
+			n = copyPast(src, "]]>")
+		case strings.HasPrefix(src, "<?"):
+			n = copyPast(src, "?>")
+		case strings.HasPrefix(src, "<!"), strings.HasPrefix(src, "</"):
+			n = copyPast(src, ">")
+		case src[0] == '<':
+			n, err = x.startTag(src)
+		default:
+			n, err = x.reference(src, false)
+		}
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			// not recognized; let the parser report it
+			x.buf.WriteByte(src[0])
+			n = 1
+		} else if n > 0 {
+			x.buf.WriteString(src[:n])
+		} else {
+			n = -n
+		}
+		src = src[n:]
+	}
+	return nil
+}
+
+// copyPast returns the length of the prefix of src up to and
+// including the first occurrence of s.
+func copyPast(src, s string) int {
+	i := strings.Index(src, s)
+	if i < 0 {
+		return len(src)
+	}
+	return i + len(s)
+}
+
+func xmlName(s string) int {
+	n := 0
+	for n < len(s) {
+		c := s[n]
+		if c == '_' || c == ':' || c == '-' || c == '.' || c >= 0x80 ||
+			'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' {
+			n++
+			continue
+		}
+		break
+	}
+	return n
+}
+
+// reference handles the entity or character reference at the start
+// of src. It returns the length of the reference if it is copied as it
+// is, the negated length if its replacement text was written, or 0 if
+// it is malformed. Within attribute values, quotes in replacement text
+// are escaped.
+func (x *expander) reference(src string, attr bool) (int, error) {
+	end := strings.IndexByte(src, ';')
+	if end < 0 {
+		return 0, nil
+	}
+	name := src[1:end]
+	if strings.HasPrefix(name, "#") {
+		return end + 1, nil
+	}
+	switch name {
+	case "lt", "gt", "amp", "apos", "quot":
+		return end + 1, nil
+	}
+	e := x.dtd.Entity(name)
+	if e == nil {
+		// an error in a well-formed document
+		return end + 1, nil
+	}
+	if e.Notation != "" {
+		return 0, fmt.Errorf("xmltree: reference to unparsed entity &%s;", name)
+	}
+	for _, s := range x.stack {
+		if s == name {
+			return 0, fmt.Errorf("xmltree: recursive reference to entity &%s;", name)
+		}
+	}
+	if len(x.stack) >= 64 {
+		return 0, &LimitError{Limit: LimitEntityExpansion, Max: x.max}
+	}
+	text := e.Value
+	if e.External() {
+		if attr {
+			return 0, fmt.Errorf("xmltree: reference to external entity &%s; in attribute value", name)
+		}
+		if x.resolver == nil {
+			return 0, fmt.Errorf("xmltree: cannot expand external entity &%s; without a DTDResolver", name)
+		}
+		data, err := x.resolver(e.PublicID, e.SystemID)
+		if err != nil {
+			return 0, fmt.Errorf("xmltree: loading entity &%s;: %w", name, err)
+		}
+		text = string(stripTextDecl(data))
+	}
+	x.expanded += int64(len(text))
+	if x.expanded > x.max {
+		return 0, &LimitError{Limit: LimitEntityExpansion, Max: x.max}
+	}
+	x.changed = true
+	x.stack = append(x.stack, name)
+	var err error
+	if attr {
+		err = x.attrValue(text)
+	} else {
+		mark := x.buf.Len()
+		err = x.content(text)
+		if err == nil && !balanced(x.buf.Bytes()[mark:]) {
+			err = fmt.Errorf("xmltree: syntax error: replacement text of entity &%s; is not balanced markup", name)
+		}
+	}
+	x.stack = x.stack[:len(x.stack)-1]
+	return -(end + 1), err
+}
+
+// balanced reports whether every start tag in the expanded text b is
+// closed by an end tag within b, and every end tag closes a start tag
+// within b, as XML requires of the replacement text of an entity.
+func balanced(b []byte) bool {
+	depth := 0
+	for {
+		i := bytes.IndexByte(b, '<')
+		if i < 0 {
+			return depth == 0
+		}
+		b = b[i:]
+		var end []byte
+		switch {
+		case bytes.HasPrefix(b, []byte("<!--")):
+			end = []byte("-->")
+		case bytes.HasPrefix(b, []byte("<![CDATA[")):
+			end = []byte("]]>")
+		case bytes.HasPrefix(b, []byte("<?")):
+			end = []byte("?>")
+		case bytes.HasPrefix(b, []byte("</")):
+			if depth--; depth < 0 {
+				return false
+			}
+			end = []byte(">")
+		default:
+			// Start tags have been rewritten by startTag, so
+			// attribute values are quoted with '"' and do not
+			// contain it.
+			n := tagEnd(b)
+			if n < 0 {
+				return false
+			}
+			if b[n-2] != '/' {
+				depth++
+			}
+			b = b[n:]
+			continue
+		}
+		n := bytes.Index(b, end)
+		if n < 0 {
+			return false
+		}
+		b = b[n+len(end):]
+	}
+}
+
+// tagEnd returns the length of the start tag at the beginning of b, or
+// -1 if it is not terminated.
+func tagEnd(b []byte) int {
+	quoted := false
+	for i, c := range b {
+		switch {
+		case c == '"':
+			quoted = !quoted
+		case c == '>' && !quoted:
+			return i + 1
+		}
+	}
+	return -1
+}
+
+// stripTextDecl removes the byte order mark and text declaration
+// that may begin an external entity.
+func stripTextDecl(data []byte) []byte {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	if bytes.HasPrefix(data, []byte("<?xml")) && len(data) > 5 && isXMLSpace(rune(data[5])) {
+		if i := bytes.Index(data, []byte("?>")); i >= 0 {
+			data = data[i+2:]
+		}
+	}
+	return data
+}
+
+// attrValue writes an attribute value, expanding entity references
+// and escaping double quotes, so that the value may be written between
+// double quotes.
+func (x *expander) attrValue(value string) error {
+	for len(value) > 0 {
+		i := strings.IndexAny(value, "&<\"")
+		if i < 0 {
+			x.buf.WriteString(value)
+			return nil
+		}
+		x.buf.WriteString(value[:i])
+		value = value[i:]
+		switch value[0] {
+		case '"':
+			x.buf.WriteString("&quot;")
+			value = value[1:]
+		case '<':
+			return errors.New("xmltree: '<' in attribute value")
+		case '&':
+			n, err := x.reference(value, true)
+			if err != nil {
+				return err
+			}
+			if n == 0 {
+				x.buf.WriteByte('&')
+				n = 1
+			} else if n > 0 {
+				x.buf.WriteString(value[:n])
+			} else {
+				n = -n
+			}
+			value = value[n:]
+		}
+	}
+	return nil
+}
+
+// startTag rewrites the start tag at the beginning of src. It returns
+// the negated length of the tag, or 0 if the tag is malformed.
+func (x *expander) startTag(src string) (int, error) {
+	name := src[1 : 1+xmlName(src[1:])]
+	if name == "" {
+		return 0, nil
+	}
+	mark := x.buf.Len()
+	x.buf.WriteString("<" + name)
+	seen := make(map[string]bool)
+	i := 1 + len(name)
+	for {
+		j := i
+		for j < len(src) && isXMLSpace(rune(src[j])) {
+			j++
+		}
+		if j == len(src) {
+			x.buf.Truncate(mark)
+			return 0, nil
+		}
+		if src[j] == '>' || strings.HasPrefix(src[j:], "/>") {
+			x.defaults(name, seen)
+			x.buf.WriteString(src[i:j])
+			if src[j] == '>' {
+				x.buf.WriteString(">")
+				return -(j + 1), nil
+			}
+			x.buf.WriteString("/>")
+			return -(j + 2), nil
+		}
+		attr := src[j : j+xmlName(src[j:])]
+		k := j + len(attr)
+		for k < len(src) && isXMLSpace(rune(src[k])) {
+			k++
+		}
+		if attr == "" || j == i || k == len(src) || src[k] != '=' {
+			x.buf.Truncate(mark)
+			return 0, nil
+		}
+		k++
+		for k < len(src) && isXMLSpace(rune(src[k])) {
+			k++
+		}
+		if k == len(src) || (src[k] != '"' && src[k] != '\'') {
+			x.buf.Truncate(mark)
+			return 0, nil
+		}
+		end := strings.IndexByte(src[k+1:], src[k])
+		if end < 0 {
+			x.buf.Truncate(mark)
+			return 0, nil
+		}
+		value := src[k+1 : k+1+end]
+		seen[attr] = true
+		x.buf.WriteString(src[i:j] + attr + `="`)
+		if err := x.attrValue(value); err != nil {
+			return 0, err
+		}
+		x.buf.WriteString(`"`)
+		i = k + 1 + end + 1
+	}
+}
+
+// defaults writes the default values of the attributes of the element
+// name that are not in seen.
+func (x *expander) defaults(name string, seen map[string]bool) {
+	for _, a := range x.dtd.AttributesOf(name) {
+		if seen[a.Name] || (a.DefaultKind != dtd.Default && a.DefaultKind != dtd.Fixed) {
+			continue
+		}
+		x.buf.WriteString(" " + a.Name + `="` + escapeAttr(a.Value) + `"`)
+		x.changed = true
+	}
+}
+
+// applyDTD normalizes the values of attributes declared in d with types
+// other than CDATA, and records attributes declared with type ID.
+func (el *Element) applyDTD(d *dtd.DTD) {
+	for _, e := range append([]*Element{el}, el.Flatten()...) {
+		name := e.Name.Local
+		if e.prefix != "" {
+			name = e.prefix + ":" + name
+		}
+		decls := d.AttributesOf(name)
+		if len(decls) == 0 {
+			continue
+		}
+		for i := range e.StartElement.Attr {
+			attr := &e.StartElement.Attr[i]
+			qname := attr.Name.Local
+			if i < len(e.attrSrc) && e.attrSrc[i].prefix != "" {
+				qname = e.attrSrc[i].prefix + ":" + qname
+			}
+			for _, decl := range decls {
+				if decl.Name != qname {
+					continue
+				}
+				attr.Value = decl.Normalize(attr.Value)
+				if decl.Type == dtd.ID {
+					e.idAttr = attr.Name
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,322 @@
+package xmltree
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strconv"
+)
+
+// This file contains methods for building and modifying Element trees.
+// Elements added to a tree are copied, and their Scope is rewritten so
+// that it extends the Scope of their new parent, declaring any
+// namespaces they use that are not already in scope. Because Children
+// is a slice of values, adding or removing a child may move its
+// siblings, invalidating any pointers to them or their descendants.
+
+// NewElement returns a new Element with the given name, and no
+// attributes or content. If space is not empty, it is declared as
+// the default namespace of the Element.
+func NewElement(space, local string) *Element {
+	el := &Element{
+		StartElement: xml.StartElement{Name: xml.Name{Space: space, Local: local}},
+	}
+	if space != "" {
+		el.ns = []xml.Name{{Space: space}}
+	}
+	return el
+}
+
+// AppendChild adds a copy of child to the end of el's children, and
+// returns a pointer to the copy.
+func (el *Element) AppendChild(child *Element) *Element {
+	return el.InsertBefore(child, nil)
+}
+
+// InsertBefore adds a copy of child to el's children, immediately
+// before ref, and returns a pointer to the copy. If ref is nil, the
+// child is added to the end of el's children. InsertBefore panics if
+// ref is not nil and is not a child of el.
+func (el *Element) InsertBefore(child, ref *Element) *Element {
+	i := len(el.Children)
+	if ref != nil {
+		if i = el.childIndex(ref); i < 0 {
+			panic("xmltree: InsertBefore reference element is not a child")
+		}
+	}
+	dup := el.adopt(child)
+	if el.Nodes != nil {
+		pos := len(el.Nodes)
+		for j, n := range el.Nodes {
+			if n.Kind == ElementNode && n.Child == i && ref != nil {
+				pos = j
+				break
+			}
+		}
+		nodes := make([]Node, 0, len(el.Nodes)+1)
+		nodes = append(nodes, el.Nodes[:pos]...)
+		nodes = append(nodes, Node{Kind: ElementNode, Child: i})
+		for _, n := range el.Nodes[pos:] {
+			if n.Kind == ElementNode && n.Child >= i {
+				n.Child++
+			}
+			nodes = append(nodes, n)
+		}
+		el.Nodes = nodes
+	}
+	children := make([]Element, 0, len(el.Children)+1)
+	children = append(children, el.Children[:i]...)
+	children = append(children, dup)
+	el.Children = append(children, el.Children[i:]...)
+	el.syncContent()
+	return &el.Children[i]
+}
+
+// ReplaceChild replaces old, which must be a child of el, with a copy
+// of child, and returns a pointer to the copy. ReplaceChild panics if
+// old is not a child of el.
+func (el *Element) ReplaceChild(child, old *Element) *Element {
+	i := el.childIndex(old)
+	if i < 0 {
+		panic("xmltree: ReplaceChild argument is not a child")
+	}
+	dup := el.adopt(child)
+	el.Children = append([]Element(nil), el.Children...)
+	el.Children[i] = dup
+	el.syncContent()
+	return &el.Children[i]
+}
+
+// RemoveChild removes child from el's children, and returns it. The
+// returned Element retains the Scope of its former location, so
+// it may be marshaled on its own or moved elsewhere with AppendChild
+// or InsertBefore. RemoveChild returns nil if child is not a child
+// of el.
+func (el *Element) RemoveChild(child *Element) *Element {
+	i := el.childIndex(child)
+	if i < 0 {
+		return nil
+	}
+	removed := el.Children[i]
+	if el.Nodes != nil {
+		nodes := make([]Node, 0, len(el.Nodes))
+		for _, n := range el.Nodes {
+			if n.Kind == ElementNode {
+				if n.Child == i {
+					continue
+				} else if n.Child > i {
+					n.Child--
+				}
+			}
+			nodes = append(nodes, n)
+		}
+		el.Nodes = nodes
+	}
+	children := make([]Element, 0, len(el.Children)-1)
+	children = append(children, el.Children[:i]...)
+	el.Children = append(children, el.Children[i+1:]...)
+	el.syncContent()
+	return &removed
+}
+
+// SetText replaces the content of el, including any children, with
+// the given text.
+func (el *Element) SetText(text string) {
+	el.Children = nil
+	if el.Nodes != nil {
+		el.Nodes = []Node{}
+		if text != "" {
+			el.Nodes = append(el.Nodes, Node{Kind: TextNode, Data: []byte(text)})
+		}
+	}
+	var buf bytes.Buffer
+	escapeText(&buf, []byte(text))
+	el.Content = buf.Bytes()
+}
+
+// RemoveAttr removes the first attribute whose name matches the space
+// and local arguments, using the same rules as Attr.
+func (el *Element) RemoveAttr(space, local string) {
+	for i, a := range el.StartElement.Attr {
+		if a.Name.Local != local || (space != "" && a.Name.Space != space) {
+			continue
+		}
+		attrs := make([]xml.Attr, 0, len(el.StartElement.Attr)-1)
+		attrs = append(attrs, el.StartElement.Attr[:i]...)
+		el.StartElement.Attr = append(attrs, el.StartElement.Attr[i+1:]...)
+		if i < len(el.attrSrc) {
+			src := make([]attrSource, 0, len(el.attrSrc)-1)
+			src = append(src, el.attrSrc[:i]...)
+			el.attrSrc = append(src, el.attrSrc[i+1:]...)
+		}
+		return
+	}
+}
+
+// childIndex returns the index of child in el.Children, or -1.
+func (el *Element) childIndex(child *Element) int {
+	for i := range el.Children {
+		if &el.Children[i] == child {
+			return i
+		}
+	}
+	return -1
+}
+
+// syncContent updates the Content of el after its Children have been
+// modified. Without Nodes, the text between children cannot be
+// kept consistent with them, so it is dropped, as it is by Marshal.
+func (el *Element) syncContent() {
+	if len(el.Children) > 0 || el.Nodes == nil {
+		el.Content = nil
+		return
+	}
+	var buf bytes.Buffer
+	for _, n := range el.Nodes {
+		writeNode(&buf, n)
+	}
+	el.Content = buf.Bytes()
+}
+
+// adopt returns a copy of child, with its Scope and the Scope of its
+// descendants rewritten to extend the Scope of el.
+func (el *Element) adopt(child *Element) Element {
+	dup := *child
+	// If child was created within el's scope, only the
+	// declarations made by child are kept.
+	var old []xml.Name
+	if hasScope(child.ns, el.ns) {
+		old = el.ns
+	}
+	dup.rescope(el.ns, old, 0)
+	return dup
+}
+
+// rescope replaces the prefix old of the Scope of el and its
+// descendants with outer, and declares any missing namespaces. The
+// Children, attributes and Nodes of el are copied, so that they are
+// not shared with the original tree.
+func (el *Element) rescope(outer, old []xml.Name, depth int) {
+	if depth > recursionLimit {
+		return
+	}
+	orig := el.ns
+	local := el.ns
+	if hasScope(el.ns, old) {
+		local = el.ns[len(old):]
+	}
+	el.ns = outer[:len(outer):len(outer)]
+	for _, decl := range local {
+		// Skip declarations that are already in effect.
+		name, ok := el.ResolveNS(decl.Local + ":x")
+		if decl.Local == "" {
+			name, ok = el.ResolveNS("x")
+		}
+		if name.Space == decl.Space && (ok || decl.Space == "") {
+			continue
+		}
+		el.pushDecl(decl)
+	}
+	el.StartElement.Attr = append([]xml.Attr(nil), el.StartElement.Attr...)
+	if el.Nodes != nil {
+		el.Nodes = append([]Node{}, el.Nodes...)
+	}
+	el.declareNS()
+	if el.Children != nil {
+		el.Children = append([]Element(nil), el.Children...)
+	}
+	for i := range el.Children {
+		el.Children[i].rescope(el.ns, orig, depth+1)
+	}
+}
+
+// hasScope reports whether the namespace list outer is a
+// prefix of ns.
+func hasScope(ns, outer []xml.Name) bool {
+	if len(outer) > len(ns) {
+		return false
+	}
+	for i := range outer {
+		if ns[i] != outer[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// declareNS adds declarations to el's Scope for the namespaces of
+// its name and attributes that cannot otherwise be expressed.
+func (el *Element) declareNS() {
+	switch space := el.Name.Space; space {
+	case xmlLangURI, xmlNamespaceURI:
+	case "":
+		// An element in no namespace must not be
+		// in the scope of a default namespace.
+		if name, _ := el.ResolveNS(el.Name.Local); name.Space != "" {
+			el.pushDecl(xml.Name{})
+		}
+	default:
+		if el.Prefix(el.Name) != "" {
+			break
+		}
+		if el.prefix != "" && !el.boundPrefix(el.prefix) {
+			el.pushDecl(xml.Name{Space: space, Local: el.prefix})
+		} else {
+			el.pushDecl(xml.Name{Space: space})
+		}
+	}
+	for _, a := range el.StartElement.Attr {
+		el.declareAttrNS(a.Name.Space)
+	}
+}
+
+// declareAttrNS ensures that a prefix is bound to the namespace space,
+// as attribute names are not affected by the default namespace.
+func (el *Element) declareAttrNS(space string) {
+	switch space {
+	case "", "xmlns", xmlLangURI, xmlNamespaceURI:
+		return
+	}
+	if el.attrPrefix(xml.Name{Space: space}) != "" {
+		return
+	}
+	for i := 1; ; i++ {
+		prefix := "ns" + strconv.Itoa(i)
+		if !el.boundPrefix(prefix) {
+			el.pushDecl(xml.Name{Space: space, Local: prefix})
+			return
+		}
+	}
+}
+
+// boundPrefix reports whether prefix is declared in el's Scope.
+func (el *Element) boundPrefix(prefix string) bool {
+	_, ok := el.ResolveNS(prefix + ":x")
+	return ok
+}
+
+func (el *Element) pushDecl(decl xml.Name) {
+	ns := make([]xml.Name, 0, len(el.ns)+1)
+	ns = append(append(ns, el.ns...), decl)
+	el.ns = ns[:len(ns):len(ns)]
+}
+
+// attrPrefix returns the prefix bound to the namespace of an attribute
+// name, or the empty string if there is none. Unlike Prefix, it
+// does not consider the default namespace, which does not apply to
+// attributes.
+func (scope *Scope) attrPrefix(name xml.Name) string {
+	if name.Space == "" {
+		return ""
+	}
+	for i := len(scope.ns) - 1; i >= 0; i-- {
+		decl := scope.ns[i]
+		if decl.Space != name.Space || decl.Local == "" {
+			continue
+		}
+		// The prefix may be rebound by a later declaration.
+		if name, _ := scope.ResolveNS(decl.Local + ":x"); name.Space == decl.Space {
+			return decl.Local
+		}
+	}
+	return ""
+}
@@ -2,7 +2,9 @@ package xmltree_test
 
 import (
 	"fmt"
+	"io"
 	"log"
+	"strings"
 
 	"github.com/m29h/go-xml/xmltree"
 )
@@ -225,7 +227,7 @@ func ExampleMarshal() {
 	// </toc>
 }
 
-func ExampleMarshalNested() {
+func Example_marshalNested() {
 	var input = []byte(`<?xml version="1.0" encoding="UTF-8"?>
 	<toc>
 	  <level1>
@@ -265,3 +267,78 @@ func ExampleMarshalNested() {
 	//   </level1>
 	// </toc>
 }
+
+func ExampleElement_Query() {
+	data := `
+	  <Staff xmlns:hr="urn:hr">
+        <Person hr:id="1" role="host">
+            <FullName>Ira Glass</FullName>
+        </Person>
+        <Person hr:id="2" role="host">
+            <FullName>Tom Magliozzi</FullName>
+        </Person>
+        <Person hr:id="3" role="guest">
+            <FullName>Terry Gross</FullName>
+        </Person>
+    </Staff>
+	`
+	root, err := xmltree.Parse([]byte(data))
+	if err != nil {
+		log.Fatal(err)
+	}
+	hosts, err := root.Query("/Staff/Person[@role='host' and @hr:id > 1]/FullName")
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, el := range hosts {
+		fmt.Printf("%s\n", el.Content)
+	}
+	count, err := root.QueryString("count(//Person)")
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(count)
+
+	// Output:
+	// Tom Magliozzi
+	// 3
+}
+
+func ExampleStream() {
+	data := `
+	  <export xmlns="urn:example:export" xmlns:t="urn:example:types">
+        <record type="t:person"><name>Ira Glass</name></record>
+        <record type="t:person"><name>Tom Magliozzi</name></record>
+        <record type="t:company"><name>WBEZ</name></record>
+      </export>
+	`
+	stream := xmltree.NewStream(strings.NewReader(data))
+	for {
+		el, err := stream.Next("urn:example:export", "record")
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			log.Fatal(err)
+		}
+		typ := el.Resolve(el.Attr("", "type"))
+		fmt.Printf("%s %s\n", typ.Local, el.Children[0].Content)
+	}
+
+	// Output:
+	// person Ira Glass
+	// person Tom Magliozzi
+	// company WBEZ
+}
+
+func ExampleNewElement() {
+	feed := xmltree.NewElement("http://www.w3.org/2005/Atom", "feed")
+	feed.AppendChild(xmltree.NewElement("http://www.w3.org/2005/Atom", "title")).SetText("Example Feed")
+	entry := feed.AppendChild(xmltree.NewElement("http://www.w3.org/2005/Atom", "entry"))
+	entry.SetAttr("http://www.w3.org/XML/1998/namespace", "lang", "en")
+	entry.AppendChild(xmltree.NewElement("http://purl.org/dc/elements/1.1/", "creator")).SetText("Ira Glass")
+
+	fmt.Println(feed)
+
+	// Output:
+	// <feed xmlns="http://www.w3.org/2005/Atom"><title>Example Feed</title><entry xml:lang="en"><creator xmlns="http://purl.org/dc/elements/1.1/">Ira Glass</creator></entry></feed>
+}
@@ -0,0 +1,207 @@
+package xmltree
+
+import (
+	"encoding/xml"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// NormalizeNamespaces rewrites the namespace declarations of el and its
+// descendants. Declarations that are not used are removed, and the
+// remaining declarations are moved to el, the outermost element that
+// can hold them. A prefix that is bound to different namespaces in
+// different parts of the tree, or a default namespace that is undeclared
+// in some part of the tree, cannot be moved, and is declared on each
+// element that uses it instead.
+//
+// A declaration is used if its prefix appears in the name of an element
+// or attribute, or in front of a colon in an attribute value or the text
+// of an element, where it may be part of a QName. Documents that refer
+// to namespace prefixes in other ways may not survive normalization.
+func (el *Element) NormalizeNamespaces() {
+	uris := make(map[string][]string)
+	var order []string
+	for _, e := range append([]*Element{el}, el.Flatten()...) {
+		for _, b := range e.bindings() {
+			if _, ok := uris[b.Local]; !ok {
+				order = append(order, b.Local)
+			}
+			if !containsString(uris[b.Local], b.Space) {
+				uris[b.Local] = append(uris[b.Local], b.Space)
+			}
+		}
+	}
+	var root []xml.Name
+	hoisted := make(map[string]bool)
+	for _, prefix := range order {
+		if len(uris[prefix]) != 1 {
+			continue
+		}
+		hoisted[prefix] = true
+		if uri := uris[prefix][0]; prefix != "" || uri != "" {
+			root = append(root, xml.Name{Space: uri, Local: prefix})
+		}
+	}
+	el.renormalize(root, hoisted, 0)
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// renormalize replaces the Scope of el and its descendants with outer,
+// plus declarations for any bindings they use that are not hoisted.
+func (el *Element) renormalize(outer []xml.Name, hoisted map[string]bool, depth int) {
+	if depth > recursionLimit {
+		return
+	}
+	used := el.bindings()
+	el.ns = outer[:len(outer):len(outer)]
+	for _, b := range used {
+		if hoisted[b.Local] {
+			continue
+		}
+		qname := b.Local + ":x"
+		if b.Local == "" {
+			qname = "x"
+		}
+		if name, _ := el.ResolveNS(qname); name.Space != b.Space {
+			el.pushDecl(b)
+		}
+	}
+	// Trees that have been modified may use namespaces that no
+	// prefix was bound to.
+	el.declareNS()
+	for i := range el.Children {
+		el.Children[i].renormalize(el.ns, hoisted, depth+1)
+	}
+}
+
+// bindings returns the namespace bindings used by el, according to
+// its current Scope. The default namespace is included if the name
+// of el is unprefixed, even when it is not in a namespace.
+func (el *Element) bindings() []xml.Name {
+	var result []xml.Name
+	add := func(prefix string) {
+		qname := prefix + ":x"
+		if prefix == "" {
+			qname = "x"
+		}
+		name, ok := el.ResolveNS(qname)
+		if prefix != "" && !ok {
+			return
+		}
+		b := xml.Name{Space: name.Space, Local: prefix}
+		for _, v := range result {
+			if v == b {
+				return
+			}
+		}
+		result = append(result, b)
+	}
+	switch el.Name.Space {
+	case xmlLangURI, xmlNamespaceURI:
+	case "":
+		result = append(result, xml.Name{})
+	default:
+		if el.prefix != "" && el.boundPrefix(el.prefix) {
+			if name, _ := el.ResolveNS(el.prefix + ":x"); name.Space == el.Name.Space {
+				add(el.prefix)
+				break
+			}
+		}
+		qname := el.Prefix(el.Name)
+		if i := strings.IndexByte(qname, ':'); i >= 0 {
+			add(qname[:i])
+		} else if qname != "" {
+			add("")
+		}
+	}
+	for i, a := range el.StartElement.Attr {
+		switch a.Name.Space {
+		case "", "xmlns", xmlLangURI, xmlNamespaceURI:
+		default:
+			if i < len(el.attrSrc) && el.attrSrc[i].prefix != "" {
+				if name, ok := el.ResolveNS(el.attrSrc[i].prefix + ":x"); ok && name.Space == a.Name.Space {
+					add(el.attrSrc[i].prefix)
+					break
+				}
+			}
+			if prefix := el.attrPrefix(a.Name); prefix != "" {
+				add(prefix)
+			}
+		}
+		for _, prefix := range qnamePrefixes(a.Value) {
+			add(prefix)
+		}
+	}
+	for _, item := range el.contentItems() {
+		if item.kind == TextNode || item.kind == CDATANode {
+			for _, prefix := range qnamePrefixes(item.data) {
+				add(prefix)
+			}
+		}
+	}
+	return result
+}
+
+// qnamePrefixes returns the strings in s that could be the prefix of a
+// QName: names immediately followed by a colon.
+func qnamePrefixes(s string) []string {
+	var result []string
+	for {
+		i := strings.IndexByte(s, ':')
+		if i < 0 {
+			return result
+		}
+		j := i
+		for j > 0 {
+			r, size := utf8.DecodeLastRuneInString(s[:j])
+			if !isNameChar(r) {
+				break
+			}
+			j -= size
+		}
+		if r, _ := utf8.DecodeRuneInString(s[j:i]); j < i && isNameStart(r) {
+			result = append(result, s[j:i])
+		}
+		s = s[i+1:]
+	}
+}
+
+// SortAttrs sorts the attributes of el and its descendants by their
+// qualified names, with unprefixed attributes first.
+func (el *Element) SortAttrs() {
+	for _, e := range append([]*Element{el}, el.Flatten()...) {
+		attrs := e.StartElement.Attr
+		perm := make([]int, len(attrs))
+		keys := make([]string, len(attrs))
+		for i, a := range attrs {
+			perm[i] = i
+			keys[i] = attrName(e.Scope, a.Name)
+			if strings.IndexByte(keys[i], ':') < 0 {
+				// sorts before any prefixed name
+				keys[i] = "\x00" + keys[i]
+			}
+		}
+		sort.SliceStable(perm, func(i, j int) bool {
+			return keys[perm[i]] < keys[perm[j]]
+		})
+		sorted := make([]xml.Attr, len(attrs))
+		src := make([]attrSource, len(attrs))
+		for i, p := range perm {
+			sorted[i] = attrs[p]
+			if p < len(e.attrSrc) {
+				src[i] = e.attrSrc[p]
+			}
+		}
+		e.StartElement.Attr = sorted
+		e.attrSrc = src
+	}
+}
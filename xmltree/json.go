@@ -0,0 +1,639 @@
+package xmltree
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// A JSONConvention describes how an XML document is represented
+// in JSON.
+//
+// With the BadgerFish convention, an element is an object with a
+// single member named after the element. Its value is an object in
+// which attributes are members whose names start with "@", the text of
+// the element is the member "$", and each child element is a member
+// named after the child. Namespace declarations made by an element are
+// held in an object named "@xmlns", whose member "$" is the default
+// namespace, and whose other members are named after the declared
+// prefixes:
+//
+//	<book xmlns="urn:b" xmlns:x="urn:x" id="1"><title>Go</title><x:tag>a</x:tag></book>
+//
+//	{"book":{"@xmlns":{"$":"urn:b","x":"urn:x"},"@id":"1","title":{"$":"Go"},"x:tag":{"$":"a"}}}
+//
+// With the Parker convention, the document element is represented by
+// its value alone, attributes and namespace declarations are dropped,
+// an element containing only text is represented by its text, and
+// an element without content is null:
+//
+//	{"title":"Go","x:tag":"a"}
+//
+// With both conventions, element and attribute names carry the prefix
+// used in the XML document, and elements that occur more than once
+// within their parent are collected in an array, in document order.
+// Text interleaved with child elements is concatenated, and text
+// consisting only of white space is dropped from elements with
+// children, so mixed content does not survive conversion. Comments
+// and processing instructions are dropped.
+type JSONConvention int
+
+const (
+	BadgerFish JSONConvention = iota
+	Parker
+)
+
+// A JSONType is the JSON type used to represent the text of an element
+// or attribute.
+type JSONType int
+
+const (
+	JSONString JSONType = iota
+	JSONNumber
+	JSONBool
+)
+
+// A JSONSchema provides type information for converting XML documents
+// to JSON. Each element is identified by its path, the names of the
+// element and its ancestors, starting with the document element. The
+// xsd package provides a JSONSchema for documents described by an XML
+// Schema.
+type JSONSchema interface {
+	// ElementType returns the JSON type of the text of the element
+	// at path, and whether the element may occur more than once
+	// within its parent. Elements that may occur more than once are
+	// always represented as arrays.
+	ElementType(path []xml.Name) (t JSONType, plural bool)
+	// AttrType returns the JSON type of the value of an attribute
+	// of the element at path.
+	AttrType(path []xml.Name, attr xml.Name) JSONType
+}
+
+// JSONOptions control the conversion of XML documents to and from JSON.
+// The zero value uses the BadgerFish convention, and represents all
+// text as JSON strings.
+type JSONOptions struct {
+	Convention JSONConvention
+	// If not nil, Schema is used by ToJSON to represent numeric and
+	// boolean values as JSON numbers and booleans, and to decide
+	// which elements are represented as arrays. Values that are not
+	// valid for their type remain strings.
+	Schema JSONSchema
+	// Namespaces binds prefixes used in JSON names to namespaces,
+	// for FromJSON. The empty prefix binds the default namespace.
+	// With the BadgerFish convention, declarations in "@xmlns"
+	// members take precedence.
+	Namespaces map[string]string
+	// The name of the document element created by FromJSON with
+	// the Parker convention, which does not record it. If Root has
+	// a namespace, it is bound to its prefix in Namespaces if there
+	// is one, and declared as the default namespace otherwise.
+	Root xml.Name
+	// If not empty, ToJSON indents its output with Indent.
+	Indent string
+}
+
+// ToJSON converts an Element to JSON, as described by opts. If opts
+// is nil, the BadgerFish convention is used.
+func ToJSON(el *Element, opts *JSONOptions) ([]byte, error) {
+	if opts == nil {
+		opts = new(JSONOptions)
+	}
+	c := jsonConverter{opts: opts}
+	var v interface{}
+	switch opts.Convention {
+	case BadgerFish:
+		v = jsonObject{{el.qname(), c.badgerFish(nil, el, []xml.Name{el.Name}, 0)}}
+	case Parker:
+		v = c.parker(el, []xml.Name{el.Name}, 0)
+	default:
+		return nil, fmt.Errorf("xmltree: unknown JSON convention %d", opts.Convention)
+	}
+	if c.err != nil {
+		return nil, c.err
+	}
+	var buf bytes.Buffer
+	if err := writeJSON(&buf, v); err != nil {
+		return nil, err
+	}
+	if opts.Indent == "" {
+		return buf.Bytes(), nil
+	}
+	var out bytes.Buffer
+	if err := json.Indent(&out, buf.Bytes(), "", opts.Indent); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// A jsonObject is a JSON object whose members are kept in order.
+type jsonObject []jsonMember
+
+type jsonMember struct {
+	key   string
+	value interface{}
+}
+
+// A jsonNumber is the text of a JSON number.
+type jsonNumber string
+
+type jsonConverter struct {
+	opts *JSONOptions
+	err  error
+}
+
+func (c *jsonConverter) elementType(path []xml.Name) (JSONType, bool) {
+	if c.opts.Schema == nil {
+		return JSONString, false
+	}
+	return c.opts.Schema.ElementType(path)
+}
+
+// value converts text to a JSON value of type t. Text that is not
+// valid for t is returned as a string.
+func (c *jsonConverter) value(text string, t JSONType) interface{} {
+	s := strings.TrimSpace(text)
+	switch t {
+	case JSONNumber:
+		if f, err := strconv.ParseFloat(s, 64); err == nil && !math.IsInf(f, 0) && !math.IsNaN(f) {
+			if s != "" && (s[0] == '-' || ('0' <= s[0] && s[0] <= '9')) && json.Valid([]byte(s)) {
+				// keep the precision of the original
+				return jsonNumber(s)
+			}
+			return jsonNumber(strconv.FormatFloat(f, 'g', -1, 64))
+		}
+	case JSONBool:
+		switch s {
+		case "true", "1":
+			return true
+		case "false", "0":
+			return false
+		}
+	}
+	return text
+}
+
+// ownText returns the text directly contained by el, and whether el
+// has child elements.
+func ownText(el *Element) (string, bool) {
+	var buf strings.Builder
+	children := false
+	for _, item := range el.contentItems() {
+		switch item.kind {
+		case TextNode, CDATANode:
+			buf.WriteString(item.data)
+		case ElementNode:
+			children = true
+		}
+	}
+	text := buf.String()
+	if children && strings.TrimSpace(text) == "" {
+		text = ""
+	}
+	return text, children || len(el.Children) > 0
+}
+
+// children groups the child elements of el by name, in order of first
+// appearance. Groups of more than one element, or of plural elements,
+// become arrays.
+func (c *jsonConverter) children(el *Element, path []xml.Name, depth int, convert func(*Element, []xml.Name, int) interface{}) jsonObject {
+	var obj jsonObject
+	index := make(map[string]int)
+	count := make(map[string]int)
+	for i := range el.Children {
+		count[el.Children[i].qname()]++
+	}
+	for i := range el.Children {
+		child := &el.Children[i]
+		key := child.qname()
+		childPath := append(path[:len(path):len(path)], child.Name)
+		_, plural := c.elementType(childPath)
+		value := convert(child, childPath, depth+1)
+		if !plural && count[key] == 1 {
+			obj = append(obj, jsonMember{key, value})
+			continue
+		}
+		if j, ok := index[key]; ok {
+			obj[j].value = append(obj[j].value.([]interface{}), value)
+			continue
+		}
+		index[key] = len(obj)
+		obj = append(obj, jsonMember{key, []interface{}{value}})
+	}
+	return obj
+}
+
+func (c *jsonConverter) badgerFish(parent, el *Element, path []xml.Name, depth int) interface{} {
+	if depth > recursionLimit {
+		c.err = errDeepJSON
+		return nil
+	}
+	obj := jsonObject{}
+	var xmlns jsonObject
+	for _, decl := range diffScope(parent, el).ns {
+		key := decl.Local
+		if key == "" {
+			key = "$"
+		}
+		xmlns = append(xmlns, jsonMember{key, decl.Space})
+	}
+	if xmlns != nil {
+		obj = append(obj, jsonMember{"@xmlns", xmlns})
+	}
+	for _, a := range el.StartElement.Attr {
+		t := JSONString
+		if c.opts.Schema != nil {
+			t = c.opts.Schema.AttrType(path, a.Name)
+		}
+		obj = append(obj, jsonMember{"@" + attrName(el.Scope, a.Name), c.value(a.Value, t)})
+	}
+	if text, _ := ownText(el); text != "" {
+		t, _ := c.elementType(path)
+		obj = append(obj, jsonMember{"$", c.value(text, t)})
+	}
+	children := c.children(el, path, depth, func(child *Element, path []xml.Name, depth int) interface{} {
+		return c.badgerFish(el, child, path, depth)
+	})
+	return append(obj, children...)
+}
+
+func (c *jsonConverter) parker(el *Element, path []xml.Name, depth int) interface{} {
+	if depth > recursionLimit {
+		c.err = errDeepJSON
+		return nil
+	}
+	text, hasChildren := ownText(el)
+	if !hasChildren {
+		if text == "" {
+			return nil
+		}
+		t, _ := c.elementType(path)
+		return c.value(text, t)
+	}
+	return c.children(el, path, depth, c.parker)
+}
+
+var errDeepJSON = errors.New("xmltree: document too deeply nested for JSON conversion")
+
+func writeJSON(buf *bytes.Buffer, v interface{}) error {
+	switch v := v.(type) {
+	case nil:
+		buf.WriteString("null")
+	case bool:
+		buf.WriteString(strconv.FormatBool(v))
+	case jsonNumber:
+		buf.WriteString(string(v))
+	case string:
+		enc := json.NewEncoder(buf)
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(v); err != nil {
+			return err
+		}
+		// Encode adds a newline
+		buf.Truncate(buf.Len() - 1)
+	case []interface{}:
+		buf.WriteByte('[')
+		for i, item := range v {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeJSON(buf, item); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	case jsonObject:
+		buf.WriteByte('{')
+		for i, m := range v {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeJSON(buf, m.key); err != nil {
+				return err
+			}
+			buf.WriteByte(':')
+			if err := writeJSON(buf, m.value); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	default:
+		return fmt.Errorf("xmltree: unexpected JSON value %T", v)
+	}
+	return nil
+}
+
+// FromJSON converts JSON produced by ToJSON, or following the same
+// convention, back to an Element. If opts is nil, the BadgerFish
+// convention is used. JSON numbers and booleans become text. Names
+// with prefixes that are not declared by the JSON or in
+// opts.Namespaces are an error.
+func FromJSON(data []byte, opts *JSONOptions) (*Element, error) {
+	if opts == nil {
+		opts = new(JSONOptions)
+	}
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	v, err := readJSON(d, 0)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := d.Token(); err != io.EOF {
+		return nil, errors.New("xmltree: unexpected data after JSON value")
+	}
+	b := jsonBuilder{opts: opts}
+	scope := make(map[string]string, len(opts.Namespaces))
+	for prefix, ns := range opts.Namespaces {
+		scope[prefix] = ns
+	}
+	switch opts.Convention {
+	case BadgerFish:
+		obj, ok := v.(jsonObject)
+		if !ok || len(obj) != 1 {
+			return nil, errors.New("xmltree: BadgerFish JSON must be an object with a single member")
+		}
+		if _, ok := obj[0].value.([]interface{}); ok {
+			return nil, errors.New("xmltree: document element cannot be an array")
+		}
+		err = b.badgerFish(obj[0].key, obj[0].value, scope, b.rootDecls(), 0)
+	case Parker:
+		if opts.Root.Local == "" {
+			return nil, errors.New("xmltree: JSONOptions.Root is required for the Parker convention")
+		}
+		name, decls := opts.Root.Local, b.rootDecls()
+		if opts.Root.Space != "" {
+			prefix := ""
+			for p, ns := range opts.Namespaces {
+				if ns == opts.Root.Space && p != "" && (prefix == "" || p < prefix) {
+					prefix = p
+				}
+			}
+			if prefix != "" {
+				name = prefix + ":" + name
+			} else if opts.Namespaces[""] != opts.Root.Space {
+				scope[""] = opts.Root.Space
+				decls = append(decls, xml.Name{Space: opts.Root.Space})
+			}
+		}
+		err = b.parker(name, v, scope, decls, 0)
+	default:
+		return nil, fmt.Errorf("xmltree: unknown JSON convention %d", opts.Convention)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return Parse(b.buf.Bytes())
+}
+
+// readJSON reads a JSON value, preserving the order of object members.
+func readJSON(d *json.Decoder, depth int) (interface{}, error) {
+	if depth > recursionLimit {
+		return nil, errDeepJSON
+	}
+	tok, err := d.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch tok {
+	case json.Delim('{'):
+		obj := jsonObject{}
+		for d.More() {
+			key, err := d.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := readJSON(d, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			obj = append(obj, jsonMember{key.(string), value})
+		}
+		_, err := d.Token()
+		return obj, err
+	case json.Delim('['):
+		list := []interface{}{}
+		for d.More() {
+			value, err := readJSON(d, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, value)
+		}
+		_, err := d.Token()
+		return list, err
+	}
+	return tok, nil
+}
+
+// A jsonBuilder writes the XML encoding of a JSON value.
+type jsonBuilder struct {
+	opts *JSONOptions
+	buf  bytes.Buffer
+}
+
+// rootDecls returns the namespace declarations from opts.Namespaces,
+// which are made on the document element.
+func (b *jsonBuilder) rootDecls() []xml.Name {
+	decls := make([]xml.Name, 0, len(b.opts.Namespaces))
+	for prefix, ns := range b.opts.Namespaces {
+		decls = append(decls, xml.Name{Space: ns, Local: prefix})
+	}
+	sortDecls(decls)
+	return decls
+}
+
+func sortDecls(decls []xml.Name) {
+	for i := 1; i < len(decls); i++ {
+		for j := i; j > 0 && decls[j].Local < decls[j-1].Local; j-- {
+			decls[j], decls[j-1] = decls[j-1], decls[j]
+		}
+	}
+}
+
+// checkName returns an error if the prefix of qname is not bound
+// in scope.
+func checkName(qname string, scope map[string]string) error {
+	i := strings.IndexByte(qname, ':')
+	if i < 0 {
+		return nil
+	}
+	if prefix := qname[:i]; prefix != "xml" {
+		if _, ok := scope[prefix]; !ok {
+			return fmt.Errorf("xmltree: undeclared namespace prefix in %q", qname)
+		}
+	}
+	return nil
+}
+
+// scalar returns the text of a JSON string, number or boolean.
+func scalar(v interface{}) (string, bool) {
+	switch v := v.(type) {
+	case string:
+		return v, true
+	case json.Number:
+		return string(v), true
+	case bool:
+		return strconv.FormatBool(v), true
+	}
+	return "", false
+}
+
+func (b *jsonBuilder) startTag(qname string, decls []xml.Name, attrs []jsonMember) {
+	b.buf.WriteString("<" + qname)
+	for _, d := range decls {
+		if d.Local == "" {
+			b.buf.WriteString(` xmlns="` + escapeAttr(d.Space) + `"`)
+		} else {
+			b.buf.WriteString(" xmlns:" + d.Local + `="` + escapeAttr(d.Space) + `"`)
+		}
+	}
+	for _, a := range attrs {
+		text, _ := scalar(a.value)
+		b.buf.WriteString(" " + a.key + `="` + escapeAttr(text) + `"`)
+	}
+	b.buf.WriteString(">")
+}
+
+// members calls fn for each element represented by a member of
+// an object: once for a single value, and for each item of an array.
+func members(obj jsonObject, fn func(key string, value interface{}) error) error {
+	for _, m := range obj {
+		list, ok := m.value.([]interface{})
+		if !ok {
+			list = []interface{}{m.value}
+		}
+		for _, item := range list {
+			if _, ok := item.([]interface{}); ok {
+				return fmt.Errorf("xmltree: nested arrays in member %q", m.key)
+			}
+			if err := fn(m.key, item); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (b *jsonBuilder) badgerFish(qname string, v interface{}, outer map[string]string, decls []xml.Name, depth int) error {
+	if depth > recursionLimit {
+		return errDeepJSON
+	}
+	obj, ok := v.(jsonObject)
+	if !ok {
+		// be lenient and accept scalars as the text of
+		// an element
+		if v != nil {
+			obj = jsonObject{{"$", v}}
+		}
+	}
+	scope := outer
+	var attrs, children jsonObject
+	var text string
+	for _, m := range obj {
+		switch {
+		case m.key == "@xmlns":
+			ns, ok := m.value.(jsonObject)
+			if !ok {
+				return errors.New(`xmltree: "@xmlns" must be an object`)
+			}
+			scope = make(map[string]string, len(outer)+len(ns))
+			for k, v := range outer {
+				scope[k] = v
+			}
+			for _, d := range ns {
+				uri, ok := d.value.(string)
+				if !ok {
+					return fmt.Errorf("xmltree: namespace for %q must be a string", d.key)
+				}
+				prefix := d.key
+				if prefix == "$" {
+					prefix = ""
+				}
+				scope[prefix] = uri
+				decls = append(decls, xml.Name{Space: uri, Local: prefix})
+			}
+		case strings.HasPrefix(m.key, "@"):
+			if _, ok := scalar(m.value); !ok {
+				return fmt.Errorf("xmltree: value of attribute %q must be a string, number or boolean", m.key)
+			}
+			attrs = append(attrs, jsonMember{m.key[1:], m.value})
+		case m.key == "$":
+			s, ok := scalar(m.value)
+			if !ok {
+				return errors.New(`xmltree: "$" must be a string, number or boolean`)
+			}
+			text = s
+		default:
+			children = append(children, m)
+		}
+	}
+	if err := checkName(qname, scope); err != nil {
+		return err
+	}
+	for _, a := range attrs {
+		if err := checkName(a.key, scope); err != nil {
+			return err
+		}
+	}
+	b.startTag(qname, uniqueDecls(decls), attrs)
+	xml.EscapeText(&b.buf, []byte(text))
+	err := members(children, func(key string, value interface{}) error {
+		return b.badgerFish(key, value, scope, nil, depth+1)
+	})
+	if err != nil {
+		return err
+	}
+	b.buf.WriteString("</" + qname + ">")
+	return nil
+}
+
+// uniqueDecls removes declarations of a prefix that are overridden
+// by a later declaration of the same prefix.
+func uniqueDecls(decls []xml.Name) []xml.Name {
+	var result []xml.Name
+	for i, d := range decls {
+		overridden := false
+		for _, later := range decls[i+1:] {
+			if later.Local == d.Local {
+				overridden = true
+			}
+		}
+		if !overridden {
+			result = append(result, d)
+		}
+	}
+	return result
+}
+
+func (b *jsonBuilder) parker(qname string, v interface{}, scope map[string]string, decls []xml.Name, depth int) error {
+	if depth > recursionLimit {
+		return errDeepJSON
+	}
+	if err := checkName(qname, scope); err != nil {
+		return err
+	}
+	b.startTag(qname, uniqueDecls(decls), nil)
+	switch v := v.(type) {
+	case nil:
+	case jsonObject:
+		err := members(v, func(key string, value interface{}) error {
+			return b.parker(key, value, scope, nil, depth+1)
+		})
+		if err != nil {
+			return err
+		}
+	case []interface{}:
+		return fmt.Errorf("xmltree: unexpected array for element %q", qname)
+	default:
+		text, _ := scalar(v)
+		xml.EscapeText(&b.buf, []byte(text))
+	}
+	b.buf.WriteString("</" + qname + ">")
+	return nil
+}
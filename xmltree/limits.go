@@ -0,0 +1,310 @@
+package xmltree
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+
+	"github.com/m29h/go-xml/dtd"
+)
+
+// ParseOptions limits the resources used to parse a document, so that
+// documents from untrusted sources can be parsed safely. A zero value
+// for any limit leaves that aspect of the document unrestricted, except
+// for MaxDepth, which defaults to 3000, the limit used by Parse.
+//
+// The encoding/xml package, on which xmltree is built, does not expand
+// entities declared in a DOCTYPE, so unless ParseDTD is set, documents
+// cannot use entity expansion to grow beyond their input size. When it
+// is set, entity expansion is limited by MaxEntityExpansion.
+// DisallowDOCTYPE may be used to reject documents with a DOCTYPE
+// outright.
+type ParseOptions struct {
+	// Maximum nesting depth of elements. The document element
+	// is at depth 0.
+	MaxDepth int
+	// Maximum number of elements in the document.
+	MaxElements int
+	// Maximum number of attributes on a single element,
+	// including namespace declarations.
+	MaxAttrs int
+	// Maximum size in bytes of a single token: a start tag
+	// with its attributes, a run of character data, a comment,
+	// a processing instruction or a directive. A Stream checks
+	// the size of tokens as it reads them, so that oversized
+	// tokens are not held in memory.
+	MaxTokenSize int
+	// Maximum size in bytes of the document.
+	MaxBytes int64
+	// If true, documents containing a DOCTYPE declaration are
+	// rejected.
+	DisallowDOCTYPE bool
+
+	// If true, the document type declaration of the document is
+	// parsed with the dtd package. References to the entities it
+	// declares are replaced with their replacement text, default
+	// attribute values are added to elements, the values of
+	// attributes with types other than CDATA are normalized, and
+	// attributes declared with type ID are recorded for use by the
+	// ID method and the XPath id() function. The Pos of Elements,
+	// and the limits other than MaxBytes, apply to the document
+	// after entity expansion. NewStream does not parse DTDs.
+	ParseDTD bool
+	// If not nil, DTDResolver loads the external subset and the
+	// external entities of documents when ParseDTD is set.
+	// Otherwise, they are not loaded, and references to external
+	// entities from the document are an error. Resolvers that read
+	// from the network or file system should restrict the
+	// locations they read from, as they are chosen by the document.
+	DTDResolver dtd.Resolver
+	// Maximum number of bytes of replacement text added by
+	// expanding entities, when ParseDTD is set. If zero,
+	// dtd.DefaultMaxExpansion is used.
+	MaxEntityExpansion int64
+}
+
+// A Limit identifies one of the limits of ParseOptions.
+type Limit int
+
+// The limits of ParseOptions.
+const (
+	LimitDepth Limit = iota + 1
+	LimitElements
+	LimitAttrs
+	LimitTokenSize
+	LimitBytes
+	LimitDOCTYPE
+	LimitEntityExpansion
+)
+
+func (l Limit) String() string {
+	switch l {
+	case LimitDepth:
+		return "nesting depth"
+	case LimitElements:
+		return "number of elements"
+	case LimitAttrs:
+		return "number of attributes"
+	case LimitTokenSize:
+		return "token size"
+	case LimitBytes:
+		return "document size"
+	case LimitDOCTYPE:
+		return "DOCTYPE declaration"
+	case LimitEntityExpansion:
+		return "entity expansion"
+	}
+	return fmt.Sprintf("Limit(%d)", int(l))
+}
+
+// A LimitError is returned when a document exceeds one of the limits
+// set by ParseOptions. Parse returns a LimitError with a Limit of
+// LimitDepth for documents nested more than 3000 elements deep.
+type LimitError struct {
+	Limit Limit
+	// The value of the limit that was exceeded. Max is 0
+	// for LimitDOCTYPE.
+	Max int64
+	// The location in the document where the limit was exceeded.
+	// Pos is not valid for LimitBytes errors detected before the
+	// document is read, for LimitTokenSize errors detected by a
+	// Stream while reading, or for LimitEntityExpansion errors.
+	Pos Pos
+}
+
+func (e *LimitError) Error() string {
+	if e.Limit == LimitDOCTYPE {
+		return fmt.Sprintf("xmltree: %s at %s is not allowed", e.Limit, e.Pos)
+	}
+	if !e.Pos.IsValid() {
+		return fmt.Sprintf("xmltree: %s exceeds limit of %d", e.Limit, e.Max)
+	}
+	return fmt.Sprintf("xmltree: %s exceeds limit of %d at %s", e.Limit, e.Max, e.Pos)
+}
+
+// Parse is like the package-level Parse function, but enforces the
+// limits in opts. A nil *ParseOptions uses the default limits.
+func (opts *ParseOptions) Parse(doc []byte) (*Element, error) {
+	scanner, err := opts.newScanner(doc)
+	if err != nil {
+		return nil, err
+	}
+	return scanner.parseRoot()
+}
+
+// ParseDocument is like the package-level ParseDocument function,
+// but enforces the limits in opts. A nil *ParseOptions uses the
+// default limits.
+func (opts *ParseOptions) ParseDocument(doc []byte) (*Document, error) {
+	scanner, err := opts.newScanner(doc)
+	if err != nil {
+		return nil, err
+	}
+	return scanner.parseDocument()
+}
+
+// NewStream is like the package-level NewStream function, but the
+// Stream enforces the limits in opts. The limits apply to the whole
+// document, not just the Elements returned by the Stream. A nil
+// *ParseOptions uses the default limits.
+func (opts *ParseOptions) NewStream(r io.Reader) *Stream {
+	if opts != nil && opts.MaxBytes > 0 {
+		r = &limitReader{r: r, max: opts.MaxBytes}
+	}
+	if opts != nil && opts.MaxTokenSize > 0 {
+		r = &tokenSizeReader{r: r, max: int64(opts.MaxTokenSize)}
+	}
+	s := newStream(r)
+	s.scanner.opts = opts
+	return s
+}
+
+// A limitReader returns a LimitError once more than max bytes
+// have been read from r.
+type limitReader struct {
+	r      io.Reader
+	n, max int64
+}
+
+func (l *limitReader) Read(p []byte) (int, error) {
+	if l.n > l.max {
+		return 0, &LimitError{Limit: LimitBytes, Max: l.max}
+	}
+	if int64(len(p)) > l.max-l.n+1 {
+		p = p[:l.max-l.n+1]
+	}
+	n, err := l.r.Read(p)
+	l.n += int64(n)
+	return n, err
+}
+
+// A tokenSizeReader returns a LimitError once a token of more than
+// max bytes has been read from r, so that the Stream's decoder does
+// not buffer oversized tokens. It follows the markup just closely
+// enough to find where tokens end.
+type tokenSizeReader struct {
+	r    io.Reader
+	max  int64
+	n    int64 // bytes read of the current token
+	mode byte  // 0 for text, '<' in a tag, or the last byte of the terminator
+	// the terminator of the current comment, CDATA section or
+	// processing instruction
+	end string
+	// the last bytes read, to recognize delimiters split across reads
+	tail  [9]byte
+	quote byte
+}
+
+func (t *tokenSizeReader) Read(p []byte) (int, error) {
+	n, err := t.r.Read(p)
+	for _, c := range p[:n] {
+		copy(t.tail[:], t.tail[1:])
+		t.tail[len(t.tail)-1] = c
+		t.n++
+		switch {
+		case t.mode == 0 && c == '<':
+			t.mode, t.n = '<', 1
+		case t.mode == '<' && t.quote != 0:
+			if c == t.quote {
+				t.quote = 0
+			}
+		case t.mode == '<':
+			switch {
+			case c == '"' || c == '\'':
+				t.quote = c
+			case c == '>':
+				t.mode, t.n = 0, 0
+			case t.n == 2 && c == '?':
+				t.mode, t.end = 1, "?>"
+			case t.n == 4 && t.hasSuffix("<!--"):
+				t.mode, t.end = 1, "-->"
+			case t.n == 9 && t.hasSuffix("<![CDATA["):
+				t.mode, t.end = 1, "]]>"
+			}
+		case t.mode == 1 && t.hasSuffix(t.end):
+			t.mode, t.n = 0, 0
+		}
+		if t.n > t.max {
+			return 0, &LimitError{Limit: LimitTokenSize, Max: t.max}
+		}
+	}
+	return n, err
+}
+
+func (t *tokenSizeReader) hasSuffix(s string) bool {
+	return string(t.tail[len(t.tail)-len(s):]) == s
+}
+
+func (opts *ParseOptions) newScanner(doc []byte) (*scanner, error) {
+	if opts != nil && opts.MaxBytes > 0 && int64(len(doc)) > opts.MaxBytes {
+		return nil, &LimitError{Limit: LimitBytes, Max: opts.MaxBytes}
+	}
+	var types *dtd.DTD
+	if opts != nil && opts.ParseDTD {
+		expanded, d, err := opts.expandDTD(doc)
+		if err != nil {
+			return nil, err
+		}
+		if len(expanded) != len(doc) {
+			// The size of the input has already been
+			// checked, and expansion is limited separately.
+			limited := *opts
+			limited.MaxBytes = 0
+			opts = &limited
+		}
+		doc, types = expanded, d
+	}
+	scanner := newScanner(doc)
+	scanner.opts = opts
+	scanner.dtd = types
+	return scanner, nil
+}
+
+func (opts *ParseOptions) maxDepth() int {
+	if opts == nil || opts.MaxDepth <= 0 {
+		return recursionLimit
+	}
+	return opts.MaxDepth
+}
+
+// checkDepth returns an error if an element at the given depth
+// exceeds the limits of the scanner.
+func (s *scanner) checkDepth(depth int) error {
+	if max := s.opts.maxDepth(); depth > max {
+		return &LimitError{Limit: LimitDepth, Max: int64(max), Pos: s.pos}
+	}
+	return nil
+}
+
+// checkLimits returns an error if the current token exceeds the
+// limits of the scanner, other than the depth limit, which is
+// checked by the caller.
+func (s *scanner) checkLimits() error {
+	opts := s.opts
+	if opts == nil {
+		return nil
+	}
+	end := s.InputOffset()
+	if opts.MaxBytes > 0 && end > opts.MaxBytes {
+		return &LimitError{Limit: LimitBytes, Max: opts.MaxBytes, Pos: s.pos}
+	}
+	if opts.MaxTokenSize > 0 && end-s.pos.Offset > int64(opts.MaxTokenSize) {
+		return &LimitError{Limit: LimitTokenSize, Max: int64(opts.MaxTokenSize), Pos: s.pos}
+	}
+	switch tok := s.tok.(type) {
+	case xml.StartElement:
+		s.elements++
+		if opts.MaxElements > 0 && s.elements > opts.MaxElements {
+			return &LimitError{Limit: LimitElements, Max: int64(opts.MaxElements), Pos: s.pos}
+		}
+		if opts.MaxAttrs > 0 && len(tok.Attr) > opts.MaxAttrs {
+			return &LimitError{Limit: LimitAttrs, Max: int64(opts.MaxAttrs), Pos: s.pos}
+		}
+	case xml.Directive:
+		if opts.DisallowDOCTYPE && bytes.HasPrefix(bytes.TrimSpace(tok), []byte("DOCTYPE")) {
+			return &LimitError{Limit: LimitDOCTYPE, Pos: s.pos}
+		}
+	}
+	return nil
+}
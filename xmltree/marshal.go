@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/xml"
 	"io"
+	"strings"
 	"text/template"
 )
 
@@ -11,12 +12,15 @@ import (
 // prefixes in attribute names. Therefore we add .Name.Space verbatim
 // instead of trying to resolve it. One consequence is this is that we cannot
 // rename prefixes without some work.
-var tagTmpl = template.Must(template.New("Marshal XML tags").Parse(
+var tagTmpl = template.Must(template.New("Marshal XML tags").Funcs(template.FuncMap{
+	"escape":   escapeAttr,
+	"attrName": attrName,
+}).Parse(
 	`{{define "start" -}}
 	<{{.Scope.Prefix .Name -}}
-	{{range .StartElement.Attr}} {{$.Scope.Prefix .Name -}}="{{.Value}}"{{end -}}
-	{{range .NS }} xmlns{{ if .Local }}:{{ .Local }}{{end}}="{{ .Space }}"{{end -}}
-	{{if or .Children .Content}}>{{else}} />{{end}}
+	{{range .StartElement.Attr}} {{attrName $.Scope .Name -}}="{{escape .Value}}"{{end -}}
+	{{range .NS }} xmlns{{ if .Local }}:{{ .Local }}{{end}}="{{ escape .Space }}"{{end -}}
+	{{if .Empty}} />{{else}}>{{end}}
 	{{- end}}
 
 	{{define "end" -}}
@@ -73,6 +77,9 @@ type encoder struct {
 	w              io.Writer
 	prefix, indent string
 	pretty         bool
+	// If true, the Nodes of elements without significant text
+	// are indented, rather than written as-is.
+	indentNodes bool
 }
 
 // This could be used to print a subset of an XML document, or a document
@@ -94,12 +101,54 @@ func (e *encoder) encode(el, parent *Element, visited map[*Element]struct{}) err
 	if err := e.encodeOpenTag(el, scope, len(visited)); err != nil {
 		return err
 	}
-	if len(el.Children) == 0 {
-		if len(el.Content) > 0 {
-			e.w.Write(el.Content)
-		} else {
-			return nil
+	if el.empty() {
+		return nil
+	}
+	if el.Nodes != nil && e.indentContent(el) {
+		visited[el] = struct{}{}
+		for _, n := range el.Nodes {
+			var err error
+			switch {
+			case n.Kind == TextNode:
+				// only white space, replaced by indentation
+			case n.Kind != ElementNode:
+				for i := 0; i < len(visited); i++ {
+					io.WriteString(e.w, e.indent)
+				}
+				if err = writeNode(e.w, n); err == nil {
+					_, err = io.WriteString(e.w, "\n")
+				}
+			case n.Child >= 0 && n.Child < len(el.Children):
+				err = e.encode(&el.Children[n.Child], el, visited)
+			}
+			if err != nil {
+				return err
+			}
 		}
+		delete(visited, el)
+		return e.encodeCloseTag(el, len(visited))
+	}
+	if el.Nodes != nil {
+		// Indentation would change the content of the
+		// element, so it is written as-is.
+		inner := encoder{w: e.w}
+		visited[el] = struct{}{}
+		for _, n := range el.Nodes {
+			var err error
+			if n.Kind != ElementNode {
+				err = writeNode(e.w, n)
+			} else if n.Child >= 0 && n.Child < len(el.Children) {
+				err = inner.encode(&el.Children[n.Child], el, visited)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		delete(visited, el)
+		return e.encodeCloseTag(el, len(visited))
+	}
+	if len(el.Children) == 0 {
+		e.w.Write(el.Content)
 	}
 	for i := range el.Children {
 		visited[el] = struct{}{}
@@ -141,23 +190,98 @@ func (e *encoder) encodeOpenTag(el *Element, scope Scope, depth int) error {
 	}
 	var tag = struct {
 		*Element
-		NS []xml.Name
-	}{Element: el, NS: scope.ns}
+		NS    []xml.Name
+		Empty bool
+	}{Element: el, NS: scope.ns, Empty: el.empty()}
 	if err := tagTmpl.ExecuteTemplate(e.w, "start", tag); err != nil {
 		return err
 	}
-	if e.pretty {
-		if len(el.Children) > 0 || len(el.Content) == 0 {
-			io.WriteString(e.w, "\n")
-		}
+	if e.pretty && (e.indentContent(el) || tag.Empty) {
+		io.WriteString(e.w, "\n")
 	}
 	return nil
 }
 
+// indentContent returns true if the content of an Element is written
+// on separate lines, indented by one more level than the Element.
+func (e *encoder) indentContent(el *Element) bool {
+	if !e.pretty {
+		return false
+	}
+	if el.Nodes == nil {
+		return len(el.Children) > 0
+	}
+	if !e.indentNodes {
+		return false
+	}
+	// Only content consisting of elements, comments and processing
+	// instructions, separated by white space, can be indented
+	// without changing its meaning.
+	markup := false
+	for _, n := range el.Nodes {
+		switch n.Kind {
+		case TextNode:
+			if len(bytes.Trim(n.Data, " \t\r\n")) > 0 {
+				return false
+			}
+		case CDATANode:
+			return false
+		default:
+			markup = true
+		}
+	}
+	return markup
+}
+
+// empty returns true if an Element has no content, and
+// can be written as a self-closing tag.
+func (el *Element) empty() bool {
+	if el.Nodes != nil {
+		return len(el.Nodes) == 0
+	}
+	return len(el.Children) == 0 && len(el.Content) == 0
+}
+
+// attrName returns the qualified name of an attribute. The default
+// namespace does not apply to attributes, so a namespaced attribute
+// is given a prefix even where its namespace is the default.
+func attrName(scope Scope, name xml.Name) string {
+	if prefix := scope.attrPrefix(name); prefix != "" {
+		return prefix + ":" + name.Local
+	}
+	return scope.Prefix(name)
+}
+
+// escapeAttr escapes an attribute value. White space other than
+// spaces is escaped so that it survives attribute value
+// normalization.
+func escapeAttr(s string) string {
+	var buf strings.Builder
+	for _, c := range s {
+		switch c {
+		case '&':
+			buf.WriteString("&amp;")
+		case '<':
+			buf.WriteString("&lt;")
+		case '"':
+			buf.WriteString("&quot;")
+		case '\t':
+			buf.WriteString("&#x9;")
+		case '\n':
+			buf.WriteString("&#xA;")
+		case '\r':
+			buf.WriteString("&#xD;")
+		default:
+			buf.WriteRune(c)
+		}
+	}
+	return buf.String()
+}
+
 func (e *encoder) encodeCloseTag(el *Element, depth int) error {
 	if e.pretty {
 		for i := 0; i < depth; i++ {
-			if len(el.Children) > 0 {
+			if e.indentContent(el) {
 				io.WriteString(e.w, e.indent)
 			}
 		}
@@ -0,0 +1,136 @@
+package xmltree
+
+import (
+	"encoding/xml"
+	"fmt"
+)
+
+// A Pos describes a location in the source of an XML document. For
+// documents that are not encoded in UTF-8, offsets and columns refer
+// to the document after conversion to UTF-8.
+type Pos struct {
+	// Byte offset from the start of the document, starting at 0.
+	Offset int64
+	// Line number, starting at 1.
+	Line int
+	// Column number, starting at 1. Columns are counted in bytes.
+	Column int
+}
+
+// IsValid returns true if p refers to a location in a document.
+func (p Pos) IsValid() bool { return p.Line > 0 }
+
+// String returns a string of the form line:column, or "-" for
+// an invalid Pos.
+func (p Pos) String() string {
+	if !p.IsValid() {
+		return "-"
+	}
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
+}
+
+// AttrPos returns the location of the name of the first attribute
+// whose name matches the space and local arguments, using the same
+// rules as the Attr method. If the attribute could not be found,
+// or was not read from a document, the zero Pos is returned.
+func (el *Element) AttrPos(space, local string) Pos {
+	for i, v := range el.StartElement.Attr {
+		if v.Name.Local != local {
+			continue
+		}
+		if space == "" || space == v.Name.Space {
+			if i < len(el.attrSrc) {
+				return el.attrSrc[i].pos
+			}
+			return Pos{}
+		}
+	}
+	return Pos{}
+}
+
+// An attrSource records where an attribute was found in the source
+// document, and the prefix used for its name.
+type attrSource struct {
+	pos    Pos
+	prefix string
+}
+
+// scanTag scans the raw text of a start tag beginning at start. It
+// returns the prefix of the element's name, and the location and
+// prefix of each of attrs, omitting namespace declarations in the same
+// way as pushNS. The attributes must be in the order they appear in
+// the tag.
+func scanTag(attrs []xml.Attr, tag []byte, start Pos) (string, []attrSource) {
+	var (
+		found []attrSource
+		pos   = start
+		i     = 0
+	)
+	advance := func() {
+		if tag[i] == '\n' {
+			pos.Line++
+			pos.Column = 1
+		} else {
+			pos.Column++
+		}
+		pos.Offset++
+		i++
+	}
+	isSpace := func(b byte) bool {
+		return b == ' ' || b == '\t' || b == '\r' || b == '\n'
+	}
+	// scanName consumes a name, and returns its prefix
+	scanName := func() string {
+		begin, colon := i, -1
+		for i < len(tag) && tag[i] != '=' && tag[i] != '/' && tag[i] != '>' && !isSpace(tag[i]) {
+			if tag[i] == ':' && colon < 0 {
+				colon = i
+			}
+			advance()
+		}
+		if colon < 0 {
+			return ""
+		}
+		return string(tag[begin:colon])
+	}
+	if i < len(tag) && tag[i] == '<' {
+		advance()
+	}
+	prefix := scanName()
+	for i < len(tag) {
+		for i < len(tag) && isSpace(tag[i]) {
+			advance()
+		}
+		if i >= len(tag) || tag[i] == '/' || tag[i] == '>' {
+			break
+		}
+		src := attrSource{pos: pos}
+		src.prefix = scanName()
+		found = append(found, src)
+		for i < len(tag) && tag[i] != '\'' && tag[i] != '"' {
+			advance()
+		}
+		if i >= len(tag) {
+			break
+		}
+		quote := tag[i]
+		advance()
+		for i < len(tag) && tag[i] != quote {
+			advance()
+		}
+		if i < len(tag) {
+			advance()
+		}
+	}
+	if len(found) != len(attrs) {
+		return prefix, nil
+	}
+	var result []attrSource
+	for i, attr := range attrs {
+		if attr.Name.Space == "xmlns" || attr.Name.Local == "xmlns" {
+			continue
+		}
+		result = append(result, found[i])
+	}
+	return prefix, result
+}
@@ -0,0 +1,160 @@
+package xmltree
+
+import (
+	"bufio"
+	"encoding/xml"
+	"io"
+
+	"golang.org/x/net/html/charset"
+)
+
+// When not inside a subtree, the Stream drops input that it has
+// already consumed once more than this many bytes are buffered.
+const streamDiscardThreshold = 4096
+
+// A Stream reads an XML document from an io.Reader and yields
+// selected subtrees of the document as Elements, one at a time.
+// Only the subtree being built is held in memory; the rest of the
+// document is read and discarded. This makes a Stream suitable for
+// documents that are too large for Parse, such as long lists of
+// records.
+//
+// The Elements returned by a Stream have the same properties as those
+// returned by Parse; in particular, their Scope includes namespace
+// declarations made by their ancestors in the document.
+type Stream struct {
+	d       *xml.Decoder
+	scanner scanner
+	rec     *recorder
+	// scopes of the ancestors of the current position
+	stack []Scope
+}
+
+// A recorder keeps a copy of the bytes read from an input stream,
+// so that the raw content of Elements can be sliced from it.
+type recorder struct {
+	r *bufio.Reader
+	// buf[0] is at input offset base
+	buf  []byte
+	base int64
+	// set when Elements hold references to buf
+	shared bool
+}
+
+func (r *recorder) ReadByte() (byte, error) {
+	b, err := r.r.ReadByte()
+	if err == nil {
+		r.buf = append(r.buf, b)
+	}
+	return b, err
+}
+
+func (r *recorder) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.buf = append(r.buf, p[:n]...)
+	return n, err
+}
+
+func (r *recorder) slice(begin, end int64) []byte {
+	return r.buf[begin-r.base : end-r.base]
+}
+
+// discard drops recorded input before offset.
+func (r *recorder) discard(offset int64) {
+	rest := r.buf[offset-r.base:]
+	if r.shared {
+		// Content returned to the caller refers to buf;
+		// do not overwrite it.
+		r.buf = append(make([]byte, 0, len(rest)+streamDiscardThreshold), rest...)
+		r.shared = false
+	} else {
+		r.buf = r.buf[:copy(r.buf, rest)]
+	}
+	r.base = offset
+}
+
+// NewStream returns a Stream that reads an XML document from r.
+// As with Parse, documents in character encodings other than
+// UTF-8 are converted to UTF-8. To read documents from untrusted
+// sources, use the NewStream method of ParseOptions.
+func NewStream(r io.Reader) *Stream {
+	return newStream(r)
+}
+
+func newStream(r io.Reader) *Stream {
+	s := &Stream{rec: &recorder{r: bufio.NewReader(r)}}
+	s.d = xml.NewDecoder(s.rec)
+	s.d.CharsetReader = func(label string, r io.Reader) (io.Reader, error) {
+		utf8input, err := charset.NewReaderLabel(label, r)
+		if err != nil {
+			return nil, err
+		}
+		// Offsets reported by the Decoder continue from the
+		// end of the <?xml?> header, but refer to the converted
+		// input from here on.
+		s.rec = &recorder{
+			r:    bufio.NewReader(utf8input),
+			base: s.d.InputOffset(),
+		}
+		return s.rec, nil
+	}
+	s.scanner = scanner{
+		Decoder: s.d,
+		data: func(begin, end int64) []byte {
+			return s.rec.slice(begin, end)
+		},
+	}
+	return s
+}
+
+// Next reads the document until it finds an element matching the
+// space and local arguments, and returns it with all of its children.
+// If space is the empty string, any namespace is matched. Elements
+// nested within a returned Element are not returned by subsequent
+// calls to Next. At the end of the document, Next returns io.EOF.
+func (s *Stream) Next(space, local string) (*Element, error) {
+	return s.NextFunc(func(el *Element) bool {
+		if local != el.Name.Local {
+			return false
+		}
+		return space == "" || space == el.Name.Space
+	})
+}
+
+// NextFunc is like Next, but returns the next Element for which fn
+// returns true. The Element passed to fn has its StartElement and Scope
+// fields set, but its Content and Children have not yet been read.
+func (s *Stream) NextFunc(fn func(*Element) bool) (*Element, error) {
+	for s.scanner.scan() {
+		switch tok := s.scanner.tok.(type) {
+		case xml.StartElement:
+			depth := len(s.stack)
+			if err := s.scanner.checkDepth(depth); err != nil {
+				return nil, err
+			}
+			el := &Element{StartElement: tok.Copy()}
+			if depth > 0 {
+				el.Scope = s.stack[depth-1]
+			}
+			el.parseStart(&s.scanner)
+			if !fn(el) {
+				s.stack = append(s.stack, el.Scope)
+				break
+			}
+			s.rec.discard(s.d.InputOffset())
+			if err := el.parseContent(&s.scanner, depth); err != nil {
+				return nil, err
+			}
+			s.rec.shared = true
+			return el, nil
+		case xml.EndElement:
+			if len(s.stack) > 0 {
+				s.stack = s.stack[:len(s.stack)-1]
+			}
+		}
+		if len(s.rec.buf) > streamDiscardThreshold {
+			s.rec.discard(s.d.InputOffset())
+		}
+	}
+	return nil, s.scanner.err
+}
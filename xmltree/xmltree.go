@@ -9,12 +9,12 @@ package xmltree
 import (
 	"bytes"
 	"encoding/xml"
-	"errors"
 	"fmt"
 	"io"
 	"sort"
 	"strings"
 
+	"github.com/m29h/go-xml/dtd"
 	"golang.org/x/net/html/charset"
 )
 
@@ -32,12 +32,11 @@ func (x byXMLName) Less(i, j int) bool {
 }
 func (x byXMLName) Swap(i, j int) { x[i], x[j] = x[j], x[i] }
 
-var errDeepXML = errors.New("xmltree: xml document too deeply nested")
-
 // An Element represents a single element in an XML document. Elements
 // may have zero or more children. The byte array used by the Content
 // field is shared among all elements in the document, and should not
-// be modified. An Element also captures xml namespace prefixes, so
+// be modified; use methods such as SetText and AppendChild to edit an
+// Element. An Element also captures xml namespace prefixes, so
 // that arbitrary QNames in attribute values can be resolved.
 type Element struct {
 	xml.StartElement
@@ -45,10 +44,31 @@ type Element struct {
 	// document.
 	Scope
 	// The raw content contained within this element's start and
-	// end tags. Uses the underlying byte array passed to Parse.
+	// end tags. Uses the underlying byte array passed to Parse, or
+	// a buffer private to the Stream that returned the Element.
 	Content []byte
 	// Sub-elements contained within this element.
 	Children []Element
+	// If non-nil, the content of the element in document order,
+	// including text, comments, processing instructions and CDATA
+	// sections. Element nodes refer to Children. Nodes is only
+	// set by ParseDocument; when it is set, Marshal uses Nodes
+	// rather than Content to encode the element's content.
+	Nodes []Node
+	// The location of the element's start tag, and the location
+	// immediately following its end tag, in the source document.
+	// Elements that were not read from a document have a zero
+	// Start and End.
+	Start, End Pos
+
+	// The prefix used for the element's name in the source
+	// document, and source information for the attributes in
+	// StartElement.Attr, in the same order.
+	prefix  string
+	attrSrc []attrSource
+	// The name of the attribute declared with type ID in the
+	// DTD of the document, if any.
+	idAttr xml.Name
 }
 
 // Attr gets the value of the first attribute whose name matches the
@@ -161,6 +181,17 @@ func (scope *Scope) Prefix(name xml.Name) (qname string) {
 	return qname
 }
 
+// Namespaces returns the namespace bindings in scope, keyed by
+// prefix. The default namespace is keyed by the empty string; a
+// default namespace of "" means there is no default namespace.
+func (scope *Scope) Namespaces() map[string]string {
+	ns := make(map[string]string, len(scope.ns))
+	for _, name := range scope.ns {
+		ns[name.Local] = name.Space
+	}
+	return ns
+}
+
 func (scope *Scope) pushNS(tag xml.StartElement) []xml.Attr {
 	var ns []xml.Name
 	var newAttrs []xml.Attr
@@ -192,20 +223,67 @@ type scanner struct {
 	*xml.Decoder
 	tok xml.Token
 	err error
+	// returns the utf-8 input between two offsets
+	data func(begin, end int64) []byte
+	// location of the start of tok
+	pos Pos
+	// if true, record Nodes for each element
+	nodes bool
+	// limits on the input; nil for the defaults
+	opts *ParseOptions
+	// number of elements read
+	elements int
+	// the DTD of the document, if ParseOptions.ParseDTD is set
+	dtd *dtd.DTD
 }
 
 func (s *scanner) scan() bool {
 	if s.err != nil {
 		return false
 	}
+	s.pos = s.inputPos()
 	s.tok, s.err = s.Token()
+	if s.err == nil {
+		s.err = s.checkLimits()
+	}
 	return s.err == nil
 }
 
+func (s *scanner) inputPos() Pos {
+	line, col := s.InputPos()
+	return Pos{Offset: s.InputOffset(), Line: line, Column: col}
+}
+
 // Parse builds a tree of Elements by reading an XML document.  The
 // byte slice passed to Parse is expected to be a valid XML document
-// with a single root element.
+// with a single root element. To parse documents from untrusted
+// sources, use the Parse method of ParseOptions.
 func Parse(doc []byte) (*Element, error) {
+	return newScanner(doc).parseRoot()
+}
+
+func (s *scanner) parseRoot() (*Element, error) {
+	root := new(Element)
+
+	for s.scan() {
+		if start, ok := s.tok.(xml.StartElement); ok {
+			root.StartElement = start
+			break
+		}
+	}
+	if s.err != nil {
+		return nil, s.err
+	}
+	if err := root.parse(s, 0); err != nil {
+		return nil, err
+	}
+	if s.dtd != nil {
+		root.applyDTD(s.dtd)
+	}
+	return root, nil
+}
+
+func newScanner(doc []byte) *scanner {
 	d := xml.NewDecoder(bytes.NewReader(doc))
 
 	// The xmltree package, when constructing the tree, takes slices
@@ -230,32 +308,36 @@ func Parse(doc []byte) (*Element, error) {
 		if err != nil {
 			return nil, err
 		}
-		return bytes.NewReader(utf8buf.Bytes()[len(padding)+1:]), nil
-	}
-	scanner := scanner{Decoder: d}
-	root := new(Element)
-
-	for scanner.scan() {
-		if start, ok := scanner.tok.(xml.StartElement); ok {
-			root.StartElement = start
-			break
-		}
-	}
-	if scanner.err != nil {
-		return nil, scanner.err
+		return bytes.NewReader(utf8buf.Bytes()[len(padding):]), nil
 	}
-	if err := root.parse(&scanner, utf8buf.Bytes(), 0); err != nil {
-		return nil, err
+	scanner := &scanner{Decoder: d}
+	scanner.data = func(begin, end int64) []byte {
+		return utf8buf.Bytes()[int(begin):int(end)]
 	}
-	return root, nil
+	return scanner
 }
 
-func (el *Element) parse(scanner *scanner, data []byte, depth int) error {
-	if depth > recursionLimit {
-		return errDeepXML
+func (el *Element) parse(scanner *scanner, depth int) error {
+	if err := scanner.checkDepth(depth); err != nil {
+		return err
 	}
+	el.parseStart(scanner)
+	return el.parseContent(scanner, depth)
+}
+
+// parseStart records the location of an Element's start tag and
+// its attributes, and adds its namespace declarations to its Scope.
+// The start tag must be the current token of scanner.
+func (el *Element) parseStart(scanner *scanner) {
+	el.Start = scanner.pos
+	tag := scanner.data(el.Start.Offset, scanner.InputOffset())
+	el.prefix, el.attrSrc = scanTag(el.StartElement.Attr, tag, el.Start)
 	el.StartElement.Attr = el.pushNS(el.StartElement)
+}
 
+// parseContent reads the children and content of an Element whose
+// start tag has already been consumed.
+func (el *Element) parseContent(scanner *scanner, depth int) error {
 	begin := scanner.InputOffset()
 	end := begin
 walk:
@@ -263,16 +345,27 @@ walk:
 		switch tok := scanner.tok.(type) {
 		case xml.StartElement:
 			child := Element{StartElement: tok.Copy(), Scope: el.Scope}
-			if err := child.parse(scanner, data, depth+1); err != nil {
+			if err := child.parse(scanner, depth+1); err != nil {
 				return err
 			}
+			if scanner.nodes {
+				el.Nodes = append(el.Nodes, Node{Kind: ElementNode, Child: len(el.Children)})
+			}
 			el.Children = append(el.Children, child)
 		case xml.EndElement:
 			if tok.Name != el.Name {
 				return fmt.Errorf("Expecting </%s>, got </%s>", el.Prefix(el.Name), el.Prefix(tok.Name))
 			}
-			el.Content = data[int(begin):int(end)]
+			el.Content = scanner.data(begin, end)
+			el.End = scanner.inputPos()
+			if scanner.nodes && el.Nodes == nil {
+				el.Nodes = []Node{}
+			}
 			break walk
+		default:
+			if scanner.nodes {
+				el.Nodes = append(el.Nodes, scanner.node())
+			}
 		}
 		end = scanner.InputOffset()
 	}
@@ -296,7 +389,8 @@ func (el *Element) Flatten() []*Element {
 }
 
 // SetAttr adds an XML attribute to an Element's existing Attributes.
-// If the attribute already exists, it is replaced.
+// If the attribute already exists, it is replaced. If the namespace of
+// a new attribute is not in scope, it is declared on the Element.
 func (el *Element) SetAttr(space, local, value string) {
 	for i, a := range el.StartElement.Attr {
 		if a.Name.Local != local {
@@ -311,6 +405,7 @@ func (el *Element) SetAttr(space, local, value string) {
 		Name:  xml.Name{Space: space, Local: local},
 		Value: value,
 	})
+	el.declareAttrNS(space)
 }
 
 // walkFunc is the type of the function called for each of an Element's
@@ -1,10 +1,16 @@
 package xmltree
 
 import (
+	"bytes"
 	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
 	"os"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 )
 
 var googleSOAP = []byte(`<soap11:Envelope
@@ -340,3 +346,764 @@ func TestExistingNSAttrs(t *testing.T) {
 		found[attr.Name] = true
 	}
 }
+
+func TestStream(t *testing.T) {
+	const wsdlNS = "http://schemas.xmlsoap.org/wsdl/"
+	root := parseDoc(t, exampleDoc)
+	want := root.Search(wsdlNS, "operation")
+
+	s := NewStream(bytes.NewReader(exampleDoc))
+	var got []*Element
+	for {
+		el, err := s.Next(wsdlNS, "operation")
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, el)
+	}
+	// nested operations are part of the enclosing subtree
+	var outer []*Element
+	for _, el := range want {
+		nested := false
+		for _, o := range outer {
+			for _, c := range o.Flatten() {
+				nested = nested || c == el
+			}
+		}
+		if !nested {
+			outer = append(outer, el)
+		}
+	}
+	if len(got) != len(outer) {
+		t.Fatalf("got %d elements from Stream, want %d", len(got), len(outer))
+	}
+	for i := range got {
+		if !Equal(got[i], outer[i]) || !bytes.Equal(got[i].Content, outer[i].Content) {
+			t.Errorf("Stream returned\n%s\nwant\n%s", Marshal(got[i]), Marshal(outer[i]))
+		}
+		for _, prefix := range []string{"soap", "tns", "s", ""} {
+			if got[i].Resolve(prefix+":x") != outer[i].Resolve(prefix+":x") {
+				t.Errorf("prefix %q resolves to %q in Stream, %q in Parse",
+					prefix, got[i].Resolve(prefix+":x").Space, outer[i].Resolve(prefix+":x").Space)
+			}
+		}
+	}
+}
+
+func TestStreamLarge(t *testing.T) {
+	const n = 5000
+	var buf bytes.Buffer
+	buf.WriteString(`<export xmlns="urn:export" xmlns:x="urn:x">`)
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&buf, "<record x:id=\"%d\"><!-- %[1]d --><value>%[1]d</value></record>\n", i)
+	}
+	buf.WriteString(`</export>`)
+
+	s := NewStream(&buf)
+	for i := 0; ; i++ {
+		el, err := s.Next("urn:export", "record")
+		if err == io.EOF {
+			if i != n {
+				t.Errorf("read %d records, want %d", i, n)
+			}
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		id := fmt.Sprint(i)
+		if el.Attr("urn:x", "id") != id || string(el.Children[0].Content) != id {
+			t.Fatalf("record %d: got %s", i, Marshal(el))
+		}
+		if want := "<!-- " + id + " --><value>" + id + "</value>"; string(el.Content) != want {
+			t.Fatalf("record %d: Content is %q, want %q", i, el.Content, want)
+		}
+		if len(s.rec.buf) > 2*streamDiscardThreshold {
+			t.Fatalf("stream is buffering %d bytes", len(s.rec.buf))
+		}
+	}
+}
+
+func TestStreamCharset(t *testing.T) {
+	f, err := os.Open("testdata/iso8859-1.xsd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	root := parseFile(t, "testdata/iso8859-1.xsd")
+	want := root.Search("", "book")
+
+	s := NewStream(f)
+	for i := 0; ; i++ {
+		el, err := s.Next("", "book")
+		if err == io.EOF {
+			if i != len(want) {
+				t.Errorf("read %d elements, want %d", i, len(want))
+			}
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		if !Equal(el, want[i]) || !bytes.Equal(el.Content, want[i].Content) {
+			t.Errorf("Stream returned %s, want %s", Marshal(el), Marshal(want[i]))
+		}
+	}
+}
+
+func TestPositions(t *testing.T) {
+	doc := []byte("<?xml version=\"1.0\"?>\n<a xmlns=\"urn:a\">\n  <b x=\"1\"\n     y='>'/>\n  <c>text</c>\n</a>")
+	root := parseDoc(t, doc)
+	b, c := &root.Children[0], &root.Children[1]
+	tests := []struct {
+		name string
+		pos  Pos
+		want string
+	}{
+		{"<a>", root.Start, "<a "},
+		{"</a>", root.End, ""},
+		{"<b>", b.Start, "<b "},
+		{"</b>", b.End, "\n  <c>"},
+		{"b@x", b.AttrPos("", "x"), "x=\"1\""},
+		{"b@y", b.AttrPos("", "y"), "y='>'"},
+		{"<c>", c.Start, "<c>"},
+		{"</c>", c.End, "\n</a>"},
+	}
+	for _, tt := range tests {
+		if !strings.HasPrefix(string(doc[tt.pos.Offset:]), tt.want) {
+			t.Errorf("%s: offset %d points to %q, want %q", tt.name, tt.pos.Offset, doc[tt.pos.Offset:], tt.want)
+		}
+		// recompute the line and column from the offset
+		line, col := 1, 1
+		for _, ch := range doc[:tt.pos.Offset] {
+			if ch == '\n' {
+				line, col = line+1, 1
+			} else {
+				col++
+			}
+		}
+		if tt.pos.Line != line || tt.pos.Column != col {
+			t.Errorf("%s: at %s, want %d:%d", tt.name, tt.pos, line, col)
+		}
+	}
+	if pos := b.AttrPos("", "z"); pos.IsValid() {
+		t.Errorf("got position %s for missing attribute", pos)
+	}
+}
+
+func TestParseDocument(t *testing.T) {
+	doc := `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE note>
+<!-- before -->
+<note id="n&amp;1" xmlns="urn:note" xmlns:x="urn:x">
+  <?render fancy?>
+  Dear <x:to>Tove</x:to>, <![CDATA[<don't> forget]]> me &lt;3<!-- inline -->
+  <empty />
+</note>
+<!-- after -->`
+	d, err := ParseDocument([]byte(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(MarshalDocument(d)); got != doc {
+		t.Errorf("MarshalDocument produced\n%s\nwant\n%s", got, doc)
+	}
+	var kinds []string
+	for _, n := range d.Root.Nodes {
+		kinds = append(kinds, n.Kind.String())
+	}
+	want := "text processing-instruction text element text cdata text comment text element text"
+	if got := strings.Join(kinds, " "); got != want {
+		t.Errorf("got nodes %s, want %s", got, want)
+	}
+
+	// The Root of a Document is an ordinary Element
+	out := MarshalIndent(d.Root, "", "  ")
+	if _, err := ParseDocument(out); err != nil {
+		t.Errorf("%v\n%s", err, out)
+	}
+}
+
+func TestParseDocumentCharset(t *testing.T) {
+	data, err := os.ReadFile("testdata/iso8859-1.xsd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := ParseDocument(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := MarshalDocument(d)
+	if !bytes.HasPrefix(out, []byte(`<?xml version="1.0" encoding="UTF-8"?>`)) {
+		t.Errorf("XML declaration not adjusted for UTF-8 output: %.50s", out)
+	}
+	if !bytes.Contains(out, []byte("Bröderna Lejonhjärta")) {
+		t.Errorf("output does not contain converted text")
+	}
+}
+
+func TestDiff(t *testing.T) {
+	parse := func(s string) *Element {
+		el, err := Parse([]byte(s))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return el
+	}
+	tests := []struct {
+		a, b string
+		opts *DiffOptions
+		want []string
+	}{
+		{
+			a:    `<a x="1"><b>text</b></a>`,
+			b:    `<a x="1"><b>text</b></a>`,
+			want: nil,
+		},
+		{
+			a: `<a x="1" y="2"><b>one</b><c/></a>`,
+			b: `<a x="3" z="4"><b>two</b><c/><d/></a>`,
+			want: []string{
+				`changed /a/@x: "1" != "3"`,
+				`removed /a/@y: "2"`,
+				`added /a/@z: "4"`,
+				`changed /a/b/text(): "one" != "two"`,
+				`added /a/d: "d"`,
+			},
+		},
+		{
+			a: `<a><b>1</b><b>2</b><b>3</b></a>`,
+			b: `<a><b>1</b><c/><b>3</b></a>`,
+			want: []string{
+				`removed /a/b[2]: "b"`,
+				`added /a/c: "c"`,
+			},
+		},
+		{
+			a:    `<a><b>1</b><b>2</b><c/></a>`,
+			b:    `<a><c/><b>2</b><b>1</b></a>`,
+			opts: &DiffOptions{IgnoreOrder: true},
+			want: nil,
+		},
+		{
+			a: `<a>x<b/>y</a>`,
+			b: `<a>xy<b/></a>`,
+			want: []string{
+				`changed /a/text()[1]: "x" != "xy"`,
+				`removed /a/text()[2]: "y"`,
+			},
+		},
+		{
+			a:    `<a>x<b/>y</a>`,
+			b:    `<a>x<!-- c --><b/><![CDATA[y]]></a>`,
+			want: nil,
+		},
+		{
+			a:    "<a>\n  <b> some  text </b>\n</a>",
+			b:    `<a><b>some text</b></a>`,
+			opts: &DiffOptions{IgnoreWhitespace: true},
+			want: nil,
+		},
+		{
+			a: `<p:a xmlns:p="urn:x" p:y="1"/>`,
+			b: `<q:a xmlns:q="urn:x" q:y="1"/>`,
+			want: []string{
+				`changed /p:a: "p:a" != "q:a"`,
+				`changed /p:a/@p:y: "p:y" != "q:y"`,
+			},
+		},
+		{
+			a:    `<p:a xmlns:p="urn:x" p:y="1"/>`,
+			b:    `<a xmlns="urn:x" xmlns:q="urn:x" q:y="1"/>`,
+			opts: &DiffOptions{IgnorePrefixes: true},
+			want: nil,
+		},
+		{
+			a:    `<a id="1" time="now"><b time="then"/></a>`,
+			b:    `<a id="1" time="later"><b/></a>`,
+			opts: &DiffOptions{IgnoreAttrs: []xml.Name{{Local: "time"}}},
+			want: nil,
+		},
+		{
+			a:    `<a xmlns="urn:x"/>`,
+			b:    `<a xmlns="urn:y"/>`,
+			want: []string{`changed /a: "{urn:x}a" != "{urn:y}a"`},
+		},
+	}
+	for _, tt := range tests {
+		a, b := parse(tt.a), parse(tt.b)
+		before := a.String()
+		var got []string
+		for _, d := range Diff(a, b, tt.opts) {
+			got = append(got, d.String())
+		}
+		if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+			t.Errorf("Diff(%s, %s):\ngot\n\t%s\nwant\n\t%s", tt.a, tt.b,
+				strings.Join(got, "\n\t"), strings.Join(tt.want, "\n\t"))
+		}
+		if a.String() != before {
+			t.Errorf("Diff modified its argument %s", tt.a)
+		}
+	}
+}
+
+// Matching unordered children must not compare every pair of
+// subtrees again at every level, which takes exponential time in the
+// depth of the documents.
+func TestDiffIgnoreOrderLarge(t *testing.T) {
+	// 5461 elements with the same name, which differ only in the
+	// text of their leaves.
+	var build func(buf *strings.Builder, id string, depth int, reverse bool)
+	build = func(buf *strings.Builder, id string, depth int, reverse bool) {
+		buf.WriteString("<n>")
+		if depth == 0 {
+			if reverse && id == "0123012" {
+				id = "changed"
+			}
+			buf.WriteString(id)
+		}
+		for i := 0; depth > 0 && i < 4; i++ {
+			k := i
+			if reverse {
+				k = 3 - i
+			}
+			build(buf, id+strconv.Itoa(k), depth-1, reverse)
+		}
+		buf.WriteString("</n>")
+	}
+	var a, b strings.Builder
+	build(&a, "0", 6, false)
+	build(&b, "0", 6, true)
+	x, err := Parse([]byte(a.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	y, err := Parse([]byte(b.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	diffs := Diff(x, y, &DiffOptions{IgnoreOrder: true})
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Diff took %s", elapsed)
+	}
+	want := `changed /n/n[2]/n[3]/n[4]/n[1]/n[2]/n[3]/text(): "0123012" != "changed"`
+	if len(diffs) != 1 || diffs[0].String() != want {
+		t.Errorf("got %v, want [%s]", diffs, want)
+	}
+}
+
+func TestEdit(t *testing.T) {
+	root := NewElement("urn:a", "root")
+	item := root.AppendChild(NewElement("urn:a", "item"))
+	item.SetText("1 < 2")
+	item.SetAttr("urn:b", "attr", "v")
+	root.AppendChild(NewElement("", "plain"))
+	root.InsertBefore(NewElement("urn:c", "first"), &root.Children[0])
+
+	want := `<root xmlns="urn:a"><first xmlns="urn:c" /><item ns1:attr="v" xmlns:ns1="urn:b">1 &lt; 2</item><plain xmlns="" /></root>`
+	if got := root.String(); got != want {
+		t.Errorf("got\n\t%s\nwant\n\t%s", got, want)
+	}
+	parsed, err := Parse([]byte(root.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := Diff(root, parsed, nil); d != nil {
+		t.Errorf("marshaled tree differs from original: %v", d)
+	}
+
+	doc, err := ParseDocument([]byte(`<a xmlns="urn:a" xmlns:x="urn:x"><!-- c --><b x:id="1">text</b> tail <c/></a>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	el := doc.Root
+	// Move b into another document with conflicting prefixes.
+	other, err := Parse([]byte(`<x:other xmlns:x="urn:other" xmlns="urn:other"/>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	moved := el.RemoveChild(&el.Children[0])
+	other.AppendChild(moved)
+	el.AppendChild(NewElement("urn:a", "d")).SetAttr("", "n", "2")
+	el.RemoveChild(&el.Children[0])
+	el.Children[0].RemoveAttr("", "n")
+	el.InsertBefore(NewElement("urn:a", "e"), &el.Children[0])
+
+	tests := []struct {
+		el   *Element
+		want string
+	}{
+		{el, `<a xmlns="urn:a" xmlns:x="urn:x"><!-- c --> tail <e /><d /></a>`},
+		{other, `<x:other xmlns:x="urn:other" xmlns="urn:other"><b xmlns="urn:a" xmlns:y="urn:x" y:id="1">text</b></x:other>`},
+	}
+	for _, tt := range tests {
+		want, err := Parse([]byte(tt.want))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := Parse(Marshal(tt.el))
+		if err != nil {
+			t.Fatalf("%s: %v", Marshal(tt.el), err)
+		}
+		if d := Diff(want, got, &DiffOptions{IgnorePrefixes: true}); d != nil {
+			t.Errorf("got %s, want %s: %v", Marshal(tt.el), tt.want, d)
+		}
+	}
+	if s, err := el.QueryString("string(.)"); err != nil || s != " tail " {
+		t.Errorf("string value of edited element is %q, want %q", s, " tail ")
+	}
+	if s, err := el.QueryString("name(*[1])"); err != nil || s != "e" {
+		t.Errorf("first child of edited element is %q, want %q", s, "e")
+	}
+
+	replaced, err := Parse([]byte(`<a><b/><c/></a>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	replaced.ReplaceChild(NewElement("", "d"), &replaced.Children[0])
+	if replaced.Content != nil {
+		t.Errorf("Content of element after ReplaceChild is %q, want nil", replaced.Content)
+	}
+	if got, want := string(Marshal(replaced)), `<a><d /><c /></a>`; got != want {
+		t.Errorf("marshaled %s after ReplaceChild, want %s", got, want)
+	}
+}
+
+func TestParseOptions(t *testing.T) {
+	deep := strings.Repeat("<a>", 20) + strings.Repeat("</a>", 20)
+	tests := []struct {
+		doc   string
+		opts  ParseOptions
+		limit Limit
+	}{
+		{deep, ParseOptions{MaxDepth: 10}, LimitDepth},
+		{deep, ParseOptions{MaxDepth: 20}, 0},
+		{`<a><b/><b/><b/></a>`, ParseOptions{MaxElements: 3}, LimitElements},
+		{`<a><b/><b/></a>`, ParseOptions{MaxElements: 3}, 0},
+		{`<a x="1" y="2" xmlns="urn:a"/>`, ParseOptions{MaxAttrs: 2}, LimitAttrs},
+		{`<a>` + strings.Repeat("x", 100) + `</a>`, ParseOptions{MaxTokenSize: 64}, LimitTokenSize},
+		{`<a x="` + strings.Repeat("x", 100) + `"/>`, ParseOptions{MaxTokenSize: 64}, LimitTokenSize},
+		{`<a><!--` + strings.Repeat("-x>", 30) + `--></a>`, ParseOptions{MaxTokenSize: 64}, LimitTokenSize},
+		{`<a x="` + strings.Repeat(">", 40) + `"><![CDATA[` + strings.Repeat("<", 40) + `]]></a>`, ParseOptions{MaxTokenSize: 64}, 0},
+		{`<a>` + strings.Repeat("x", 100) + `</a>`, ParseOptions{MaxBytes: 64}, LimitBytes},
+		{`<!DOCTYPE a [<!ENTITY e "x">]><a/>`, ParseOptions{DisallowDOCTYPE: true}, LimitDOCTYPE},
+		{`<!DOCTYPE a [<!ENTITY e "x">]><a/>`, ParseOptions{}, 0},
+	}
+	for _, tt := range tests {
+		opts := tt.opts
+		parsers := map[string]func() error{
+			"Parse": func() error {
+				_, err := opts.Parse([]byte(tt.doc))
+				return err
+			},
+			"ParseDocument": func() error {
+				_, err := opts.ParseDocument([]byte(tt.doc))
+				return err
+			},
+			"Stream": func() error {
+				_, err := opts.NewStream(strings.NewReader(tt.doc)).Next("", "a")
+				return err
+			},
+		}
+		for name, parse := range parsers {
+			err := parse()
+			var lerr *LimitError
+			switch {
+			case tt.limit == 0 && err != nil:
+				t.Errorf("%s(%.30q) with %+v: %v", name, tt.doc, tt.opts, err)
+			case tt.limit != 0 && !errors.As(err, &lerr):
+				t.Errorf("%s(%.30q) with %+v: got %v, want LimitError", name, tt.doc, tt.opts, err)
+			case tt.limit != 0 && lerr.Limit != tt.limit:
+				t.Errorf("%s(%.30q) with %+v: exceeded %s, want %s", name, tt.doc, tt.opts, lerr.Limit, tt.limit)
+			}
+		}
+	}
+
+	// A Stream stops reading an oversized token, rather than
+	// buffering all of it.
+	r := &endlessAttr{}
+	_, err := (&ParseOptions{MaxTokenSize: 1024}).NewStream(r).Next("", "a")
+	var lerr *LimitError
+	if !errors.As(err, &lerr) || lerr.Limit != LimitTokenSize {
+		t.Errorf("got %v, want a LimitError for the token size", err)
+	}
+	if r.n > 1<<20 {
+		t.Errorf("read %d bytes of a token before rejecting it", r.n)
+	}
+	if _, err := Parse([]byte(strings.Repeat("<a>", 3002))); err == nil {
+		t.Error("Parse accepted a document nested 3002 levels deep")
+	}
+}
+
+// An endlessAttr is a document with an attribute that never ends.
+type endlessAttr struct{ n int }
+
+func (r *endlessAttr) Read(p []byte) (int, error) {
+	if r.n > 1<<26 {
+		return 0, io.EOF
+	}
+	for i := range p {
+		p[i] = 'x'
+	}
+	if r.n == 0 {
+		copy(p, `<a x="`)
+	}
+	r.n += len(p)
+	return len(p), nil
+}
+
+type testJSONSchema map[string]JSONType
+
+func (s testJSONSchema) ElementType(path []xml.Name) (JSONType, bool) {
+	name := path[len(path)-1].Local
+	return s[name], name == "item"
+}
+
+func (s testJSONSchema) AttrType(path []xml.Name, attr xml.Name) JSONType {
+	return s["@"+attr.Local]
+}
+
+func TestJSON(t *testing.T) {
+	const doc = `<order xmlns="urn:o" xmlns:x="urn:x" id="7" x:rush="1">
+  <item><sku>a&amp;b</sku><qty>2</qty></item>
+  <note/>
+  <x:paid>true</x:paid>
+</order>`
+	schema := testJSONSchema{"qty": JSONNumber, "paid": JSONBool, "@id": JSONNumber}
+	tests := []struct {
+		name string
+		opts JSONOptions
+		want string
+	}{
+		{
+			name: "BadgerFish",
+			want: `{"order":{"@xmlns":{"$":"urn:o","x":"urn:x"},"@id":"7","@x:rush":"1",` +
+				`"item":{"sku":{"$":"a&b"},"qty":{"$":"2"}},"note":{},"x:paid":{"$":"true"}}}`,
+		},
+		{
+			name: "BadgerFish with schema",
+			opts: JSONOptions{Schema: schema},
+			want: `{"order":{"@xmlns":{"$":"urn:o","x":"urn:x"},"@id":7,"@x:rush":"1",` +
+				`"item":[{"sku":{"$":"a&b"},"qty":{"$":2}}],"note":{},"x:paid":{"$":true}}}`,
+		},
+		{
+			name: "Parker",
+			opts: JSONOptions{Convention: Parker},
+			want: `{"item":{"sku":"a&b","qty":"2"},"note":null,"x:paid":"true"}`,
+		},
+		{
+			name: "Parker with schema",
+			opts: JSONOptions{Convention: Parker, Schema: schema},
+			want: `{"item":[{"sku":"a&b","qty":2}],"note":null,"x:paid":true}`,
+		},
+	}
+	root, err := Parse([]byte(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := tt.opts
+			data, err := ToJSON(root, &opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", data, tt.want)
+			}
+			opts.Root = xml.Name{Space: "urn:o", Local: "order"}
+			opts.Namespaces = map[string]string{"x": "urn:x"}
+			el, err := FromJSON(data, &opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Parker drops attributes, so compare the JSON
+			again, err := ToJSON(el, &opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(again) != tt.want {
+				t.Errorf("round trip through\n%s\ngot\n%s", MarshalIndent(el, "", "  "), again)
+			}
+			// Equal sorts the children of its arguments
+			orig, _ := Parse([]byte(doc))
+			if opts.Convention == BadgerFish && !Equal(el, orig) {
+				t.Errorf("round trip changed document:\n%s", MarshalIndent(el, "", "  "))
+			}
+		})
+	}
+
+	bad := []struct {
+		json string
+		opts JSONOptions
+	}{
+		{`{"a":1,"b":2}`, JSONOptions{}},
+		{`{"a":{"p:b":"x"}}`, JSONOptions{}},
+		{`{"a":{"@p:b":"x"}}`, JSONOptions{}},
+		{`{"a":[[1]]}`, JSONOptions{Convention: Parker, Root: xml.Name{Local: "r"}}},
+		{`{"a":1}`, JSONOptions{Convention: Parker}},
+		{`{"a":1} 2`, JSONOptions{}},
+	}
+	for _, tt := range bad {
+		if _, err := FromJSON([]byte(tt.json), &tt.opts); err == nil {
+			t.Errorf("FromJSON(%s) succeeded, want error", tt.json)
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	const doc = `<?xml version="1.0"?>
+<!-- top --><r:root xmlns:r="urn:r" xmlns:unused="urn:u" z="1" b="2">
+<r:a xmlns:x="urn:x" xsi:type="x:T" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">text <b>mixed</b></r:a>
+      <!-- c --><p:b xmlns:p="urn:p1"/><p:b xmlns:p="urn:p2"/>
+<c xmlns="urn:c"><d/></c>
+</r:root>`
+	const want = `<?xml version="1.0"?>
+<!-- top -->
+<r:root b="2" z="1" xmlns:r="urn:r" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xmlns:x="urn:x">
+  <r:a xsi:type="x:T">text <b>mixed</b></r:a>
+  <!-- c -->
+  <p:b xmlns:p="urn:p1" />
+  <p:b xmlns:p="urn:p2" />
+  <c xmlns="urn:c">
+    <d />
+  </c>
+</r:root>
+`
+	parsed, err := ParseDocument([]byte(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed.Root.NormalizeNamespaces()
+	parsed.Root.SortAttrs()
+	got := MarshalDocumentIndent(parsed, "  ")
+	if string(got) != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+	// Equal sorts the children of its arguments
+	formatted, err := Parse(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	orig, _ := Parse([]byte(doc))
+	if !Equal(formatted, orig) {
+		t.Errorf("formatting changed the document:\n%s", got)
+	}
+	again, err := ParseDocument(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again.Root.NormalizeNamespaces()
+	again.Root.SortAttrs()
+	if regot := MarshalDocumentIndent(again, "  "); !bytes.Equal(regot, got) {
+		t.Errorf("formatting is not idempotent:\n%s", regot)
+	}
+}
+
+func TestParseDTD(t *testing.T) {
+	const doc = `<?xml version="1.0"?>
+<!DOCTYPE book SYSTEM "book.dtd" [
+  <!ENTITY title "The &lang; Programming Language">
+  <!ENTITY lang "Go">
+  <!ENTITY authors "<author>Donovan</author><author>Kernighan</author>">
+  <!ENTITY chapter SYSTEM "chapter.xml">
+  <!ATTLIST book
+    xmlns CDATA #FIXED "urn:books"
+    id ID #IMPLIED
+    kind (print|ebook) "print"
+    tags NMTOKENS #IMPLIED>
+]>
+<book id="gopl" tags="  go   programming " note='say "&lang;"'>
+  <title>&title;</title>
+  &authors;
+  &chapter;
+</book>`
+	resolver := func(publicID, systemID string) ([]byte, error) {
+		switch systemID {
+		case "book.dtd":
+			return []byte(`<!ATTLIST author role CDATA "author">`), nil
+		case "chapter.xml":
+			return []byte(`<?xml encoding="UTF-8"?><chapter>Tutorial</chapter>`), nil
+		}
+		return nil, fmt.Errorf("%s not found", systemID)
+	}
+	opts := ParseOptions{ParseDTD: true, DTDResolver: resolver}
+	parsed, err := opts.ParseDocument([]byte(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := parsed.Root
+	if parsed.DTD == nil || parsed.DTD.Name != "book" {
+		t.Errorf("DTD not recorded")
+	}
+	if root.Name.Space != "urn:books" {
+		t.Errorf("default xmlns attribute not applied, got name %v", root.Name)
+	}
+	if got := root.Attr("", "kind"); got != "print" {
+		t.Errorf("got default kind %q, want print", got)
+	}
+	if got := root.Attr("", "tags"); got != "go programming" {
+		t.Errorf("got tags %q, want normalized value", got)
+	}
+	if got := root.Attr("", "note"); got != `say "Go"` {
+		t.Errorf("got note %q", got)
+	}
+	if got := root.ID(); got != "gopl" {
+		t.Errorf("got ID %q, want gopl", got)
+	}
+	if got := string(root.Search("urn:books", "title")[0].Content); got != "The Go Programming Language" {
+		t.Errorf("got title %q", got)
+	}
+	authors := root.Search("urn:books", "author")
+	if len(authors) != 2 || authors[1].Attr("", "role") != "author" {
+		t.Errorf("entity with markup not expanded, or external subset not loaded: %s", root)
+	}
+	if len(root.Search("urn:books", "chapter")) != 1 {
+		t.Errorf("external entity not expanded: %s", root)
+	}
+	x, err := CompileXPath("id('gopl')")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nodes, err := x.Eval(root); err != nil || len(nodes.([]*XPathNode)) != 1 {
+		t.Errorf("id('gopl') returned %v, %v", nodes, err)
+	}
+
+	// Without a resolver, external entities cannot be expanded.
+	if _, err := (&ParseOptions{ParseDTD: true}).Parse([]byte(doc)); err == nil {
+		t.Error("expected an error expanding an external entity without a resolver")
+	}
+
+	laughs := `<!DOCTYPE lolz [<!ENTITY lol0 "lollollollollollollollollollol">`
+	for i := 1; i < 10; i++ {
+		laughs += fmt.Sprintf(`<!ENTITY lol%d "%s">`, i, strings.Repeat(fmt.Sprintf("&lol%d;", i-1), 10))
+	}
+	laughs += `]><lolz>&lol9;</lolz>`
+	_, err = (&ParseOptions{ParseDTD: true}).Parse([]byte(laughs))
+	var lerr *LimitError
+	if !errors.As(err, &lerr) || lerr.Limit != LimitEntityExpansion {
+		t.Errorf("got %v, want entity expansion LimitError", err)
+	}
+	if _, err := (&ParseOptions{ParseDTD: true}).Parse([]byte(`<!DOCTYPE a [<!ENTITY a "&a;">]><a>&a;</a>`)); err == nil {
+		t.Error("expected an error for a recursive entity")
+	}
+	for _, doc := range []string{
+		`<!DOCTYPE a [<!ENTITY e "<b>">]><a>&e;</b></a>`,
+		`<!DOCTYPE a [<!ENTITY e "</b>">]><a><b>&e;</a>`,
+		`<!DOCTYPE a [<!ENTITY e "<b x='1'">]><a>&e;/></a>`,
+		`<!DOCTYPE a [<!ENTITY o "<b>"><!ENTITY e "&o;</b></b>">]><a><b>&e;</a>`,
+	} {
+		if _, err := (&ParseOptions{ParseDTD: true}).Parse([]byte(doc)); err == nil {
+			t.Errorf("expected an error for unbalanced entity replacement text in %s", doc)
+		}
+	}
+	balanced, err := (&ParseOptions{ParseDTD: true}).Parse([]byte(
+		`<!DOCTYPE a [<!ENTITY e "<b x='&gt;'><!-- </b> --><c/></b>">]><a>&e;</a>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(balanced.Search("", "c")) != 1 {
+		t.Errorf("balanced entity not expanded: %s", balanced)
+	}
+}
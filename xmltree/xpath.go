@@ -0,0 +1,536 @@
+package xmltree
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// A NodeKind identifies the type of a node in an XML document.
+type NodeKind int
+
+const (
+	// RootNode is the document node that contains the root
+	// element.
+	RootNode NodeKind = iota
+	ElementNode
+	AttrNode
+	TextNode
+	CommentNode
+	ProcInstNode
+	// CDATANode is a CDATA section. In the XPath data model,
+	// CDATA sections are part of text nodes.
+	CDATANode
+	// DirectiveNode is a directive such as <!DOCTYPE>. Directives
+	// are not part of the XPath data model.
+	DirectiveNode
+)
+
+func (k NodeKind) String() string {
+	switch k {
+	case RootNode:
+		return "root"
+	case ElementNode:
+		return "element"
+	case AttrNode:
+		return "attribute"
+	case TextNode:
+		return "text"
+	case CommentNode:
+		return "comment"
+	case ProcInstNode:
+		return "processing-instruction"
+	case CDATANode:
+		return "cdata"
+	case DirectiveNode:
+		return "directive"
+	}
+	return fmt.Sprintf("NodeKind(%d)", int(k))
+}
+
+// An XPathNode is a node in the XPath data model. It wraps an Element,
+// one of an Element's attributes, or one of the text, comment or
+// processing instruction nodes contained in an Element. Unlike an
+// Element, an XPathNode knows its parent, so that the reverse axes
+// of XPath can be navigated.
+//
+// XPathNodes are created during the evaluation of an XPath expression,
+// or by the NewXPathRoot function. Two XPathNodes refer to the same node
+// if their Same method returns true.
+type XPathNode struct {
+	kind   NodeKind
+	el     *Element
+	parent *XPathNode
+	// For attributes, the index into el.StartElement.Attr. For
+	// elements, the index into the parent's Children. For all
+	// other kinds, the gap (position between child elements)
+	// and the index of the node within that gap.
+	index, sub int
+	// character data for text, comment and processing
+	// instruction nodes
+	data, target string
+
+	kids  []*XPathNode
+	attrs []*XPathNode
+	order []int
+}
+
+// NewXPathRoot returns the root node of a document whose document
+// element is el. The root node is the starting point for absolute
+// location paths.
+func NewXPathRoot(el *Element) *XPathNode {
+	return &XPathNode{kind: RootNode, el: el}
+}
+
+// XPathNode returns the node for el, as the document element of
+// a new document.
+func (el *Element) XPathNode() *XPathNode {
+	root := NewXPathRoot(el)
+	return root.Children()[0]
+}
+
+// Kind returns the type of the node.
+func (n *XPathNode) Kind() NodeKind { return n.kind }
+
+// Element returns the Element for element nodes. For attribute,
+// text, comment and processing instruction nodes, the Element
+// containing the node is returned. For the root node, the document
+// element is returned.
+func (n *XPathNode) Element() *Element { return n.el }
+
+// Parent returns the parent of a node, or nil for the root node. The
+// parent of an attribute node is the element that carries it.
+func (n *XPathNode) Parent() *XPathNode { return n.parent }
+
+// Name returns the expanded name of element and attribute nodes.
+// For processing instructions, the Local field contains the target.
+// The name of all other nodes is empty.
+func (n *XPathNode) Name() xml.Name {
+	switch n.kind {
+	case ElementNode:
+		return n.el.Name
+	case AttrNode:
+		return n.el.StartElement.Attr[n.index].Name
+	case ProcInstNode:
+		return xml.Name{Local: n.target}
+	}
+	return xml.Name{}
+}
+
+// Value returns the string-value of the node, as defined by the
+// XPath data model. For root and element nodes, this is the
+// concatenation of all descendant text.
+func (n *XPathNode) Value() string {
+	switch n.kind {
+	case RootNode, ElementNode:
+		return n.el.textContent()
+	case AttrNode:
+		return n.el.StartElement.Attr[n.index].Value
+	}
+	return n.data
+}
+
+// Same returns true if n and other refer to the same node in
+// the same document.
+func (n *XPathNode) Same(other *XPathNode) bool {
+	return n.key() == other.key()
+}
+
+type nodeKey struct {
+	kind       NodeKind
+	el         *Element
+	index, sub int
+}
+
+func (n *XPathNode) key() nodeKey {
+	return nodeKey{n.kind, n.el, n.index, n.sub}
+}
+
+// Attributes returns the attribute nodes of an element node,
+// in the order they appear in the Element.
+func (n *XPathNode) Attributes() []*XPathNode {
+	if n.kind != ElementNode {
+		return nil
+	}
+	if n.attrs == nil {
+		n.attrs = make([]*XPathNode, 0, len(n.el.StartElement.Attr))
+		for i := range n.el.StartElement.Attr {
+			n.attrs = append(n.attrs, &XPathNode{
+				kind:   AttrNode,
+				el:     n.el,
+				parent: n,
+				index:  i,
+			})
+		}
+	}
+	return n.attrs
+}
+
+// Children returns the child nodes of a root or element node in
+// document order. Text, comment and processing instruction children
+// are only available for Elements with Nodes, or whose Content is
+// consistent with their Children; if the Children of an Element
+// without Nodes have been modified, only the child elements are
+// returned.
+func (n *XPathNode) Children() []*XPathNode {
+	if n.kids != nil {
+		return n.kids
+	}
+	switch n.kind {
+	case RootNode:
+		n.kids = []*XPathNode{{kind: ElementNode, el: n.el, parent: n}}
+	case ElementNode:
+		items := n.el.contentItems()
+		n.kids = make([]*XPathNode, 0, len(items))
+		gap, sub := 0, 0
+		for _, item := range items {
+			if item.kind == ElementNode {
+				n.kids = append(n.kids, &XPathNode{
+					kind:   ElementNode,
+					el:     &n.el.Children[item.child],
+					parent: n,
+					index:  item.child,
+				})
+				gap, sub = item.child+1, 0
+				continue
+			}
+			n.kids = append(n.kids, &XPathNode{
+				kind:   item.kind,
+				el:     n.el,
+				parent: n,
+				index:  gap,
+				sub:    sub,
+				data:   item.data,
+				target: item.target,
+			})
+			sub++
+		}
+	default:
+		n.kids = []*XPathNode{}
+	}
+	return n.kids
+}
+
+// documentOrder returns a key that can be used to sort nodes
+// in document order. Attributes sort after their element but before
+// its children.
+func (n *XPathNode) documentOrder() []int {
+	if n.order != nil || n.parent == nil {
+		return n.order
+	}
+	parent := n.parent.documentOrder()
+	order := make([]int, len(parent), len(parent)+2)
+	copy(order, parent)
+	switch n.kind {
+	case AttrNode:
+		order = append(order, -1, n.index)
+	case ElementNode:
+		order = append(order, 2*n.index+1, 0)
+	default:
+		order = append(order, 2*n.index, n.sub)
+	}
+	n.order = order
+	return order
+}
+
+func compareOrder(a, b *XPathNode) int {
+	x, y := a.documentOrder(), b.documentOrder()
+	for i := 0; i < len(x) && i < len(y); i++ {
+		if x[i] != y[i] {
+			if x[i] < y[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return len(x) - len(y)
+}
+
+// sortNodes sorts a node-set in document order and
+// removes duplicate nodes.
+func sortNodes(nodes []*XPathNode) []*XPathNode {
+	if len(nodes) < 2 {
+		return nodes
+	}
+	sort.SliceStable(nodes, func(i, j int) bool {
+		return compareOrder(nodes[i], nodes[j]) < 0
+	})
+	result := nodes[:1]
+	for _, n := range nodes[1:] {
+		if !n.Same(result[len(result)-1]) {
+			result = append(result, n)
+		}
+	}
+	return result
+}
+
+// A contentItem is one of the nodes directly contained by an
+// Element.
+type contentItem struct {
+	kind         NodeKind
+	data, target string
+	child        int
+}
+
+// contentItems returns the nodes directly contained by an Element. If
+// the Element has no Nodes, its Content is tokenized to recover the
+// text, comment and processing instruction nodes between its children.
+// If the Content does not agree with Children, only the child elements
+// are returned.
+func (el *Element) contentItems() []contentItem {
+	if el.Nodes != nil {
+		items := make([]contentItem, 0, len(el.Nodes))
+		for _, n := range el.Nodes {
+			switch n.Kind {
+			case ElementNode:
+				if n.Child >= 0 && n.Child < len(el.Children) {
+					items = append(items, contentItem{kind: ElementNode, child: n.Child})
+				}
+			case TextNode, CDATANode:
+				items = append(items, contentItem{kind: TextNode, data: string(n.Data)})
+			case CommentNode, ProcInstNode:
+				items = append(items, contentItem{kind: n.Kind, data: string(n.Data), target: n.Target})
+			}
+		}
+		return items
+	}
+	items, err := tokenizeContent(el.Content, len(el.Children))
+	if err != nil {
+		items = make([]contentItem, 0, len(el.Children))
+		for i := range el.Children {
+			items = append(items, contentItem{kind: ElementNode, child: i})
+		}
+	}
+	return items
+}
+
+var errContentMismatch = errors.New("xmltree: element Content does not match Children")
+
+func tokenizeContent(content []byte, nchildren int) ([]contentItem, error) {
+	var (
+		items []contentItem
+		text  bytes.Buffer
+		depth int
+		child int
+	)
+	flush := func() {
+		if text.Len() > 0 {
+			items = append(items, contentItem{kind: TextNode, data: text.String()})
+			text.Reset()
+		}
+	}
+	d := xml.NewDecoder(bytes.NewReader(content))
+	for {
+		tok, err := d.RawToken()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			if depth == 0 {
+				flush()
+				items = append(items, contentItem{kind: ElementNode, child: child})
+				child++
+			}
+			depth++
+		case xml.EndElement:
+			depth--
+		case xml.CharData:
+			if depth == 0 {
+				text.Write(tok)
+			}
+		case xml.Comment:
+			if depth == 0 {
+				flush()
+				items = append(items, contentItem{kind: CommentNode, data: string(tok)})
+			}
+		case xml.ProcInst:
+			if depth == 0 {
+				flush()
+				items = append(items, contentItem{
+					kind:   ProcInstNode,
+					target: tok.Target,
+					data:   string(tok.Inst),
+				})
+			}
+		}
+	}
+	flush()
+	if child != nchildren || depth != 0 {
+		return nil, errContentMismatch
+	}
+	return items, nil
+}
+
+// textContent returns the concatenation of all character data
+// contained within an Element, at any depth.
+func (el *Element) textContent() string {
+	var buf strings.Builder
+	el.writeText(&buf, 0)
+	return buf.String()
+}
+
+func (el *Element) writeText(buf *strings.Builder, depth int) {
+	if depth > recursionLimit {
+		return
+	}
+	for _, item := range el.contentItems() {
+		switch item.kind {
+		case TextNode:
+			buf.WriteString(item.data)
+		case ElementNode:
+			el.Children[item.child].writeText(buf, depth+1)
+		}
+	}
+}
+
+// An XPath is a compiled XPath 1.0 expression. An XPath is safe
+// for concurrent use by multiple goroutines.
+type XPath struct {
+	src  string
+	expr xpathExpr
+}
+
+// CompileXPath parses an XPath 1.0 expression. If successful, the
+// returned XPath can be evaluated against any number of documents.
+func CompileXPath(expr string) (*XPath, error) {
+	e, err := parseXPath(expr)
+	if err != nil {
+		return nil, err
+	}
+	return &XPath{src: expr, expr: e}, nil
+}
+
+// MustCompileXPath is like CompileXPath, but panics if the expression
+// cannot be parsed.
+func MustCompileXPath(expr string) *XPath {
+	x, err := CompileXPath(expr)
+	if err != nil {
+		panic(err)
+	}
+	return x
+}
+
+// String returns the source text of the expression.
+func (x *XPath) String() string { return x.src }
+
+// An XPathFunc implements an XPath function. The arguments and return
+// value are of one of the types bool, float64, string, or []*XPathNode.
+type XPathFunc func(ctx *XPathContext, args ...interface{}) (interface{}, error)
+
+// An XPathEnv provides the static and dynamic context for evaluating
+// an XPath expression beyond the context node. All fields are optional.
+type XPathEnv struct {
+	// Namespaces maps prefixes used in the expression to namespace
+	// URIs. Prefixes that are not in Namespaces are resolved using
+	// the Scope of the context node's Element.
+	Namespaces map[string]string
+	// Variables holds the values of variables referenced in the
+	// expression, keyed by their name without the leading '$'.
+	Variables map[string]interface{}
+	// Functions defines additional functions, or overrides those
+	// in the core function library.
+	Functions map[string]XPathFunc
+	// If AnyNamespace is true, unprefixed names in name tests match
+	// elements and attributes with that local name in any namespace,
+	// like the Search method of Element. Otherwise, as in XPath 1.0,
+	// they only match names without a namespace, even when the
+	// document declares a default namespace.
+	AnyNamespace bool
+}
+
+// An XPathContext is passed to functions called during the
+// evaluation of an XPath expression.
+type XPathContext struct {
+	// The context node
+	Node *XPathNode
+	// The context position and size, starting at 1.
+	Position, Size int
+	// The environment passed to the evaluation.
+	Env *XPathEnv
+
+	scope *Scope
+}
+
+// Eval evaluates the expression with el as the context node. el is
+// treated as the document element; absolute location paths start at
+// a root node whose only child is el. The result is one of the types
+// bool, float64, string, or []*XPathNode. Node-sets are returned in
+// document order.
+func (x *XPath) Eval(el *Element) (interface{}, error) {
+	return x.EvalNode(el.XPathNode(), nil)
+}
+
+// EvalNode evaluates the expression with n as the context node,
+// using the variables, functions and namespace bindings in env.
+// env may be nil.
+func (x *XPath) EvalNode(n *XPathNode, env *XPathEnv) (interface{}, error) {
+	return x.EvalContext(XPathContext{Node: n, Position: 1, Size: 1, Env: env})
+}
+
+// EvalContext evaluates the expression with the context node, position
+// and size given by ctx, using the environment ctx.Env, which may be
+// nil. EvalContext is useful for evaluating an expression on behalf of
+// another, such as an XSLT instruction within xsl:for-each.
+func (x *XPath) EvalContext(ctx XPathContext) (interface{}, error) {
+	if ctx.Env == nil {
+		ctx.Env = new(XPathEnv)
+	}
+	if ctx.Node.el != nil {
+		ctx.scope = &ctx.Node.el.Scope
+	}
+	return x.expr.eval(&ctx)
+}
+
+// Select evaluates the expression with el as the context node, and
+// returns the elements in the resulting node-set, in document order.
+// Nodes that are not elements are omitted. An error is returned if
+// the expression does not evaluate to a node-set.
+func (x *XPath) Select(el *Element) ([]*Element, error) {
+	v, err := x.Eval(el)
+	if err != nil {
+		return nil, err
+	}
+	nodes, ok := v.([]*XPathNode)
+	if !ok {
+		return nil, fmt.Errorf("xpath: %s evaluates to a %s, not a node-set", x.src, xpathTypeName(v))
+	}
+	result := make([]*Element, 0, len(nodes))
+	for _, n := range nodes {
+		if n.kind == ElementNode {
+			result = append(result, n.el)
+		}
+	}
+	return result, nil
+}
+
+// Query compiles and evaluates an XPath 1.0 expression with el as the
+// context node, returning the selected elements. See the Select method
+// of the XPath type for details.
+func (el *Element) Query(expr string) ([]*Element, error) {
+	x, err := CompileXPath(expr)
+	if err != nil {
+		return nil, err
+	}
+	return x.Select(el)
+}
+
+// QueryString is like Query, but converts the result of the
+// expression to a string, as if by the XPath string() function.
+func (el *Element) QueryString(expr string) (string, error) {
+	x, err := CompileXPath(expr)
+	if err != nil {
+		return "", err
+	}
+	v, err := x.Eval(el)
+	if err != nil {
+		return "", err
+	}
+	return XPathString(v), nil
+}
@@ -0,0 +1,667 @@
+package xmltree
+
+import (
+	"encoding/xml"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+type xpathExpr interface {
+	eval(ctx *XPathContext) (interface{}, error)
+}
+
+type axis int
+
+const (
+	axisAncestor axis = iota
+	axisAncestorOrSelf
+	axisAttribute
+	axisChild
+	axisDescendant
+	axisDescendantOrSelf
+	axisFollowing
+	axisFollowingSibling
+	axisNamespace
+	axisParent
+	axisPreceding
+	axisPrecedingSibling
+	axisSelf
+)
+
+var xpathAxes = map[string]axis{
+	"ancestor":           axisAncestor,
+	"ancestor-or-self":   axisAncestorOrSelf,
+	"attribute":          axisAttribute,
+	"child":              axisChild,
+	"descendant":         axisDescendant,
+	"descendant-or-self": axisDescendantOrSelf,
+	"following":          axisFollowing,
+	"following-sibling":  axisFollowingSibling,
+	"namespace":          axisNamespace,
+	"parent":             axisParent,
+	"preceding":          axisPreceding,
+	"preceding-sibling":  axisPrecedingSibling,
+	"self":               axisSelf,
+}
+
+// Reverse axes number their nodes in reverse document order when
+// evaluating predicates.
+func (a axis) reverse() bool {
+	switch a {
+	case axisAncestor, axisAncestorOrSelf, axisPreceding, axisPrecedingSibling:
+		return true
+	}
+	return false
+}
+
+type testKind int
+
+const (
+	testName testKind = iota
+	testNode
+	testText
+	testComment
+	testProcInst
+)
+
+type nodeTest struct {
+	kind testKind
+	// For name tests, the name as written. For processing-instruction
+	// tests, the (optional) target.
+	name string
+}
+
+// Unprefixed names in a name test match elements and attributes
+// without a namespace, or in any namespace if the XPathEnv sets
+// AnyNamespace. Prefixed names are resolved against the XPathEnv,
+// then the Scope of the context node.
+func (t nodeTest) match(ctx *XPathContext, a axis, n *XPathNode) (bool, error) {
+	switch t.kind {
+	case testNode:
+		return true, nil
+	case testText:
+		return n.kind == TextNode, nil
+	case testComment:
+		return n.kind == CommentNode, nil
+	case testProcInst:
+		return n.kind == ProcInstNode && (t.name == "" || t.name == n.target), nil
+	}
+	principal := ElementNode
+	if a == axisAttribute {
+		principal = AttrNode
+	}
+	if n.kind != principal {
+		return false, nil
+	}
+	if t.name == "*" {
+		return true, nil
+	}
+	name := n.Name()
+	prefix, local := "", t.name
+	if i := strings.IndexByte(t.name, ':'); i >= 0 {
+		prefix, local = t.name[:i], t.name[i+1:]
+	}
+	if local != "*" && local != name.Local {
+		return false, nil
+	}
+	if prefix == "" {
+		return ctx.Env.AnyNamespace || name.Space == "", nil
+	}
+	space, err := ctx.resolvePrefix(prefix)
+	if err != nil {
+		return false, err
+	}
+	return space == name.Space, nil
+}
+
+func (ctx *XPathContext) resolvePrefix(prefix string) (string, error) {
+	if ns, ok := ctx.Env.Namespaces[prefix]; ok {
+		return ns, nil
+	}
+	if ctx.scope != nil {
+		if name, ok := ctx.scope.ResolveNS(prefix + ":x"); ok {
+			return name.Space, nil
+		}
+	}
+	return "", fmt.Errorf("xpath: undeclared namespace prefix %q", prefix)
+}
+
+type step struct {
+	axis  axis
+	test  nodeTest
+	preds []xpathExpr
+}
+
+// axisNodes returns the nodes along an axis, in the axis' order;
+// reverse axes return their nodes in reverse document order.
+func axisNodes(a axis, n *XPathNode) []*XPathNode {
+	var result []*XPathNode
+	var descend func(*XPathNode, int)
+	descend = func(n *XPathNode, depth int) {
+		if depth > recursionLimit {
+			return
+		}
+		for _, c := range n.Children() {
+			result = append(result, c)
+			descend(c, depth+1)
+		}
+	}
+	switch a {
+	case axisSelf:
+		result = append(result, n)
+	case axisChild:
+		result = append(result, n.Children()...)
+	case axisAttribute:
+		result = append(result, n.Attributes()...)
+	case axisParent:
+		if n.parent != nil {
+			result = append(result, n.parent)
+		}
+	case axisAncestorOrSelf:
+		result = append(result, n)
+		fallthrough
+	case axisAncestor:
+		for p := n.parent; p != nil; p = p.parent {
+			result = append(result, p)
+		}
+	case axisDescendantOrSelf:
+		result = append(result, n)
+		fallthrough
+	case axisDescendant:
+		descend(n, 0)
+	case axisFollowingSibling, axisPrecedingSibling:
+		if n.parent == nil || n.kind == AttrNode {
+			break
+		}
+		siblings := n.parent.Children()
+		for i, s := range siblings {
+			if !s.Same(n) {
+				continue
+			}
+			if a == axisFollowingSibling {
+				result = append(result, siblings[i+1:]...)
+			} else {
+				for j := i - 1; j >= 0; j-- {
+					result = append(result, siblings[j])
+				}
+			}
+			break
+		}
+	case axisFollowing:
+		start := n
+		if n.kind == AttrNode {
+			// The following axis of an attribute includes the
+			// descendants of its element.
+			start = n.parent
+			descend(start, 0)
+		}
+		for x := start; x.parent != nil; x = x.parent {
+			for _, s := range axisNodes(axisFollowingSibling, x) {
+				result = append(result, s)
+				descend(s, 0)
+			}
+		}
+	case axisPreceding:
+		start := n
+		if n.kind == AttrNode {
+			start = n.parent
+		}
+		for x := start; x.parent != nil; x = x.parent {
+			for _, s := range axisNodes(axisPrecedingSibling, x) {
+				// descendants of s in reverse document order
+				sub := axisNodes(axisDescendant, s)
+				for i := len(sub) - 1; i >= 0; i-- {
+					result = append(result, sub[i])
+				}
+				result = append(result, s)
+			}
+		}
+	case axisNamespace:
+		// Namespace nodes are not part of the xmltree data
+		// model; the axis is always empty.
+	}
+	return result
+}
+
+func (s *step) eval(ctx *XPathContext, n *XPathNode) ([]*XPathNode, error) {
+	var selected []*XPathNode
+	for _, c := range axisNodes(s.axis, n) {
+		ok, err := s.test.match(ctx, s.axis, c)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			selected = append(selected, c)
+		}
+	}
+	for _, pred := range s.preds {
+		var err error
+		if selected, err = applyPredicate(ctx, pred, selected); err != nil {
+			return nil, err
+		}
+	}
+	return selected, nil
+}
+
+// The nodes passed to applyPredicate must be in the order of the
+// axis that selected them; proximity positions are assigned in this
+// order.
+func applyPredicate(ctx *XPathContext, pred xpathExpr, nodes []*XPathNode) ([]*XPathNode, error) {
+	result := nodes[:0:0]
+	for i, n := range nodes {
+		sub := ctx.with(n, i+1, len(nodes))
+		v, err := pred.eval(sub)
+		if err != nil {
+			return nil, err
+		}
+		var keep bool
+		if f, ok := v.(float64); ok {
+			keep = f == float64(i+1)
+		} else {
+			keep = XPathBool(v)
+		}
+		if keep {
+			result = append(result, n)
+		}
+	}
+	return result, nil
+}
+
+func (ctx *XPathContext) with(n *XPathNode, pos, size int) *XPathContext {
+	sub := *ctx
+	sub.Node = n
+	sub.Position = pos
+	sub.Size = size
+	return &sub
+}
+
+type pathExpr struct {
+	filter   xpathExpr
+	absolute bool
+	steps    []*step
+}
+
+func (p *pathExpr) eval(ctx *XPathContext) (interface{}, error) {
+	var nodes []*XPathNode
+	switch {
+	case p.filter != nil:
+		v, err := p.filter.eval(ctx)
+		if err != nil {
+			return nil, err
+		}
+		set, ok := v.([]*XPathNode)
+		if !ok {
+			return nil, fmt.Errorf("xpath: cannot apply location path to a %s", xpathTypeName(v))
+		}
+		nodes = set
+	case p.absolute:
+		root := ctx.Node
+		for root.parent != nil {
+			root = root.parent
+		}
+		nodes = []*XPathNode{root}
+	default:
+		nodes = []*XPathNode{ctx.Node}
+	}
+	for _, s := range p.steps {
+		var next []*XPathNode
+		for _, n := range nodes {
+			selected, err := s.eval(ctx, n)
+			if err != nil {
+				return nil, err
+			}
+			next = append(next, selected...)
+		}
+		nodes = sortNodes(next)
+	}
+	if nodes == nil {
+		nodes = []*XPathNode{}
+	}
+	return nodes, nil
+}
+
+type filterExpr struct {
+	primary xpathExpr
+	preds   []xpathExpr
+}
+
+func (f *filterExpr) eval(ctx *XPathContext) (interface{}, error) {
+	v, err := f.primary.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	nodes, ok := v.([]*XPathNode)
+	if !ok {
+		return nil, fmt.Errorf("xpath: cannot apply predicate to a %s", xpathTypeName(v))
+	}
+	for _, pred := range f.preds {
+		if nodes, err = applyPredicate(ctx, pred, nodes); err != nil {
+			return nil, err
+		}
+	}
+	return nodes, nil
+}
+
+type unionExpr struct {
+	lhs, rhs xpathExpr
+}
+
+func (u *unionExpr) eval(ctx *XPathContext) (interface{}, error) {
+	var result []*XPathNode
+	for _, e := range []xpathExpr{u.lhs, u.rhs} {
+		v, err := e.eval(ctx)
+		if err != nil {
+			return nil, err
+		}
+		nodes, ok := v.([]*XPathNode)
+		if !ok {
+			return nil, fmt.Errorf("xpath: operands of '|' must be node-sets, not %s", xpathTypeName(v))
+		}
+		result = append(result, nodes...)
+	}
+	return sortNodes(result), nil
+}
+
+type negateExpr struct {
+	x xpathExpr
+}
+
+func (e *negateExpr) eval(ctx *XPathContext) (interface{}, error) {
+	v, err := e.x.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return -XPathNumber(v), nil
+}
+
+type literal string
+
+func (l literal) eval(*XPathContext) (interface{}, error) { return string(l), nil }
+
+type number float64
+
+func (n number) eval(*XPathContext) (interface{}, error) { return float64(n), nil }
+
+type varRef string
+
+func (name varRef) eval(ctx *XPathContext) (interface{}, error) {
+	v, ok := ctx.Env.Variables[string(name)]
+	if !ok {
+		return nil, fmt.Errorf("xpath: undefined variable $%s", string(name))
+	}
+	switch v := v.(type) {
+	case bool, float64, string, []*XPathNode:
+		return v, nil
+	case int:
+		return float64(v), nil
+	case *Element:
+		return []*XPathNode{v.XPathNode()}, nil
+	}
+	return nil, fmt.Errorf("xpath: variable $%s has unsupported type %T", string(name), v)
+}
+
+type binaryExpr struct {
+	op       xpathTokenKind
+	lhs, rhs xpathExpr
+}
+
+func (e *binaryExpr) eval(ctx *XPathContext) (interface{}, error) {
+	lhs, err := e.lhs.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// and/or short-circuit
+	switch e.op {
+	case tokAnd:
+		if !XPathBool(lhs) {
+			return false, nil
+		}
+	case tokOr:
+		if XPathBool(lhs) {
+			return true, nil
+		}
+	}
+	rhs, err := e.rhs.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	switch e.op {
+	case tokAnd, tokOr:
+		return XPathBool(rhs), nil
+	case tokEq, tokNeq, tokLt, tokLte, tokGt, tokGte:
+		return compare(e.op, lhs, rhs), nil
+	}
+	x, y := XPathNumber(lhs), XPathNumber(rhs)
+	switch e.op {
+	case tokPlus:
+		return x + y, nil
+	case tokMinus:
+		return x - y, nil
+	case tokMul:
+		return x * y, nil
+	case tokDiv:
+		return x / y, nil
+	case tokMod:
+		return math.Mod(x, y), nil
+	}
+	panic(fmt.Sprintf("xmltree: unexpected xpath operator %d", e.op))
+}
+
+// compare implements the comparison rules of section 3.4 of the
+// XPath recommendation. Comparisons involving node-sets are true
+// if the comparison is true for any node in the set.
+func compare(op xpathTokenKind, lhs, rhs interface{}) bool {
+	// A node-set compared to a boolean is converted to a
+	// boolean first.
+	_, lb := lhs.(bool)
+	_, rb := rhs.(bool)
+	if lb || rb {
+		return compareAtoms(op, XPathBool(lhs), XPathBool(rhs))
+	}
+	if l, ok := lhs.([]*XPathNode); ok {
+		if r, ok := rhs.([]*XPathNode); ok {
+			for _, a := range l {
+				for _, b := range r {
+					if compareAtoms(op, a.Value(), b.Value()) {
+						return true
+					}
+				}
+			}
+			return false
+		}
+		for _, a := range l {
+			if compareAtoms(op, nodeAtom(a, rhs), rhs) {
+				return true
+			}
+		}
+		return false
+	}
+	if r, ok := rhs.([]*XPathNode); ok {
+		for _, b := range r {
+			if compareAtoms(op, lhs, nodeAtom(b, lhs)) {
+				return true
+			}
+		}
+		return false
+	}
+	return compareAtoms(op, lhs, rhs)
+}
+
+// nodeAtom converts a node to the type of other, for comparisons
+// between node-sets and other values.
+func nodeAtom(n *XPathNode, other interface{}) interface{} {
+	if _, ok := other.(float64); ok {
+		return XPathNumber(n.Value())
+	}
+	return n.Value()
+}
+
+func compareAtoms(op xpathTokenKind, lhs, rhs interface{}) bool {
+	switch op {
+	case tokEq, tokNeq:
+		var eq bool
+		_, lb := lhs.(bool)
+		_, rb := rhs.(bool)
+		_, lf := lhs.(float64)
+		_, rf := rhs.(float64)
+		switch {
+		case lb || rb:
+			eq = XPathBool(lhs) == XPathBool(rhs)
+		case lf || rf:
+			eq = XPathNumber(lhs) == XPathNumber(rhs)
+		default:
+			eq = XPathString(lhs) == XPathString(rhs)
+		}
+		return eq == (op == tokEq)
+	}
+	x, y := XPathNumber(lhs), XPathNumber(rhs)
+	switch op {
+	case tokLt:
+		return x < y
+	case tokLte:
+		return x <= y
+	case tokGt:
+		return x > y
+	case tokGte:
+		return x >= y
+	}
+	return false
+}
+
+func xpathTypeName(v interface{}) string {
+	switch v.(type) {
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []*XPathNode:
+		return "node-set"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// XPathString converts the result of an XPath expression to a string,
+// following the rules of the XPath string() function.
+func XPathString(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case bool:
+		if v {
+			return "true"
+		}
+		return "false"
+	case float64:
+		return formatXPathNumber(v)
+	case []*XPathNode:
+		if len(v) == 0 {
+			return ""
+		}
+		return v[0].Value()
+	}
+	return ""
+}
+
+func formatXPathNumber(f float64) string {
+	switch {
+	case math.IsNaN(f):
+		return "NaN"
+	case math.IsInf(f, 1):
+		return "Infinity"
+	case math.IsInf(f, -1):
+		return "-Infinity"
+	case f == 0:
+		return "0"
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// XPathNumber converts the result of an XPath expression to a number,
+// following the rules of the XPath number() function.
+func XPathNumber(v interface{}) float64 {
+	switch v := v.(type) {
+	case float64:
+		return v
+	case bool:
+		if v {
+			return 1
+		}
+		return 0
+	case string:
+		return parseXPathNumber(v)
+	case []*XPathNode:
+		return parseXPathNumber(XPathString(v))
+	}
+	return math.NaN()
+}
+
+// The lexical form of a number in XPath is more restrictive than
+// that accepted by strconv.ParseFloat; there are no exponents, and
+// no special values.
+func parseXPathNumber(s string) float64 {
+	s = strings.TrimSpace(s)
+	digits := strings.TrimPrefix(s, "-")
+	if digits == "" || digits == "." {
+		return math.NaN()
+	}
+	dot := false
+	for _, c := range digits {
+		switch {
+		case c == '.' && !dot:
+			dot = true
+		case c < '0' || c > '9':
+			return math.NaN()
+		}
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return math.NaN()
+	}
+	return f
+}
+
+// XPathBool converts the result of an XPath expression to a boolean,
+// following the rules of the XPath boolean() function.
+func XPathBool(v interface{}) bool {
+	switch v := v.(type) {
+	case bool:
+		return v
+	case float64:
+		return v != 0 && !math.IsNaN(v)
+	case string:
+		return v != ""
+	case []*XPathNode:
+		return len(v) > 0
+	}
+	return false
+}
+
+// qualifiedName returns the QName of an element or attribute node,
+// using the prefixes in scope at its element.
+func qualifiedName(n *XPathNode) string {
+	name := n.Name()
+	switch n.kind {
+	case ElementNode:
+		return n.el.Prefix(name)
+	case AttrNode:
+		if name.Space == "" {
+			return name.Local
+		}
+		for i := len(n.el.Scope.ns) - 1; i >= 0; i-- {
+			ns := n.el.Scope.ns[i]
+			if ns.Space == name.Space && ns.Local != "" {
+				return ns.Local + ":" + name.Local
+			}
+		}
+		return n.el.Prefix(name)
+	case ProcInstNode:
+		return name.Local
+	}
+	return ""
+}
+
+var xmlIDName = xml.Name{Space: xmlLangURI, Local: "id"}
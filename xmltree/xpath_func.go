@@ -0,0 +1,394 @@
+package xmltree
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"unicode/utf8"
+)
+
+type funcCall struct {
+	name string
+	args []xpathExpr
+}
+
+type coreFunc struct {
+	// minimum and maximum number of arguments; a
+	// negative max means there is no upper limit.
+	min, max int
+	fn       func(ctx *XPathContext, args []interface{}) (interface{}, error)
+}
+
+// The core function library, from section 4 of the XPath
+// recommendation.
+var xpathFuncs map[string]coreFunc
+
+func init() {
+	xpathFuncs = map[string]coreFunc{
+		"last":             {0, 0, fnLast},
+		"position":         {0, 0, fnPosition},
+		"count":            {1, 1, fnCount},
+		"id":               {1, 1, fnID},
+		"local-name":       {0, 1, fnLocalName},
+		"namespace-uri":    {0, 1, fnNamespaceURI},
+		"name":             {0, 1, fnName},
+		"string":           {0, 1, fnString},
+		"concat":           {2, -1, fnConcat},
+		"starts-with":      {2, 2, fnStartsWith},
+		"contains":         {2, 2, fnContains},
+		"substring-before": {2, 2, fnSubstringBefore},
+		"substring-after":  {2, 2, fnSubstringAfter},
+		"substring":        {2, 3, fnSubstring},
+		"string-length":    {0, 1, fnStringLength},
+		"normalize-space":  {0, 1, fnNormalizeSpace},
+		"translate":        {3, 3, fnTranslate},
+		"boolean":          {1, 1, fnBoolean},
+		"not":              {1, 1, fnNot},
+		"true":             {0, 0, fnTrue},
+		"false":            {0, 0, fnFalse},
+		"lang":             {1, 1, fnLang},
+		"number":           {0, 1, fnNumber},
+		"sum":              {1, 1, fnSum},
+		"floor":            {1, 1, fnFloor},
+		"ceiling":          {1, 1, fnCeiling},
+		"round":            {1, 1, fnRound},
+	}
+}
+
+// check validates the number of arguments passed to functions in
+// the core library. Calls to other functions are checked when the
+// expression is evaluated, as they may be provided by an XPathEnv.
+func (call *funcCall) check() error {
+	f, ok := xpathFuncs[call.name]
+	if !ok {
+		return nil
+	}
+	n := len(call.args)
+	switch {
+	case n < f.min && f.min == f.max:
+		return fmt.Errorf("%s() requires %d argument(s), got %d", call.name, f.min, n)
+	case n < f.min:
+		return fmt.Errorf("%s() requires at least %d argument(s), got %d", call.name, f.min, n)
+	case f.max >= 0 && n > f.max:
+		return fmt.Errorf("%s() accepts at most %d argument(s), got %d", call.name, f.max, n)
+	}
+	return nil
+}
+
+func (call *funcCall) eval(ctx *XPathContext) (interface{}, error) {
+	args := make([]interface{}, 0, len(call.args))
+	for _, arg := range call.args {
+		v, err := arg.eval(ctx)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, v)
+	}
+	if fn, ok := ctx.Env.Functions[call.name]; ok {
+		v, err := fn(ctx, args...)
+		if err != nil {
+			return nil, err
+		}
+		switch v := v.(type) {
+		case bool, float64, string, []*XPathNode:
+			return v, nil
+		case int:
+			return float64(v), nil
+		}
+		return nil, fmt.Errorf("xpath: function %s() returned unsupported type %T", call.name, v)
+	}
+	if f, ok := xpathFuncs[call.name]; ok {
+		return f.fn(ctx, args)
+	}
+	return nil, fmt.Errorf("xpath: unknown function %s()", call.name)
+}
+
+func nodeSetArg(name string, v interface{}) ([]*XPathNode, error) {
+	nodes, ok := v.([]*XPathNode)
+	if !ok {
+		return nil, fmt.Errorf("xpath: argument to %s() must be a node-set, not %s", name, xpathTypeName(v))
+	}
+	return nodes, nil
+}
+
+// nodeArg returns the first node in the optional node-set argument
+// of functions such as name(), or the context node if there are no
+// arguments. nil is returned for an empty node-set.
+func nodeArg(ctx *XPathContext, name string, args []interface{}) (*XPathNode, error) {
+	if len(args) == 0 {
+		return ctx.Node, nil
+	}
+	nodes, err := nodeSetArg(name, args[0])
+	if err != nil || len(nodes) == 0 {
+		return nil, err
+	}
+	return nodes[0], nil
+}
+
+// stringArg returns the first argument as a string, or the
+// string-value of the context node if there are no arguments.
+func stringArg(ctx *XPathContext, args []interface{}) string {
+	if len(args) == 0 {
+		return ctx.Node.Value()
+	}
+	return XPathString(args[0])
+}
+
+func fnLast(ctx *XPathContext, _ []interface{}) (interface{}, error) {
+	return float64(ctx.Size), nil
+}
+
+func fnPosition(ctx *XPathContext, _ []interface{}) (interface{}, error) {
+	return float64(ctx.Position), nil
+}
+
+func fnCount(_ *XPathContext, args []interface{}) (interface{}, error) {
+	nodes, err := nodeSetArg("count", args[0])
+	if err != nil {
+		return nil, err
+	}
+	return float64(len(nodes)), nil
+}
+
+// fnID selects elements by their ID. Attributes declared with type ID
+// in the DTD of a document parsed with ParseOptions.ParseDTD, and
+// attributes named xml:id, are IDs. For elements without a declared
+// ID attribute, attributes with the unqualified name "id" are also
+// considered IDs.
+func fnID(ctx *XPathContext, args []interface{}) (interface{}, error) {
+	want := make(map[string]bool)
+	if nodes, ok := args[0].([]*XPathNode); ok {
+		for _, n := range nodes {
+			for _, id := range strings.Fields(n.Value()) {
+				want[id] = true
+			}
+		}
+	} else {
+		for _, id := range strings.Fields(XPathString(args[0])) {
+			want[id] = true
+		}
+	}
+	result := []*XPathNode{}
+	if len(want) == 0 {
+		return result, nil
+	}
+	root := ctx.Node
+	for root.parent != nil {
+		root = root.parent
+	}
+	for _, n := range axisNodes(axisDescendant, root) {
+		if n.kind != ElementNode {
+			continue
+		}
+		for _, attr := range n.el.StartElement.Attr {
+			isID := attr.Name == xmlIDName
+			if idAttr := n.el.idAttr; idAttr.Local != "" {
+				isID = isID || attr.Name == idAttr
+			} else {
+				isID = isID || (attr.Name.Space == "" && attr.Name.Local == "id")
+			}
+			if isID && want[strings.TrimSpace(attr.Value)] {
+				result = append(result, n)
+				break
+			}
+		}
+	}
+	return result, nil
+}
+
+func fnLocalName(ctx *XPathContext, args []interface{}) (interface{}, error) {
+	n, err := nodeArg(ctx, "local-name", args)
+	if err != nil || n == nil {
+		return "", err
+	}
+	return n.Name().Local, nil
+}
+
+func fnNamespaceURI(ctx *XPathContext, args []interface{}) (interface{}, error) {
+	n, err := nodeArg(ctx, "namespace-uri", args)
+	if err != nil || n == nil {
+		return "", err
+	}
+	if n.kind == ProcInstNode {
+		return "", nil
+	}
+	return n.Name().Space, nil
+}
+
+func fnName(ctx *XPathContext, args []interface{}) (interface{}, error) {
+	n, err := nodeArg(ctx, "name", args)
+	if err != nil || n == nil {
+		return "", err
+	}
+	return qualifiedName(n), nil
+}
+
+func fnString(ctx *XPathContext, args []interface{}) (interface{}, error) {
+	return stringArg(ctx, args), nil
+}
+
+func fnConcat(_ *XPathContext, args []interface{}) (interface{}, error) {
+	var buf strings.Builder
+	for _, arg := range args {
+		buf.WriteString(XPathString(arg))
+	}
+	return buf.String(), nil
+}
+
+func fnStartsWith(_ *XPathContext, args []interface{}) (interface{}, error) {
+	return strings.HasPrefix(XPathString(args[0]), XPathString(args[1])), nil
+}
+
+func fnContains(_ *XPathContext, args []interface{}) (interface{}, error) {
+	return strings.Contains(XPathString(args[0]), XPathString(args[1])), nil
+}
+
+func fnSubstringBefore(_ *XPathContext, args []interface{}) (interface{}, error) {
+	s, sep := XPathString(args[0]), XPathString(args[1])
+	if i := strings.Index(s, sep); i >= 0 {
+		return s[:i], nil
+	}
+	return "", nil
+}
+
+func fnSubstringAfter(_ *XPathContext, args []interface{}) (interface{}, error) {
+	s, sep := XPathString(args[0]), XPathString(args[1])
+	if i := strings.Index(s, sep); i >= 0 {
+		return s[i+len(sep):], nil
+	}
+	return "", nil
+}
+
+// Characters are numbered from 1; the substring contains the
+// characters whose position p satisfies
+//
+//	round(start) <= p < round(start) + round(length)
+//
+// Comparisons involving NaN are false, so a NaN start or length
+// yields the empty string.
+func fnSubstring(_ *XPathContext, args []interface{}) (interface{}, error) {
+	s := XPathString(args[0])
+	first := xpathRound(XPathNumber(args[1]))
+	last := math.Inf(1)
+	if len(args) > 2 {
+		last = first + xpathRound(XPathNumber(args[2]))
+	}
+	var buf strings.Builder
+	p := 1.0
+	for _, r := range s {
+		if p >= first && p < last {
+			buf.WriteRune(r)
+		}
+		p++
+	}
+	return buf.String(), nil
+}
+
+func fnStringLength(ctx *XPathContext, args []interface{}) (interface{}, error) {
+	return float64(utf8.RuneCountInString(stringArg(ctx, args))), nil
+}
+
+func fnNormalizeSpace(ctx *XPathContext, args []interface{}) (interface{}, error) {
+	fields := strings.FieldsFunc(stringArg(ctx, args), isXMLSpace)
+	return strings.Join(fields, " "), nil
+}
+
+func isXMLSpace(r rune) bool {
+	return r == ' ' || r == '\t' || r == '\n' || r == '\r'
+}
+
+func fnTranslate(_ *XPathContext, args []interface{}) (interface{}, error) {
+	s := XPathString(args[0])
+	from := []rune(XPathString(args[1]))
+	to := []rune(XPathString(args[2]))
+	mapping := make(map[rune]int, len(from))
+	for i := len(from) - 1; i >= 0; i-- {
+		mapping[from[i]] = i
+	}
+	var buf strings.Builder
+	for _, r := range s {
+		i, ok := mapping[r]
+		switch {
+		case !ok:
+			buf.WriteRune(r)
+		case i < len(to):
+			buf.WriteRune(to[i])
+		}
+	}
+	return buf.String(), nil
+}
+
+func fnBoolean(_ *XPathContext, args []interface{}) (interface{}, error) {
+	return XPathBool(args[0]), nil
+}
+
+func fnNot(_ *XPathContext, args []interface{}) (interface{}, error) {
+	return !XPathBool(args[0]), nil
+}
+
+func fnTrue(*XPathContext, []interface{}) (interface{}, error)  { return true, nil }
+func fnFalse(*XPathContext, []interface{}) (interface{}, error) { return false, nil }
+
+// fnLang tests the xml:lang attribute in scope at the context node.
+func fnLang(ctx *XPathContext, args []interface{}) (interface{}, error) {
+	want := XPathString(args[0])
+	for n := ctx.Node; n != nil; n = n.parent {
+		if n.kind != ElementNode {
+			continue
+		}
+		for _, attr := range n.el.StartElement.Attr {
+			if attr.Name.Space != xmlLangURI || attr.Name.Local != "lang" {
+				continue
+			}
+			lang := attr.Value
+			if len(lang) > len(want) && lang[len(want)] == '-' {
+				lang = lang[:len(want)]
+			}
+			return strings.EqualFold(lang, want), nil
+		}
+	}
+	return false, nil
+}
+
+func fnNumber(ctx *XPathContext, args []interface{}) (interface{}, error) {
+	if len(args) == 0 {
+		return parseXPathNumber(ctx.Node.Value()), nil
+	}
+	return XPathNumber(args[0]), nil
+}
+
+func fnSum(_ *XPathContext, args []interface{}) (interface{}, error) {
+	nodes, err := nodeSetArg("sum", args[0])
+	if err != nil {
+		return nil, err
+	}
+	var sum float64
+	for _, n := range nodes {
+		sum += parseXPathNumber(n.Value())
+	}
+	return sum, nil
+}
+
+func fnFloor(_ *XPathContext, args []interface{}) (interface{}, error) {
+	return math.Floor(XPathNumber(args[0])), nil
+}
+
+func fnCeiling(_ *XPathContext, args []interface{}) (interface{}, error) {
+	return math.Ceil(XPathNumber(args[0])), nil
+}
+
+func fnRound(_ *XPathContext, args []interface{}) (interface{}, error) {
+	return xpathRound(XPathNumber(args[0])), nil
+}
+
+// xpathRound rounds half-way cases towards positive infinity,
+// unlike math.Round.
+func xpathRound(f float64) float64 {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return f
+	}
+	if f < 0 && f >= -0.5 {
+		return math.Copysign(0, -1)
+	}
+	return math.Floor(f + 0.5)
+}
@@ -0,0 +1,658 @@
+package xmltree
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// The lexical structure of XPath 1.0 is described in section 3.7 of
+// the recommendation:
+//
+// https://www.w3.org/TR/1999/REC-xpath-19991116/#exprlex
+
+type xpathTokenKind int
+
+const (
+	tokEOF xpathTokenKind = iota
+	tokLParen
+	tokRParen
+	tokLBracket
+	tokRBracket
+	tokDot
+	tokDotDot
+	tokAt
+	tokComma
+	tokColonColon
+	tokSlash
+	tokSlashSlash
+	tokPipe
+	tokPlus
+	tokMinus
+	tokEq
+	tokNeq
+	tokLt
+	tokLte
+	tokGt
+	tokGte
+	tokMul
+	tokAnd
+	tokOr
+	tokMod
+	tokDiv
+	tokLiteral
+	tokNumber
+	tokVar
+	tokName
+	tokFunc
+	tokNodeType
+	tokAxis
+)
+
+type xpathToken struct {
+	kind xpathTokenKind
+	val  string
+	num  float64
+	pos  int
+}
+
+// An XPathError describes a syntax error in an XPath expression.
+type XPathError struct {
+	Expr string
+	// Byte offset in Expr where the error was detected
+	Offset int
+	Msg    string
+}
+
+func (err *XPathError) Error() string {
+	return fmt.Sprintf("xpath: %s at offset %d in %q", err.Msg, err.Offset, err.Expr)
+}
+
+func isNameStart(r rune) bool {
+	return r == '_' || unicode.IsLetter(r)
+}
+
+func isNameChar(r rune) bool {
+	return isNameStart(r) || r == '-' || r == '.' || unicode.IsDigit(r) ||
+		unicode.Is(unicode.Mn, r) || unicode.Is(unicode.Mc, r)
+}
+
+var xpathPunct = map[byte]xpathTokenKind{
+	'(': tokLParen, ')': tokRParen, '[': tokLBracket, ']': tokRBracket,
+	'@': tokAt, ',': tokComma, '|': tokPipe, '+': tokPlus, '-': tokMinus,
+	'=': tokEq,
+}
+
+type xpathLexer struct {
+	src    string
+	pos    int
+	tokens []xpathToken
+}
+
+func (lx *xpathLexer) errorf(format string, v ...interface{}) error {
+	return &XPathError{Expr: lx.src, Offset: lx.pos, Msg: fmt.Sprintf(format, v...)}
+}
+
+func (lx *xpathLexer) peekRune(offset int) rune {
+	if lx.pos+offset >= len(lx.src) {
+		return -1
+	}
+	r, _ := utf8.DecodeRuneInString(lx.src[lx.pos+offset:])
+	return r
+}
+
+func (lx *xpathLexer) skipSpace() {
+	for lx.pos < len(lx.src) {
+		switch lx.src[lx.pos] {
+		case ' ', '\t', '\r', '\n':
+			lx.pos++
+		default:
+			return
+		}
+	}
+}
+
+func (lx *xpathLexer) ncname() string {
+	start := lx.pos
+	for lx.pos < len(lx.src) {
+		r, sz := utf8.DecodeRuneInString(lx.src[lx.pos:])
+		if lx.pos == start && !isNameStart(r) || lx.pos > start && !isNameChar(r) {
+			break
+		}
+		lx.pos += sz
+	}
+	return lx.src[start:lx.pos]
+}
+
+// If there is a preceding token and the preceding token is not one
+// of @, ::, (, [, , or an Operator, then a * must be recognized as a
+// MultiplyOperator and an NCName must be recognized as an
+// OperatorName.
+func (lx *xpathLexer) operatorExpected() bool {
+	if len(lx.tokens) == 0 {
+		return false
+	}
+	switch lx.tokens[len(lx.tokens)-1].kind {
+	case tokAt, tokColonColon, tokLParen, tokLBracket, tokComma,
+		tokAnd, tokOr, tokMod, tokDiv, tokMul, tokSlash, tokSlashSlash,
+		tokPipe, tokPlus, tokMinus, tokEq, tokNeq, tokLt, tokLte, tokGt, tokGte:
+		return false
+	}
+	return true
+}
+
+// nextNonSpace returns the next non-whitespace byte, without
+// consuming any input.
+func (lx *xpathLexer) nextNonSpace() string {
+	return strings.TrimLeft(lx.src[lx.pos:], " \t\r\n")
+}
+
+func lexXPath(src string) ([]xpathToken, error) {
+	lx := &xpathLexer{src: src}
+	for {
+		lx.skipSpace()
+		if lx.pos >= len(src) {
+			lx.tokens = append(lx.tokens, xpathToken{kind: tokEOF, pos: lx.pos})
+			return lx.tokens, nil
+		}
+		tok := xpathToken{pos: lx.pos}
+		c := src[lx.pos]
+		switch {
+		case xpathPunct[c] != tokEOF:
+			tok.kind = xpathPunct[c]
+			lx.pos++
+		case c == '.':
+			if strings.HasPrefix(src[lx.pos:], "..") {
+				tok.kind = tokDotDot
+				lx.pos += 2
+			} else if r := lx.peekRune(1); r >= '0' && r <= '9' {
+				if err := lx.number(&tok); err != nil {
+					return nil, err
+				}
+			} else {
+				tok.kind = tokDot
+				lx.pos++
+			}
+		case c >= '0' && c <= '9':
+			if err := lx.number(&tok); err != nil {
+				return nil, err
+			}
+		case c == ':':
+			if !strings.HasPrefix(src[lx.pos:], "::") {
+				return nil, lx.errorf("unexpected ':'")
+			}
+			tok.kind = tokColonColon
+			lx.pos += 2
+		case c == '/':
+			if strings.HasPrefix(src[lx.pos:], "//") {
+				tok.kind = tokSlashSlash
+				lx.pos += 2
+			} else {
+				tok.kind = tokSlash
+				lx.pos++
+			}
+		case c == '!':
+			if !strings.HasPrefix(src[lx.pos:], "!=") {
+				return nil, lx.errorf("unexpected '!'")
+			}
+			tok.kind = tokNeq
+			lx.pos += 2
+		case c == '<' || c == '>':
+			tok.kind = tokLt
+			if c == '>' {
+				tok.kind = tokGt
+			}
+			lx.pos++
+			if lx.pos < len(src) && src[lx.pos] == '=' {
+				tok.kind++
+				lx.pos++
+			}
+		case c == '"' || c == '\'':
+			end := strings.IndexByte(src[lx.pos+1:], c)
+			if end < 0 {
+				return nil, lx.errorf("unterminated string literal")
+			}
+			tok.kind = tokLiteral
+			tok.val = src[lx.pos+1 : lx.pos+1+end]
+			lx.pos += end + 2
+		case c == '$':
+			lx.pos++
+			name, err := lx.qname()
+			if err != nil {
+				return nil, err
+			}
+			tok.kind = tokVar
+			tok.val = name
+		case c == '*':
+			lx.pos++
+			if lx.operatorExpected() {
+				tok.kind = tokMul
+			} else {
+				tok.kind = tokName
+				tok.val = "*"
+			}
+		default:
+			if r := lx.peekRune(0); !isNameStart(r) {
+				return nil, lx.errorf("unexpected character %q", r)
+			}
+			if err := lx.name(&tok); err != nil {
+				return nil, err
+			}
+		}
+		lx.tokens = append(lx.tokens, tok)
+	}
+}
+
+func (lx *xpathLexer) number(tok *xpathToken) error {
+	start := lx.pos
+	for lx.pos < len(lx.src) && (lx.src[lx.pos] >= '0' && lx.src[lx.pos] <= '9' || lx.src[lx.pos] == '.') {
+		lx.pos++
+	}
+	f, err := strconv.ParseFloat(lx.src[start:lx.pos], 64)
+	if err != nil {
+		text := lx.src[start:lx.pos]
+		lx.pos = start
+		return lx.errorf("invalid number %q", text)
+	}
+	tok.kind = tokNumber
+	tok.num = f
+	return nil
+}
+
+func (lx *xpathLexer) qname() (string, error) {
+	prefix := lx.ncname()
+	if prefix == "" {
+		return "", lx.errorf("expected name")
+	}
+	if strings.HasPrefix(lx.src[lx.pos:], ":") && !strings.HasPrefix(lx.src[lx.pos:], "::") {
+		lx.pos++
+		local := lx.ncname()
+		if local == "" {
+			return "", lx.errorf("expected local name after %s:", prefix)
+		}
+		return prefix + ":" + local, nil
+	}
+	return prefix, nil
+}
+
+func (lx *xpathLexer) name(tok *xpathToken) error {
+	start := lx.pos
+	ncname := lx.ncname()
+	if lx.operatorExpected() {
+		switch ncname {
+		case "and":
+			tok.kind = tokAnd
+		case "or":
+			tok.kind = tokOr
+		case "mod":
+			tok.kind = tokMod
+		case "div":
+			tok.kind = tokDiv
+		default:
+			return lx.errorf("expected operator, found %q", ncname)
+		}
+		return nil
+	}
+	rest := lx.src[lx.pos:]
+	if strings.HasPrefix(rest, ":*") {
+		lx.pos += 2
+		tok.kind = tokName
+		tok.val = ncname + ":*"
+		return nil
+	}
+	lx.pos = start
+	name, err := lx.qname()
+	if err != nil {
+		return err
+	}
+	tok.val = name
+	next := lx.nextNonSpace()
+	switch {
+	case strings.HasPrefix(next, "::"):
+		tok.kind = tokAxis
+	case strings.HasPrefix(next, "("):
+		switch name {
+		case "comment", "text", "processing-instruction", "node":
+			tok.kind = tokNodeType
+		default:
+			tok.kind = tokFunc
+		}
+	default:
+		tok.kind = tokName
+	}
+	return nil
+}
+
+type xpathParser struct {
+	src    string
+	tokens []xpathToken
+	pos    int
+}
+
+func parseXPath(src string) (xpathExpr, error) {
+	tokens, err := lexXPath(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &xpathParser{src: src, tokens: tokens}
+	e, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().kind != tokEOF {
+		return nil, p.errorf("unexpected %q", p.text(p.peek()))
+	}
+	return e, nil
+}
+
+func (p *xpathParser) peek() xpathToken { return p.tokens[p.pos] }
+
+func (p *xpathParser) next() xpathToken {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *xpathParser) text(tok xpathToken) string {
+	if tok.kind == tokEOF {
+		return "end of expression"
+	}
+	end := len(p.src)
+	if p.pos+1 < len(p.tokens) {
+		end = p.tokens[p.pos+1].pos
+	}
+	if tok.pos < end {
+		return strings.TrimSpace(p.src[tok.pos:end])
+	}
+	return tok.val
+}
+
+func (p *xpathParser) errorf(format string, v ...interface{}) error {
+	return &XPathError{Expr: p.src, Offset: p.peek().pos, Msg: fmt.Sprintf(format, v...)}
+}
+
+func (p *xpathParser) expect(kind xpathTokenKind, what string) error {
+	if p.peek().kind != kind {
+		return p.errorf("expected %s, found %q", what, p.text(p.peek()))
+	}
+	p.next()
+	return nil
+}
+
+func (p *xpathParser) expr() (xpathExpr, error) {
+	return p.binary(0)
+}
+
+// Operator precedence, from loosest to tightest binding.
+var xpathPrecedence = [][]xpathTokenKind{
+	{tokOr},
+	{tokAnd},
+	{tokEq, tokNeq},
+	{tokLt, tokLte, tokGt, tokGte},
+	{tokPlus, tokMinus},
+	{tokMul, tokDiv, tokMod},
+}
+
+func (p *xpathParser) binary(level int) (xpathExpr, error) {
+	if level == len(xpathPrecedence) {
+		return p.unary()
+	}
+	lhs, err := p.binary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+Loop:
+	for {
+		op := p.peek().kind
+		for _, k := range xpathPrecedence[level] {
+			if op == k {
+				p.next()
+				rhs, err := p.binary(level + 1)
+				if err != nil {
+					return nil, err
+				}
+				lhs = &binaryExpr{op: op, lhs: lhs, rhs: rhs}
+				continue Loop
+			}
+		}
+		return lhs, nil
+	}
+}
+
+func (p *xpathParser) unary() (xpathExpr, error) {
+	if p.peek().kind == tokMinus {
+		p.next()
+		e, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return &negateExpr{e}, nil
+	}
+	return p.union()
+}
+
+func (p *xpathParser) union() (xpathExpr, error) {
+	lhs, err := p.path()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokPipe {
+		p.next()
+		rhs, err := p.path()
+		if err != nil {
+			return nil, err
+		}
+		lhs = &unionExpr{lhs, rhs}
+	}
+	return lhs, nil
+}
+
+func (p *xpathParser) path() (xpathExpr, error) {
+	switch p.peek().kind {
+	case tokVar, tokLParen, tokLiteral, tokNumber, tokFunc:
+		filter, err := p.filter()
+		if err != nil {
+			return nil, err
+		}
+		switch p.peek().kind {
+		case tokSlash, tokSlashSlash:
+		default:
+			return filter, nil
+		}
+		path := &pathExpr{filter: filter}
+		if err := p.relativePath(path); err != nil {
+			return nil, err
+		}
+		return path, nil
+	}
+	path := new(pathExpr)
+	switch p.peek().kind {
+	case tokSlash:
+		p.next()
+		path.absolute = true
+		if !p.startsStep() {
+			return path, nil
+		}
+	case tokSlashSlash:
+		p.next()
+		path.absolute = true
+		path.steps = append(path.steps, descendantOrSelf)
+	}
+	if err := p.relativePath(path); err != nil {
+		return nil, err
+	}
+	return path, nil
+}
+
+var descendantOrSelf = &step{axis: axisDescendantOrSelf, test: nodeTest{kind: testNode}}
+
+func (p *xpathParser) startsStep() bool {
+	switch p.peek().kind {
+	case tokName, tokNodeType, tokAxis, tokAt, tokDot, tokDotDot:
+		return true
+	}
+	return false
+}
+
+// Parses a relative location path and appends its steps to path.
+// If the next token is a '/' or '//', it is consumed first.
+func (p *xpathParser) relativePath(path *pathExpr) error {
+	switch p.peek().kind {
+	case tokSlash:
+		p.next()
+	case tokSlashSlash:
+		p.next()
+		path.steps = append(path.steps, descendantOrSelf)
+	}
+	for {
+		s, err := p.step()
+		if err != nil {
+			return err
+		}
+		path.steps = append(path.steps, s)
+		switch p.peek().kind {
+		case tokSlash:
+			p.next()
+		case tokSlashSlash:
+			p.next()
+			path.steps = append(path.steps, descendantOrSelf)
+		default:
+			return nil
+		}
+	}
+}
+
+func (p *xpathParser) step() (*step, error) {
+	s := &step{axis: axisChild}
+	switch p.peek().kind {
+	case tokDot:
+		p.next()
+		s.axis = axisSelf
+		s.test.kind = testNode
+		return s, nil
+	case tokDotDot:
+		p.next()
+		s.axis = axisParent
+		s.test.kind = testNode
+		return s, nil
+	case tokAt:
+		p.next()
+		s.axis = axisAttribute
+	case tokAxis:
+		tok := p.next()
+		axis, ok := xpathAxes[tok.val]
+		if !ok {
+			return nil, &XPathError{Expr: p.src, Offset: tok.pos, Msg: "unknown axis " + tok.val}
+		}
+		s.axis = axis
+		p.next() // ::
+	}
+	tok := p.next()
+	switch tok.kind {
+	case tokName:
+		s.test.kind = testName
+		s.test.name = tok.val
+	case tokNodeType:
+		p.next() // (
+		switch tok.val {
+		case "node":
+			s.test.kind = testNode
+		case "text":
+			s.test.kind = testText
+		case "comment":
+			s.test.kind = testComment
+		case "processing-instruction":
+			s.test.kind = testProcInst
+			if p.peek().kind == tokLiteral {
+				s.test.name = p.next().val
+			}
+		}
+		if err := p.expect(tokRParen, "')'"); err != nil {
+			return nil, err
+		}
+	default:
+		p.pos--
+		return nil, p.errorf("expected node test, found %q", p.text(tok))
+	}
+	for p.peek().kind == tokLBracket {
+		pred, err := p.predicate()
+		if err != nil {
+			return nil, err
+		}
+		s.preds = append(s.preds, pred)
+	}
+	return s, nil
+}
+
+func (p *xpathParser) predicate() (xpathExpr, error) {
+	p.next() // [
+	e, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(tokRBracket, "']'"); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (p *xpathParser) filter() (xpathExpr, error) {
+	var primary xpathExpr
+	tok := p.next()
+	switch tok.kind {
+	case tokVar:
+		primary = varRef(tok.val)
+	case tokLiteral:
+		primary = literal(tok.val)
+	case tokNumber:
+		primary = number(tok.num)
+	case tokLParen:
+		e, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(tokRParen, "')'"); err != nil {
+			return nil, err
+		}
+		primary = e
+	case tokFunc:
+		call := &funcCall{name: tok.val}
+		p.next() // (
+		if p.peek().kind != tokRParen {
+			for {
+				arg, err := p.expr()
+				if err != nil {
+					return nil, err
+				}
+				call.args = append(call.args, arg)
+				if p.peek().kind != tokComma {
+					break
+				}
+				p.next()
+			}
+		}
+		if err := p.expect(tokRParen, "')'"); err != nil {
+			return nil, err
+		}
+		if err := call.check(); err != nil {
+			return nil, &XPathError{Expr: p.src, Offset: tok.pos, Msg: err.Error()}
+		}
+		primary = call
+	}
+	if p.peek().kind != tokLBracket {
+		return primary, nil
+	}
+	f := &filterExpr{primary: primary}
+	for p.peek().kind == tokLBracket {
+		pred, err := p.predicate()
+		if err != nil {
+			return nil, err
+		}
+		f.preds = append(f.preds, pred)
+	}
+	return f, nil
+}
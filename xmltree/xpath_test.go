@@ -0,0 +1,124 @@
+package xmltree
+
+import (
+	"testing"
+)
+
+var xpathDoc = []byte(`<library xmlns:x="urn:extra" xml:lang="en-US">
+  <!-- catalogue -->
+  <book id="b1" year="1954"><title>The Fellowship of the Ring</title><price>12.50</price></book>
+  <book id="b2" year="1937"><title>The Hobbit</title><price>8</price><x:note>first edition</x:note></book>
+  <?render fancy?>
+  <book id="b3"><title>Silmarillion</title><price>20</price></book>
+</library>`)
+
+func TestXPath(t *testing.T) {
+	root := parseDoc(t, xpathDoc)
+	tests := []struct {
+		expr, want string
+	}{
+		{"count(//book)", "3"},
+		{"/library/book[@id='b2']/title", "The Hobbit"},
+		{"book[2]/title", "The Hobbit"},
+		{"book[last()]/@id", "b3"},
+		{"//book[price > 10][1]/@id", "b1"},
+		{"//book[not(@year)]/title", "Silmarillion"},
+		{"sum(//price)", "40.5"},
+		{"//x:note", "first edition"},
+		{"name(//x:note)", "x:note"},
+		{"local-name(/*)", "library"},
+		{"namespace-uri(//x:note)", "urn:extra"},
+		{"//title[.='The Hobbit']/../following-sibling::book/@id", "b3"},
+		{"//book[@id='b3']/preceding::title[1]", "The Hobbit"},
+		{"count(ancestor-or-self::*)", "1"},
+		{"comment()", " catalogue "},
+		{"processing-instruction('render')", "fancy"},
+		{"count(node())", "11"},
+		{"id('b2 b3')[1]/title", "The Hobbit"},
+		{"lang('en')", "true"},
+		{"concat(substring('12345', 1.5, 2.6), '-', translate('bar', 'abc', 'AB'))", "234-BAr"},
+		{"normalize-space('  a   b ')", "a b"},
+		{"substring-after(//book[1]/title, ' of ')", "the Ring"},
+		{"round(-0.5) = 0 and round(2.5) = 3", "true"},
+		{"1 div 0", "Infinity"},
+		{"7 mod -2 * 3", "3"},
+		{"//book/@year = 1937", "true"},
+		{"//nothing = false()", "true"},
+		{"(//book | //title)[2]", "The Fellowship of the Ring"},
+	}
+	for _, tt := range tests {
+		got, err := root.QueryString(tt.expr)
+		if err != nil {
+			t.Errorf("%s: %v", tt.expr, err)
+		} else if got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestXPathEnv(t *testing.T) {
+	root := parseDoc(t, xpathDoc)
+	x := MustCompileXPath("//book[@year < $year][custom(@id)][e:note]")
+	env := &XPathEnv{
+		Namespaces: map[string]string{"e": "urn:extra"},
+		Variables:  map[string]interface{}{"year": 1950},
+		Functions: map[string]XPathFunc{
+			"custom": func(ctx *XPathContext, args ...interface{}) (interface{}, error) {
+				return XPathString(args[0]) == "b2", nil
+			},
+		},
+	}
+	v, err := x.EvalNode(root.XPathNode(), env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodes := v.([]*XPathNode)
+	if len(nodes) != 1 || nodes[0].Element().Attr("", "id") != "b2" {
+		t.Errorf("%s selected %d nodes, want book b2", x, len(nodes))
+	}
+}
+
+func TestXPathNameTest(t *testing.T) {
+	root := parseDoc(t, []byte(`<r xmlns="urn:a" xmlns:b="urn:b"><x/><b:x/><x xmlns=""/></r>`))
+	tests := []struct {
+		expr string
+		env  *XPathEnv
+		want string
+	}{
+		{"count(//x)", nil, "1"},
+		{"count(//a:x)", &XPathEnv{Namespaces: map[string]string{"a": "urn:a"}}, "1"},
+		{"count(//b:x)", nil, "1"},
+		{"count(//*)", nil, "4"},
+		{"count(//x)", &XPathEnv{AnyNamespace: true}, "3"},
+	}
+	for _, tt := range tests {
+		v, err := MustCompileXPath(tt.expr).EvalNode(root.XPathNode(), tt.env)
+		if err != nil {
+			t.Errorf("%s: %v", tt.expr, err)
+		} else if got := XPathString(v); got != tt.want {
+			t.Errorf("%s = %q, want %q (env %+v)", tt.expr, got, tt.want, tt.env)
+		}
+	}
+}
+
+func TestXPathErrors(t *testing.T) {
+	root := parseDoc(t, xpathDoc)
+	for _, expr := range []string{
+		"//book[",
+		"count()",
+		"1 +",
+		"foo::bar",
+		"'unterminated",
+		"//y:book",
+		"$undefined",
+		"undefined-function()",
+		"count('string')",
+		"1/book",
+	} {
+		if _, err := root.Query(expr); err == nil {
+			t.Errorf("expected error evaluating %q", expr)
+		} else {
+			t.Logf("%s: %v", expr, err)
+		}
+	}
+}
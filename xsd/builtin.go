@@ -68,6 +68,10 @@ const (
 	XMLBase  // xml:base
 	XMLId    // xml:id
 	AnySimpleType
+
+	// Added in XML Schema 1.1
+	DayTimeDuration   // duration with only days, hours, minutes and seconds
+	YearMonthDuration // duration with only years and months
 )
 
 // Name returns the canonical name of the built-in type. All
@@ -93,7 +97,7 @@ func (b Builtin) Name() xml.Name {
 // does not name a built-in type, ParseBuiltin returns
 // a non-nil error.
 func ParseBuiltin(qname xml.Name) (Builtin, error) {
-	for i := AnyType; i <= AnySimpleType; i++ {
+	for i := AnyType; i <= YearMonthDuration; i++ {
 		if i.Name() == qname {
 			return i, nil
 		}
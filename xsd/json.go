@@ -0,0 +1,126 @@
+package xsd
+
+import (
+	"encoding/xml"
+
+	"github.com/m29h/go-xml/xmltree"
+)
+
+// JSONSchema returns an xmltree.JSONSchema describing documents that
+// are valid against the given schemas, for use with xmltree.ToJSON.
+// Elements and attributes whose types are derived from the numeric and
+// boolean built-in types are converted to JSON numbers and booleans,
+// and elements with a maxOccurs greater than 1 are always converted to
+// arrays. Lists, unions, and elements or attributes not found in the
+// schemas are converted to strings.
+func JSONSchema(schemas []Schema) xmltree.JSONSchema {
+	return jsonSchema(schemas)
+}
+
+type jsonSchema []Schema
+
+func (s jsonSchema) ElementType(path []xml.Name) (xmltree.JSONType, bool) {
+	el := s.element(path)
+	if el == nil {
+		return xmltree.JSONString, false
+	}
+	return jsonType(el.Type), el.Plural
+}
+
+func (s jsonSchema) AttrType(path []xml.Name, attr xml.Name) xmltree.JSONType {
+	el := s.element(path)
+	if el == nil {
+		return xmltree.JSONString
+	}
+	for t := el.Type; t != nil; t = Base(t) {
+		c, ok := t.(*ComplexType)
+		if !ok {
+			break
+		}
+		for i := range c.Attributes {
+			a := &c.Attributes[i]
+			if a.Name.Local == attr.Local && (attr.Space == "" || a.Name.Space == attr.Space) {
+				if a.Plural {
+					return xmltree.JSONString
+				}
+				return jsonType(a.Type)
+			}
+		}
+	}
+	return xmltree.JSONString
+}
+
+// element returns the declaration of the element at path, or nil
+// if it is not declared.
+func (s jsonSchema) element(path []xml.Name) *Element {
+	if len(path) == 0 {
+		return nil
+	}
+	var t Type
+	for _, schema := range s {
+		if t = schema.Types[path[0]]; t != nil {
+			break
+		}
+	}
+	if t == nil {
+		return nil
+	}
+	el := &Element{Name: path[0], Type: t}
+	for _, name := range path[1:] {
+		if el = childElement(el.Type, name); el == nil {
+			return nil
+		}
+	}
+	return el
+}
+
+// childElement finds the declaration of the element name in the content
+// of t or the types it is derived from. Elements in no namespace match
+// by local name alone, to allow for unqualified local elements.
+func childElement(t Type, name xml.Name) *Element {
+	var local *Element
+	for ; t != nil; t = Base(t) {
+		c, ok := t.(*ComplexType)
+		if !ok {
+			break
+		}
+		for i := range c.Elements {
+			el := &c.Elements[i]
+			if el.Name == name {
+				return el
+			}
+			if local == nil && el.Name.Local == name.Local && (el.Name.Space == "" || name.Space == "") {
+				local = el
+			}
+		}
+	}
+	return local
+}
+
+// jsonType returns the JSON type used for the text of a value of type t.
+func jsonType(t Type) xmltree.JSONType {
+	for ; t != nil; t = Base(t) {
+		switch b := t.(type) {
+		case *SimpleType:
+			if b.List || len(b.Union) > 0 {
+				return xmltree.JSONString
+			}
+		case *ComplexType:
+			if len(b.Elements) > 0 || b.Mixed {
+				return xmltree.JSONString
+			}
+		case Builtin:
+			switch b {
+			case Boolean:
+				return xmltree.JSONBool
+			case Byte, Decimal, Double, Float, Int, Integer, Long,
+				NegativeInteger, NonNegativeInteger, NonPositiveInteger,
+				PositiveInteger, Short, UnsignedByte, UnsignedInt,
+				UnsignedLong, UnsignedShort:
+				return xmltree.JSONNumber
+			}
+			return xmltree.JSONString
+		}
+	}
+	return xmltree.JSONString
+}
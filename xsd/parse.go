@@ -45,9 +45,16 @@ type Ref struct {
 // the schema imports or includes, along with a URL for the schema,
 // if provided.
 func Imports(data []byte) ([]Ref, error) {
+	return ImportsWithOptions(nil, data)
+}
+
+// ImportsWithOptions is like Imports, but enforces the limits in
+// opts when parsing data. A nil opts uses the default limits of
+// xmltree.Parse.
+func ImportsWithOptions(opts *xmltree.ParseOptions, data []byte) ([]Ref, error) {
 	var result []Ref
 
-	root, err := xmltree.Parse(data)
+	root, err := opts.Parse(data)
 	if err != nil {
 		return nil, err
 	}
@@ -90,11 +97,23 @@ func Imports(data []byte) ([]Ref, error) {
 // number of trees returned by Normalize may not equal the
 // number of arguments.
 func Normalize(docs ...[]byte) ([]*xmltree.Element, error) {
+	return NormalizeWithOptions(nil, docs...)
+}
+
+// NormalizeWithOptions is like Normalize, but enforces the limits in
+// opts when parsing docs. The documents in StandardSchema, which
+// are always included, are not subject to the limits.
+func NormalizeWithOptions(opts *xmltree.ParseOptions, docs ...[]byte) ([]*xmltree.Element, error) {
+	user := len(docs)
 	docs = append(docs, StandardSchema...)
 	result := make([]*xmltree.Element, 0, len(docs))
 
-	for _, data := range docs {
-		root, err := xmltree.Parse(data)
+	for i, data := range docs {
+		parse := opts.Parse
+		if i >= user {
+			parse = xmltree.Parse
+		}
+		root, err := parse(data)
 		if err != nil {
 			return nil, err
 		}
@@ -133,13 +152,20 @@ func Normalize(docs ...[]byte) ([]*xmltree.Element, error) {
 // <import> or <include> statements; use the Imports function to
 // find any additional schema documents required for a schema.
 func Parse(docs ...[]byte) ([]Schema, error) {
+	return ParseWithOptions(nil, docs...)
+}
+
+// ParseWithOptions is like Parse, but enforces the limits in opts
+// when parsing docs, for schema retrieved from untrusted sources.
+// A nil opts uses the default limits of xmltree.Parse.
+func ParseWithOptions(opts *xmltree.ParseOptions, docs ...[]byte) ([]Schema, error) {
 	var (
 		result = make([]Schema, 0, len(docs))
 		parsed = make(map[string]Schema, len(docs))
 		types  = make(map[xml.Name]Type)
 	)
 
-	schema, err := Normalize(docs...)
+	schema, err := NormalizeWithOptions(opts, docs...)
 	if err != nil {
 		return nil, err
 	}
@@ -798,6 +824,9 @@ func joinElem(a, b Element) Element {
 	if a.Default != b.Default {
 		a.Default = ""
 	}
+	if a.Fixed != b.Fixed {
+		a.Fixed = ""
+	}
 
 	return a
 }
@@ -852,6 +881,7 @@ func parsePlural(el *xmltree.Element) bool {
 }
 
 func parseAnyElement(ns string, el *xmltree.Element) Element {
+	defer visit(el)
 	var base Type = AnyType
 	typeattr := el.Attr("", "type")
 	if typeattr != "" {
@@ -865,12 +895,14 @@ func parseAnyElement(ns string, el *xmltree.Element) Element {
 }
 
 func parseElement(ns string, efd FormOption, afd FormOption, el *xmltree.Element) Element {
+	defer visit(el)
 	var doc annotation
 	e := Element{
 		Name:     el.ResolveDefault(el.Attr("", "name"), ns),
 		Form:     parseForm(el.Attr("", "form"), efd),
 		Type:     parseType(el.Resolve(el.Attr("", "type"))),
 		Default:  el.Attr("", "default"),
+		Fixed:    el.Attr("", "fixed"),
 		Abstract: parseBool(el.Attr("", "abstract")),
 		Nillable: parseBool(el.Attr("", "nillable")),
 		Plural:   parsePlural(el),
@@ -881,8 +913,6 @@ func parseElement(ns string, efd FormOption, afd FormOption, el *xmltree.Element
 	}
 	if x := el.Attr("", "minOccurs"); x != "" && parseInt(x) == 0 {
 		e.Optional = true
-	} else if e.Default != "" {
-		e.Optional = true
 	}
 	walk(el, func(el *xmltree.Element) {
 		if el.Name.Local == "annotation" {
@@ -895,6 +925,7 @@ func parseElement(ns string, efd FormOption, afd FormOption, el *xmltree.Element
 }
 
 func parseAttribute(ns string, afd FormOption, el *xmltree.Element) Attribute {
+	defer visit(el)
 	var a Attribute
 	var doc annotation
 	// Non-QName xml attributes explicitly do *not* have a namespace.
@@ -905,8 +936,12 @@ func parseAttribute(ns string, afd FormOption, el *xmltree.Element) Attribute {
 		a.Name.Space = ns
 	}
 	a.Form = parseForm(el.Attr("", "form"), afd)
+	if a.Form == FormOptionUnqualified && !strings.Contains(el.Attr("", "name"), ":") {
+		a.Name.Space = ""
+	}
 	a.Type = parseType(el.Resolve(el.Attr("", "type")))
 	a.Default = el.Attr("", "default")
+	a.Fixed = el.Attr("", "fixed")
 	a.Scope = el.Scope
 	a.Optional = el.Attr("", "use") != "required"
 
@@ -24,7 +24,23 @@ func (err parseError) Error() string {
 		}
 		breadcrumbs = append(breadcrumbs, piece)
 	}
-	return "Error at " + strings.Join(breadcrumbs, ">") + ": " + err.message
+	msg := "Error at " + strings.Join(breadcrumbs, ">")
+	if pos := err.Pos(); pos.IsValid() {
+		msg += fmt.Sprintf(" (line %d, column %d)", pos.Line, pos.Column)
+	}
+	return msg + ": " + err.message
+}
+
+// Pos returns the location in the source document of the innermost
+// element on the error's path that was read from a document. Elements
+// created during normalization have no location.
+func (err parseError) Pos() xmltree.Pos {
+	for _, el := range err.path {
+		if el.Start.IsValid() {
+			return el.Start
+		}
+	}
+	return xmltree.Pos{}
 }
 
 func stop(msg string) {
@@ -32,10 +48,15 @@ func stop(msg string) {
 }
 
 func walk(root *xmltree.Element, fn func(*xmltree.Element)) {
+	// the child being visited when the error was raised
+	var current *xmltree.Element
 	defer func() {
 		if r := recover(); r != nil {
 			if err, ok := r.(parseError); ok {
-				err.path = append(err.path, root)
+				if current != nil {
+					err.path = appendPath(err.path, current)
+				}
+				err.path = appendPath(err.path, root)
 				panic(err)
 			} else {
 				panic(r)
@@ -48,8 +69,30 @@ func walk(root *xmltree.Element, fn func(*xmltree.Element)) {
 		if root.Children[i].Name.Space != schemaNS {
 			continue
 		}
-		fn(&root.Children[i])
+		current = &root.Children[i]
+		fn(current)
+	}
+	current = nil
+}
+
+// visit adds el to the path of a parseError raised while el is being
+// parsed, so that the error is reported at el. It must be deferred.
+func visit(el *xmltree.Element) {
+	if r := recover(); r != nil {
+		if err, ok := r.(parseError); ok {
+			err.path = appendPath(err.path, el)
+			panic(err)
+		}
+		panic(r)
+	}
+}
+
+// appendPath adds el to path, unless it was the last element added.
+func appendPath(path []*xmltree.Element, el *xmltree.Element) []*xmltree.Element {
+	if n := len(path); n > 0 && path[n-1] == el {
+		return path
 	}
+	return append(path, el)
 }
 
 // defer catchParseError(&err)
@@ -67,6 +67,9 @@ type Element struct {
 	Nillable bool
 	// Default overrides the zero value of this element.
 	Default string
+	// Fixed is the only value this element may have, if it is
+	// not empty.
+	Fixed string
 	// Any additional attributes provided in the <xs:element> element.
 	attr []xml.Attr
 	// Used for resolving prefixed strings in extra attribute values.
@@ -92,6 +95,9 @@ type Attribute struct {
 	Plural bool
 	// Default overrides the zero value of this element.
 	Default string
+	// Fixed is the only value this attribute may have, if it is
+	// not empty.
+	Fixed string
 	// True if the attribute is not required
 	Optional bool
 	// Any additional attributes provided in the <xs:attribute> element.
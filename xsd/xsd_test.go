@@ -228,3 +228,131 @@ func TestCases(t *testing.T) {
 		}
 	}
 }
+
+func TestParseErrorPos(t *testing.T) {
+	for _, doc := range []string{
+		`<schema xmlns="http://www.w3.org/2001/XMLSchema" targetNamespace="tns">
+  <complexType name="item">
+    <sequence>
+      <element name="count" type="int" minOccurs="many"/>
+    </sequence>
+  </complexType>
+</schema>`,
+		`<schema xmlns="http://www.w3.org/2001/XMLSchema" targetNamespace="tns">
+  <simpleType name="code">
+    <restriction base="string">
+      <maxLength value="long"/>
+    </restriction>
+  </simpleType>
+</schema>`,
+	} {
+		_, err := Parse([]byte(doc))
+		if err == nil {
+			t.Errorf("expected an error parsing %s", doc)
+			continue
+		}
+		perr, ok := err.(interface{ Pos() xmltree.Pos })
+		if !ok {
+			t.Errorf("error %v does not report a position", err)
+			continue
+		}
+		if pos := perr.Pos(); pos.Line != 4 {
+			t.Errorf("error %v reported at %s, want line 4", err, pos)
+		}
+		if !strings.Contains(err.Error(), "line 4") {
+			t.Errorf("error message %q does not include the line number", err)
+		}
+	}
+}
+
+func TestAttributeForm(t *testing.T) {
+	schema, err := Parse([]byte(`<schema xmlns="http://www.w3.org/2001/XMLSchema" targetNamespace="tns"
+    attributeFormDefault="unqualified">
+  <complexType name="item">
+    <attribute name="plain" type="string"/>
+    <attribute name="local" type="string" form="unqualified"/>
+    <attribute name="global" type="string" form="qualified"/>
+  </complexType>
+</schema>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	item, ok := schema[0].Types[xml.Name{Space: "tns", Local: "item"}].(*ComplexType)
+	if !ok {
+		t.Fatal("complex type item not found")
+	}
+	want := map[string]string{"plain": "", "local": "", "global": "tns"}
+	for _, attr := range item.Attributes {
+		if ns, ok := want[attr.Name.Local]; ok && attr.Name.Space != ns {
+			t.Errorf("attribute %s has namespace %q, want %q", attr.Name.Local, attr.Name.Space, ns)
+		}
+	}
+}
+
+func TestParseWithOptions(t *testing.T) {
+	doc := []byte(`<!DOCTYPE schema [<!ENTITY ns "tns">]>
+<schema xmlns="http://www.w3.org/2001/XMLSchema" targetNamespace="tns">
+  <element name="a" type="string"/>
+</schema>`)
+	if _, err := ParseWithOptions(nil, doc); err != nil {
+		t.Fatal(err)
+	}
+	_, err := ParseWithOptions(&xmltree.ParseOptions{DisallowDOCTYPE: true}, doc)
+	if lerr, ok := err.(*xmltree.LimitError); !ok || lerr.Limit != xmltree.LimitDOCTYPE {
+		t.Errorf("got error %v, want DOCTYPE LimitError", err)
+	}
+	// The limits do not apply to the standard schema, which
+	// are much larger than doc.
+	if _, err := ParseWithOptions(&xmltree.ParseOptions{MaxBytes: int64(len(doc))}, doc); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestJSONSchema(t *testing.T) {
+	schema, err := Parse([]byte(`<schema xmlns="http://www.w3.org/2001/XMLSchema" xmlns:tns="tns" targetNamespace="tns">
+  <simpleType name="quantity">
+    <restriction base="positiveInteger"><maxInclusive value="99"/></restriction>
+  </simpleType>
+  <complexType name="item">
+    <sequence>
+      <element name="sku" type="string"/>
+      <element name="qty" type="tns:quantity"/>
+    </sequence>
+    <attribute name="gift" type="boolean"/>
+  </complexType>
+  <complexType name="order">
+    <sequence>
+      <element name="item" type="tns:item" maxOccurs="unbounded"/>
+      <element name="total" type="decimal"/>
+    </sequence>
+  </complexType>
+  <element name="order" type="tns:order"/>
+</schema>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := xmltree.Parse([]byte(`<order xmlns="tns">
+  <item gift="true"><sku>a1</sku><qty>2</qty></item>
+  <total>12.50</total>
+</order>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := xmltree.ToJSON(doc, &xmltree.JSONOptions{
+		Convention: xmltree.Parker,
+		Schema:     JSONSchema(schema),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"item":[{"sku":"a1","qty":2}],"total":12.50}`; string(data) != want {
+		t.Errorf("got %s, want %s", data, want)
+	}
+	data, err = xmltree.ToJSON(doc, &xmltree.JSONOptions{Schema: JSONSchema(schema)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"@gift":true`) {
+		t.Errorf("attribute gift not converted to boolean in %s", data)
+	}
+}
@@ -0,0 +1,156 @@
+package xsdgen
+
+import (
+	"encoding/xml"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"strconv"
+	"strings"
+
+	"github.com/m29h/go-xml/xsd"
+)
+
+// A typeBinding is a Go type, declared outside of the generated
+// code, that is used for an XML type.
+type typeBinding struct {
+	// import path and package name; empty for types declared in
+	// the generated package or predeclared types.
+	path, pkg string
+	name      string
+}
+
+// parseGoType parses a Go type name of the form "name" or
+// "import/path.Name".
+func parseGoType(s string) (typeBinding, error) {
+	var b typeBinding
+	i := strings.LastIndex(s, ".")
+	if i >= 0 && strings.LastIndex(s, "/") < i {
+		b.path, b.name = s[:i], s[i+1:]
+		b.pkg = packageName(b.path)
+	} else {
+		b.name = s
+	}
+	if !token.IsIdentifier(b.name) || (b.path != "" && b.pkg == "") {
+		return b, fmt.Errorf("invalid Go type %q; must be a name or import/path.Name", s)
+	}
+	return b, nil
+}
+
+// BindType uses the existing Go type goType for the XML type with the
+// canonical name, which may be a built-in type such as
+//
+//	xml.Name{Space: "http://www.w3.org/2001/XMLSchema", Local: "decimal"}
+//
+// or a type declared in a schema. No type is generated for bound
+// types; fields of the type use goType instead, which is either the
+// name of a type, or the import path of a package, followed by a dot
+// and the name of a type in the package, as in
+// "github.com/shopspring/decimal.Decimal". The package name is
+// assumed to be the last element of the import path, or the one
+// before it if the last is a major version suffix, as in
+// "github.com/cockroachdb/apd/v3.Decimal". A number is appended to the
+// name the package is imported as if the generated code uses that
+// name for another package, such as time or xml. The Go type
+// must implement encoding.TextMarshaler and encoding.TextUnmarshaler,
+// or xml.Marshaler and xml.Unmarshaler, unless the default encoding
+// of its underlying type is suitable. An empty goType removes the
+// binding for name.
+func BindType(name xml.Name, goType string) Option {
+	return func(cfg *Config) Option {
+		prev, ok := cfg.bindings[name]
+		undo := BindType(name, "")
+		if ok {
+			undo = BindType(name, prev.String())
+		}
+		if goType == "" {
+			delete(cfg.bindings, name)
+			return undo
+		}
+		b, err := parseGoType(goType)
+		if err != nil {
+			cfg.logf("BindType: %v", err)
+			return undo
+		}
+		if cfg.bindings == nil {
+			cfg.bindings = make(map[xml.Name]typeBinding)
+		}
+		cfg.bindings[name] = b
+		return undo
+	}
+}
+
+func (b typeBinding) String() string {
+	if b.path == "" {
+		return b.name
+	}
+	return b.path + "." + b.name
+}
+
+// binding returns the Go type that t is bound to, if any.
+func (cfg *Config) binding(t xsd.Type) (typeBinding, bool) {
+	if len(cfg.bindings) == 0 || t == nil {
+		return typeBinding{}, false
+	}
+	b, ok := cfg.bindings[xsd.XMLName(t)]
+	return b, ok
+}
+
+// boundExpr returns the expression for a bound type, and records
+// the import it requires.
+func (cfg *Config) boundExpr(b typeBinding) ast.Expr {
+	if b.path == "" {
+		return ast.NewIdent(b.name)
+	}
+	pkg := b.pkg
+	if cfg.boundImports != nil {
+		pkg = cfg.importName(b)
+	}
+	return &ast.SelectorExpr{
+		X:   ast.NewIdent(pkg),
+		Sel: ast.NewIdent(b.name),
+	}
+}
+
+// importName returns the name that the package of b is imported as,
+// choosing one that no other package of the generated code uses if
+// this is the first type bound to the package.
+func (cfg *Config) importName(b typeBinding) string {
+	if name, ok := cfg.boundImports[b.path]; ok {
+		return name
+	}
+	taken := func(name string) bool {
+		if p, ok := implicitImports[name]; ok && p != b.path {
+			return true
+		}
+		for _, q := range cfg.qualifiers {
+			if q == name {
+				return true
+			}
+		}
+		for _, other := range cfg.boundImports {
+			if other == name {
+				return true
+			}
+		}
+		return false
+	}
+	name := b.pkg
+	for i := 2; taken(name); i++ {
+		name = b.pkg + strconv.Itoa(i)
+	}
+	cfg.boundImports[b.path] = name
+	return name
+}
+
+// needsHelper returns true if fields of type t need a helper type
+// to be marshalled and unmarshalled.
+func (cfg *Config) needsHelper(t xsd.Type) bool {
+	if _, ok := cfg.binding(t); ok {
+		return false
+	}
+	if _, ok := cfg.exactTimeType(t); ok {
+		return false
+	}
+	return nonTrivialBuiltin(t)
+}
@@ -29,6 +29,21 @@ func nonTrivialBuiltin(t xsd.Type) bool {
 	return false
 }
 
+// Returns true if t is an xsd.Builtin whose Go type is a helper type
+// that is declared in the generated code, rather than a Go type with
+// a helper type for marshalling it.
+func namedBuiltin(t xsd.Type) bool {
+	b, ok := t.(xsd.Builtin)
+	if !ok {
+		return false
+	}
+	switch b {
+	case xsd.Duration, xsd.DayTimeDuration, xsd.YearMonthDuration:
+		return true
+	}
+	return false
+}
+
 // The 45 built-in types of the XSD schema
 var builtinTbl = []ast.Expr{
 	xsd.AnyType:       &ast.Ident{Name: "string"},
@@ -52,9 +67,9 @@ var builtinTbl = []ast.Expr{
 	xsd.DateTime:      &ast.Ident{Name: "time.Time"},
 	xsd.Decimal:       &ast.Ident{Name: "float64"},
 	xsd.Double:        &ast.Ident{Name: "float64"},
-	// the "duration" built-in is especially broken, so we
-	// don't parse it at all.
-	xsd.Duration:           &ast.Ident{Name: "string"},
+	// durations are declared as helper types in the generated
+	// code; see addDurationHelpers.
+	xsd.Duration:           &ast.Ident{Name: "xsdDuration"},
 	xsd.Float:              &ast.Ident{Name: "float32"},
 	xsd.GDay:               &ast.Ident{Name: "time.Time"},
 	xsd.GMonth:             &ast.Ident{Name: "time.Time"},
@@ -79,4 +94,6 @@ var builtinTbl = []ast.Expr{
 	xsd.UnsignedInt:        &ast.Ident{Name: "uint"},
 	xsd.UnsignedLong:       &ast.Ident{Name: "uint64"},
 	xsd.UnsignedShort:      &ast.Ident{Name: "uint"},
+	xsd.DayTimeDuration:    &ast.Ident{Name: "xsdDayTimeDuration"},
+	xsd.YearMonthDuration:  &ast.Ident{Name: "xsdYearMonthDuration"},
 }
@@ -1,6 +1,7 @@
 package xsdgen
 
 import (
+	"encoding/xml"
 	"flag"
 	"fmt"
 	"go/ast"
@@ -10,6 +11,7 @@ import (
 
 	"github.com/m29h/go-xml/internal/commandline"
 	"github.com/m29h/go-xml/internal/gen"
+	"github.com/m29h/go-xml/rng"
 	"github.com/m29h/go-xml/xsd"
 )
 
@@ -76,16 +78,48 @@ func (cfg *Config) GenCodeWithSchema(injectedSchema *xsd.Schema, data ...[]byte)
 // GenAST creates an *ast.File containing type declarations and
 // associated methods based on a set of XML schema.
 func (cfg *Config) GenAST(files ...string) (*ast.File, error) {
-	cfg.filesRead = make(map[string]bool)
-	data, err := cfg.readFiles(files...)
+	code, err := cfg.readCode(files...)
 	if err != nil {
 		return nil, err
 	}
-	code, err := cfg.GenCode(data...)
+	return code.GenAST()
+}
+
+// GenFiles is like GenAST, but distributes the generated code
+// across multiple files. See Code.GenFiles for the meaning of its
+// arguments.
+func (cfg *Config) GenFiles(grouping FileGrouping, maxLines int, files ...string) (map[string]*ast.File, error) {
+	code, err := cfg.readCode(files...)
 	if err != nil {
 		return nil, err
 	}
-	return code.GenAST()
+	return code.GenFiles(grouping, maxLines)
+}
+
+func (cfg *Config) readCode(files ...string) (*Code, error) {
+	data, err := cfg.readSchemas(files...)
+	if err != nil {
+		return nil, err
+	}
+	return cfg.GenCode(data...)
+}
+
+// readSchemas reads the schema in files, and the schema they import
+// if FollowImports is set.
+func (cfg *Config) readSchemas(files ...string) ([][]byte, error) {
+	cfg.filesRead = make(map[string]bool)
+	cfg.sources = make(map[xml.Name]string)
+	cfg.unqualifiedRNG = false
+	data, err := cfg.readFiles(files...)
+	if err != nil {
+		return nil, err
+	}
+	if len(cfg.namespaces) == 0 && cfg.unqualifiedRNG {
+		// lookupTargetNS does not return the empty namespace, which
+		// RELAX NG schema commonly use.
+		cfg.Option(Namespaces(append(lookupTargetNS(data...), "")...))
+	}
+	return data, nil
 }
 
 func (cfg *Config) readFiles(files ...string) ([][]byte, error) {
@@ -106,6 +140,17 @@ func (cfg *Config) readFiles(files ...string) ([][]byte, error) {
 			return nil, err
 		}
 		cfg.debugf("read %s", path)
+		if ext := strings.ToLower(filepath.Ext(path)); ext == ".rng" || ext == ".rnc" {
+			docs, err := cfg.translateRNG(path, b)
+			if err != nil {
+				return nil, err
+			}
+			for _, doc := range docs {
+				cfg.addSources(path, doc)
+			}
+			data = append(data, docs...)
+			continue
+		}
 		if cfg.followImports {
 			dir := filepath.Dir(path)
 			importedRefs, err := xsd.Imports(b)
@@ -126,11 +171,57 @@ func (cfg *Config) readFiles(files ...string) ([][]byte, error) {
 			}
 			data = append(data, referencedData...)
 		}
+		cfg.addSources(path, b)
 		data = append(data, b)
 	}
 	return data, nil
 }
 
+// addSources records path as the source of the top-level
+// declarations in the schema data.
+func (cfg *Config) addSources(path string, data []byte) {
+	if cfg.sources == nil {
+		return
+	}
+	for _, name := range schemaSources(data) {
+		if _, ok := cfg.sources[name]; !ok {
+			cfg.sources[name] = path
+		}
+	}
+}
+
+// translateRNG translates the RELAX NG schema in the file path, with
+// content b, to XML Schema. Included and external schema are read
+// from the local file system.
+func (cfg *Config) translateRNG(path string, b []byte) ([][]byte, error) {
+	opts := &rng.Options{
+		Location: filepath.ToSlash(path),
+		Resolver: func(href string) ([]byte, error) {
+			if strings.Contains(href, "://") {
+				return nil, fmt.Errorf("cannot retrieve %s", href)
+			}
+			href = strings.TrimPrefix(href, "file:")
+			cfg.debugf("read %s", href)
+			return os.ReadFile(filepath.FromSlash(href))
+		},
+	}
+	parse := rng.Parse
+	if strings.EqualFold(filepath.Ext(path), ".rnc") {
+		parse = rng.ParseCompact
+	}
+	g, err := parse(b, opts)
+	if err != nil {
+		return nil, err
+	}
+	docs := rng.XSD(g)
+	for _, doc := range docs {
+		if len(lookupTargetNS(doc)) == 0 {
+			cfg.unqualifiedRNG = true
+		}
+	}
+	return docs, nil
+}
+
 // The GenSource method converts the AST returned by GenAST to formatted
 // Go source code.
 func (cfg *Config) GenSource(files ...string) ([]byte, error) {
@@ -151,19 +242,33 @@ func (cfg *Config) GenCLI(arguments ...string) error {
 		err                                error
 		replaceRules                       commandline.ReplaceRuleList
 		xmlns                              commandline.Strings
+		pkgPaths                           commandline.Strings
+		prefixes                           commandline.Strings
+		renames                            commandline.Strings
+		bindings                           commandline.Strings
 		fs                                 = flag.NewFlagSet("xsdgen", flag.ExitOnError)
 		packageName                        = fs.String("pkg", "", "name of the the generated package")
-		output                             = fs.String("o", "xsdgen_output.go", "name of the output file")
+		output                             = fs.String("o", "xsdgen_output.go", "name of the output file, or directory if -split, -maxlines or -pkgpath is used")
+		split                              = fs.String("split", "", "split output into multiple files by `namespace`, file or size")
+		maxLines                           = fs.Int("maxlines", 0, "split output files longer than `n` lines")
 		followImports                      = fs.Bool("f", false, "follow import statements; load imported references recursively into scope")
 		addJsonTags                        = fs.Bool("json", false, "add json tags to struct tag so that the json name equals the xml name")
 		targetNamespacesOnly               = fs.Bool("t", false, "restict output of types to these declared in the target namespace(s) provided")
 		xmlpkg                             = fs.String("xmlpkg", "encoding/xml", "name of the go xml package to use")
 		applyXMLNameToTopLevelElementTypes = fs.Bool("n", false, "apply XMLName to all top level element types")
+		optional                           = fs.String("optional", "omitempty", "declare optional fields as `omitempty` values, pointer or generic Optional[T]")
+		exactTimes                         = fs.Bool("exacttimes", false, "use helper types for date and time types that preserve time zones and fractional seconds")
+		losslessNumbers                    = fs.Bool("lossless", false, "use string-based types for xs:decimal and xs:integer, to preserve their precision")
 		verbose                            = fs.Bool("v", false, "print verbose output")
 		debug                              = fs.Bool("vv", false, "print debug output")
+		configFile                         = fs.String("config", "", "read options from a JSON `file`; flags override the file")
 	)
 	fs.Var(&replaceRules, "r", "replacement rule 'regex -> repl' (can be used multiple times)")
 	fs.Var(&xmlns, "ns", "target namespace(s) to generate types for")
+	fs.Var(&prefixes, "nsprefix", "prefix the names of types in a namespace, as 'xmlns=Prefix' (can be used multiple times)")
+	fs.Var(&renames, "rename", "set the Go name of a type, as 'xmlns:name=GoName' (can be used multiple times)")
+	fs.Var(&bindings, "bind", "use an existing Go type for a type, as 'xmlns:name=import/path.Type' (can be used multiple times)")
+	fs.Var(&pkgPaths, "pkgpath", "generate namespace into its own package, as 'xmlns=importpath' (can be used multiple times)")
 
 	// Usage is a replacement usage function for the flags package.
 	fs.Usage = func() {
@@ -188,17 +293,131 @@ func (cfg *Config) GenCLI(arguments ...string) error {
 	if *xmlpkg != "encoding/xml" {
 		cfg.Option(XMLPackage(*xmlpkg))
 	}
-	cfg.Option(Namespaces(xmlns...))
-	cfg.Option(FollowImports(*followImports))
-	cfg.Option(AddJSONTags(*addJsonTags))
-	cfg.Option(TargetNamespacesOnly(*targetNamespacesOnly))
-	cfg.Option(ApplyXMLNameToTopLevelElementTypes(*applyXMLNameToTopLevelElementTypes))
+	var conf ConfigFile
+	if *configFile != "" {
+		f, err := ReadConfigFile(*configFile)
+		if err != nil {
+			return err
+		}
+		opts, err := f.Options()
+		if err != nil {
+			return fmt.Errorf("%s: %v", *configFile, err)
+		}
+		cfg.Option(opts...)
+		conf = *f
+	}
+	// Flags given on the command line override the config file,
+	// which overrides the default values of the flags.
+	explicit := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+	flagOption := func(name string, configured bool, opt Option) {
+		if explicit[name] || !configured {
+			cfg.Option(opt)
+		}
+	}
+	flagOption("ns", len(conf.Namespaces) > 0, Namespaces(xmlns...))
+	flagOption("f", conf.FollowImports != nil, FollowImports(*followImports))
+	flagOption("json", conf.JSONTags != nil, AddJSONTags(*addJsonTags))
+	flagOption("t", conf.TargetNamespacesOnly != nil, TargetNamespacesOnly(*targetNamespacesOnly))
+	flagOption("n", conf.XMLName != nil, ApplyXMLNameToTopLevelElementTypes(*applyXMLNameToTopLevelElementTypes))
+	flagOption("lossless", conf.LosslessNumbers != nil, LosslessNumbers(*losslessNumbers))
+	flagOption("exacttimes", conf.ExactTimes != nil, ExactTimes(*exactTimes))
+	optionalStyle, err := parseOptionalStyle(*optional)
+	if err != nil {
+		return err
+	}
+	flagOption("optional", conf.Optional != "", OptionalFields(optionalStyle))
 	for _, r := range replaceRules {
 		cfg.Option(replaceAllNamesRegex(r.From, r.To))
 	}
 	if *packageName != "" {
 		cfg.Option(PackageName(*packageName))
 	}
+	for _, p := range prefixes {
+		i := strings.LastIndex(p, "=")
+		if i < 0 {
+			return fmt.Errorf("invalid -nsprefix %q; must be \"xmlns=Prefix\"", p)
+		}
+		cfg.Option(NamespacePrefix(p[:i], p[i+1:]))
+	}
+	for _, r := range renames {
+		i := strings.LastIndex(r, "=")
+		if i < 0 {
+			return fmt.Errorf("invalid -rename %q; must be \"xmlns:name=GoName\"", r)
+		}
+		cfg.Option(RenameType(parseTypeName(r[:i]), r[i+1:]))
+	}
+	for _, b := range bindings {
+		i := strings.LastIndex(b, "=")
+		if i < 0 {
+			return fmt.Errorf("invalid -bind %q; must be \"xmlns:name=import/path.Type\"", b)
+		}
+		if _, err := parseGoType(b[i+1:]); err != nil {
+			return err
+		}
+		cfg.Option(BindType(parseTypeName(b[:i]), b[i+1:]))
+	}
+	for _, p := range pkgPaths {
+		i := strings.LastIndex(p, "=")
+		if i < 0 {
+			return fmt.Errorf("invalid -pkgpath %q; must be \"xmlns=importpath\"", p)
+		}
+		cfg.Option(PackagePath(p[:i], p[i+1:]))
+	}
+
+	var grouping FileGrouping
+	splitFiles := *split != "" || *maxLines > 0
+	if splitFiles {
+		if grouping, err = parseGrouping(*split, *maxLines); err != nil {
+			return err
+		}
+	}
+	// The default output file name makes no sense as a
+	// directory name.
+	dir := "."
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "o" {
+			dir = *output
+		}
+	})
+
+	if len(pkgPaths) > 0 || len(conf.Packages) > 0 {
+		data, err := cfg.readSchemas(fs.Args()...)
+		if err != nil {
+			return err
+		}
+		packages, err := cfg.GenPackages(data...)
+		if err != nil {
+			return err
+		}
+		for _, code := range packages {
+			var files map[string]*ast.File
+			if splitFiles {
+				files, err = code.GenFiles(grouping, *maxLines)
+			} else {
+				var file *ast.File
+				file, err = code.GenAST()
+				files = map[string]*ast.File{"xsdgen_output.go": file}
+			}
+			if err != nil {
+				return err
+			}
+			if err := writeFiles(filepath.Join(dir, code.pkgname), files); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if splitFiles {
+		files, err := cfg.GenFiles(grouping, *maxLines, fs.Args()...)
+		if err != nil {
+			return err
+		}
+		return writeFiles(dir, files)
+	}
 
 	file, err := cfg.GenAST(fs.Args()...)
 	if err != nil {
@@ -211,3 +430,38 @@ func (cfg *Config) GenCLI(arguments ...string) error {
 	}
 	return os.WriteFile(*output, data, 0666)
 }
+
+func parseGrouping(split string, maxLines int) (FileGrouping, error) {
+	switch split {
+	case "namespace":
+		return GroupByNamespace, nil
+	case "file":
+		return GroupBySourceFile, nil
+	case "size":
+		return GroupBySize, nil
+	case "":
+		if maxLines > 0 {
+			return GroupBySize, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid -split value %q; must be namespace, file or size", split)
+}
+
+// writeFiles writes formatted source for each of files to the
+// directory dir, creating it if necessary.
+func writeFiles(dir string, files map[string]*ast.File) error {
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return err
+	}
+	for name, file := range files {
+		path := filepath.Join(dir, name)
+		data, err := gen.FormattedSource(file, path)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, data, 0666); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -55,6 +55,38 @@ type Config struct {
 
 	// keep track of files that are read already to avoid reading it again
 	filesRead map[string]bool
+	// set if a RELAX NG schema declared elements in no namespace
+	unqualifiedRNG bool
+	// the files that top-level declarations were read from
+	sources map[xml.Name]string
+	// Go names of types, set by RenameType, and prefixes
+	// for the names of types in each namespace
+	typeNames    map[xml.Name]string
+	typePrefixes map[string]string
+	// use xsdDecimal and xsdInteger helper types for unbounded numeric
+	// types
+	losslessNumbers bool
+	// use helper types that preserve the lexical form of date and
+	// time values
+	exactTimes bool
+	// how to declare the fields of optional and nillable elements
+	// and attributes
+	optionalStyle OptionalStyle
+	// name anonymous types after their fields, and whether the
+	// type processor that does so has been added
+	fieldNames, fieldNamesAdded bool
+	// helper types that the generated code refers to by name
+	namedHelpers map[xml.Name]bool
+	// existing Go types used for XML types, and the packages
+	// they are imported from
+	bindings     map[xml.Name]typeBinding
+	boundImports map[string]string
+	// import paths of the packages for each namespace
+	packages map[string]string
+	// while generating a package, the names of the other
+	// packages, by namespace, and the namespaces referenced
+	qualifiers map[string]string
+	imported   map[string]bool
 }
 
 type typeTransform func(xsd.Schema, xsd.Type) xsd.Type
@@ -273,6 +305,40 @@ func replacePostprocessType(p *specTransform, fn specTransform) Option {
 	}
 }
 
+// NamespacePrefix adds a prefix to the Go names of all types in
+// the namespace ns, so that types of the same name in different
+// namespaces do not collide. The prefix is added after any
+// replacement rules are applied, and should begin with an upper
+// case letter if the types are to be exported.
+func NamespacePrefix(ns, prefix string) Option {
+	return func(cfg *Config) Option {
+		prev := cfg.typePrefixes[ns]
+		if cfg.typePrefixes == nil {
+			cfg.typePrefixes = make(map[string]string)
+		}
+		cfg.typePrefixes[ns] = prefix
+		return NamespacePrefix(ns, prev)
+	}
+}
+
+// RenameType sets the Go name of the type with the canonical XML
+// name, overriding any replacement rules and namespace prefixes. An
+// empty goName removes the override.
+func RenameType(name xml.Name, goName string) Option {
+	return func(cfg *Config) Option {
+		prev := cfg.typeNames[name]
+		if goName == "" {
+			delete(cfg.typeNames, name)
+		} else {
+			if cfg.typeNames == nil {
+				cfg.typeNames = make(map[xml.Name]string)
+			}
+			cfg.typeNames[name] = goName
+		}
+		return RenameType(name, prev)
+	}
+}
+
 // PackageName specifies the name of the generated Go
 // package.
 func PackageName(name string) Option {
@@ -381,72 +447,95 @@ func replaceAllNamesRegex(reg *regexp.Regexp, repl string) Option {
 }
 
 // The UseFieldNames Option names anonymous types based on the name
-// of the element or attribute they describe.
+// of the element or attribute they describe. When different types
+// describe elements of the same name, a number is appended to the
+// names of all but the first, as in Comment2.
 func UseFieldNames() Option {
-	return ProcessTypes(useFieldNames)
+	return fieldNames(true)
 }
 
-func useFieldNames(s xsd.Schema, t xsd.Type) xsd.Type {
-
-	used := func(search xml.Name) bool {
-		for _, t := range s.Types {
-			if xsd.XMLName(t) == search {
-				return true
-			}
+// fieldNames turns UseFieldNames on or off. A ConfigFile uses it to
+// undo the UseFieldNames in DefaultOptions, which cannot remove the
+// type processor once it has been added.
+func fieldNames(on bool) Option {
+	return func(cfg *Config) Option {
+		prev := cfg.fieldNames
+		cfg.fieldNames = on
+		if on && !cfg.fieldNamesAdded {
+			cfg.fieldNamesAdded = true
+			ProcessTypes(func(s xsd.Schema, t xsd.Type) xsd.Type {
+				if !cfg.fieldNames {
+					return t
+				}
+				return useFieldNames(s, t)
+			})(cfg)
 		}
-		return false
+		return fieldNames(prev)
 	}
+}
+
+func useFieldNames(s xsd.Schema, t xsd.Type) xsd.Type {
 	c, ok := t.(*xsd.ComplexType)
 	if !ok {
 		return t
 	}
 	for _, el := range c.Elements {
-		switch base := el.Type.(type) {
-		case *xsd.SimpleType:
-			if !base.Anonymous {
-				break
-			}
-			base.Name = el.Name
-			base.Anonymous = false
-		case *xsd.ComplexType:
-			if !base.Anonymous {
-				break
-			}
-			for i := 1; ; i++ {
-				name := el.Name
-				if i > 1 {
-					name.Local = fmt.Sprint(el.Name.Local, i)
-				}
-				if used(name) {
-					if other, ok := s.Types[el.Name].(*xsd.ComplexType); ok {
-						if !reflect.DeepEqual(other.Elements, base.Elements) {
-							continue
-						}
-					}
-				}
-				base.Name = name
-				base.Anonymous = false
-				break
-			}
-		}
+		nameFieldType(s, el.Type, el.Name)
 	}
 	for _, attr := range c.Attributes {
-		switch base := attr.Type.(type) {
-		case *xsd.SimpleType:
-			if !base.Anonymous {
-				break
-			}
-			base.Name = attr.Name
-			base.Anonymous = false
-		case *xsd.ComplexType:
-			if !base.Anonymous {
+		nameFieldType(s, attr.Type, attr.Name)
+	}
+	return t
+}
+
+// nameFieldType names the anonymous type t after the element or
+// attribute name. If a different type already has that name, a
+// number is appended to it.
+func nameFieldType(s xsd.Schema, t xsd.Type, name xml.Name) {
+	switch t := t.(type) {
+	case *xsd.SimpleType:
+		if !t.Anonymous {
+			return
+		}
+		t.Name = fieldTypeName(s, t, name, func(name xml.Name) xsd.Type {
+			v := *t
+			v.Name, v.Anonymous = name, false
+			return &v
+		})
+		t.Anonymous = false
+	case *xsd.ComplexType:
+		if !t.Anonymous {
+			return
+		}
+		t.Name = fieldTypeName(s, t, name, func(name xml.Name) xsd.Type {
+			v := *t
+			v.Name, v.Anonymous = name, false
+			return &v
+		})
+		t.Anonymous = false
+	}
+}
+
+// fieldTypeName returns the first of name, name2, name3 and so on
+// that is not the name of a type in s other than t, or of a type
+// equal to t renamed by rename.
+func fieldTypeName(s xsd.Schema, t xsd.Type, name xml.Name, rename func(xml.Name) xsd.Type) xml.Name {
+	for i := 1; ; i++ {
+		candidate := name
+		if i > 1 {
+			candidate.Local = fmt.Sprint(name.Local, i)
+		}
+		free := true
+		for _, other := range s.Types {
+			if other != t && xsd.XMLName(other) == candidate && !reflect.DeepEqual(other, rename(candidate)) {
+				free = false
 				break
 			}
-			base.Name = attr.Name
-			base.Anonymous = false
+		}
+		if free {
+			return candidate
 		}
 	}
-	return t
 }
 
 // ProcessTypes allows for users to make arbitrary changes to a type before
@@ -537,14 +626,34 @@ func (cfg *Config) filterFields(t *xsd.ComplexType) ([]xsd.Attribute, []xsd.Elem
 // Return the identifier for non-builtin types, or the Go expression
 // mapped to the built-in type.
 func (cfg *Config) expr(t xsd.Type) (ast.Expr, error) {
+	if b, ok := cfg.binding(t); ok {
+		return cfg.boundExpr(b), nil
+	}
 	if t, ok := t.(xsd.Builtin); ok {
+		if ex, ok := cfg.losslessExpr(t); ok {
+			return ex, nil
+		}
+		if ex, ok := cfg.exactTimeExpr(t); ok {
+			return ex, nil
+		}
 		ex := builtinExpr(t)
 		if ex == nil {
 			return nil, fmt.Errorf("unknown built-in type %q", t.Name().Local)
 		}
+		if namedBuiltin(t) {
+			cfg.useHelper(t)
+		}
 		return ex, nil
 	}
-	return ast.NewIdent(cfg.public(xsd.XMLName(t))), nil
+	name := xsd.XMLName(t)
+	if q, ok := cfg.qualifier(name.Space); ok {
+		cfg.imported[name.Space] = true
+		return &ast.SelectorExpr{
+			X:   ast.NewIdent(q),
+			Sel: ast.NewIdent(cfg.typeName(name)),
+		}, nil
+	}
+	return ast.NewIdent(cfg.typeName(name)), nil
 }
 
 func (cfg *Config) exprString(t xsd.Type) string {
@@ -567,6 +676,15 @@ func (cfg *Config) NameOf(name xml.Name) string {
 	return cfg.public(name)
 }
 
+// typeName returns the Go identifier for the type with the
+// canonical XML name.
+func (cfg *Config) typeName(name xml.Name) string {
+	if s, ok := cfg.typeNames[name]; ok {
+		return s
+	}
+	return cfg.typePrefixes[name.Space] + cfg.public(name)
+}
+
 func (cfg *Config) public(name xml.Name) string {
 	if cfg.nameTransform != nil {
 		name = cfg.nameTransform(name)
@@ -831,6 +949,60 @@ func (cfg *Config) addStandardHelpers() {
 				`).MustDecl(),
 		},
 	}
+	cfg.addDurationHelpers()
+	cfg.addOptionalHelpers()
+	cfg.addDefaultHelpers()
+	if cfg.losslessNumbers {
+		cfg.addLosslessHelpers()
+	}
+	if cfg.exactTimes {
+		cfg.addExactTimeHelpers()
+	}
+}
+
+// useHelper records that the generated code refers to the helper
+// type for t by name.
+func (cfg *Config) useHelper(t xsd.Type) {
+	if cfg.namedHelpers != nil {
+		cfg.namedHelpers[xsd.XMLName(t)] = true
+	}
+}
+
+// addNamedHelpers adds the helper types that the generated code
+// refers to by name, and the helper types they depend on, to its
+// declarations.
+func (cfg *Config) addNamedHelpers(code *Code) error {
+	var errList errorList
+	queue := make([]xml.Name, 0, len(cfg.namedHelpers))
+	for name := range cfg.namedHelpers {
+		queue = append(queue, name)
+	}
+	for len(queue) > 0 {
+		h, ok := cfg.helperTypes[queue[0]]
+		queue = queue[1:]
+		if !ok || code.helpers[h.name] {
+			continue
+		}
+		if prev, ok := code.decls[h.name]; ok {
+			errList = append(errList, fmt.Errorf("type %s conflicts with the helper type %s; "+
+				"use the RenameType option to rename it", xmlNameString(specName(prev)), h.name))
+			continue
+		}
+		code.decls[h.name] = h
+		code.helpers[h.name] = true
+		queue = append(queue, h.helperTypes...)
+	}
+	if len(errList) > 0 {
+		return errList
+	}
+	return nil
+}
+
+func xmlNameString(name xml.Name) string {
+	if name.Space == "" {
+		return name.Local
+	}
+	return name.Space + ":" + name.Local
 }
 
 // SOAP arrays (and other similar types) are complex types with a single
@@ -0,0 +1,198 @@
+package xsdgen
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// A ConfigFile describes a Config declaratively, so that the xsdgen
+// command can be customized without writing a Go program around the
+// Option functions. It is read from JSON by ReadConfigFile, using the
+// field names in the json tags below. Fields that are not set leave
+// the corresponding setting unchanged.
+//
+//	{
+//		"package": "ubl",
+//		"namespaces": ["urn:oasis:names:specification:ubl:schema:xsd:Invoice-2"],
+//		"followImports": true,
+//		"prefixes": {"urn:oasis:names:specification:ubl:schema:xsd:CommonAggregateComponents-2": "Cac"},
+//		"renames": {"urn:example:Party": "Customer"},
+//		"replace": [{"pattern": "Type$", "replacement": ""}],
+//		"ignoreElements": ["UBLExtensions"]
+//	}
+type ConfigFile struct {
+	// The name of the generated package; see PackageName.
+	Package string `json:"package,omitempty"`
+	// The target namespaces to generate types for; see Namespaces.
+	Namespaces []string `json:"namespaces,omitempty"`
+	// Import paths of the packages to generate namespaces into,
+	// by namespace; see PackagePath.
+	Packages map[string]string `json:"packages,omitempty"`
+	// Prefixes for the Go names of types, by namespace; see
+	// NamespacePrefix.
+	Prefixes map[string]string `json:"prefixes,omitempty"`
+	// Go names of types, keyed by the namespace and name of the
+	// type, separated by the last colon, as in "urn:example:Party";
+	// see RenameType.
+	Renames map[string]string `json:"renames,omitempty"`
+	// Replacement rules for all identifiers, applied in order; see
+	// Replace.
+	Replace []ReplaceRule `json:"replace,omitempty"`
+	// Patterns of the names of the types to generate; see OnlyTypes.
+	OnlyTypes []string `json:"onlyTypes,omitempty"`
+	// Existing Go types to use for XML types, keyed by the name of
+	// the XML type in the same form as the keys of Renames, as in
+	// "http://www.w3.org/2001/XMLSchema:decimal"; see BindType.
+	Bindings map[string]string `json:"bindings,omitempty"`
+	// Names of the types to generate, in the same form as the keys
+	// of Renames; see AllowType.
+	AllowTypes []string `json:"allowTypes,omitempty"`
+	// Names of elements and attributes to leave out of the
+	// generated types; see IgnoreElements and IgnoreAttributes.
+	IgnoreElements   []string `json:"ignoreElements,omitempty"`
+	IgnoreAttributes []string `json:"ignoreAttributes,omitempty"`
+	// The import path of the xml package to use; see XMLPackage.
+	XMLPackage string `json:"xmlPackage,omitempty"`
+	// How to declare optional fields, one of "omitempty", "pointer"
+	// or "generic"; see OptionalFields.
+	Optional string `json:"optional,omitempty"`
+
+	// Feature toggles. See FollowImports, AddJSONTags,
+	// TargetNamespacesOnly, ApplyXMLNameToTopLevelElementTypes,
+	// LosslessNumbers, ExactTimes and UseFieldNames.
+	FollowImports        *bool `json:"followImports,omitempty"`
+	JSONTags             *bool `json:"jsonTags,omitempty"`
+	TargetNamespacesOnly *bool `json:"targetNamespacesOnly,omitempty"`
+	XMLName              *bool `json:"xmlName,omitempty"`
+	LosslessNumbers      *bool `json:"losslessNumbers,omitempty"`
+	ExactTimes           *bool `json:"exactTimes,omitempty"`
+	UseFieldNames        *bool `json:"useFieldNames,omitempty"`
+}
+
+// A ReplaceRule is a replacement rule in a ConfigFile.
+type ReplaceRule struct {
+	Pattern     string `json:"pattern"`
+	Replacement string `json:"replacement"`
+}
+
+// ReadConfigFile reads a ConfigFile from the JSON file at path.
+// Unknown fields are reported as errors, to catch misspellings.
+func ReadConfigFile(path string) (*ConfigFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	var file ConfigFile
+	if err := dec.Decode(&file); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return &file, nil
+}
+
+// Options returns the Options described by the ConfigFile, or an
+// error if any of its values are invalid.
+func (f *ConfigFile) Options() ([]Option, error) {
+	var opts []Option
+	if f.Package != "" {
+		opts = append(opts, PackageName(f.Package))
+	}
+	if len(f.Namespaces) > 0 {
+		opts = append(opts, Namespaces(f.Namespaces...))
+	}
+	for _, ns := range sortedKeys(f.Packages) {
+		opts = append(opts, PackagePath(ns, f.Packages[ns]))
+	}
+	for _, ns := range sortedKeys(f.Prefixes) {
+		opts = append(opts, NamespacePrefix(ns, f.Prefixes[ns]))
+	}
+	for _, key := range sortedKeys(f.Renames) {
+		opts = append(opts, RenameType(parseTypeName(key), f.Renames[key]))
+	}
+	for _, key := range sortedKeys(f.Bindings) {
+		if _, err := parseGoType(f.Bindings[key]); err != nil {
+			return nil, err
+		}
+		opts = append(opts, BindType(parseTypeName(key), f.Bindings[key]))
+	}
+	for _, r := range f.Replace {
+		if _, err := regexp.Compile(r.Pattern); err != nil {
+			return nil, fmt.Errorf("invalid replace pattern %q: %v", r.Pattern, err)
+		}
+		opts = append(opts, Replace(r.Pattern, r.Replacement))
+	}
+	if len(f.OnlyTypes) > 0 {
+		pat := strings.Join(f.OnlyTypes, "|")
+		if _, err := regexp.Compile(pat); err != nil {
+			return nil, fmt.Errorf("invalid onlyTypes pattern %q: %v", pat, err)
+		}
+		opts = append(opts, OnlyTypes(f.OnlyTypes...))
+	}
+	for _, key := range f.AllowTypes {
+		opts = append(opts, AllowType(parseTypeName(key)))
+	}
+	if len(f.IgnoreElements) > 0 {
+		opts = append(opts, IgnoreElements(f.IgnoreElements...))
+	}
+	if len(f.IgnoreAttributes) > 0 {
+		opts = append(opts, IgnoreAttributes(f.IgnoreAttributes...))
+	}
+	if f.XMLPackage != "" {
+		opts = append(opts, XMLPackage(f.XMLPackage))
+	}
+	if f.Optional != "" {
+		style, err := parseOptionalStyle(f.Optional)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, OptionalFields(style))
+	}
+	if f.FollowImports != nil {
+		opts = append(opts, FollowImports(*f.FollowImports))
+	}
+	if f.JSONTags != nil {
+		opts = append(opts, AddJSONTags(*f.JSONTags))
+	}
+	if f.TargetNamespacesOnly != nil {
+		opts = append(opts, TargetNamespacesOnly(*f.TargetNamespacesOnly))
+	}
+	if f.XMLName != nil {
+		opts = append(opts, ApplyXMLNameToTopLevelElementTypes(*f.XMLName))
+	}
+	if f.LosslessNumbers != nil {
+		opts = append(opts, LosslessNumbers(*f.LosslessNumbers))
+	}
+	if f.ExactTimes != nil {
+		opts = append(opts, ExactTimes(*f.ExactTimes))
+	}
+	if f.UseFieldNames != nil {
+		opts = append(opts, fieldNames(*f.UseFieldNames))
+	}
+	return opts, nil
+}
+
+// parseTypeName parses the name of a type in the form used by
+// ConfigFile and the -rename flag. XML names cannot contain a colon,
+// so the last colon separates the namespace from the name.
+func parseTypeName(s string) xml.Name {
+	if i := strings.LastIndex(s, ":"); i >= 0 {
+		return xml.Name{Space: s[:i], Local: s[i+1:]}
+	}
+	return xml.Name{Local: s}
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,281 @@
+package xsdgen
+
+import (
+	"encoding/xml"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/m29h/go-xml/internal/gen"
+	"github.com/m29h/go-xml/xsd"
+)
+
+// A fieldValue is the default or fixed value of the field of an
+// element or attribute. As in XML Schema, the value of an element is
+// set when the element is present and empty, and the value of an
+// attribute is set when the attribute is absent, or when a field with
+// the zero value would be left out of a document by the omitempty
+// option. The fixed value is set the same way, and any other value is
+// an error.
+type fieldValue struct {
+	Name      string // name of the field
+	Tag       string // struct tag of the field
+	Const     string // name of the constant holding the value
+	Zero      string // zero value of the field's type
+	Equal     string // type with an Equal method comparing values, if any
+	Fixed     bool
+	Element   bool   // the field is an element, not an attribute
+	OmitEmpty bool   // the field has the omitempty option
+	Desc      string // element or attribute, for error messages
+
+	field *gen.Field
+	spec  *ast.ValueSpec
+}
+
+// IsZero returns an expression that is true if the field of the
+// struct x has the zero value.
+func (v fieldValue) IsZero(x string) string {
+	if v.Zero == "false" {
+		return "!" + x + "." + v.Name
+	}
+	return x + "." + v.Name + " == " + v.Zero
+}
+
+// IsSet returns an expression that is true if the field of the
+// struct x does not have the zero value.
+func (v fieldValue) IsSet(x string) string {
+	if v.Zero == "false" {
+		return x + "." + v.Name
+	}
+	return x + "." + v.Name + " != " + v.Zero
+}
+
+// Differs returns an expression that is true if the field of the
+// struct x does not have the value of the constant. The values of
+// the xsdDecimal and xsdInteger types are compared numerically, so that
+// 1.0 is the same as 1.00.
+func (v fieldValue) Differs(x string) string {
+	if v.Equal != "" {
+		return fmt.Sprintf("!%[1]s(%[2]s.%[3]s).Equal(%[1]s(%[4]s))", v.Equal, x, v.Name, v.Const)
+	}
+	return x + "." + v.Name + " != " + v.Const
+}
+
+var (
+	decimalLiteral = regexp.MustCompile(`^[+-]?([0-9]+(\.[0-9]*)?|\.[0-9]+)$`)
+	integerLiteral = regexp.MustCompile(`^[+-]?[0-9]+$`)
+)
+
+// valueLiteral returns the Go literal for value, the default or fixed
+// value of an element or attribute of type t, and the literal for the
+// zero value of its type. If values of the type are compared with an
+// Equal method, equal is the name of the type. If the Go type of t
+// cannot be a constant, lit is empty.
+func (cfg *Config) valueLiteral(t xsd.Type, value string) (lit, zero, equal string, err error) {
+	for {
+		if _, ok := cfg.binding(t); ok {
+			return "", "", "", nil
+		}
+		switch v := t.(type) {
+		case *xsd.SimpleType:
+			if v.List {
+				return "", "", "", nil
+			}
+			if len(v.Union) > 0 {
+				// unions are declared as strings
+				return strconv.Quote(value), `""`, "", nil
+			}
+			t = v.Base
+			continue
+		case xsd.Builtin:
+			if name, ok := cfg.losslessType(v); ok {
+				s := strings.TrimSpace(value)
+				pattern, kind := decimalLiteral, "decimal"
+				if name == "xsdInteger" {
+					pattern, kind = integerLiteral, "integer"
+				}
+				if !pattern.MatchString(s) {
+					return "", "", "", fmt.Errorf("invalid %s", kind)
+				}
+				return strconv.Quote(s), `""`, name, nil
+			}
+			ident, ok := builtinExpr(v).(*ast.Ident)
+			if !ok {
+				return "", "", "", nil
+			}
+			lit, zero, err := basicLiteral(ident.Name, value)
+			return lit, zero, "", err
+		}
+		return "", "", "", nil
+	}
+}
+
+// basicLiteral returns the literal of value, and the literal of the
+// zero value, for the basic Go type typ.
+func basicLiteral(typ, value string) (lit, zero string, err error) {
+	s := strings.TrimSpace(value)
+	switch typ {
+	case "string":
+		return strconv.Quote(value), `""`, nil
+	case "bool":
+		switch s {
+		case "true", "1":
+			return "true", "false", nil
+		case "false", "0":
+			return "false", "false", nil
+		}
+		return "", "", fmt.Errorf("invalid boolean %q", value)
+	case "int", "int64":
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return "", "", err
+		}
+		return strconv.FormatInt(n, 10), "0", nil
+	case "byte", "uint", "uint64":
+		bits := 64
+		if typ == "byte" {
+			bits = 8
+		}
+		n, err := strconv.ParseUint(strings.TrimPrefix(s, "+"), 10, bits)
+		if err != nil {
+			return "", "", err
+		}
+		return strconv.FormatUint(n, 10), "0", nil
+	case "float32", "float64":
+		bits := 64
+		if typ == "float32" {
+			bits = 32
+		}
+		f, err := strconv.ParseFloat(s, bits)
+		if err != nil {
+			return "", "", err
+		}
+		// INF and NaN cannot be constants.
+		if math.IsInf(f, 0) || math.IsNaN(f) {
+			return "", "", nil
+		}
+		return strconv.FormatFloat(f, 'g', -1, bits), "0", nil
+	}
+	return "", "", nil
+}
+
+// fieldValue returns the fieldValue for the field of the element or
+// attribute desc of the complex type t, or nil if it has no default or
+// fixed value, or the value cannot be declared as a constant.
+func (cfg *Config) fieldValue(t *xsd.ComplexType, desc string, field *ast.Ident, typ ast.Expr, valueType xsd.Type, def, fixed string) (*fieldValue, error) {
+	value, kind, suffix := def, "default", "Default"
+	if fixed != "" {
+		value, kind, suffix = fixed, "fixed", "Fixed"
+	}
+	if value == "" {
+		return nil, nil
+	}
+	lit, zero, equal, err := cfg.valueLiteral(valueType, value)
+	if err != nil {
+		return nil, fmt.Errorf("%s %s: invalid %s value %q: %v", t.Name.Local, desc, kind, value, err)
+	}
+	if lit == "" {
+		cfg.logf("%s %s: ignoring %s value %q of type %s, which cannot be a constant",
+			t.Name.Local, desc, kind, value, xsd.XMLName(valueType).Local)
+		return nil, nil
+	}
+	name := cfg.typeName(t.Name) + field.Name + suffix
+	return &fieldValue{
+		Name:  field.Name,
+		Const: name,
+		Zero:  zero,
+		Equal: equal,
+		Fixed: fixed != "",
+		Desc:  desc,
+		spec: &ast.ValueSpec{
+			Names:  []*ast.Ident{ast.NewIdent(name)},
+			Type:   typ,
+			Values: []ast.Expr{ast.NewIdent(lit)},
+		},
+	}, nil
+}
+
+// The key of the helper type for the elements of fieldValues. It is
+// not an XML type, so it is in a namespace of its own.
+var defaultName = xml.Name{Space: "github.com/m29h/go-xml/xsdgen", Local: "Default"}
+
+// addDefaultHelpers adds the helper type for the elements of
+// fieldValues to the helper types of cfg. encoding/xml unmarshals an
+// empty element as the zero value, which cannot be told apart from an
+// absent one, so the UnmarshalXML method of a type with such elements
+// uses the helper type in place of their fields.
+func (cfg *Config) addDefaultHelpers() {
+	cfg.helperTypes[defaultName] = spec{
+		name: "xsdDefault",
+		doc: "xsdDefault unmarshals an element with a default or fixed value " +
+			"into Value, a pointer to its field. Present is true if the " +
+			"element is present, and Empty is true if it is also empty, in " +
+			"which case Value is left alone.",
+		expr: &ast.StructType{Fields: &ast.FieldList{List: []*ast.Field{
+			{Names: []*ast.Ident{ast.NewIdent("Value")}, Type: ast.NewIdent("any")},
+			{Names: []*ast.Ident{ast.NewIdent("Present"), ast.NewIdent("Empty")}, Type: ast.NewIdent("bool")},
+		}}},
+		methods: []*ast.FuncDecl{
+			gen.Func("UnmarshalXML").
+				Receiver("x *xsdDefault").
+				Args("d *xml.Decoder", "start xml.StartElement").
+				Returns("error").
+				Comment("UnmarshalXML decodes the character data of the element, " +
+					"which is converted the same way as that of the field.").
+				Body(`
+					x.Present = true
+					if _isNil(start) {
+						return d.Skip()
+					}
+					var text string
+					if err := d.DecodeElement(&text, &start); err != nil {
+						return err
+					}
+					if text == "" {
+						x.Empty = true
+						return nil
+					}
+					var buf bytes.Buffer
+					buf.WriteString("<v>")
+					xml.EscapeText(&buf, []byte(text))
+					buf.WriteString("</v>")
+					return xml.Unmarshal(buf.Bytes(), x.Value)
+				`).MustDecl(),
+		},
+		helperFuncs: []string{"_isNil"},
+	}
+}
+
+// valueDecl returns the declaration of the constants holding the
+// default and fixed values of the fields of the type name.
+func valueDecl(name string, values []fieldValue) *ast.GenDecl {
+	decl := &ast.GenDecl{
+		Doc: gen.CommentGroup("Default and fixed values of the fields of " + name + "."),
+		Tok: token.CONST,
+	}
+	for _, v := range values {
+		decl.Specs = append(decl.Specs, v.spec)
+	}
+	if len(decl.Specs) > 1 {
+		decl.Lparen = 1
+	}
+	return decl
+}
+
+// setDefaults returns the SetDefaults method of the type name, which
+// sets the fields with a default or fixed value to that value.
+func setDefaults(name string, values []fieldValue) *ast.FuncDecl {
+	var body strings.Builder
+	for _, v := range values {
+		fmt.Fprintf(&body, "t.%s = %s\n", v.Name, v.Const)
+	}
+	return gen.Func("SetDefaults").
+		Receiver("t *" + name).
+		Comment("SetDefaults sets the fields of t that have a default or fixed value to that value.").
+		Body(body.String()).
+		MustDecl()
+}
@@ -0,0 +1,339 @@
+package xsdgen
+
+import (
+	"encoding/xml"
+	"go/ast"
+
+	"github.com/m29h/go-xml/internal/gen"
+	"github.com/m29h/go-xml/xsd"
+)
+
+// addDurationHelpers adds the helper types for xs:duration and the
+// xs:dayTimeDuration and xs:yearMonthDuration types of XML Schema 1.1
+// to the helper types of cfg. Unlike the helper types for dates and
+// times, fields are declared with these types, since there is no type
+// in the standard library that can represent a duration in months.
+func (cfg *Config) addDurationHelpers() {
+	duration := spec{
+		name: "xsdDuration",
+		doc: "xsdDuration is an xs:duration value. The sign applies to the " +
+			"duration as a whole; the other fields must not be negative. " +
+			"Fractions of a second beyond nanoseconds are truncated. A zero " +
+			"xsdDuration is marshalled as PT0S.",
+		expr: &ast.StructType{Fields: &ast.FieldList{List: []*ast.Field{
+			{Names: []*ast.Ident{ast.NewIdent("Negative")}, Type: ast.NewIdent("bool")},
+			{Names: []*ast.Ident{ast.NewIdent("Years")}, Type: ast.NewIdent("int")},
+			{Names: []*ast.Ident{ast.NewIdent("Months")}, Type: ast.NewIdent("int")},
+			{Names: []*ast.Ident{ast.NewIdent("Days")}, Type: ast.NewIdent("int")},
+			{Names: []*ast.Ident{ast.NewIdent("Hours")}, Type: ast.NewIdent("int")},
+			{Names: []*ast.Ident{ast.NewIdent("Minutes")}, Type: ast.NewIdent("int")},
+			{Names: []*ast.Ident{ast.NewIdent("Seconds")}, Type: ast.NewIdent("int")},
+			{Names: []*ast.Ident{ast.NewIdent("Nanoseconds")}, Type: ast.NewIdent("int")},
+		}}},
+		private: true,
+		xsdType: xsd.Duration,
+		methods: []*ast.FuncDecl{
+			gen.Func("UnmarshalText").
+				Receiver("d *xsdDuration").
+				Args("text []byte").
+				Returns("error").
+				Body(`
+					s := string(bytes.TrimSpace(text))
+					invalid := fmt.Errorf("invalid duration %%q", s)
+					var v xsdDuration
+					rest := s
+					if strings.HasPrefix(rest, "-") {
+						v.Negative = true
+						rest = rest[1:]
+					}
+					if !strings.HasPrefix(rest, "P") {
+						return invalid
+					}
+					date, clock, hasClock := strings.Cut(rest[1:], "T")
+					if date == "" && !hasClock || hasClock && clock == "" {
+						return invalid
+					}
+					parts := []struct {
+						text, designators string
+						fields            []*int
+					}{
+						{date, "YMD", []*int{&v.Years, &v.Months, &v.Days}},
+						{clock, "HMS", []*int{&v.Hours, &v.Minutes, &v.Seconds}},
+					}
+					for _, p := range parts {
+						for p.text != "" {
+							n := strings.IndexAny(p.text, p.designators)
+							if n <= 0 {
+								return invalid
+							}
+							i := strings.IndexByte(p.designators, p.text[n])
+							num := p.text[:n]
+							if p.text[n] == 'S' {
+								if whole, frac, ok := strings.Cut(num, "."); ok {
+									if frac == "" || strings.Trim(frac, "0123456789") != "" {
+										return invalid
+									}
+									v.Nanoseconds, _ = strconv.Atoi((frac + "000000000")[:9])
+									num = whole
+								}
+							}
+							if num == "" || strings.Trim(num, "0123456789") != "" {
+								return invalid
+							}
+							x, err := strconv.Atoi(num)
+							if err != nil {
+								return invalid
+							}
+							*p.fields[i] = x
+							p.text = p.text[n+1:]
+							p.designators = p.designators[i+1:]
+							p.fields = p.fields[i+1:]
+						}
+					}
+					*d = v
+					return nil
+				`).MustDecl(),
+			gen.Func("MarshalText").
+				Receiver("d xsdDuration").
+				Returns("[]byte", "error").
+				Body(`
+					for _, n := range []int{d.Years, d.Months, d.Days, d.Hours, d.Minutes, d.Seconds, d.Nanoseconds} {
+						if n < 0 {
+							return nil, fmt.Errorf("invalid duration %%+v: negative field", d)
+						}
+					}
+					// The fields are normalized, as long as the
+					// totals fit in an int.
+					mulAdd := func(x, m, y int, ok bool) (int, bool) {
+						if !ok || x > (math.MaxInt-y)/m {
+							return 0, false
+						}
+						return x*m + y, true
+					}
+					months, ok := mulAdd(d.Years, 12, d.Months, true)
+					hours, ok := mulAdd(d.Days, 24, d.Hours, ok)
+					mins, ok := mulAdd(hours, 60, d.Minutes, ok)
+					secs, ok := mulAdd(mins, 60, d.Seconds, ok)
+					secs, ok = mulAdd(secs, 1, d.Nanoseconds/1e9, ok)
+					if !ok {
+						return nil, fmt.Errorf("invalid duration %%+v: too large", d)
+					}
+					nanos := d.Nanoseconds %% 1e9
+					if months == 0 && secs == 0 && nanos == 0 {
+						return []byte("PT0S"), nil
+					}
+					var buf bytes.Buffer
+					if d.Negative {
+						buf.WriteByte('-')
+					}
+					buf.WriteByte('P')
+					if months >= 12 {
+						fmt.Fprintf(&buf, "%%dY", months/12)
+					}
+					if months%%12 != 0 {
+						fmt.Fprintf(&buf, "%%dM", months%%12)
+					}
+					if secs >= 86400 {
+						fmt.Fprintf(&buf, "%%dD", secs/86400)
+					}
+					if secs %%= 86400; secs == 0 && nanos == 0 {
+						return buf.Bytes(), nil
+					}
+					buf.WriteByte('T')
+					if secs >= 3600 {
+						fmt.Fprintf(&buf, "%%dH", secs/3600)
+					}
+					if secs%%3600 >= 60 {
+						fmt.Fprintf(&buf, "%%dM", secs%%3600/60)
+					}
+					if secs%%60 != 0 || nanos != 0 {
+						fmt.Fprintf(&buf, "%%d", secs%%60)
+						if nanos != 0 {
+							buf.WriteString(strings.TrimRight(fmt.Sprintf(".%%09d", nanos), "0"))
+						}
+						buf.WriteByte('S')
+					}
+					return buf.Bytes(), nil
+				`).MustDecl(),
+			gen.Func("Duration").
+				Receiver("d xsdDuration").
+				Returns("time.Duration", "bool").
+				Body(`
+					const limit = math.MaxInt64/1000000000 - 1
+					if d.Years != 0 || d.Months != 0 ||
+						int64(d.Days) > limit/86400 || int64(d.Hours) > limit/3600 ||
+						int64(d.Minutes) > limit/60 || int64(d.Seconds) > limit ||
+						int64(d.Nanoseconds) > limit {
+						return 0, false
+					}
+					secs := int64(d.Days)*86400 + int64(d.Hours)*3600 + int64(d.Minutes)*60 +
+						int64(d.Seconds) + int64(d.Nanoseconds/1e9)
+					if secs > limit {
+						return 0, false
+					}
+					v := time.Duration(secs)*time.Second + time.Duration(d.Nanoseconds%%1e9)
+					if d.Negative {
+						v = -v
+					}
+					return v, true
+				`).MustDecl(),
+			gen.Func("SetDuration").
+				Receiver("d *xsdDuration").
+				Args("v time.Duration").
+				Body(`
+					u := uint64(v)
+					if v < 0 {
+						u = -u
+					}
+					*d = xsdDuration{
+						Negative:    v < 0,
+						Seconds:     int(u / uint64(time.Second)),
+						Nanoseconds: int(u %% uint64(time.Second)),
+					}
+				`).MustDecl(),
+		},
+	}
+	cfg.helperTypes[xsd.XMLName(xsd.Duration)] = duration
+
+	// The XML Schema 1.1 duration types restrict the lexical space
+	// of xs:duration; they are checked after parsing.
+	restricted := []struct {
+		b     xsd.Builtin
+		doc   string
+		check string
+	}{
+		{xsd.DayTimeDuration, "only days, hours, minutes and seconds",
+			`strings.ContainsAny(strings.SplitN(string(text), "T", 2)[0], "YM")`},
+		{xsd.YearMonthDuration, "only years and months",
+			`bytes.ContainsAny(text, "DT")`},
+	}
+	for _, r := range restricted {
+		name := builtinExpr(r.b).(*ast.Ident).Name
+		s := spec{
+			name: name,
+			doc: name + " is an xs:" + xsd.XMLName(r.b).Local + " value, which is " +
+				"an xs:duration with " + r.doc + ".",
+			expr:        ast.NewIdent(duration.name),
+			private:     true,
+			xsdType:     r.b,
+			helperTypes: []xml.Name{xsd.XMLName(xsd.Duration)},
+		}
+		for _, m := range delegateMethods(name, duration) {
+			if m.Name.Name == "UnmarshalText" {
+				m = gen.Func("UnmarshalText").
+					Receiver("t *"+name).
+					Args("text []byte").
+					Returns("error").
+					Body(`
+						if %s {
+							return fmt.Errorf("invalid %s %%q", bytes.TrimSpace(text))
+						}
+						return (*%s)(t).UnmarshalText(text)
+					`, r.check, xsd.XMLName(r.b).Local, duration.name).MustDecl()
+			}
+			s.methods = append(s.methods, m)
+		}
+		cfg.helperTypes[xsd.XMLName(r.b)] = s
+	}
+}
+
+// isDuration returns true if fields of type t are declared with one
+// of the duration helper types, or a type derived from one. Such
+// fields are structs, which encoding/xml never considers empty, so
+// optional ones are declared as pointers to be left out when absent.
+func (cfg *Config) isDuration(t xsd.Type) bool {
+	for {
+		if _, ok := cfg.binding(t); ok {
+			return false
+		}
+		switch v := t.(type) {
+		case *xsd.SimpleType:
+			if v.List || len(v.Union) > 0 {
+				return false
+			}
+			t = v.Base
+		case xsd.Builtin:
+			return v == xsd.Duration || v == xsd.DayTimeDuration || v == xsd.YearMonthDuration
+		default:
+			return false
+		}
+	}
+}
+
+// delegateMethods returns methods for the type name, whose underlying
+// type is that of the helper type, that call the exported methods of
+// the helper type.
+func delegateMethods(name string, helper spec) []*ast.FuncDecl {
+	var result []*ast.FuncDecl
+	for _, m := range helper.methods {
+		if m.Recv == nil || !m.Name.IsExported() {
+			continue
+		}
+		recv := m.Recv.List[0]
+		var (
+			recvType ast.Expr = ast.NewIdent(name)
+			convType ast.Expr = ast.NewIdent(helper.name)
+		)
+		if _, ok := recv.Type.(*ast.StarExpr); ok {
+			recvType = &ast.StarExpr{X: recvType}
+			convType = &ast.ParenExpr{X: &ast.StarExpr{X: convType}}
+		}
+		var args []ast.Expr
+		if m.Type.Params != nil {
+			for _, p := range m.Type.Params.List {
+				for _, n := range p.Names {
+					args = append(args, ast.NewIdent(n.Name))
+				}
+			}
+		}
+		call := &ast.CallExpr{
+			Fun: &ast.SelectorExpr{
+				X:   &ast.CallExpr{Fun: convType, Args: []ast.Expr{ast.NewIdent("t")}},
+				Sel: ast.NewIdent(m.Name.Name),
+			},
+			Args: args,
+		}
+		var stmt ast.Stmt = &ast.ExprStmt{X: call}
+		if m.Type.Results != nil && len(m.Type.Results.List) > 0 {
+			stmt = &ast.ReturnStmt{Results: []ast.Expr{call}}
+		}
+		result = append(result, &ast.FuncDecl{
+			Recv: &ast.FieldList{List: []*ast.Field{{
+				Names: []*ast.Ident{ast.NewIdent("t")},
+				Type:  recvType,
+			}}},
+			Name: ast.NewIdent(m.Name.Name),
+			Type: m.Type,
+			Body: &ast.BlockStmt{List: []ast.Stmt{stmt}},
+		})
+	}
+	return result
+}
+
+// textListMethods sets the bodies of the methods of a list of a
+// helper type that implements encoding.TextMarshaler and
+// encoding.TextUnmarshaler.
+func textListMethods(marshalFn, unmarshalFn *gen.Function, helper string) (*gen.Function, *gen.Function) {
+	marshalFn = marshalFn.Body(`
+		result := make([][]byte, 0, len(*x))
+		for _, v := range *x {
+			b, err := v.MarshalText()
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, b)
+		}
+		return bytes.Join(result, []byte(" ")), nil
+	`)
+	unmarshalFn = unmarshalFn.Body(`
+		for _, v := range bytes.Fields(text) {
+			var item %s
+			if err := item.UnmarshalText(v); err != nil {
+				return err
+			}
+			*x = append(*x, item)
+		}
+		return nil
+	`, helper)
+	return marshalFn, unmarshalFn
+}
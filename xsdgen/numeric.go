@@ -0,0 +1,260 @@
+package xsdgen
+
+import (
+	"go/ast"
+
+	"github.com/m29h/go-xml/internal/gen"
+	"github.com/m29h/go-xml/xsd"
+)
+
+// LosslessNumbers changes the Go types used for xs:decimal and the
+// unbounded integer types, such as xs:integer and
+// xs:nonNegativeInteger, from float64 and int to the unexported types
+// xsdDecimal and xsdInteger, which are declared in the generated code
+// and cannot collide with the names of schema types. Both types hold
+// the text of a value, so that no precision is lost, are validated
+// when unmarshalled, and have methods that return the value as a
+// *big.Rat or *big.Int and that compare values numerically. An empty
+// value is the number zero, and is marshalled as 0. Simple types
+// derived from them check the totalDigits and fractionDigits facets
+// of the schema, and have the same methods. Default and fixed values
+// of these types are declared as string constants.
+func LosslessNumbers(lossless bool) Option {
+	return func(cfg *Config) Option {
+		prev := cfg.losslessNumbers
+		cfg.losslessNumbers = lossless
+		return LosslessNumbers(prev)
+	}
+}
+
+// losslessType returns the name of the helper type used for t if
+// LosslessNumbers is set.
+func (cfg *Config) losslessType(t xsd.Type) (string, bool) {
+	if !cfg.losslessNumbers {
+		return "", false
+	}
+	b, ok := t.(xsd.Builtin)
+	if !ok {
+		return "", false
+	}
+	switch b {
+	case xsd.Decimal:
+		return "xsdDecimal", true
+	case xsd.Integer, xsd.NonNegativeInteger, xsd.PositiveInteger,
+		xsd.NegativeInteger, xsd.NonPositiveInteger:
+		return "xsdInteger", true
+	}
+	return "", false
+}
+
+// losslessExpr returns the expression for the helper type used for
+// t, and records that it is needed.
+func (cfg *Config) losslessExpr(t xsd.Type) (ast.Expr, bool) {
+	name, ok := cfg.losslessType(t)
+	if !ok {
+		return nil, false
+	}
+	cfg.useHelper(t)
+	return ast.NewIdent(name), true
+}
+
+// addLosslessHelpers adds the helper types for LosslessNumbers to
+// the helper types of cfg.
+func (cfg *Config) addLosslessHelpers() {
+	decimal := spec{
+		name: "xsdDecimal",
+		doc: "xsdDecimal is an xs:decimal value. It holds the text of the " +
+			"value, so that no precision is lost. The empty value is zero.",
+		expr:    ast.NewIdent("string"),
+		xsdType: xsd.Decimal,
+		methods: []*ast.FuncDecl{
+			gen.Func("UnmarshalText").
+				Receiver("d *xsdDecimal").
+				Args("text []byte").
+				Returns("error").
+				Body(`return d.parse(text, 0, 0)`).
+				MustDecl(),
+			gen.Func("MarshalText").
+				Receiver("d xsdDecimal").
+				Returns("[]byte", "error").
+				Body(`
+					if d == "" {
+						return []byte("0"), nil
+					}
+					return []byte(d), nil
+				`).MustDecl(),
+			gen.Func("Rat").
+				Receiver("d xsdDecimal").
+				Returns("*big.Rat", "bool").
+				Body(`
+					if d == "" {
+						return new(big.Rat), true
+					}
+					return new(big.Rat).SetString(string(d))
+				`).MustDecl(),
+			gen.Func("Equal").
+				Receiver("d xsdDecimal").
+				Args("v xsdDecimal").
+				Returns("bool").
+				Body(`
+					x, ok1 := d.Rat()
+					y, ok2 := v.Rat()
+					if !ok1 || !ok2 {
+						return d == v
+					}
+					return x.Cmp(y) == 0
+				`).MustDecl(),
+			gen.Func("parse").
+				Receiver("d *xsdDecimal").
+				Args("text []byte", "totalDigits", "fractionDigits int").
+				Returns("error").
+				Body(`
+					s := strings.TrimSpace(string(text))
+					t := strings.TrimLeft(s, "+-")
+					whole, frac, _ := strings.Cut(t, ".")
+					if len(s)-len(t) > 1 || whole+frac == "" || strings.Trim(whole+frac, "0123456789") != "" {
+						return fmt.Errorf("invalid decimal %%q", s)
+					}
+					frac = strings.TrimRight(frac, "0")
+					if n := len(strings.TrimLeft(whole, "0")) + len(frac); totalDigits > 0 && n > totalDigits {
+						return fmt.Errorf("decimal %%s has more than %%d digits", s, totalDigits)
+					}
+					if fractionDigits > 0 && len(frac) > fractionDigits {
+						return fmt.Errorf("decimal %%s has more than %%d fraction digits", s, fractionDigits)
+					}
+					*d = xsdDecimal(s)
+					return nil
+				`).MustDecl(),
+		},
+	}
+	integer := spec{
+		name: "xsdInteger",
+		doc: "xsdInteger is a value of xs:integer or a type derived from it. " +
+			"It holds the text of the value, so that values of any size " +
+			"can be represented. The empty value is zero.",
+		expr:    ast.NewIdent("string"),
+		xsdType: xsd.Integer,
+		methods: []*ast.FuncDecl{
+			gen.Func("UnmarshalText").
+				Receiver("i *xsdInteger").
+				Args("text []byte").
+				Returns("error").
+				Body(`return i.parse(text, 0, 0)`).
+				MustDecl(),
+			gen.Func("MarshalText").
+				Receiver("i xsdInteger").
+				Returns("[]byte", "error").
+				Body(`
+					if i == "" {
+						return []byte("0"), nil
+					}
+					return []byte(i), nil
+				`).MustDecl(),
+			gen.Func("BigInt").
+				Receiver("i xsdInteger").
+				Returns("*big.Int", "bool").
+				Body(`
+					if i == "" {
+						return new(big.Int), true
+					}
+					return new(big.Int).SetString(string(i), 10)
+				`).MustDecl(),
+			gen.Func("Equal").
+				Receiver("i xsdInteger").
+				Args("v xsdInteger").
+				Returns("bool").
+				Body(`
+					x, ok1 := i.BigInt()
+					y, ok2 := v.BigInt()
+					if !ok1 || !ok2 {
+						return i == v
+					}
+					return x.Cmp(y) == 0
+				`).MustDecl(),
+			gen.Func("parse").
+				Receiver("i *xsdInteger").
+				Args("text []byte", "totalDigits", "_ int").
+				Returns("error").
+				Body(`
+					s := strings.TrimSpace(string(text))
+					t := strings.TrimLeft(s, "+-")
+					if len(s)-len(t) > 1 || t == "" || strings.Trim(t, "0123456789") != "" {
+						return fmt.Errorf("invalid integer %%q", s)
+					}
+					if totalDigits > 0 && len(strings.TrimLeft(t, "0")) > totalDigits {
+						return fmt.Errorf("integer %%s has more than %%d digits", s, totalDigits)
+					}
+					*i = xsdInteger(s)
+					return nil
+				`).MustDecl(),
+		},
+	}
+	cfg.helperTypes[xsd.XMLName(xsd.Decimal)] = decimal
+	for _, b := range []xsd.Builtin{xsd.Integer, xsd.NonNegativeInteger,
+		xsd.PositiveInteger, xsd.NegativeInteger, xsd.NonPositiveInteger} {
+		cfg.helperTypes[xsd.XMLName(b)] = integer
+	}
+}
+
+// losslessMethods adds the methods of the helper type for the base
+// of a simple type to the simple type, checking the digits facets of
+// the simple type. A defined type does not have the methods of its
+// underlying type, so the others are forwarded to the helper type.
+func (cfg *Config) losslessMethods(s spec, t *xsd.SimpleType) spec {
+	helper, _ := cfg.losslessType(t.Base)
+	value, result := "Rat", "*big.Rat"
+	if helper == "xsdInteger" {
+		value, result = "BigInt", "*big.Int"
+	}
+	s.methods = append(s.methods, gen.Func("UnmarshalText").
+		Receiver("t *"+s.name).
+		Args("text []byte").
+		Returns("error").
+		Body(`return (*%s)(t).parse(text, %d, %d)`, helper,
+			t.Restriction.TotalDigits, t.Restriction.Precision).
+		MustDecl())
+	s.methods = append(s.methods, gen.Func("MarshalText").
+		Receiver("t "+s.name).
+		Returns("[]byte", "error").
+		Body(`return %s(t).MarshalText()`, helper).
+		MustDecl())
+	s.methods = append(s.methods, gen.Func(value).
+		Receiver("t "+s.name).
+		Returns(result, "bool").
+		Body(`return %s(t).%s()`, helper, value).
+		MustDecl())
+	s.methods = append(s.methods, gen.Func("Equal").
+		Receiver("t "+s.name).
+		Args("v "+s.name).
+		Returns("bool").
+		Body(`return %[1]s(t).Equal(%[1]s(v))`, helper).
+		MustDecl())
+	return s
+}
+
+// losslessListMethods sets the bodies of the methods of a list of
+// the helper type.
+func losslessListMethods(marshalFn, unmarshalFn *gen.Function, helper string) (*gen.Function, *gen.Function) {
+	marshalFn = marshalFn.Body(`
+		result := make([][]byte, 0, len(*x))
+		for _, v := range *x {
+			b, err := v.MarshalText()
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, b)
+		}
+		return bytes.Join(result, []byte(" ")), nil
+	`)
+	unmarshalFn = unmarshalFn.Body(`
+		for _, v := range bytes.Fields(text) {
+			var n %s
+			if err := n.UnmarshalText(v); err != nil {
+				return err
+			}
+			*x = append(*x, n)
+		}
+		return nil
+	`, helper)
+	return marshalFn, unmarshalFn
+}
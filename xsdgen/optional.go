@@ -0,0 +1,259 @@
+package xsdgen
+
+import (
+	"encoding/xml"
+	"fmt"
+	"go/ast"
+
+	"github.com/m29h/go-xml/internal/gen"
+)
+
+// An OptionalStyle determines how the fields of optional and nillable
+// elements, and of optional attributes, are declared.
+type OptionalStyle int
+
+const (
+	// OptionalOmitEmpty declares the fields as plain values with
+	// the omitempty option, so that an absent value cannot be told
+	// apart from a zero value. Elements of complex types, and
+	// elements and attributes of the duration types, which are
+	// structs that encoding/xml does not leave out, are declared as
+	// pointers. This is the default.
+	OptionalOmitEmpty OptionalStyle = iota
+	// OptionalPointer declares the fields as pointers, which are
+	// nil if the element or attribute is absent. Nillable elements
+	// are declared with the generic type Nillable[T], which is
+	// declared in the generated code, and holds a pointer that is
+	// nil if the element has xsi:nil="true", and is marshalled that
+	// way. The fields of nillable elements that are also optional
+	// are pointers to a Nillable[T], so that an absent element can
+	// be told apart from a nil one.
+	OptionalPointer
+	// OptionalGeneric declares the fields with the generic type
+	// Optional[T], which is declared in the generated code, and
+	// records whether a value is present, and whether a nillable
+	// element is nil.
+	OptionalGeneric
+)
+
+// OptionalFields sets the style used for the fields of optional and
+// nillable elements, and of optional attributes. Elements that may
+// occur more than once, and elements and attributes with a default
+// or fixed value, are always declared as plain values, as are fields of the
+// date, time and binary types, unless the ExactTimes option is set.
+func OptionalFields(style OptionalStyle) Option {
+	return func(cfg *Config) Option {
+		prev := cfg.optionalStyle
+		cfg.optionalStyle = style
+		return OptionalFields(prev)
+	}
+}
+
+// parseOptionalStyle parses the name of an OptionalStyle, as used by
+// the -optional flag and ConfigFile.
+func parseOptionalStyle(s string) (OptionalStyle, error) {
+	switch s {
+	case "omitempty":
+		return OptionalOmitEmpty, nil
+	case "pointer":
+		return OptionalPointer, nil
+	case "generic":
+		return OptionalGeneric, nil
+	}
+	return 0, fmt.Errorf("invalid optional style %q; must be omitempty, pointer or generic", s)
+}
+
+// The keys of the helper types for OptionalFields. They are not XML
+// types, so they are in a namespace of their own.
+var (
+	optionalName = xml.Name{Space: "github.com/m29h/go-xml/xsdgen", Local: "Optional"}
+	nillableName = xml.Name{Space: "github.com/m29h/go-xml/xsdgen", Local: "Nillable"}
+)
+
+// optionalExpr returns the type of the field for an optional or
+// nillable element or attribute whose type would otherwise be base.
+func (cfg *Config) optionalExpr(base ast.Expr) ast.Expr {
+	switch cfg.optionalStyle {
+	case OptionalPointer:
+		if _, ok := base.(*ast.StarExpr); ok {
+			return base
+		}
+		return &ast.StarExpr{X: base}
+	case OptionalGeneric:
+		if star, ok := base.(*ast.StarExpr); ok {
+			base = star.X
+		}
+		cfg.namedHelpers[optionalName] = true
+		return &ast.IndexExpr{X: ast.NewIdent("Optional"), Index: base}
+	}
+	return base
+}
+
+// nillableExpr returns the type of the field for a nillable element
+// in the OptionalPointer style. A nil pointer field would be left out
+// by encoding/xml, so the field has a type of its own that is
+// marshalled with xsi:nil="true" in its place.
+func (cfg *Config) nillableExpr(base ast.Expr) ast.Expr {
+	if star, ok := base.(*ast.StarExpr); ok {
+		base = star.X
+	}
+	cfg.namedHelpers[nillableName] = true
+	return &ast.IndexExpr{X: ast.NewIdent("Nillable"), Index: base}
+}
+
+// addOptionalHelpers adds the helper types for OptionalFields to the
+// helper types of cfg.
+func (cfg *Config) addOptionalHelpers() {
+	fns := []*gen.Function{
+		gen.Func("_isNil").
+			Args("start xml.StartElement").
+			Returns("bool").
+			Body(`
+				for _, attr := range start.Attr {
+					if attr.Name.Space == "http://www.w3.org/2001/XMLSchema-instance" && attr.Name.Local == "nil" {
+						return attr.Value == "true" || attr.Value == "1"
+					}
+				}
+				return false
+			`),
+		gen.Func("_marshalNil").
+			Args("e *xml.Encoder", "start xml.StartElement").
+			Returns("error").
+			Body(`
+				start.Attr = append(start.Attr, xml.Attr{
+					Name:  xml.Name{Space: "http://www.w3.org/2001/XMLSchema-instance", Local: "nil"},
+					Value: "true",
+				})
+				if err := e.EncodeToken(start); err != nil {
+					return err
+				}
+				return e.EncodeToken(start.End())
+			`),
+	}
+	for _, fn := range fns {
+		cfg.helperFuncs[fn.Name()] = fn.MustDecl()
+	}
+	typeParams := &ast.FieldList{List: []*ast.Field{{
+		Names: []*ast.Ident{ast.NewIdent("T")},
+		Type:  ast.NewIdent("any"),
+	}}}
+
+	cfg.helperTypes[optionalName] = spec{
+		name: "Optional",
+		doc: "Optional is the value of an optional or nillable element or " +
+			"attribute. Valid is false if the element or attribute is absent, " +
+			"and Nil is true if a nillable element is present with " +
+			`xsi:nil="true".`,
+		typeParams: typeParams,
+		expr: &ast.StructType{Fields: &ast.FieldList{List: []*ast.Field{
+			{Names: []*ast.Ident{ast.NewIdent("Value")}, Type: ast.NewIdent("T")},
+			{Names: []*ast.Ident{ast.NewIdent("Valid")}, Type: ast.NewIdent("bool")},
+			{Names: []*ast.Ident{ast.NewIdent("Nil")}, Type: ast.NewIdent("bool")},
+		}}},
+		methods: []*ast.FuncDecl{
+			gen.Func("MarshalXML").
+				Receiver("o Optional[T]").
+				Args("e *xml.Encoder", "start xml.StartElement").
+				Returns("error").
+				Body(`
+					switch {
+					case o.Nil:
+						return _marshalNil(e, start)
+					case o.Valid:
+						return e.EncodeElement(o.Value, start)
+					}
+					return nil
+				`).MustDecl(),
+			gen.Func("UnmarshalXML").
+				Receiver("o *Optional[T]").
+				Args("d *xml.Decoder", "start xml.StartElement").
+				Returns("error").
+				Body(`
+					*o = Optional[T]{}
+					if _isNil(start) {
+						o.Nil = true
+						return d.Skip()
+					}
+					if err := d.DecodeElement(&o.Value, &start); err != nil {
+						return err
+					}
+					o.Valid = true
+					return nil
+				`).MustDecl(),
+			gen.Func("MarshalXMLAttr").
+				Receiver("o Optional[T]").
+				Args("name xml.Name").
+				Returns("xml.Attr", "error").
+				Body(`
+					if !o.Valid {
+						return xml.Attr{}, nil
+					}
+					if m, ok := any(&o.Value).(encoding.TextMarshaler); ok {
+						text, err := m.MarshalText()
+						return xml.Attr{Name: name, Value: string(text)}, err
+					}
+					return xml.Attr{Name: name, Value: fmt.Sprint(o.Value)}, nil
+				`).MustDecl(),
+			gen.Func("UnmarshalXMLAttr").
+				Receiver("o *Optional[T]").
+				Args("attr xml.Attr").
+				Returns("error").
+				Comment("UnmarshalXMLAttr decodes the value of attr as character " +
+					"data, which is converted the same way as attribute values.").
+				Body(`
+					var buf bytes.Buffer
+					buf.WriteString("<v>")
+					xml.EscapeText(&buf, []byte(attr.Value))
+					buf.WriteString("</v>")
+					*o = Optional[T]{}
+					if err := xml.Unmarshal(buf.Bytes(), &o.Value); err != nil {
+						return err
+					}
+					o.Valid = true
+					return nil
+				`).MustDecl(),
+		},
+		helperFuncs: []string{"_isNil", "_marshalNil"},
+	}
+
+	cfg.helperTypes[nillableName] = spec{
+		name: "Nillable",
+		doc: "Nillable is the value of a nillable element. Value is nil if the " +
+			`element has xsi:nil="true", and a nil Value is marshalled that way. ` +
+			"Optional elements are declared as a *Nillable, which is nil if the " +
+			"element is absent.",
+		typeParams: typeParams,
+		expr: &ast.StructType{Fields: &ast.FieldList{List: []*ast.Field{
+			{Names: []*ast.Ident{ast.NewIdent("Value")}, Type: ast.NewIdent("*T")},
+		}}},
+		methods: []*ast.FuncDecl{
+			gen.Func("MarshalXML").
+				Receiver("n Nillable[T]").
+				Args("e *xml.Encoder", "start xml.StartElement").
+				Returns("error").
+				Body(`
+					if n.Value == nil {
+						return _marshalNil(e, start)
+					}
+					return e.EncodeElement(n.Value, start)
+				`).MustDecl(),
+			gen.Func("UnmarshalXML").
+				Receiver("n *Nillable[T]").
+				Args("d *xml.Decoder", "start xml.StartElement").
+				Returns("error").
+				Body(`
+					n.Value = nil
+					if _isNil(start) {
+						return d.Skip()
+					}
+					v := new(T)
+					if err := d.DecodeElement(v, &start); err != nil {
+						return err
+					}
+					n.Value = v
+					return nil
+				`).MustDecl(),
+		},
+		helperFuncs: []string{"_isNil", "_marshalNil"},
+	}
+}
@@ -0,0 +1,210 @@
+package xsdgen
+
+import (
+	"errors"
+	"go/ast"
+	"go/token"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PackagePath maps the target namespace ns to the Go package with the
+// given import path. Namespaces mapped to a package are generated into
+// their own package by GenPackages, and are referred to by qualified
+// identifiers, such as common.Address, from the packages of other
+// namespaces. An empty importPath removes the mapping for ns.
+func PackagePath(ns, importPath string) Option {
+	return func(cfg *Config) Option {
+		prev, ok := cfg.packages[ns]
+		if importPath == "" {
+			delete(cfg.packages, ns)
+		} else {
+			if cfg.packages == nil {
+				cfg.packages = make(map[string]string)
+			}
+			cfg.packages[ns] = importPath
+		}
+		if !ok {
+			return PackagePath(ns, "")
+		}
+		return PackagePath(ns, prev)
+	}
+}
+
+// GenPackages generates a separate package for each target namespace
+// that has been mapped to an import path with the PackagePath option.
+// The result maps import paths to the code for their package. Types
+// from the namespaces of other packages are referenced, rather than
+// declared, so a package shared by several schema, such as one for
+// common types, is generated only if its namespace is one of the
+// target namespaces; otherwise it is assumed to have been generated
+// already. Types from namespaces without an import path are declared
+// in every package that uses them.
+func (cfg *Config) GenPackages(data ...[]byte) (map[string]*Code, error) {
+	if len(cfg.packages) == 0 {
+		return nil, errors.New("no namespaces are mapped to a package path")
+	}
+	namespaces := cfg.namespaces
+	if len(namespaces) == 0 {
+		namespaces = lookupTargetNS(data...)
+	}
+	names := packageNames(cfg.packages)
+
+	defer cfg.Option(Namespaces(cfg.namespaces...))
+	defer cfg.Option(PackageName(cfg.pkgname))
+	defer func() {
+		cfg.qualifiers, cfg.imported = nil, nil
+	}()
+
+	result := make(map[string]*Code)
+	for _, ns := range namespaces {
+		importPath, ok := cfg.packages[ns]
+		if !ok {
+			cfg.logf("no package path for namespace %q; its types are declared in the packages that use them", ns)
+			continue
+		}
+		cfg.qualifiers = make(map[string]string)
+		for other, p := range cfg.packages {
+			if p != importPath {
+				cfg.qualifiers[other] = names[p]
+			}
+		}
+		cfg.imported = make(map[string]bool)
+		cfg.Option(Namespaces(ns), PackageName(names[importPath]))
+
+		cfg.debugf("generating package %s for namespace %q", importPath, ns)
+		code, err := cfg.GenCode(data...)
+		if err != nil {
+			return nil, err
+		}
+		code.pkgname = names[importPath]
+		for other := range cfg.imported {
+			p := cfg.packages[other]
+			code.imports[p] = names[p]
+		}
+		result[importPath] = code
+	}
+	if len(result) == 0 {
+		return nil, errors.New("none of the target namespaces are mapped to a package path")
+	}
+	return result, nil
+}
+
+// qualifier returns the name of the package that types in the
+// namespace ns are declared in, if it is not the package being
+// generated.
+func (cfg *Config) qualifier(ns string) (string, bool) {
+	q, ok := cfg.qualifiers[ns]
+	return q, ok
+}
+
+// packageNames chooses a unique package name for each of the import
+// paths in packages, based on the last element of the path.
+func packageNames(packages map[string]string) map[string]string {
+	var paths []string
+	seen := make(map[string]bool)
+	for _, p := range packages {
+		if !seen[p] {
+			seen[p] = true
+			paths = append(paths, p)
+		}
+	}
+	sort.Strings(paths)
+
+	names := make(map[string]string)
+	used := make(map[string]bool)
+	for _, p := range paths {
+		base := packageName(p)
+		name := base
+		for i := 2; used[name] || implicitImports[name] != ""; i++ {
+			name = base + strconv.Itoa(i)
+		}
+		used[name] = true
+		names[p] = name
+	}
+	return names
+}
+
+// packageName derives a package name from an import path, by the
+// usual convention of using its last element, or the one before it
+// if the last is a major version suffix such as v2, stripped of any
+// characters that are not allowed in identifiers.
+func packageName(importPath string) string {
+	base := path.Base(importPath)
+	if dir := path.Dir(importPath); dir != "." && majorVersion(base) {
+		base = path.Base(dir)
+	}
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case 'a' <= r && r <= 'z', '0' <= r && r <= '9', r == '_':
+			return r
+		case 'A' <= r && r <= 'Z':
+			return r - 'A' + 'a'
+		}
+		return -1
+	}, base)
+	name = strings.TrimLeft(name, "0123456789_")
+	if name == "" || token.IsKeyword(name) {
+		name = "ns" + name
+	}
+	return name
+}
+
+// majorVersion returns true if elem is the major version suffix of a
+// module path, as in example.org/mod/v2.
+func majorVersion(elem string) bool {
+	if len(elem) < 2 || elem[0] != 'v' || elem[1] == '0' {
+		return false
+	}
+	for _, r := range elem[1:] {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// implicitImports maps the names of the standard packages that the
+// generated code refers to to their import paths. Their imports are
+// added when the source is formatted, so no other import may use
+// these names.
+var implicitImports = map[string]string{
+	"big":     "math/big",
+	"bytes":   "bytes",
+	"errors":  "errors",
+	"fmt":     "fmt",
+	"math":    "math",
+	"regexp":  "regexp",
+	"sort":    "sort",
+	"strconv": "strconv",
+	"strings": "strings",
+	"time":    "time",
+	"xml":     "encoding/xml",
+}
+
+// addImports adds an import declaration for each of the packages in
+// imports, which maps import paths to package names.
+func addImports(file ast.File, imports map[string]string) ast.File {
+	if len(imports) == 0 {
+		return file
+	}
+	paths := make([]string, 0, len(imports))
+	for p := range imports {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	decl := &ast.GenDecl{Tok: token.IMPORT, Lparen: 1}
+	for _, p := range paths {
+		spec := &ast.ImportSpec{
+			Path: &ast.BasicLit{Kind: token.STRING, Value: strconv.Quote(p)},
+		}
+		if name := imports[p]; name != path.Base(p) {
+			spec.Name = ast.NewIdent(name)
+		}
+		decl.Specs = append(decl.Specs, spec)
+	}
+	file.Decls = append([]ast.Decl{decl}, file.Decls...)
+	return file
+}
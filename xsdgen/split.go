@@ -0,0 +1,338 @@
+package xsdgen
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/token"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/m29h/go-xml/internal/gen"
+	"github.com/m29h/go-xml/xmltree"
+	"github.com/m29h/go-xml/xsd"
+)
+
+// A FileGrouping determines how GenFiles distributes the generated
+// declarations across files.
+type FileGrouping int
+
+const (
+	// GroupByNamespace puts the types of each target namespace in
+	// their own file, named after the last segment of the namespace
+	// URI.
+	GroupByNamespace FileGrouping = iota
+	// GroupBySourceFile puts the types declared in each schema file
+	// in a file of the same name. Types whose source is unknown,
+	// such as those generated from data passed to GenCode, are
+	// grouped with the other types of their namespace.
+	GroupBySourceFile
+	// GroupBySize fills files, in the order of the type names,
+	// until they reach the line budget passed to GenFiles.
+	GroupBySize
+)
+
+// HelperFile is the name of the file returned by GenFiles that holds
+// the helper types and functions shared by the generated types.
+const HelperFile = "helpers.go"
+
+// GenFiles is like GenAST, but distributes the generated declarations
+// across multiple files, according to grouping. The result maps file
+// names to their contents. If maxLines is greater than zero, files
+// that would be longer than maxLines are split further, into files
+// with a numeric suffix; a single type declaration and its methods
+// are never split. Helpers shared by the generated types, such as
+// the types for xsd:dateTime, are placed in HelperFile. Every file
+// is passed through the transformation set with the XMLPackage
+// option, if any.
+func (code *Code) GenFiles(grouping FileGrouping, maxLines int) (map[string]*ast.File, error) {
+	if grouping == GroupBySize && maxLines <= 0 {
+		return nil, errors.New("grouping by size requires a maximum number of lines")
+	}
+	keys := code.decls.keys()
+	sort.Strings(keys)
+
+	var (
+		groups  = make(map[string][]ast.Decl)
+		names   = make(map[string]string)
+		order   []string
+		helpers []ast.Decl
+	)
+	add := func(group, name string, decls ...ast.Decl) {
+		if _, ok := groups[group]; !ok {
+			order = append(order, group)
+			names[group] = name
+		}
+		groups[group] = append(groups[group], decls...)
+	}
+	groupOf := code.fileGroups(grouping)
+	for _, name := range keys {
+		info := code.decls[name]
+		decls := []ast.Decl{typeDecl(name, info)}
+		if info.consts != nil {
+			decls = append(decls, info.consts)
+		}
+		for _, f := range info.methods {
+			if f.Recv == nil && code.helpers[f.Name.Name] {
+				helpers = append(helpers, f)
+				continue
+			}
+			decls = append(decls, f)
+		}
+		if code.helpers[name] {
+			helpers = append(helpers, decls...)
+		} else {
+			group, name := groupOf(info)
+			add(group, name, decls...)
+		}
+	}
+
+	result := make(map[string]*ast.File)
+	used := map[string]bool{
+		strings.TrimSuffix(HelperFile, ".go"): true,
+	}
+	for _, group := range order {
+		base := uniqueFileName(used, names[group])
+		for i, decls := range splitDecls(groups[group], maxLines) {
+			name := base
+			if i > 0 {
+				name = uniqueFileName(used, fmt.Sprintf("%s_%d", base, i+1))
+			}
+			result[name+".go"] = code.newFile(decls)
+		}
+	}
+	if len(helpers) > 0 {
+		result[HelperFile] = code.newFile(helpers)
+	}
+	return result, nil
+}
+
+// fileGroups returns a function that returns the group a type
+// declaration belongs in, and the base name of the group's file.
+func (code *Code) fileGroups(grouping FileGrouping) func(spec) (group, name string) {
+	byNamespace := func(info spec) (string, string) {
+		ns := specName(info).Space
+		return "ns:" + ns, namespaceFileName(ns)
+	}
+	switch grouping {
+	case GroupBySize:
+		return func(spec) (string, string) { return "", "types" }
+	case GroupBySourceFile:
+		// Anonymous types, and types added by the user, are
+		// placed in the file that declares the most types of
+		// their namespace.
+		count := make(map[string]map[string]int)
+		for name, src := range code.cfg.sources {
+			if count[name.Space] == nil {
+				count[name.Space] = make(map[string]int)
+			}
+			count[name.Space][src]++
+		}
+		common := make(map[string]string)
+		for ns, srcs := range count {
+			var best string
+			for src, n := range srcs {
+				if n > srcs[best] || n == srcs[best] && src < best {
+					best = src
+				}
+			}
+			common[ns] = best
+		}
+		return func(info spec) (string, string) {
+			name := specName(info)
+			src, ok := code.cfg.sources[name]
+			if !ok {
+				src, ok = common[name.Space]
+			}
+			if ok {
+				return "file:" + src, sourceFileName(src)
+			}
+			return byNamespace(info)
+		}
+	}
+	return byNamespace
+}
+
+func specName(info spec) xml.Name {
+	if info.xsdType == nil {
+		return xml.Name{}
+	}
+	return xsd.XMLName(info.xsdType)
+}
+
+func typeDecl(name string, info spec) *ast.GenDecl {
+	return &ast.GenDecl{
+		Doc: gen.CommentGroup(info.doc),
+		Tok: token.TYPE,
+		Specs: []ast.Spec{
+			&ast.TypeSpec{
+				Name:       ast.NewIdent(name),
+				TypeParams: info.typeParams,
+				Type:       info.expr,
+			},
+		},
+	}
+}
+
+func (code *Code) newFile(decls []ast.Decl) *ast.File {
+	pkgname := code.pkgname
+	if pkgname == "" {
+		pkgname = code.cfg.pkgname
+	}
+	if pkgname == "" {
+		pkgname = "ws"
+	}
+	file := addImports(ast.File{
+		Name:  ast.NewIdent(pkgname),
+		Decls: decls,
+	}, code.imports)
+	if code.cfg.postprocessFile != nil {
+		file = code.cfg.postprocessFile(file)
+	}
+	return &file
+}
+
+// splitDecls splits decls into runs whose formatted source is at
+// most maxLines long. A type declaration is kept in the same run as
+// the constants and methods that follow it.
+func splitDecls(decls []ast.Decl, maxLines int) [][]ast.Decl {
+	if maxLines <= 0 {
+		return [][]ast.Decl{decls}
+	}
+	var (
+		result [][]ast.Decl
+		run    []ast.Decl
+		lines  int
+	)
+	for i := 0; i < len(decls); {
+		j := i + 1
+		for j < len(decls) {
+			if gd, ok := decls[j].(*ast.GenDecl); ok && gd.Tok == token.CONST {
+				j++
+				continue
+			}
+			if fn, ok := decls[j].(*ast.FuncDecl); !ok || fn.Recv == nil {
+				break
+			}
+			j++
+		}
+		n := 0
+		for _, d := range decls[i:j] {
+			n += declLines(d) + 1
+		}
+		if len(run) > 0 && lines+n > maxLines {
+			result = append(result, run)
+			run, lines = nil, 0
+		}
+		run = append(run, decls[i:j]...)
+		lines += n
+		i = j
+	}
+	if len(run) > 0 {
+		result = append(result, run)
+	}
+	return result
+}
+
+// declLines returns the number of lines in the formatted source of a
+// declaration.
+func declLines(decl ast.Decl) int {
+	var buf bytes.Buffer
+	if gd, ok := decl.(*ast.GenDecl); ok && gd.Doc != nil {
+		for _, c := range gd.Doc.List {
+			buf.WriteString(c.Text + "\n")
+		}
+	}
+	if err := format.Node(&buf, token.NewFileSet(), decl); err != nil {
+		return 1
+	}
+	return bytes.Count(buf.Bytes(), []byte("\n")) + 1
+}
+
+// uniqueFileName returns name, or name with a numeric suffix if it
+// has already been used.
+func uniqueFileName(used map[string]bool, name string) string {
+	unique := name
+	for i := 2; used[unique]; i++ {
+		unique = fmt.Sprintf("%s_%d", name, i)
+	}
+	used[unique] = true
+	return unique
+}
+
+// namespaceFileName derives a file name from the last segment of a
+// namespace URI, such as "ubl" for "urn:example:ubl" and "xmldsig"
+// for "http://www.w3.org/2000/09/xmldsig#".
+func namespaceFileName(ns string) string {
+	ns = strings.TrimRight(ns, "/#:")
+	if i := strings.LastIndexAny(ns, "/:"); i >= 0 {
+		ns = ns[i+1:]
+	}
+	return sanitizeFileName(ns)
+}
+
+func sourceFileName(path string) string {
+	base := filepath.Base(path)
+	return sanitizeFileName(strings.TrimSuffix(base, filepath.Ext(base)))
+}
+
+func sanitizeFileName(s string) string {
+	s = strings.Map(func(r rune) rune {
+		switch {
+		case 'a' <= r && r <= 'z', '0' <= r && r <= '9':
+			return r
+		case 'A' <= r && r <= 'Z':
+			return r - 'A' + 'a'
+		}
+		return '_'
+	}, s)
+	s = strings.Trim(s, "_")
+	if s == "" {
+		return "types"
+	}
+	// Avoid names that the go tool treats specially.
+	suffix := s[strings.LastIndex(s, "_")+1:]
+	if suffix == "test" || buildSuffixes[suffix] {
+		s += "_types"
+	}
+	return s
+}
+
+// File name suffixes that act as build constraints.
+var buildSuffixes = make(map[string]bool)
+
+func init() {
+	for _, s := range strings.Fields(`aix android darwin dragonfly freebsd
+		hurd illumos ios js linux nacl netbsd openbsd plan9 solaris wasip1
+		windows zos 386 amd64 amd64p32 arm armbe arm64 arm64be loong64
+		mips mipsle mips64 mips64le mips64p32 mips64p32le ppc ppc64 ppc64le
+		riscv riscv64 s390 s390x sparc sparc64 wasm`) {
+		buildSuffixes[s] = true
+	}
+}
+
+// schemaSources returns the names of the top-level declarations in
+// the schema documents contained in data.
+func schemaSources(data []byte) []xml.Name {
+	tree, err := xmltree.Parse(data)
+	if err != nil {
+		return nil
+	}
+	outer := xmltree.Element{
+		Children: []xmltree.Element{*tree},
+	}
+	var result []xml.Name
+	for _, schema := range outer.Search("http://www.w3.org/2001/XMLSchema", "schema") {
+		ns := schema.Attr("", "targetNamespace")
+		for _, el := range schema.Children {
+			if name := el.Attr("", "name"); name != "" {
+				result = append(result, xml.Name{Space: ns, Local: name})
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,240 @@
+package xsdgen
+
+import (
+	"go/ast"
+
+	"github.com/m29h/go-xml/internal/gen"
+	"github.com/m29h/go-xml/xsd"
+)
+
+// ExactTimes changes the Go types used for the date and time types,
+// such as xs:dateTime and xs:gYear, from time.Time to helper types
+// that are declared in the generated code. The helper types embed a
+// time.Time, and remember whether a value had a time zone, how UTC
+// was spelled, and how many fractional digits its seconds had, so
+// that values are marshalled in the same form they were unmarshalled
+// in. Values without a time zone are not given one, and the date and
+// time types with fewer components, such as xs:gYear, are marshalled
+// with only those components. Years may be negative or have more than
+// four digits, as XML Schema allows; the year 0000 is 1 BCE, as in
+// XML Schema 1.1. The time 24:00:00 is accepted, and is marshalled as
+// 00:00:00 of the following day.
+func ExactTimes(exact bool) Option {
+	return func(cfg *Config) Option {
+		prev := cfg.exactTimes
+		cfg.exactTimes = exact
+		return ExactTimes(prev)
+	}
+}
+
+// The layouts of the date and time types, without fractional seconds
+// or time zones, which are handled separately.
+var exactTimeLayouts = map[xsd.Builtin]string{
+	xsd.Date:       "2006-01-02",
+	xsd.DateTime:   "2006-01-02T15:04:05",
+	xsd.GDay:       "---02",
+	xsd.GMonth:     "--01",
+	xsd.GMonthDay:  "--01-02",
+	xsd.GYear:      "2006",
+	xsd.GYearMonth: "2006-01",
+	xsd.Time:       "15:04:05",
+}
+
+// exactTimeType returns the name of the helper type used for t if
+// ExactTimes is set.
+func (cfg *Config) exactTimeType(t xsd.Type) (string, bool) {
+	if !cfg.exactTimes {
+		return "", false
+	}
+	b, ok := t.(xsd.Builtin)
+	if !ok {
+		return "", false
+	}
+	if _, ok := exactTimeLayouts[b]; !ok {
+		return "", false
+	}
+	return "xsd" + b.String(), true
+}
+
+// exactTimeExpr returns the expression for the helper type used for
+// t, and records that it is needed.
+func (cfg *Config) exactTimeExpr(t xsd.Type) (ast.Expr, bool) {
+	name, ok := cfg.exactTimeType(t)
+	if !ok {
+		return nil, false
+	}
+	cfg.useHelper(t)
+	return ast.NewIdent(name), true
+}
+
+// addExactTimeHelpers replaces the helper types for the date and
+// time types with the helper types for ExactTimes.
+func (cfg *Config) addExactTimeHelpers() {
+	fns := []*gen.Function{
+		gen.Func("_unmarshalExactTime").
+			Args("text []byte", "layout string", "t *time.Time", "noZone *bool", "zone *string", "digits *int").
+			Returns("err error").
+			Body(`
+				s := string(bytes.TrimSpace(text))
+				value, z := s, ""
+				if n := len(s); strings.HasSuffix(s, "Z") {
+					value, z = s[:n-1], "Z"
+				} else if n > 6 && (s[n-6] == '+' || s[n-6] == '-') && s[n-3] == ':' {
+					value, z = s[:n-6], s[n-6:]
+				}
+				// time.Parse only accepts years of four digits, so the
+				// year is parsed here, and replaced by one that has the
+				// same number of days.
+				year, hasYear := 0, strings.HasPrefix(layout, "2006")
+				if hasYear {
+					n := 0
+					if strings.HasPrefix(value, "-") {
+						n = 1
+					}
+					for n < len(value) && '0' <= value[n] && value[n] <= '9' {
+						n++
+					}
+					digits := strings.TrimPrefix(value[:n], "-")
+					if len(digits) < 4 || len(digits) > 9 || len(digits) > 4 && digits[0] == '0' {
+						return fmt.Errorf("invalid year in %%q", s)
+					}
+					year, _ = strconv.Atoi(value[:n])
+					if year%%4 == 0 && (year%%100 != 0 || year%%400 == 0) {
+						value = "2000" + value[n:]
+					} else {
+						value = "2001" + value[n:]
+					}
+				}
+				// 24:00:00 is the end of a day, which is the start of
+				// the next one.
+				endOfDay := false
+				if i := strings.Index(layout, "15"); i >= 0 && len(value) >= i+8 && value[i:i+8] == "24:00:00" {
+					if frac := value[i+8:]; frac == "" || len(frac) > 1 && frac[0] == '.' && strings.Trim(frac[1:], "0") == "" {
+						value = value[:i] + "00" + value[i+2:]
+						endOfDay = true
+					}
+				}
+				if z == "" {
+					*t, err = time.Parse(layout, value)
+				} else {
+					*t, err = time.Parse(layout+"Z07:00", value+z)
+				}
+				if err != nil {
+					return fmt.Errorf("invalid value %%q: %%v", s, err)
+				}
+				if hasYear {
+					*t = time.Date(year, t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+					if endOfDay {
+						*t = t.AddDate(0, 0, 1)
+					}
+				}
+				*noZone, *zone = z == "", z
+				if digits == nil {
+					return nil
+				}
+				*digits = 0
+				if i := strings.LastIndexByte(value, '.'); i >= 0 {
+					*digits = len(value) - i - 1
+				}
+				return nil
+			`),
+		gen.Func("_marshalExactTime").
+			Args("t time.Time", "layout string", "noZone bool", "zone string", "digits int").
+			Returns("[]byte", "error").
+			Body(`
+				b := []byte(t.Format(layout))
+				if digits > 0 {
+					frac := fmt.Sprintf("%%09d", t.Nanosecond())
+					for len(frac) < digits {
+						frac += "0"
+					}
+					b = append(b, '.')
+					b = append(b, frac[:digits]...)
+				} else if digits == 0 && t.Nanosecond() != 0 {
+					b = append(b, strings.TrimRight(fmt.Sprintf(".%%09d", t.Nanosecond()), "0")...)
+				}
+				if noZone {
+					return b, nil
+				}
+				// UTC may be written as Z, +00:00 or -00:00.
+				if _, offset := t.Zone(); offset == 0 && (zone == "Z" || zone == "+00:00" || zone == "-00:00") {
+					return append(b, zone...), nil
+				}
+				return append(b, t.Format("Z07:00")...), nil
+			`),
+	}
+	for _, fn := range fns {
+		cfg.helperFuncs[fn.Name()] = fn.MustDecl()
+	}
+
+	for b, layout := range exactTimeLayouts {
+		name, _ := cfg.exactTimeType(b)
+		fields := []*ast.Field{
+			{Type: ast.NewIdent("time.Time")},
+			{Names: []*ast.Ident{ast.NewIdent("NoZone")}, Type: ast.NewIdent("bool")},
+			{Names: []*ast.Ident{ast.NewIdent("TZ")}, Type: ast.NewIdent("string")},
+		}
+		doc := name + " is an xs:" + xsd.XMLName(b).Local + " value. NoZone is " +
+			"true if the value has no time zone. TZ is the time zone as it " +
+			"was written; if it is a spelling of UTC, such as +00:00, and " +
+			"the time is in UTC, it is marshalled in place of Z."
+		digits, digitsArg := "-1", "nil"
+		if b == xsd.DateTime || b == xsd.Time {
+			fields = append(fields, &ast.Field{
+				Names: []*ast.Ident{ast.NewIdent("Digits")},
+				Type:  ast.NewIdent("int"),
+			})
+			doc += " Digits is the number of fractional digits of the " +
+				"seconds; if it is zero, as many digits as needed are used. " +
+				"Digits beyond nanoseconds are marshalled as zeros."
+			digits, digitsArg = "t.Digits", "&t.Digits"
+		}
+		cfg.helperTypes[xsd.XMLName(b)] = spec{
+			name:    name,
+			doc:     doc,
+			expr:    &ast.StructType{Fields: &ast.FieldList{List: fields}},
+			private: true,
+			xsdType: b,
+			methods: []*ast.FuncDecl{
+				gen.Func("UnmarshalText").
+					Receiver("t *"+name).
+					Args("text []byte").
+					Returns("error").
+					Body(`return _unmarshalExactTime(text, %q, &t.Time, &t.NoZone, &t.TZ, %s)`,
+						layout, digitsArg).
+					MustDecl(),
+				gen.Func("MarshalText").
+					Receiver("t "+name).
+					Returns("[]byte", "error").
+					Body(`return _marshalExactTime(t.Time, %q, t.NoZone, t.TZ, %s)`, layout, digits).
+					MustDecl(),
+				gen.Func("MarshalXML").
+					Receiver("t "+name).
+					Args("e *xml.Encoder", "start xml.StartElement").
+					Returns("error").
+					Body(`
+						if t.IsZero() {
+							return nil
+						}
+						m, err := t.MarshalText()
+						if err != nil {
+							return err
+						}
+						return e.EncodeElement(m, start)
+					`).MustDecl(),
+				gen.Func("MarshalXMLAttr").
+					Receiver("t "+name).
+					Args("name xml.Name").
+					Returns("xml.Attr", "error").
+					Body(`
+						if t.IsZero() {
+							return xml.Attr{}, nil
+						}
+						m, err := t.MarshalText()
+						return xml.Attr{Name: name, Value: string(m)}, err
+					`).MustDecl(),
+			},
+			helperFuncs: []string{"_unmarshalExactTime", "_marshalExactTime"},
+		}
+	}
+}
@@ -5,8 +5,8 @@ import (
 	"encoding/xml"
 	"fmt"
 	"go/ast"
-	"go/token"
 	"io"
+	"reflect"
 	"sort"
 	"strconv"
 	"strings"
@@ -60,6 +60,89 @@ func lookupTargetNS(data ...[]byte) []string {
 	return result
 }
 
+// nameCollisions records the XML types that map to the same
+// Go identifier.
+type nameCollisions map[string]map[xml.Name]bool
+
+func (c nameCollisions) add(ident string, names ...xml.Name) {
+	if c[ident] == nil {
+		c[ident] = make(map[xml.Name]bool)
+	}
+	for _, name := range names {
+		c[ident][name] = true
+	}
+}
+
+func (c nameCollisions) keys() (result []string) {
+	for k := range c {
+		result = append(result, k)
+	}
+	return result
+}
+
+// errors returns an error for each collision, in a stable order.
+func (c nameCollisions) errors() []error {
+	var result []error
+	rangeMap(c, func(ident string) {
+		var names []string
+		for name := range c[ident] {
+			names = append(names, fmt.Sprintf("%q", name.Space+" "+name.Local))
+		}
+		sort.Strings(names)
+		list := strings.Join(names[:len(names)-1], ", ") + " and " + names[len(names)-1]
+		if len(names) > 2 {
+			list += " all"
+		}
+		result = append(result, fmt.Errorf("types %s map to the Go name %s; "+
+			"use the -nsprefix or -rename flags to tell them apart",
+			list, ident))
+	})
+	return result
+}
+
+// sortedNames returns the names of types, sorted by namespace and
+// then by local name.
+func sortedNames(types map[xml.Name]xsd.Type) []xml.Name {
+	names := make([]xml.Name, 0, len(types))
+	for name := range types {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if names[i].Space != names[j].Space {
+			return names[i].Space < names[j].Space
+		}
+		return names[i].Local < names[j].Local
+	})
+	return names
+}
+
+// duplicateTypes returns an error for each name shared by different
+// types, such as anonymous types named after their elements by a
+// ProcessTypes option. Code is generated for only one type of each
+// name, so the others would be lost.
+func duplicateTypes(types map[xml.Name]xsd.Type) []error {
+	var result []error
+	seen := make(map[xml.Name]xsd.Type)
+	for _, key := range sortedNames(types) {
+		t := types[key]
+		name := xsd.XMLName(t)
+		prev, ok := seen[name]
+		if !ok {
+			seen[name] = t
+		} else if !sameType(prev, t) {
+			result = append(result, fmt.Errorf("different types are named %q; "+
+				"use the ProcessTypes option to rename them", name.Space+" "+name.Local))
+		}
+	}
+	return result
+}
+
+// sameType reports whether a and b are the same type. A schema that
+// is parsed more than once yields equal copies of its types.
+func sameType(a, b xsd.Type) bool {
+	return a == b || reflect.DeepEqual(a, b)
+}
+
 type specListing map[string]spec
 
 func (m specListing) keys() (result []string) {
@@ -77,6 +160,12 @@ type Code struct {
 	names map[xml.Name]string
 	decls specListing
 	types map[xml.Name]xsd.Type
+	// names of the helper types and functions shared by
+	// the generated types
+	helpers map[string]bool
+	// set for code generated by GenPackages
+	pkgname string
+	imports map[string]string
 }
 
 // DocType retrieves the complexType for the provided target
@@ -133,11 +222,16 @@ func (c *Code) NameOf(name xml.Name) string {
 
 func (cfg *Config) gen(primaries, deps []xsd.Schema) (*Code, error) {
 	var errList errorList
+	collisions := make(nameCollisions)
+	cfg.boundImports = make(map[string]string)
+	cfg.namedHelpers = make(map[xml.Name]bool)
 
 	code := &Code{
-		cfg:   cfg,
-		names: make(map[xml.Name]string),
-		decls: make(specListing),
+		cfg:     cfg,
+		names:   make(map[xml.Name]string),
+		decls:   make(specListing),
+		helpers: make(map[string]bool),
+		imports: cfg.boundImports,
 	}
 
 	all := make(map[xml.Name]xsd.Type)
@@ -160,8 +254,11 @@ func (cfg *Config) gen(primaries, deps []xsd.Schema) (*Code, error) {
 			prev := primary.Types
 			primary.Types = all
 
-			for name, t := range prev {
-				if t := cfg.preprocessType(primary, t); t != nil {
+			// Processors such as UseFieldNames name types
+			// after the ones they have seen, so the order
+			// must not change between runs.
+			for _, name := range sortedNames(prev) {
+				if t := cfg.preprocessType(primary, prev[name]); t != nil {
 					prev[name] = t
 				}
 			}
@@ -172,6 +269,9 @@ func (cfg *Config) gen(primaries, deps []xsd.Schema) (*Code, error) {
 		}
 	}
 
+	for _, primary := range primaries {
+		errList = append(errList, duplicateTypes(primary.Types)...)
+	}
 	for _, primary := range primaries {
 		cfg.debugf("flattening type hierarchy for schema %q", primary.TargetNS)
 		types := cfg.flatten(primary.Types)
@@ -183,12 +283,16 @@ func (cfg *Config) gen(primaries, deps []xsd.Schema) (*Code, error) {
 					xsd.XMLName(t).Local, err))
 			} else {
 				for _, s := range specs {
+					if prev, ok := code.decls[s.name]; ok && !sameType(prev.xsdType, s.xsdType) {
+						collisions.add(s.name, specName(prev), specName(s))
+					}
 					code.names[xsd.XMLName(s.xsdType)] = s.name
 					code.decls[s.name] = s
 				}
 			}
 		}
 	}
+	errList = append(errList, collisions.errors()...)
 
 	if len(errList) > 0 {
 		return nil, errList
@@ -206,10 +310,14 @@ func (cfg *Config) gen(primaries, deps []xsd.Schema) (*Code, error) {
 		for _, dep := range s.helperTypes {
 			if h, ok := cfg.helperTypes[dep]; ok {
 				code.decls[h.name] = h
+				code.helpers[h.name] = true
 				delete(cfg.helperTypes, dep)
 			}
 		}
 	}
+	if err := cfg.addNamedHelpers(code); err != nil {
+		return nil, err
+	}
 	rangeMap(code.decls, func(t string) {
 		s := code.decls[t]
 		for _, dep := range s.helperFuncs {
@@ -217,6 +325,7 @@ func (cfg *Config) gen(primaries, deps []xsd.Schema) (*Code, error) {
 				cfg.debugf("adding helper function %v for type %v", dep, t)
 				s.methods = append(s.methods, h)
 				code.decls[t] = s
+				code.helpers[dep] = true
 				delete(cfg.helperFuncs, dep)
 			}
 		}
@@ -227,7 +336,7 @@ func (cfg *Config) gen(primaries, deps []xsd.Schema) (*Code, error) {
 // GenAST generates a Go abstract syntax tree with
 // the type declarations contained in the xml schema document.
 func (code *Code) GenAST() (*ast.File, error) {
-	var file ast.File
+	var decls []ast.Decl
 
 	keys := make([]string, 0, len(code.decls))
 	for name := range code.decls {
@@ -236,42 +345,27 @@ func (code *Code) GenAST() (*ast.File, error) {
 	sort.Strings(keys)
 	for _, name := range keys {
 		info := code.decls[name]
-		typeDecl := &ast.GenDecl{
-			Doc: gen.CommentGroup(info.doc),
-			Tok: token.TYPE,
-			Specs: []ast.Spec{
-				&ast.TypeSpec{
-					Name: ast.NewIdent(name),
-					Type: info.expr,
-				},
-			},
-		}
-		file.Decls = append(file.Decls, typeDecl)
+		decls = append(decls, typeDecl(name, info))
+		if info.consts != nil {
+			decls = append(decls, info.consts)
+		}
 		for _, f := range info.methods {
-			file.Decls = append(file.Decls, f)
+			decls = append(decls, f)
 		}
 	}
-	pkgname := code.cfg.pkgname
-	if pkgname == "" {
-		pkgname = "ws"
-	}
-	file.Name = ast.NewIdent(pkgname)
-
-	if code.cfg.postprocessFile != nil {
-		file = code.cfg.postprocessFile(file)
-	}
-
-	return &file, nil
+	return code.newFile(decls), nil
 }
 
 type spec struct {
 	name, doc   string
+	typeParams  *ast.FieldList
 	expr        ast.Expr
 	private     bool
 	methods     []*ast.FuncDecl
 	xsdType     xsd.Type
 	helperTypes []xml.Name
 	helperFuncs []string
+	consts      *ast.GenDecl
 }
 
 // Simplifies complex types derived from other complex types by merging
@@ -378,7 +472,8 @@ func (cfg *Config) flatten(types map[xml.Name]xsd.Type) []xsd.Type {
 	}
 
 	var flattenedTypes = map[xml.Name]xsd.Type{}
-	for _, t := range types {
+	for _, name := range sortedNames(types) {
+		t := types[name]
 		if xsd.XMLName(t).Local == "_self" {
 			continue
 		}
@@ -414,6 +509,9 @@ func (cfg *Config) flatten1(t xsd.Type, flattenedTypes map[xml.Name]xsd.Type, pu
 		return res
 	}
 	flattenedTypes[xsd.XMLName(t)] = t
+	if _, ok := cfg.binding(t); ok {
+		return t
+	}
 
 	const maxDepth = 1000
 	if depth > maxDepth {
@@ -456,7 +554,7 @@ func (cfg *Config) flatten1(t xsd.Type, flattenedTypes map[xml.Name]xsd.Type, pu
 		if t.List || len(t.Union) > 0 {
 			return t
 		}
-		if nonTrivialBuiltin(t.Base) {
+		if cfg.needsHelper(t.Base) {
 			return t
 		}
 
@@ -476,6 +574,14 @@ func (cfg *Config) flatten1(t xsd.Type, flattenedTypes map[xml.Name]xsd.Type, pu
 		if t.Restriction.Length != 0 {
 			t.Doc += "\nMust be exactly " + strconv.Itoa(t.Restriction.Length) + " items long"
 		}
+		if _, ok := cfg.losslessType(t.Base); ok {
+			if t.Restriction.TotalDigits != 0 {
+				t.Doc += "\nMay have no more than " + strconv.Itoa(t.Restriction.TotalDigits) + " digits"
+			}
+			if t.Restriction.Precision != 0 {
+				t.Doc += "\nMay have no more than " + strconv.Itoa(t.Restriction.Precision) + " fraction digits"
+			}
+		}
 		if len(t.Doc) > l {
 			return t
 		}
@@ -504,6 +610,11 @@ func (cfg *Config) flatten1(t xsd.Type, flattenedTypes map[xml.Name]xsd.Type, pu
 				}
 			}
 		}
+		// Types declared in other packages are referenced
+		// by name, so their fields are of no concern.
+		if _, ok := cfg.qualifier(t.Name.Space); ok {
+			return t
+		}
 		// We can flatten a struct field if its type does not
 		// need additional methods for unmarshalling.
 		for i, el := range t.Elements {
@@ -557,6 +668,14 @@ func (cfg *Config) genTypeSpec(t xsd.Type) (result []spec, err error) {
 			return result, nil
 		}
 	}
+	if _, ok := cfg.qualifier(name.Space); ok {
+		cfg.debugf("%q is declared in another package", name.Local)
+		return result, nil
+	}
+	if b, ok := cfg.binding(t); ok {
+		cfg.debugf("%q is bound to %s", name.Local, b)
+		return result, nil
+	}
 
 	cfg.debugf("generating type spec for %q", name.Local)
 
@@ -579,7 +698,6 @@ func (cfg *Config) genTypeSpec(t xsd.Type) (result []spec, err error) {
 type fieldOverride struct {
 	BaseField        *gen.Field
 	FromType, ToType string
-	DefaultValue     string
 	Type             xsd.Type
 	Pointer          string
 	Name             string
@@ -629,6 +747,7 @@ func (cfg *Config) genComplexType(t *xsd.ComplexType) ([]spec, error) {
 	var result []spec
 	var fields []*gen.Field
 	var overrides []fieldOverride
+	var values []fieldValue
 	var helperTypes []xml.Name
 
 	namegen := nameGenerator{cfg, make(map[string]struct{})}
@@ -655,10 +774,11 @@ func (cfg *Config) genComplexType(t *xsd.ComplexType) ([]spec, error) {
 			fields = append(fields, &gen.Field{Name: expr, Type: expr, TagOption: "chardata"})
 		case xsd.Builtin:
 			if b == xsd.AnyType {
-				// extending anyType doesn't really make sense, but
-				// we can just ignore it.
-				cfg.debugf("complexType %s: don't know how to extend anyType, ignoring",
+				// Text mixed with child elements is collected
+				// in a string, without its position among them.
+				cfg.debugf("complexType %s has mixed content, adding chardata struct field Value",
 					t.Name.Local)
+				fields = append(fields, &gen.Field{Name: namegen.unique("Value"), Type: ast.NewIdent("string"), TagOption: "chardata"})
 				break
 			}
 			// Name the field after the xsd type name.
@@ -666,7 +786,7 @@ func (cfg *Config) genComplexType(t *xsd.ComplexType) ([]spec, error) {
 				t.Name.Local, b)
 			name := "Value"
 			f := &gen.Field{Name: namegen.unique(name), Type: expr, TagOption: "chardata"}
-			if nonTrivialBuiltin(b) {
+			if cfg.needsHelper(b) {
 				h, ok := cfg.helperTypes[xsd.XMLName(b)]
 				if !ok {
 					return nil, fmt.Errorf("missing helper type for %v", b)
@@ -731,9 +851,22 @@ func (cfg *Config) genComplexType(t *xsd.ComplexType) ([]spec, error) {
 
 		// optional elements should use pointers
 		_, complex := el.Type.(*xsd.ComplexType)
-		if (el.Nillable || el.Optional) && el.Default == "" && complex {
+		if (el.Nillable || el.Optional) && el.Default == "" && (complex || cfg.isDuration(el.Type)) {
 			base = &ast.StarExpr{X: base}
 		}
+		wrap := cfg.optionalStyle != OptionalOmitEmpty && (el.Nillable || el.Optional) &&
+			!el.Plural && !el.Wildcard && el.Default == "" && el.Fixed == "" &&
+			!cfg.needsHelper(el.Type)
+		switch {
+		case wrap && el.Nillable && !el.Optional && cfg.optionalStyle == OptionalPointer:
+			base = cfg.nillableExpr(base)
+			options = ""
+		case wrap && el.Nillable && cfg.optionalStyle == OptionalPointer:
+			// nil if absent, with a nil Value if xsi:nil is set
+			base = &ast.StarExpr{X: cfg.nillableExpr(base)}
+		case wrap:
+			base = cfg.optionalExpr(base)
+		}
 		name := namegen.element(el.Name)
 		if el.Wildcard {
 			options += ",any"
@@ -752,28 +885,35 @@ func (cfg *Config) genComplexType(t *xsd.ComplexType) ([]spec, error) {
 		}
 		f := &gen.Field{Name: name, Type: base, XmlName: el.Name, TagOption: options}
 		fields = append(fields, f)
-		if el.Default != "" || nonTrivialBuiltin(el.Type) {
-			typeName := cfg.exprString(el.Type)
-			if nonTrivialBuiltin(el.Type) {
-				h, ok := cfg.helperTypes[xsd.XMLName(el.Type)]
-				if !ok {
-					return nil, fmt.Errorf("no helper type for type %v element %v", t.Name, el.Name)
-				}
-				helperTypes = append(helperTypes, xsd.XMLName(el.Type))
-				typeName = h.name
+		if !el.Plural && !el.Wildcard {
+			v, err := cfg.fieldValue(t, "element "+el.Name.Local, name.(*ast.Ident), base, el.Type, el.Default, el.Fixed)
+			if err != nil {
+				return nil, err
+			}
+			if v != nil {
+				v.Element, v.field = true, f
+				v.OmitEmpty = el.Nillable || el.Optional
+				cfg.namedHelpers[defaultName] = true
+				values = append(values, *v)
+			}
+		}
+		if cfg.needsHelper(el.Type) {
+			h, ok := cfg.helperTypes[xsd.XMLName(el.Type)]
+			if !ok {
+				return nil, fmt.Errorf("no helper type for type %v element %v", t.Name, el.Name)
 			}
+			helperTypes = append(helperTypes, xsd.XMLName(el.Type))
 			pointer := "&"
 			if _, isPointer := base.(*ast.StarExpr); isPointer {
 				pointer = ""
 			}
 
 			overrides = append(overrides, fieldOverride{
-				BaseField:    f,
-				DefaultValue: el.Default,
-				FromType:     cfg.exprString(el.Type),
-				ToType:       typeName,
-				Type:         el.Type,
-				Pointer:      pointer,
+				BaseField: f,
+				FromType:  cfg.exprString(el.Type),
+				ToType:    h.name,
+				Type:      el.Type,
+				Pointer:   pointer,
 			})
 		}
 	}
@@ -787,45 +927,59 @@ func (cfg *Config) genComplexType(t *xsd.ComplexType) ([]spec, error) {
 			return nil, fmt.Errorf("%s attribute %s: %v", t.Name.Local, attr.Name.Local, err)
 		}
 
+		if cfg.optionalStyle != OptionalOmitEmpty && attr.Optional &&
+			attr.Default == "" && attr.Fixed == "" && !cfg.needsHelper(attr.Type) {
+			base = cfg.optionalExpr(base)
+		} else if attr.Optional && attr.Default == "" && cfg.isDuration(attr.Type) {
+			base = &ast.StarExpr{X: base}
+		}
+
 		cfg.debugf("adding %s attribute %s as %v", t.Name.Local, attr.Name.Local, base)
 		name := namegen.attribute(attr.Name)
 		f := &gen.Field{Name: name, Type: base, XmlName: attr.Name, TagOption: options}
 		fields = append(fields, f)
-		if attr.Default != "" || nonTrivialBuiltin(attr.Type) {
-			typeName := cfg.exprString(attr.Type)
-			if nonTrivialBuiltin(attr.Type) {
-				h, ok := cfg.helperTypes[xsd.XMLName(attr.Type)]
-				if !ok {
-					return nil, fmt.Errorf("no helper type for type %v attribute %v", t.Name, attr.Name)
-				}
-				typeName = h.name
-				helperTypes = append(helperTypes, xsd.XMLName(attr.Type))
+		v, err := cfg.fieldValue(t, "attribute "+attr.Name.Local, name.(*ast.Ident), base, attr.Type, attr.Default, attr.Fixed)
+		if err != nil {
+			return nil, err
+		}
+		if v != nil {
+			v.OmitEmpty = attr.Optional
+			values = append(values, *v)
+		}
+		if cfg.needsHelper(attr.Type) {
+			h, ok := cfg.helperTypes[xsd.XMLName(attr.Type)]
+			if !ok {
+				return nil, fmt.Errorf("no helper type for type %v attribute %v", t.Name, attr.Name)
 			}
+			helperTypes = append(helperTypes, xsd.XMLName(attr.Type))
 			pointer := "&"
 			if _, isPointer := base.(*ast.StarExpr); isPointer {
 				pointer = ""
 			}
 			overrides = append(overrides, fieldOverride{
-				BaseField:    f,
-				DefaultValue: attr.Default,
-				FromType:     cfg.exprString(attr.Type),
-				ToType:       typeName,
-				Type:         attr.Type,
-				Pointer:      pointer,
+				BaseField: f,
+				FromType:  cfg.exprString(attr.Type),
+				ToType:    h.name,
+				Type:      attr.Type,
+				Pointer:   pointer,
 			})
 		}
 	}
 	expr := gen.Struct(fields, cfg.addJSONTags)
 	s := spec{
 		doc:         t.Doc,
-		name:        cfg.public(t.Name),
+		name:        cfg.typeName(t.Name),
 		expr:        expr,
 		xsdType:     t,
 		helperTypes: helperTypes,
 	}
 
-	if len(overrides) > 0 {
-		unmarshal, marshal, err := cfg.genComplexTypeMethods(t, overrides)
+	if len(values) > 0 {
+		s.consts = valueDecl(s.name, values)
+		s.methods = append(s.methods, setDefaults(s.name, values))
+	}
+	if len(overrides) > 0 || len(values) > 0 {
+		unmarshal, marshal, err := cfg.genComplexTypeMethods(t, overrides, values)
 		if err != nil {
 			return result, err
 		} else {
@@ -841,9 +995,13 @@ func (cfg *Config) genComplexType(t *xsd.ComplexType) ([]spec, error) {
 	return result, nil
 }
 
-func (cfg *Config) genComplexTypeMethods(t *xsd.ComplexType, overrides []fieldOverride) (marshal, unmarshal *ast.FuncDecl, err error) {
+func (cfg *Config) genComplexTypeMethods(t *xsd.ComplexType, overrides []fieldOverride, values []fieldValue) (marshal, unmarshal *ast.FuncDecl, err error) {
 	var data struct {
 		Overrides  []fieldOverride
+		Values     []fieldValue
+		Fixed      bool
+		Elements   bool
+		OmitEmpty  bool
 		Type       string
 		Name       xml.Name
 		XMLNameTag string
@@ -851,11 +1009,20 @@ func (cfg *Config) genComplexTypeMethods(t *xsd.ComplexType, overrides []fieldOv
 	}
 	data.TopLevel = t.TopLevel
 	data.Overrides = overrides
+	data.Values = values
+	for i, v := range values {
+		data.Fixed = data.Fixed || v.Fixed
+		data.Elements = data.Elements || v.Element
+		data.OmitEmpty = data.OmitEmpty || v.OmitEmpty && !v.Element
+		if v.Element {
+			data.Values[i].Tag = v.field.Tag.(*ast.BasicLit).Value
+		}
+	}
 	for i, o := range data.Overrides {
 		data.Overrides[i].Tag = o.BaseField.Tag.(*ast.BasicLit).Value
 		data.Overrides[i].Name = o.BaseField.Name.(*ast.Ident).Name
 	}
-	data.Type = cfg.public(t.Name)
+	data.Type = cfg.typeName(t.Name)
 	data.Name = t.Name
 
 	data.XMLNameTag = fmt.Sprintf("`xml:\"%s %s\"`", t.Name.Space, t.Name.Local)
@@ -872,13 +1039,20 @@ func (cfg *Config) genComplexTypeMethods(t *xsd.ComplexType, overrides []fieldOv
 				{{range .Overrides}}
 				{{.Name}} *{{.ToType}} {{.Tag}}
 				{{end}}
+				{{range .Values}}{{if .Element}}
+				{{.Name}} *xsdDefault {{.Tag}}
+				{{end}}{{end}}
 			}
 			overlay.T = (*T)(t)
 			{{range .Overrides}}
 			overlay.{{.Name}} = (*{{.ToType}})({{.Pointer}}overlay.T.{{.Name}})
-			{{if .DefaultValue}}
-			if *overlay.{{.Name}} == "" {
-				*overlay.{{.Name}} = "{{.DefaultValue}}"
+			{{end}}
+			{{range .Values}}
+			{{if .Element}}
+			overlay.{{.Name}} = &xsdDefault{Value: &overlay.T.{{.Name}}}
+			{{else}}
+			if {{.IsZero "overlay.T"}} {
+				overlay.T.{{.Name}} = {{.Const}}
 			}
 			{{end}}
 			{{end}}
@@ -887,26 +1061,41 @@ func (cfg *Config) genComplexTypeMethods(t *xsd.ComplexType, overrides []fieldOv
 			start.Name.Local = "{{.Name.Local}}"
 			{{end}}
 
+			{{if or .Fixed .Elements}}
+			if err := d.DecodeElement(&overlay, &start); err != nil {
+				return err
+			}
+			{{range .Values}}{{if .Element}}
+			if overlay.{{.Name}}.Empty {
+				overlay.T.{{.Name}} = {{.Const}}
+			}
+			{{end}}{{end}}
+			{{range .Values}}{{if .Fixed}}
+			if {{if .Element}}overlay.{{.Name}}.Present && {{end}}{{.Differs "overlay.T"}} {
+				return fmt.Errorf("{{.Desc}}: %v is not the fixed value %v", overlay.T.{{.Name}}, {{.Const}})
+			}
+			{{end}}{{end}}
+			return nil
+			{{else}}
 			return d.DecodeElement(&overlay, &start)
+			{{end}}
 		`, data).Decl()
 	if err != nil {
 		return nil, nil, err
 	}
 
-	// We don't set defaults in MarshalXML; there's no way to distinguish
-	// an intentional zero value from "no value", and the consumer of the
-	// XML should know what the default is from the XSD.
-	nonDefaultOverrides := make([]fieldOverride, 0, len(overrides))
-	for _, v := range overrides {
-		if nonTrivialBuiltin(v.Type) {
-			nonDefaultOverrides = append(nonDefaultOverrides, v)
-		}
-	}
-	if len(nonDefaultOverrides) == 0 {
+	// Default values of elements, and of required attributes, need
+	// help only to be unmarshalled.
+	if len(overrides) == 0 && !data.OmitEmpty && !data.Fixed {
 		return nil, unmarshal, nil
 	}
 
-	data.Overrides = nonDefaultOverrides
+	// Optional attributes with the zero value are marshalled with
+	// their default or fixed value, since omitempty would leave them
+	// out and they would be unmarshalled with it. Optional elements
+	// with the zero value are left out, since an absent element has
+	// no value, and the zero value of a required field is marshalled
+	// as it is.
 	marshal, err = gen.Func("MarshalXML").
 		Receiver("t *"+data.Type).
 		Args("e *xml.Encoder", "start xml.StartElement").
@@ -919,10 +1108,27 @@ func (cfg *Config) genComplexTypeMethods(t *xsd.ComplexType, overrides []fieldOv
 				{{.Name}} *{{.ToType}} {{.Tag}}
 				{{end -}}
 			}
+			{{- if .OmitEmpty}}
+			v := T(*t)
+			layout.T = &v
+			{{- else}}
 			layout.T = (*T)(t)
+			{{- end}}
 			{{- range .Overrides}}
 			layout.{{.Name}} = (*{{.ToType}})({{.Pointer}}layout.T.{{.Name}})
 			{{end -}}
+			{{- range .Values}}
+			{{- if and .OmitEmpty (not .Element)}}
+			if {{.IsZero "layout.T"}} {
+				layout.T.{{.Name}} = {{.Const}}
+			}
+			{{- end}}
+			{{- if .Fixed}}
+			if {{if and .OmitEmpty .Element}}{{.IsSet "layout.T"}} && {{end}}{{.Differs "layout.T"}} {
+				return fmt.Errorf("{{.Desc}}: %v is not the fixed value %v", layout.T.{{.Name}}, {{.Const}})
+			}
+			{{- end}}
+			{{end -}}
 			{{if .TopLevel}}
 			start.Name.Space = "{{.Name.Space}}"
 			start.Name.Local = "{{.Name.Local}}"
@@ -948,7 +1154,7 @@ func (cfg *Config) genSimpleType(t *xsd.SimpleType) ([]spec, error) {
 		// first.
 		result = append(result, spec{
 			doc:     t.Doc,
-			name:    cfg.public(t.Name),
+			name:    cfg.typeName(t.Name),
 			expr:    builtinExpr(xsd.String),
 			xsdType: t,
 		})
@@ -962,7 +1168,7 @@ func (cfg *Config) genSimpleType(t *xsd.SimpleType) ([]spec, error) {
 
 	spec, err := cfg.addSpecMethods(spec{
 		doc:     t.Doc,
-		name:    cfg.public(t.Name),
+		name:    cfg.typeName(t.Name),
 		expr:    base,
 		xsdType: t,
 	})
@@ -975,7 +1181,20 @@ func (cfg *Config) genSimpleType(t *xsd.SimpleType) ([]spec, error) {
 // Attach Marshal/Unmarshal methods to a simple type, if necessary.
 func (cfg *Config) addSpecMethods(s spec) (spec, error) {
 	t, ok := s.xsdType.(*xsd.SimpleType)
-	if !ok || !nonTrivialBuiltin(t.Base) {
+	if ok {
+		if _, lossless := cfg.losslessType(t.Base); lossless {
+			return cfg.losslessMethods(s, t), nil
+		}
+		if _, exact := cfg.exactTimeType(t.Base); exact || namedBuiltin(t.Base) {
+			helper, ok := cfg.helperTypes[xsd.XMLName(t.Base)]
+			if !ok {
+				return s, fmt.Errorf("no helper type for %v", t.Base)
+			}
+			s.methods = append(s.methods, delegateMethods(s.name, helper)...)
+			return s, nil
+		}
+	}
+	if !ok || !cfg.needsHelper(t.Base) {
 		return s, nil
 	}
 
@@ -1013,7 +1232,7 @@ func (cfg *Config) genSimpleListSpec(t *xsd.SimpleType) ([]spec, error) {
 	}
 	expr = &ast.ArrayType{Elt: expr}
 	s := spec{
-		name:    cfg.public(t.Name),
+		name:    cfg.typeName(t.Name),
 		expr:    expr,
 		xsdType: t,
 	}
@@ -1031,7 +1250,7 @@ func (cfg *Config) genSimpleListSpec(t *xsd.SimpleType) ([]spec, error) {
 	}
 
 	switch base.(xsd.Builtin) {
-	case xsd.ID, xsd.NCName, xsd.NMTOKEN, xsd.Name, xsd.QName, xsd.ENTITY, xsd.AnyURI, xsd.Language, xsd.String, xsd.Token, xsd.XMLLang, xsd.XMLSpace, xsd.XMLBase, xsd.XMLId, xsd.Duration, xsd.NormalizedString, xsd.AnySimpleType:
+	case xsd.ID, xsd.NCName, xsd.NMTOKEN, xsd.Name, xsd.QName, xsd.ENTITY, xsd.AnyURI, xsd.Language, xsd.String, xsd.Token, xsd.XMLLang, xsd.XMLSpace, xsd.XMLBase, xsd.XMLId, xsd.NormalizedString, xsd.AnySimpleType:
 		marshalFn = marshalFn.Body(`
 			result := make([][]byte, 0, len(*x))
 			for _, v := range *x {
@@ -1046,6 +1265,10 @@ func (cfg *Config) genSimpleListSpec(t *xsd.SimpleType) ([]spec, error) {
 			return nil
 		`)
 	case xsd.Date, xsd.DateTime, xsd.GDay, xsd.GMonth, xsd.GMonthDay, xsd.GYear, xsd.GYearMonth, xsd.Time:
+		if helper, ok := cfg.exactTimeType(base); ok {
+			marshalFn, unmarshalFn = textListMethods(marshalFn, unmarshalFn, helper)
+			break
+		}
 		marshalFn = marshalFn.Body(`
 			result := make([][]byte, 0, len(*x))
 			for _, v := range *x {
@@ -1066,6 +1289,9 @@ func (cfg *Config) genSimpleListSpec(t *xsd.SimpleType) ([]spec, error) {
 				*x = append(*x, t)
 			}
 		`, builtinExpr(base.(xsd.Builtin)).(*ast.Ident).Name)
+	case xsd.Duration, xsd.DayTimeDuration, xsd.YearMonthDuration:
+		marshalFn, unmarshalFn = textListMethods(marshalFn, unmarshalFn,
+			builtinExpr(base.(xsd.Builtin)).(*ast.Ident).Name)
 	case xsd.Long:
 		marshalFn = marshalFn.Body(`
 			result := make([][]byte, 0, len(*x))
@@ -1085,6 +1311,10 @@ func (cfg *Config) genSimpleListSpec(t *xsd.SimpleType) ([]spec, error) {
 			return nil
 		`)
 	case xsd.Decimal, xsd.Double:
+		if helper, ok := cfg.losslessType(base); ok {
+			marshalFn, unmarshalFn = losslessListMethods(marshalFn, unmarshalFn, helper)
+			break
+		}
 		marshalFn = marshalFn.Body(`
 			result := make([][]byte, 0, len(*x))
 			for _, v := range *x {
@@ -1103,7 +1333,11 @@ func (cfg *Config) genSimpleListSpec(t *xsd.SimpleType) ([]spec, error) {
 			}
 			return nil
 		`)
-	case xsd.Int, xsd.Integer, xsd.NegativeInteger, xsd.NonNegativeInteger, xsd.NonPositiveInteger, xsd.Short:
+	case xsd.Int, xsd.Integer, xsd.NegativeInteger, xsd.NonNegativeInteger, xsd.NonPositiveInteger, xsd.PositiveInteger, xsd.Short:
+		if helper, ok := cfg.losslessType(base); ok {
+			marshalFn, unmarshalFn = losslessListMethods(marshalFn, unmarshalFn, helper)
+			break
+		}
 		marshalFn = marshalFn.Body(`
 			result := make([][]byte, 0, len(*x))
 			for _, v := range *x {
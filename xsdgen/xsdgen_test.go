@@ -1,9 +1,19 @@
 package xsdgen
 
 import (
+	"encoding/xml"
+	"fmt"
+	"go/ast"
+	"go/token"
 	"os"
+	"path/filepath"
 	"regexp"
+	"sort"
+	"strings"
 	"testing"
+
+	"github.com/m29h/go-xml/internal/gen"
+	"github.com/m29h/go-xml/xsd"
 )
 
 type testLogger testing.T
@@ -78,3 +88,627 @@ func TestSimpleUnion(t *testing.T) {
 func TestImports(t *testing.T) {
 	t.Logf("%s\n", testGen(t, "ns1", "testdata/ns1.xsd"))
 }
+
+// typeNames returns the names of the types declared in files.
+func typeNames(files ...*ast.File) []string {
+	var names []string
+	for _, file := range files {
+		for _, decl := range file.Decls {
+			if gd, ok := decl.(*ast.GenDecl); ok && gd.Tok == token.TYPE {
+				names = append(names, gd.Specs[0].(*ast.TypeSpec).Name.Name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestGenFiles(t *testing.T) {
+	var cfg Config
+	cfg.Option(DefaultOptions...)
+	cfg.Option(LogOutput((*testLogger)(t)))
+	cfg.Option(FollowImports(true))
+	cfg.Option(Namespaces("ns1", "ns2", "common"))
+
+	files, err := cfg.GenFiles(GroupByNamespace, 0, "testdata/ns1.xsd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]string{
+		"ns1.go":    {"CombinedType"},
+		"ns2.go":    {"ReferrableType"},
+		"common.go": {"Complex", "Simple"},
+	}
+	for name, types := range want {
+		if got := typeNames(files[name]); fmt.Sprint(got) != fmt.Sprint(types) {
+			t.Errorf("%s declares %v, want %v", name, got, types)
+		}
+	}
+	if len(files) != len(want) {
+		t.Errorf("got %d files, want %d", len(files), len(want))
+	}
+
+	cfg = Config{}
+	cfg.Option(DefaultOptions...)
+	cfg.Option(LogOutput((*testLogger)(t)))
+	file, err := cfg.GenAST("testdata/library.xsd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	all := typeNames(file)
+
+	cfg = Config{}
+	cfg.Option(DefaultOptions...)
+	cfg.Option(LogOutput((*testLogger)(t)))
+	files, err = cfg.GenFiles(GroupBySize, 20, "testdata/library.xsd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	helpers, ok := files[HelperFile]
+	if !ok {
+		t.Fatalf("no %s in %d files", HelperFile, len(files))
+	}
+	var split []*ast.File
+	for name, file := range files {
+		if name != HelperFile {
+			split = append(split, file)
+		}
+		for _, decl := range file.Decls {
+			if fn, ok := decl.(*ast.FuncDecl); ok && fn.Recv == nil && name != HelperFile {
+				t.Errorf("helper function %s in %s", fn.Name.Name, name)
+			}
+		}
+	}
+	if len(split) < 2 {
+		t.Errorf("got %d files, want types split across several files", len(split))
+	}
+	if got := typeNames(append(split, helpers)...); fmt.Sprint(got) != fmt.Sprint(all) {
+		t.Errorf("split files declare %v, want %v", got, all)
+	}
+}
+
+func TestGenPackages(t *testing.T) {
+	var data [][]byte
+	for _, name := range []string{"ns1.xsd", "ns2.xsd", "common.xsd"} {
+		b, err := os.ReadFile("testdata/" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data = append(data, b)
+	}
+	var cfg Config
+	cfg.Option(DefaultOptions...)
+	cfg.Option(LogOutput((*testLogger)(t)))
+	cfg.Option(Namespaces("ns1", "ns2"))
+	cfg.Option(PackagePath("ns1", "example.org/ns1"))
+	cfg.Option(PackagePath("ns2", "example.org/schema/ns2"))
+	cfg.Option(PackagePath("common", "example.org/common"))
+
+	packages, err := cfg.GenPackages(data...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(packages) != 2 || packages["example.org/common"] != nil {
+		t.Errorf("got %d packages, want ns1 and ns2 only", len(packages))
+	}
+	want := map[string][]string{
+		"example.org/ns1": {
+			"package ns1",
+			`"example.org/common"`,
+			`"example.org/schema/ns2"`,
+			`Typed +common.Simple`,
+			`ReferrableType +ns2.ReferrableType`,
+		},
+		"example.org/schema/ns2": {
+			"package ns2",
+			`Typed +common.Complex`,
+		},
+	}
+	for path, patterns := range want {
+		code, ok := packages[path]
+		if !ok {
+			t.Errorf("no package %s", path)
+			continue
+		}
+		file, err := code.GenAST()
+		if err != nil {
+			t.Fatal(err)
+		}
+		src, err := gen.FormattedSource(file, "fixme.go")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, pattern := range patterns {
+			if !grep(pattern, string(src)) {
+				t.Errorf("%s does not match %s:\n%s", path, pattern, src)
+			}
+		}
+		if grep(`type (Complex|Simple)`, string(src)) {
+			t.Errorf("%s declares types of package common:\n%s", path, src)
+		}
+	}
+}
+
+func TestNameCollisions(t *testing.T) {
+	schema := func(ns string) []byte {
+		return []byte(`<schema xmlns="http://www.w3.org/2001/XMLSchema" targetNamespace="` + ns + `">
+			<complexType name="Address">
+				<sequence><element name="street" type="string"/></sequence>
+			</complexType>
+			<complexType name="Party">
+				<sequence><element name="name" type="string"/></sequence>
+			</complexType>
+		</schema>`)
+	}
+	data := [][]byte{schema("urn:a"), schema("urn:b")}
+	newConfig := func() *Config {
+		var cfg Config
+		cfg.Option(DefaultOptions...)
+		cfg.Option(LogOutput((*testLogger)(t)))
+		return &cfg
+	}
+
+	_, err := newConfig().GenCode(data...)
+	if err == nil {
+		t.Fatal("expected name collisions to be reported")
+	}
+	for _, name := range []string{"Address", "Party"} {
+		if !strings.Contains(err.Error(), "Go name "+name) {
+			t.Errorf("error does not report collision for %s: %v", name, err)
+		}
+	}
+	const msg = `types "urn:a Address" and "urn:b Address" map to the Go name Address; ` +
+		`use the -nsprefix or -rename flags to tell them apart`
+	if !strings.Contains(err.Error(), msg) {
+		t.Errorf("error %q does not contain %q", err, msg)
+	}
+
+	cfg := newConfig()
+	cfg.Option(NamespacePrefix("urn:b", "B"))
+	cfg.Option(RenameType(xml.Name{Space: "urn:a", Local: "Party"}, "Customer"))
+	code, err := cfg.GenCode(data...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := code.GenAST()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"Address", "BAddress", "BParty", "Customer"}
+	if got := typeNames(file); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("got types %v, want %v", got, want)
+	}
+
+	// LIT10054 has two anonymous Comment types, with a maxLength
+	// of 255 and 180, which UseFieldNames must tell apart.
+	const lit = "testdata/LIT10054_WaterQualityMultiReturn.xsd"
+	var first []byte
+	for i := 0; i < 5; i++ {
+		src, err := newConfig().GenSource(lit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if first == nil {
+			first = src
+		} else if string(src) != string(first) {
+			t.Fatal("generated code for LIT10054 differs between runs")
+		}
+	}
+	for _, pattern := range []string{
+		`255 items long\ntype Comment string`,
+		`180 items long\ntype Comment2 string`,
+	} {
+		if !grep(pattern, string(first)) {
+			t.Errorf("generated code for LIT10054 does not match %q", pattern)
+		}
+	}
+
+	// Different types with the same name are reported.
+	cfg = new(Config)
+	cfg.Option(LogOutput((*testLogger)(t)))
+	cfg.Option(ProcessTypes(func(s xsd.Schema, t xsd.Type) xsd.Type {
+		if st, ok := t.(*xsd.SimpleType); ok && st.Anonymous {
+			st.Name.Local = "Comment"
+		}
+		return t
+	}))
+	_, err = cfg.GenSource(lit)
+	if err == nil || !strings.Contains(err.Error(), "different types are named") {
+		t.Errorf("got %v, want an error for the types named Comment", err)
+	}
+}
+
+func TestConfigFile(t *testing.T) {
+	dir := t.TempDir()
+	conf := filepath.Join(dir, "xsdgen.json")
+	err := os.WriteFile(conf, []byte(`{
+		"namespaces": ["ns1", "ns2", "common"],
+		"followImports": true,
+		"prefixes": {"ns2": "N2"},
+		"renames": {"common:Complex": "Composite"},
+		"ignoreElements": ["Simple2"]
+	}`), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	output := filepath.Join(dir, "output.go")
+
+	var cfg Config
+	cfg.Option(DefaultOptions...)
+	cfg.Option(LogOutput((*testLogger)(t)))
+	if err := cfg.GenCLI("-config", conf, "-o", output, "testdata/ns1.xsd"); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, pattern := range []string{
+		`type Composite struct`,
+		`type N2ReferrableType struct`,
+		`Typed +Composite`,
+	} {
+		if !grep(pattern, string(data)) {
+			t.Errorf("generated code does not match %s:\n%s", pattern, data)
+		}
+	}
+	if grep(`Simple2`, string(data)) {
+		t.Errorf("ignored element Simple2 was generated:\n%s", data)
+	}
+
+	os.WriteFile(conf, []byte(`{"namespace": "ns1"}`), 0666)
+	if _, err := ReadConfigFile(conf); err == nil {
+		t.Error("expected error for misspelled field")
+	}
+
+	// useFieldNames: false undoes the UseFieldNames default
+	os.WriteFile(conf, []byte(`{"useFieldNames": false}`), 0666)
+	file, err := ReadConfigFile(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts, err := file.Options()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg = Config{}
+	cfg.Option(DefaultOptions...)
+	cfg.Option(LogOutput((*testLogger)(t)))
+	cfg.Option(opts...)
+	src, err := cfg.GenSource("testdata/LIT10054_WaterQualityMultiReturn.xsd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if grep(`type Comment2 string`, string(src)) {
+		t.Errorf("useFieldNames: false named an anonymous type Comment2:\n%s", src)
+	}
+}
+
+func TestBindType(t *testing.T) {
+	// Bindings of simple types are tested in gentests/bindtype.
+	const ns = "http://example.org/orders"
+	var cfg Config
+	cfg.Option(DefaultOptions...)
+	cfg.Option(LogOutput((*testLogger)(t)))
+	cfg.Option(BindType(xml.Name{Space: ns, Local: "Address"}, "example.org/domain.PostalAddress"))
+	code, err := cfg.GenCode([]byte(`<schema xmlns="http://www.w3.org/2001/XMLSchema"
+		xmlns:o="` + ns + `" targetNamespace="` + ns + `">
+		<complexType name="Address">
+			<sequence><element name="street" type="string"/></sequence>
+		</complexType>
+		<complexType name="Order">
+			<sequence>
+				<element name="shipTo" type="o:Address"/>
+			</sequence>
+		</complexType>
+	</schema>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := code.GenAST()
+	if err != nil {
+		t.Fatal(err)
+	}
+	src, err := gen.FormattedSource(file, "fixme.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pattern := `ShipTo +domain.PostalAddress`; !grep(pattern, string(src)) {
+		t.Errorf("generated code does not match %s:\n%s", pattern, src)
+	}
+	if want := []string{"Order"}; fmt.Sprint(typeNames(file)) != fmt.Sprint(want) {
+		t.Errorf("got types %v, want %v", typeNames(file), want)
+	}
+}
+
+func TestLosslessNumbers(t *testing.T) {
+	const ns = "http://example.org/orders"
+	var cfg Config
+	cfg.Option(DefaultOptions...)
+	cfg.Option(LogOutput((*testLogger)(t)))
+	cfg.Option(LosslessNumbers(true))
+	code, err := cfg.GenCode([]byte(`<schema xmlns="http://www.w3.org/2001/XMLSchema"
+		xmlns:o="` + ns + `" targetNamespace="` + ns + `">
+		<complexType name="Order">
+			<sequence>
+				<element name="count" type="nonNegativeInteger"/>
+				<element name="quantity" type="int"/>
+			</sequence>
+		</complexType>
+	</schema>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := code.GenAST()
+	if err != nil {
+		t.Fatal(err)
+	}
+	src, err := gen.FormattedSource(file, "fixme.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The generated types are tested in gentests/lossless. Types
+	// with a bounded range keep their Go types.
+	for _, pattern := range []string{
+		`Count +xsdInteger`,
+		`Quantity +int`,
+	} {
+		if !grep(pattern, string(src)) {
+			t.Errorf("generated code does not match %s:\n%s", pattern, src)
+		}
+	}
+}
+
+func TestDuration(t *testing.T) {
+	const ns = "http://example.org/jobs"
+	var cfg Config
+	cfg.Option(DefaultOptions...)
+	cfg.Option(LogOutput((*testLogger)(t)))
+	code, err := cfg.GenCode([]byte(`<schema xmlns="http://www.w3.org/2001/XMLSchema"
+		xmlns:j="` + ns + `" targetNamespace="` + ns + `">
+		<simpleType name="Timeout">
+			<restriction base="duration">
+				<pattern value="PT\d+S"/>
+			</restriction>
+		</simpleType>
+		<simpleType name="Steps">
+			<list itemType="dayTimeDuration"/>
+		</simpleType>
+		<complexType name="Job">
+			<sequence>
+				<element name="timeout" type="j:Timeout"/>
+				<element name="period" type="duration"/>
+				<element name="term" type="yearMonthDuration"/>
+				<element name="steps" type="j:Steps"/>
+			</sequence>
+		</complexType>
+	</schema>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := code.GenAST()
+	if err != nil {
+		t.Fatal(err)
+	}
+	src, err := gen.FormattedSource(file, "fixme.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The generated types are tested in gentests/duration.
+	for _, pattern := range []string{
+		`type Timeout xsdDuration`,
+		`Term +xsdYearMonthDuration`,
+	} {
+		if !grep(pattern, string(src)) {
+			t.Errorf("generated code does not match %s:\n%s", pattern, src)
+		}
+	}
+}
+
+func TestExactTimes(t *testing.T) {
+	const ns = "http://example.org/events"
+	var cfg Config
+	cfg.Option(DefaultOptions...)
+	cfg.Option(LogOutput((*testLogger)(t)))
+	cfg.Option(ExactTimes(true))
+	code, err := cfg.GenCode([]byte(`<schema xmlns="http://www.w3.org/2001/XMLSchema"
+		xmlns:e="` + ns + `" targetNamespace="` + ns + `">
+		<simpleType name="Stamp">
+			<restriction base="dateTime">
+				<pattern value=".*Z"/>
+			</restriction>
+		</simpleType>
+		<simpleType name="Years">
+			<list itemType="gYear"/>
+		</simpleType>
+		<complexType name="Event">
+			<sequence>
+				<element name="at" type="dateTime"/>
+				<element name="stamp" type="e:Stamp"/>
+				<element name="years" type="e:Years"/>
+			</sequence>
+			<attribute name="day" type="date"/>
+		</complexType>
+	</schema>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := code.GenAST()
+	if err != nil {
+		t.Fatal(err)
+	}
+	src, err := gen.FormattedSource(file, "fixme.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The generated types are tested in gentests/exacttimes.
+	for _, pattern := range []string{
+		`type Stamp xsdDateTime`,
+		`Day +xsdDate`,
+	} {
+		if !grep(pattern, string(src)) {
+			t.Errorf("generated code does not match %s:\n%s", pattern, src)
+		}
+	}
+	if grep(`UnmarshalXML`, string(src)) {
+		t.Errorf("generated code uses helper types for fields:\n%s", src)
+	}
+}
+
+func TestOptionalFields(t *testing.T) {
+	const ns = "http://example.org/records"
+	schema := []byte(`<schema xmlns="http://www.w3.org/2001/XMLSchema"
+		xmlns:r="` + ns + `" targetNamespace="` + ns + `">
+		<complexType name="Address">
+			<sequence><element name="street" type="string"/></sequence>
+		</complexType>
+		<complexType name="Record">
+			<sequence>
+				<element name="count" type="int" minOccurs="0"/>
+				<element name="rate" type="double" nillable="true"/>
+				<element name="addr" type="r:Address" minOccurs="0"/>
+				<element name="tags" type="string" minOccurs="0" maxOccurs="unbounded"/>
+			</sequence>
+			<attribute name="flag" type="boolean"/>
+			<attribute name="level" type="int" use="required"/>
+		</complexType>
+	</schema>`)
+	// The generated code is tested in gentests/optionalpointer,
+	// gentests/optionalgeneric and gentests/optionalomitempty.
+	tests := []struct {
+		style   OptionalStyle
+		pattern string
+	}{
+		{OptionalOmitEmpty, `Rate +float64 `},
+		{OptionalPointer, `Rate +Nillable\[float64\] `},
+		{OptionalGeneric, `Rate +Optional\[float64\] `},
+	}
+	for _, tt := range tests {
+		var cfg Config
+		cfg.Option(DefaultOptions...)
+		cfg.Option(LogOutput((*testLogger)(t)))
+		cfg.Option(OptionalFields(tt.style))
+		code, err := cfg.GenCode(schema)
+		if err != nil {
+			t.Fatal(err)
+		}
+		file, err := code.GenAST()
+		if err != nil {
+			t.Fatal(err)
+		}
+		src, err := gen.FormattedSource(file, "fixme.go")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !grep(tt.pattern, string(src)) {
+			t.Errorf("style %d: generated code does not match %s:\n%s", tt.style, tt.pattern, src)
+		}
+	}
+}
+
+func TestDefaultValues(t *testing.T) {
+	const ns = "http://example.org/records"
+	schema := []byte(`<schema xmlns="http://www.w3.org/2001/XMLSchema"
+		xmlns:r="` + ns + `" targetNamespace="` + ns + `">
+		<simpleType name="Color">
+			<restriction base="string">
+				<enumeration value="red"/>
+				<enumeration value="blue"/>
+			</restriction>
+		</simpleType>
+		<complexType name="Record">
+			<sequence>
+				<element name="count" type="int" default="5"/>
+				<element name="color" type="r:Color" default="blue"/>
+				<element name="format" type="string" fixed="xml"/>
+				<element name="when" type="date" default="2020-01-01"/>
+			</sequence>
+			<attribute name="version" type="decimal" fixed="1.0"/>
+			<attribute name="enabled" type="boolean" default="true"/>
+		</complexType>
+	</schema>`)
+	tests := []struct {
+		lossless bool
+		patterns []string
+	}{
+		{false, []string{
+			`RecordCountDefault +int += 5`,
+			`RecordColorDefault +Color += "blue"`,
+			`RecordFormatFixed +string += "xml"`,
+			`RecordVersionFixed +float64 += 1\n`,
+			`RecordEnabledDefault +bool += true`,
+			`func \(t \*Record\) SetDefaults\(\)`,
+			`if overlay.Count.Empty {`,
+			`if !layout.T.Enabled {`,
+			`if overlay.Format.Present && overlay.T.Format != RecordFormatFixed {`,
+			`if layout.T.Version != RecordVersionFixed {`,
+		}},
+		{true, []string{
+			`RecordVersionFixed +xsdDecimal += "1.0"`,
+			`!xsdDecimal\(layout.T.Version\).Equal\(xsdDecimal\(RecordVersionFixed\)\)`,
+		}},
+	}
+	var cfg Config
+	for _, tt := range tests {
+		cfg = Config{}
+		cfg.Option(DefaultOptions...)
+		cfg.Option(LogOutput((*testLogger)(t)), LosslessNumbers(tt.lossless))
+		code, err := cfg.GenCode(schema)
+		if err != nil {
+			t.Fatal(err)
+		}
+		file, err := code.GenAST()
+		if err != nil {
+			t.Fatal(err)
+		}
+		src, err := gen.FormattedSource(file, "fixme.go")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, pattern := range tt.patterns {
+			if !grep(pattern, string(src)) {
+				t.Errorf("lossless %t: generated code does not match %s:\n%s", tt.lossless, pattern, src)
+			}
+		}
+		if grep(`RecordWhen`, string(src)) {
+			t.Errorf("generated code has a constant for a date:\n%s", src)
+		}
+	}
+
+	schema = []byte(`<schema xmlns="http://www.w3.org/2001/XMLSchema"
+		targetNamespace="` + ns + `">
+		<complexType name="Record">
+			<attribute name="count" type="int" default="many"/>
+		</complexType>
+	</schema>`)
+	if _, err := cfg.GenCode(schema); err == nil {
+		t.Error("expected an error for an invalid default value")
+	}
+}
+
+func TestRelaxNG(t *testing.T) {
+	data := testGen(t, "http://example.org/library", "testdata/library.rnc")
+	for _, pattern := range []string{
+		`Book +\[\]\*?Book +` + "`" + `xml:"http://example.org/library book,omitempty"`,
+		`Author +\[\]string`,
+		`Isbn +string +` + "`" + `xml:"http://example.org/library isbn,omitempty"`,
+		`Status +Status +` + "`" + `xml:"status,attr"`,
+		`type Tags \[\]string`,
+	} {
+		if !grep(pattern, data) {
+			t.Errorf("generated code does not match %s", pattern)
+		}
+	}
+	t.Logf("%s\n", data)
+
+	var cfg Config
+	cfg.Option(DefaultOptions...)
+	cfg.Option(LogOutput((*testLogger)(t)))
+	src, err := cfg.GenSource("testdata/addressbook.rng")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !grep(`Card +\[\]\*?Card +`+"`"+`xml:"card,omitempty"`, string(src)) {
+		t.Errorf("generated code for schema in no namespace is missing Card field:\n%s", src)
+	}
+}
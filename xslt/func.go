@@ -0,0 +1,341 @@
+package xslt
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/m29h/go-xml/xmltree"
+)
+
+// coreFunctions lists the functions of the XPath core function
+// library, for function-available.
+var coreFunctions = strings.Fields(`last position count id local-name
+	namespace-uri name string concat starts-with contains
+	substring-before substring-after substring string-length
+	normalize-space translate boolean not true false lang number sum
+	floor ceiling round`)
+
+// instructions lists the XSLT instructions, for element-available.
+var instructions = strings.Fields(`apply-imports apply-templates
+	attribute call-template choose comment copy copy-of element fallback
+	for-each if message number processing-instruction text value-of
+	variable`)
+
+// functions returns the functions XSLT adds to the XPath core
+// function library.
+func (t *transformer) functions() map[string]xmltree.XPathFunc {
+	funcs := map[string]xmltree.XPathFunc{
+		"current":             t.fnCurrent,
+		"key":                 t.fnKey,
+		"generate-id":         t.fnGenerateID,
+		"format-number":       t.fnFormatNumber,
+		"system-property":     fnSystemProperty,
+		"element-available":   fnElementAvailable,
+		"function-available":  t.fnFunctionAvailable,
+		"unparsed-entity-uri": fnUnparsedEntityURI,
+		"document":            fnDocument,
+	}
+	for _, name := range t.s.nodeSetFns {
+		funcs[name] = fnNodeSet
+	}
+	return funcs
+}
+
+func checkArgs(name string, args []interface{}, min, max int) error {
+	if len(args) < min || len(args) > max {
+		if min == max {
+			return fmt.Errorf("xslt: %s() requires %d argument(s), got %d", name, min, len(args))
+		}
+		return fmt.Errorf("xslt: %s() requires %d to %d arguments, got %d", name, min, max, len(args))
+	}
+	return nil
+}
+
+// resolveQName expands a QName passed as a string argument to a
+// function, using the namespace bindings of the expression.
+func resolveQName(ctx *xmltree.XPathContext, qname string) (space, local string, err error) {
+	qname = strings.TrimSpace(qname)
+	i := strings.IndexByte(qname, ':')
+	if i < 0 {
+		return "", qname, nil
+	}
+	prefix := qname[:i]
+	if ns, ok := ctx.Env.Namespaces[prefix]; ok {
+		return ns, qname[i+1:], nil
+	}
+	if prefix == "xml" {
+		return xmlNamespace, qname[i+1:], nil
+	}
+	return "", "", fmt.Errorf("xslt: undeclared namespace prefix in %q", qname)
+}
+
+func (t *transformer) fnCurrent(ctx *xmltree.XPathContext, args ...interface{}) (interface{}, error) {
+	if err := checkArgs("current", args, 0, 0); err != nil {
+		return nil, err
+	}
+	if t.current == nil {
+		return []*xmltree.XPathNode{}, nil
+	}
+	return []*xmltree.XPathNode{t.current}, nil
+}
+
+func (t *transformer) fnKey(ctx *xmltree.XPathContext, args ...interface{}) (interface{}, error) {
+	if err := checkArgs("key", args, 2, 2); err != nil {
+		return nil, err
+	}
+	space, local, err := resolveQName(ctx, xmltree.XPathString(args[0]))
+	if err != nil {
+		return nil, err
+	}
+	name := local
+	if space != "" {
+		name = "{" + space + "}" + local
+	}
+	if _, ok := t.s.keys[name]; !ok {
+		return nil, fmt.Errorf("xslt: undefined key %s", xmltree.XPathString(args[0]))
+	}
+	idx, err := t.keyIndex(ctx.Node, name)
+	if err != nil {
+		return nil, err
+	}
+	nodes, ok := args[1].([]*xmltree.XPathNode)
+	if !ok {
+		return idx.lookup(xmltree.XPathString(args[1])), nil
+	}
+	var entries []keyEntry
+	for _, n := range nodes {
+		entries = append(entries, idx.values[n.Value()]...)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].ord < entries[j].ord })
+	result := make([]*xmltree.XPathNode, 0, len(entries))
+	for i, e := range entries {
+		if i == 0 || e.ord != entries[i-1].ord {
+			result = append(result, e.node)
+		}
+	}
+	return result, nil
+}
+
+// A keyIndex maps the values of a key to the nodes of a document
+// that have them.
+type keyIndex struct {
+	values map[string][]keyEntry
+}
+
+type keyEntry struct {
+	// position of the node in document order
+	ord  int
+	node *xmltree.XPathNode
+}
+
+func (idx *keyIndex) lookup(value string) []*xmltree.XPathNode {
+	entries := idx.values[value]
+	result := make([]*xmltree.XPathNode, len(entries))
+	for i, e := range entries {
+		result[i] = e.node
+	}
+	return result
+}
+
+// keyIndex returns the index for the named key in the document that
+// contains n, building it on first use.
+func (t *transformer) keyIndex(n *xmltree.XPathNode, name string) (*keyIndex, error) {
+	root := n
+	for root.Parent() != nil {
+		root = root.Parent()
+	}
+	doc := root.Element()
+	if idx, ok := t.keys[doc][name]; ok {
+		return idx, nil
+	}
+	idx := &keyIndex{values: make(map[string][]keyEntry)}
+	defs := t.s.keys[name]
+	ord := 0
+	var visit func(n *xmltree.XPathNode, depth int) error
+	add := func(n *xmltree.XPathNode) error {
+		ord++
+		for _, def := range defs {
+			ok, err := def.match.matches(t, n)
+			if err != nil || !ok {
+				return err
+			}
+			v, err := def.use.eval(t, &context{node: n, pos: 1, size: 1})
+			if err != nil {
+				return err
+			}
+			values := []string{xmltree.XPathString(v)}
+			if nodes, ok := v.([]*xmltree.XPathNode); ok {
+				values = values[:0]
+				for _, m := range nodes {
+					values = append(values, m.Value())
+				}
+			}
+			for _, value := range values {
+				entries := idx.values[value]
+				if k := len(entries); k > 0 && entries[k-1].ord == ord {
+					continue
+				}
+				idx.values[value] = append(entries, keyEntry{ord, n})
+			}
+		}
+		return nil
+	}
+	visit = func(n *xmltree.XPathNode, depth int) error {
+		if depth > maxDepth {
+			return fmt.Errorf("xslt: document nested too deeply")
+		}
+		if err := add(n); err != nil {
+			return err
+		}
+		for _, a := range n.Attributes() {
+			if err := add(a); err != nil {
+				return err
+			}
+		}
+		for _, c := range n.Children() {
+			if err := visit(c, depth+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := visit(root, 0); err != nil {
+		return nil, err
+	}
+	if t.keys[doc] == nil {
+		t.keys[doc] = make(map[string]*keyIndex)
+	}
+	t.keys[doc][name] = idx
+	return idx, nil
+}
+
+func (t *transformer) fnGenerateID(ctx *xmltree.XPathContext, args ...interface{}) (interface{}, error) {
+	if err := checkArgs("generate-id", args, 0, 1); err != nil {
+		return nil, err
+	}
+	n := ctx.Node
+	if len(args) == 1 {
+		nodes, ok := args[0].([]*xmltree.XPathNode)
+		if !ok {
+			return nil, fmt.Errorf("xslt: argument to generate-id() must be a node-set")
+		}
+		if len(nodes) == 0 {
+			return "", nil
+		}
+		n = nodes[0]
+	}
+	key := nodeID{kind: n.Kind(), el: n.Element()}
+	if parent := n.Parent(); parent != nil && n.Kind() != xmltree.ElementNode {
+		siblings := parent.Children()
+		if n.Kind() == xmltree.AttrNode {
+			siblings = parent.Attributes()
+		}
+		for i, s := range siblings {
+			if s.Same(n) {
+				key.index = i
+			}
+		}
+	}
+	if t.ids == nil {
+		t.ids = make(map[nodeID]int)
+	}
+	id, ok := t.ids[key]
+	if !ok {
+		id = len(t.ids) + 1
+		t.ids[key] = id
+	}
+	return fmt.Sprintf("id%d", id), nil
+}
+
+// A nodeID identifies a node for generate-id.
+type nodeID struct {
+	kind  xmltree.NodeKind
+	el    *xmltree.Element
+	index int
+}
+
+func fnSystemProperty(ctx *xmltree.XPathContext, args ...interface{}) (interface{}, error) {
+	if err := checkArgs("system-property", args, 1, 1); err != nil {
+		return nil, err
+	}
+	space, local, err := resolveQName(ctx, xmltree.XPathString(args[0]))
+	if err != nil {
+		return nil, err
+	}
+	if space != Namespace {
+		return "", nil
+	}
+	switch local {
+	case "version":
+		return 1.0, nil
+	case "vendor":
+		return "go-xml", nil
+	case "vendor-url":
+		return "https://github.com/m29h/go-xml", nil
+	}
+	return "", nil
+}
+
+func fnElementAvailable(ctx *xmltree.XPathContext, args ...interface{}) (interface{}, error) {
+	if err := checkArgs("element-available", args, 1, 1); err != nil {
+		return nil, err
+	}
+	space, local, err := resolveQName(ctx, xmltree.XPathString(args[0]))
+	if err != nil {
+		return nil, err
+	}
+	if space != Namespace {
+		return false, nil
+	}
+	for _, name := range instructions {
+		if name == local {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (t *transformer) fnFunctionAvailable(ctx *xmltree.XPathContext, args ...interface{}) (interface{}, error) {
+	if err := checkArgs("function-available", args, 1, 1); err != nil {
+		return nil, err
+	}
+	name := strings.TrimSpace(xmltree.XPathString(args[0]))
+	if name == "document" {
+		return false, nil
+	}
+	if _, ok := t.funcs[name]; ok {
+		return true, nil
+	}
+	for _, fn := range coreFunctions {
+		if fn == name {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func fnUnparsedEntityURI(ctx *xmltree.XPathContext, args ...interface{}) (interface{}, error) {
+	if err := checkArgs("unparsed-entity-uri", args, 1, 1); err != nil {
+		return nil, err
+	}
+	return "", nil
+}
+
+func fnDocument(ctx *xmltree.XPathContext, args ...interface{}) (interface{}, error) {
+	return nil, fmt.Errorf("xslt: document() is not supported")
+}
+
+// fnNodeSet implements the EXSLT node-set function. Result tree
+// fragments are already node-sets, so its argument is returned as is.
+func fnNodeSet(ctx *xmltree.XPathContext, args ...interface{}) (interface{}, error) {
+	if err := checkArgs("node-set", args, 1, 1); err != nil {
+		return nil, err
+	}
+	if nodes, ok := args[0].([]*xmltree.XPathNode); ok {
+		return nodes, nil
+	}
+	el := xmltree.NewElement("", "fragment")
+	el.SetText(xmltree.XPathString(args[0]))
+	return el.XPathNode().Children(), nil
+}
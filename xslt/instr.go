@@ -0,0 +1,1009 @@
+package xslt
+
+import (
+	"encoding/xml"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/m29h/go-xml/xmltree"
+)
+
+// An instruction is a compiled element or text node from the body
+// of a template.
+type instruction interface {
+	exec(t *transformer, ctx *context, out *node) error
+}
+
+// compileBody compiles the content of a template or instruction.
+func (c *compiler) compileBody(nodes []contentNode) ([]instruction, error) {
+	var body []instruction
+	for _, n := range nodes {
+		if n.el == nil {
+			body = append(body, textInstr(n.text))
+			continue
+		}
+		instr, err := c.instruction(n.el)
+		if err != nil {
+			return nil, err
+		}
+		if instr != nil {
+			body = append(body, instr)
+		}
+	}
+	return body, nil
+}
+
+func (c *compiler) instruction(el *xmltree.Element) (instruction, error) {
+	if el.Name.Space != Namespace {
+		return c.literal(el)
+	}
+	attr := func(name string) string { return el.Attr("", name) }
+	required := func(name string) (string, error) {
+		v := attr(name)
+		if v == "" {
+			return "", errorf(el, "missing %s attribute", name)
+		}
+		return v, nil
+	}
+	body := func() ([]instruction, error) {
+		return c.compileBody(contentOf(el, false))
+	}
+	switch el.Name.Local {
+	case "apply-templates":
+		a := &applyTemplates{mode: expandedName(el, attr("mode"))}
+		sel := attr("select")
+		if sel == "" {
+			sel = "child::node()"
+		}
+		var err error
+		if a.sel, err = compileExpr(sel, el); err != nil {
+			return nil, err
+		}
+		if a.sorts, a.params, err = c.sortsAndParams(el); err != nil {
+			return nil, err
+		}
+		return a, nil
+	case "call-template":
+		name, err := required("name")
+		if err != nil {
+			return nil, err
+		}
+		call := &callTemplate{name: expandedName(el, name), el: el}
+		if _, call.params, err = c.sortsAndParams(el); err != nil {
+			return nil, err
+		}
+		return call, nil
+	case "apply-imports":
+		return applyImports{}, nil
+	case "for-each":
+		sel, err := required("select")
+		if err != nil {
+			return nil, err
+		}
+		f := new(forEach)
+		if f.sel, err = compileExpr(sel, el); err != nil {
+			return nil, err
+		}
+		nodes := contentOf(el, false)
+		for len(nodes) > 0 && nodes[0].el != nil && isXSL(nodes[0].el, "sort") {
+			s, err := c.sort(nodes[0].el)
+			if err != nil {
+				return nil, err
+			}
+			f.sorts = append(f.sorts, s)
+			nodes = nodes[1:]
+		}
+		if f.body, err = c.compileBody(nodes); err != nil {
+			return nil, err
+		}
+		return f, nil
+	case "value-of":
+		sel, err := required("select")
+		if err != nil {
+			return nil, err
+		}
+		x, err := compileExpr(sel, el)
+		if err != nil {
+			return nil, err
+		}
+		return &valueOf{x}, nil
+	case "copy-of":
+		sel, err := required("select")
+		if err != nil {
+			return nil, err
+		}
+		x, err := compileExpr(sel, el)
+		if err != nil {
+			return nil, err
+		}
+		return &copyOf{x}, nil
+	case "copy":
+		b, err := body()
+		if err != nil {
+			return nil, err
+		}
+		return &copyInstr{useSets: qnames(el, attr("use-attribute-sets")), body: b}, nil
+	case "if":
+		test, err := required("test")
+		if err != nil {
+			return nil, err
+		}
+		x, err := compileExpr(test, el)
+		if err != nil {
+			return nil, err
+		}
+		b, err := body()
+		if err != nil {
+			return nil, err
+		}
+		return &ifInstr{test: x, body: b}, nil
+	case "choose":
+		ch := new(choose)
+		for i := range el.Children {
+			child := &el.Children[i]
+			switch {
+			case isXSL(child, "when") && !ch.hasOtherwise:
+				test := child.Attr("", "test")
+				if test == "" {
+					return nil, errorf(child, "missing test attribute")
+				}
+				x, err := compileExpr(test, child)
+				if err != nil {
+					return nil, err
+				}
+				b, err := c.compileBody(contentOf(child, false))
+				if err != nil {
+					return nil, err
+				}
+				ch.when = append(ch.when, &ifInstr{test: x, body: b})
+			case isXSL(child, "otherwise") && !ch.hasOtherwise:
+				b, err := c.compileBody(contentOf(child, false))
+				if err != nil {
+					return nil, err
+				}
+				ch.otherwise, ch.hasOtherwise = b, true
+			default:
+				return nil, errorf(child, "unexpected element in xsl:choose")
+			}
+		}
+		if len(ch.when) == 0 {
+			return nil, errorf(el, "xsl:choose requires at least one xsl:when")
+		}
+		return ch, nil
+	case "variable":
+		v, err := c.variable(el)
+		if err != nil {
+			return nil, err
+		}
+		return &variableInstr{v}, nil
+	case "param":
+		return nil, errorf(el, "xsl:param must be at the start of a template")
+	case "text":
+		var buf strings.Builder
+		for _, n := range el.ContentNodes() {
+			if n.Kind == xmltree.TextNode || n.Kind == xmltree.CDATANode {
+				buf.Write(n.Data)
+			}
+		}
+		return textInstr(buf.String()), nil
+	case "element":
+		name, err := required("name")
+		if err != nil {
+			return nil, err
+		}
+		e := &elementInstr{scope: el, useSets: qnames(el, attr("use-attribute-sets"))}
+		if e.name, err = parseAVT(name, el); err != nil {
+			return nil, err
+		}
+		if ns := el.Attr("", "namespace"); ns != "" || hasAttr(el, "namespace") {
+			if e.namespace, err = parseAVT(ns, el); err != nil {
+				return nil, err
+			}
+		}
+		if e.body, err = body(); err != nil {
+			return nil, err
+		}
+		return e, nil
+	case "attribute":
+		name, err := required("name")
+		if err != nil {
+			return nil, err
+		}
+		a := &attributeInstr{scope: el}
+		if a.name, err = parseAVT(name, el); err != nil {
+			return nil, err
+		}
+		if hasAttr(el, "namespace") {
+			if a.namespace, err = parseAVT(attr("namespace"), el); err != nil {
+				return nil, err
+			}
+		}
+		if a.body, err = body(); err != nil {
+			return nil, err
+		}
+		return a, nil
+	case "comment":
+		b, err := body()
+		if err != nil {
+			return nil, err
+		}
+		return &commentInstr{b}, nil
+	case "processing-instruction":
+		name, err := required("name")
+		if err != nil {
+			return nil, err
+		}
+		pi := new(procInstInstr)
+		if pi.name, err = parseAVT(name, el); err != nil {
+			return nil, err
+		}
+		if pi.body, err = body(); err != nil {
+			return nil, err
+		}
+		return pi, nil
+	case "number":
+		return c.number(el)
+	case "message":
+		b, err := body()
+		if err != nil {
+			return nil, err
+		}
+		return &message{terminate: strings.TrimSpace(attr("terminate")) == "yes", body: b}, nil
+	case "fallback":
+		return nil, nil
+	case "sort", "with-param", "when", "otherwise":
+		return nil, errorf(el, "misplaced instruction")
+	}
+	if c.forwardsCompatible(el) {
+		// Unknown instructions are replaced by their
+		// xsl:fallback children.
+		var body []instruction
+		for i := range el.Children {
+			if isXSL(&el.Children[i], "fallback") {
+				b, err := c.compileBody(contentOf(&el.Children[i], false))
+				if err != nil {
+					return nil, err
+				}
+				body = append(body, b...)
+			}
+		}
+		return sequence(body), nil
+	}
+	return nil, errorf(el, "unknown instruction")
+}
+
+func hasAttr(el *xmltree.Element, local string) bool {
+	for _, a := range el.StartElement.Attr {
+		if a.Name.Space == "" && a.Name.Local == local {
+			return true
+		}
+	}
+	return false
+}
+
+// sortsAndParams compiles the xsl:sort and xsl:with-param children of
+// xsl:apply-templates and xsl:call-template.
+func (c *compiler) sortsAndParams(el *xmltree.Element) ([]*sortKey, []*variable, error) {
+	var sorts []*sortKey
+	var params []*variable
+	for i := range el.Children {
+		child := &el.Children[i]
+		switch {
+		case isXSL(child, "sort"):
+			s, err := c.sort(child)
+			if err != nil {
+				return nil, nil, err
+			}
+			sorts = append(sorts, s)
+		case isXSL(child, "with-param"):
+			v, err := c.variable(child)
+			if err != nil {
+				return nil, nil, err
+			}
+			params = append(params, v)
+		default:
+			return nil, nil, errorf(child, "unexpected element")
+		}
+	}
+	return sorts, params, nil
+}
+
+func (c *compiler) literal(el *xmltree.Element) (instruction, error) {
+	lre := &literal{name: el.Name}
+	if q := el.Prefix(el.Name); strings.Contains(q, ":") {
+		lre.prefix = q[:strings.IndexByte(q, ':')]
+	}
+	excluded := c.excluded(el)
+	for prefix, ns := range el.Namespaces() {
+		if ns == "" || ns == Namespace || excluded[ns] {
+			continue
+		}
+		lre.ns = append(lre.ns, xml.Name{Space: ns, Local: prefix})
+	}
+	sort.Slice(lre.ns, func(i, j int) bool { return lre.ns[i].Local < lre.ns[j].Local })
+	for _, a := range el.StartElement.Attr {
+		if a.Name.Space == Namespace {
+			if a.Name.Local == "use-attribute-sets" {
+				lre.useSets = qnames(el, a.Value)
+			}
+			continue
+		}
+		value, err := parseAVT(a.Value, el)
+		if err != nil {
+			return nil, err
+		}
+		prefix := ""
+		if a.Name.Space != "" {
+			for p, ns := range el.Namespaces() {
+				if ns == a.Name.Space && p != "" && (prefix == "" || p < prefix) {
+					prefix = p
+				}
+			}
+		}
+		lre.attrs = append(lre.attrs, literalAttr{name: a.Name, prefix: prefix, value: value})
+	}
+	c.stack = append(c.stack, el)
+	body, err := c.compileBody(contentOf(el, false))
+	c.stack = c.stack[:len(c.stack)-1]
+	if err != nil {
+		return nil, err
+	}
+	lre.body = body
+	return lre, nil
+}
+
+// excluded returns the namespaces that are not copied to the result
+// from a literal result element: those named by exclude-result-prefixes
+// and extension-element-prefixes on the stylesheet or the element.
+func (c *compiler) excluded(el *xmltree.Element) map[string]bool {
+	result := make(map[string]bool)
+	add := func(scope *xmltree.Element, list string) {
+		for _, prefix := range strings.Fields(list) {
+			if prefix == "#default" {
+				prefix = ""
+			}
+			if ns, ok := scope.Namespaces()[prefix]; ok {
+				result[ns] = true
+			}
+		}
+	}
+	for _, scope := range append(c.stack, el) {
+		space := Namespace
+		if scope.Name.Space == Namespace {
+			space = ""
+		}
+		add(scope, scope.Attr(space, "exclude-result-prefixes"))
+		add(scope, scope.Attr(space, "extension-element-prefixes"))
+	}
+	return result
+}
+
+// forwardsCompatible reports whether el is processed in
+// forwards-compatible mode, because it or an ancestor specifies
+// a version other than 1.0.
+func (c *compiler) forwardsCompatible(el *xmltree.Element) bool {
+	if forwardsCompatible(el) {
+		return true
+	}
+	for _, scope := range c.stack {
+		if forwardsCompatible(scope) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *compiler) sort(el *xmltree.Element) (*sortKey, error) {
+	sel := el.Attr("", "select")
+	if sel == "" {
+		sel = "."
+	}
+	s := new(sortKey)
+	var err error
+	if s.sel, err = compileExpr(sel, el); err != nil {
+		return nil, err
+	}
+	avts := []struct {
+		name, def string
+		dst       **avt
+	}{
+		{"order", "ascending", &s.order},
+		{"data-type", "text", &s.dataType},
+		{"case-order", "upper-first", &s.caseOrder},
+	}
+	for _, a := range avts {
+		v := el.Attr("", a.name)
+		if v == "" {
+			v = a.def
+		}
+		if *a.dst, err = parseAVT(v, el); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+type textInstr string
+
+func (text textInstr) exec(t *transformer, ctx *context, out *node) error {
+	out.addText(string(text))
+	return nil
+}
+
+type sequence []instruction
+
+func (seq sequence) exec(t *transformer, ctx *context, out *node) error {
+	return t.execBody(seq, ctx, out)
+}
+
+type variableInstr struct {
+	v *variable
+}
+
+// Variables are bound by execBody; a variable that is not followed
+// by any instructions has no effect.
+func (v *variableInstr) exec(t *transformer, ctx *context, out *node) error {
+	return nil
+}
+
+type literalAttr struct {
+	name   xml.Name
+	prefix string
+	value  *avt
+}
+
+type literal struct {
+	name    xml.Name
+	prefix  string
+	ns      []xml.Name
+	attrs   []literalAttr
+	useSets []string
+	body    []instruction
+}
+
+func (lre *literal) exec(t *transformer, ctx *context, out *node) error {
+	el := &node{kind: xmltree.ElementNode, name: lre.name, prefix: lre.prefix}
+	for _, ns := range lre.ns {
+		el.addNS(ns.Local, ns.Space)
+	}
+	if err := t.useAttributeSets(lre.useSets, ctx, el, 0); err != nil {
+		return err
+	}
+	for _, a := range lre.attrs {
+		value, err := a.value.eval(t, ctx)
+		if err != nil {
+			return err
+		}
+		el.addAttr(&node{kind: xmltree.AttrNode, name: a.name, prefix: a.prefix, data: value})
+	}
+	if err := t.execBody(lre.body, ctx, el); err != nil {
+		return err
+	}
+	out.addChild(el)
+	return nil
+}
+
+// useAttributeSets adds the attributes from the named attribute sets
+// to an element.
+func (t *transformer) useAttributeSets(names []string, ctx *context, el *node, depth int) error {
+	if depth > 100 {
+		return fmt.Errorf("xslt: attribute sets nested too deeply")
+	}
+	for _, name := range names {
+		sets, ok := t.s.attrSets[name]
+		if !ok {
+			return fmt.Errorf("xslt: undefined attribute set %s", name)
+		}
+		for _, set := range sets {
+			if err := t.useAttributeSets(set.useSets, ctx, el, depth+1); err != nil {
+				return err
+			}
+			// Only global variables are visible in
+			// attribute sets.
+			c := *ctx
+			c.vars = t.globals
+			if err := t.execBody(set.attrs, &c, el); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+type applyTemplates struct {
+	sel    *expr
+	mode   string
+	sorts  []*sortKey
+	params []*variable
+}
+
+func (a *applyTemplates) exec(t *transformer, ctx *context, out *node) error {
+	nodes, err := a.sel.evalNodes(t, ctx)
+	if err != nil {
+		return err
+	}
+	if nodes, err = t.sortNodes(nodes, a.sorts, ctx); err != nil {
+		return err
+	}
+	params, err := t.params(a.params, ctx)
+	if err != nil {
+		return err
+	}
+	return t.applyTemplates(nodes, ctx, a.mode, params, out)
+}
+
+func (t *transformer) params(vars []*variable, ctx *context) (map[string]interface{}, error) {
+	if len(vars) == 0 {
+		return nil, nil
+	}
+	params := make(map[string]interface{}, len(vars))
+	for _, v := range vars {
+		value, err := t.value(v, ctx)
+		if err != nil {
+			return nil, err
+		}
+		params[v.name] = value
+	}
+	return params, nil
+}
+
+type callTemplate struct {
+	name   string
+	el     *xmltree.Element
+	params []*variable
+}
+
+func (call *callTemplate) exec(t *transformer, ctx *context, out *node) error {
+	tmpl, ok := t.s.named[call.name]
+	if !ok {
+		return fmt.Errorf("xslt: no template named %s", call.name)
+	}
+	params, err := t.params(call.params, ctx)
+	if err != nil {
+		return err
+	}
+	// The current template rule is unchanged by xsl:call-template.
+	c := *ctx
+	if err := t.invoke(tmpl, &c, params, out); err != nil {
+		return err
+	}
+	return nil
+}
+
+type applyImports struct{}
+
+func (applyImports) exec(t *transformer, ctx *context, out *node) error {
+	if ctx.tmpl == nil || ctx.tmpl.match == nil {
+		return fmt.Errorf("xslt: xsl:apply-imports used without a current template rule")
+	}
+	tmpl, err := t.findTemplate(ctx.node, ctx.mode, ctx.tmpl)
+	if err != nil {
+		return err
+	}
+	if tmpl == nil {
+		return t.builtin(ctx, out)
+	}
+	return t.invoke(tmpl, ctx, nil, out)
+}
+
+type forEach struct {
+	sel   *expr
+	sorts []*sortKey
+	body  []instruction
+}
+
+func (f *forEach) exec(t *transformer, ctx *context, out *node) error {
+	nodes, err := f.sel.evalNodes(t, ctx)
+	if err != nil {
+		return err
+	}
+	if nodes, err = t.sortNodes(nodes, f.sorts, ctx); err != nil {
+		return err
+	}
+	for i, n := range nodes {
+		c := &context{node: n, pos: i + 1, size: len(nodes), vars: ctx.vars, mode: ctx.mode}
+		if err := t.execBody(f.body, c, out); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type sortKey struct {
+	sel                        *expr
+	order, dataType, caseOrder *avt
+}
+
+// sortNodes sorts nodes by the given keys. The sort is stable, so
+// nodes with equal keys remain in document order.
+func (t *transformer) sortNodes(nodes []*xmltree.XPathNode, keys []*sortKey, ctx *context) ([]*xmltree.XPathNode, error) {
+	if len(keys) == 0 || len(nodes) < 2 {
+		return nodes, nil
+	}
+	type key struct {
+		desc, number, lowerFirst bool
+	}
+	specs := make([]key, len(keys))
+	for i, k := range keys {
+		order, err := k.order.eval(t, ctx)
+		if err != nil {
+			return nil, err
+		}
+		dataType, err := k.dataType.eval(t, ctx)
+		if err != nil {
+			return nil, err
+		}
+		caseOrder, err := k.caseOrder.eval(t, ctx)
+		if err != nil {
+			return nil, err
+		}
+		specs[i] = key{order == "descending", dataType == "number", caseOrder == "lower-first"}
+	}
+	type item struct {
+		n       *xmltree.XPathNode
+		strs    []string
+		numbers []float64
+	}
+	items := make([]item, len(nodes))
+	for i, n := range nodes {
+		items[i] = item{n: n, strs: make([]string, len(keys)), numbers: make([]float64, len(keys))}
+		c := &context{node: n, pos: i + 1, size: len(nodes), vars: ctx.vars, mode: ctx.mode}
+		for j, k := range keys {
+			s, err := k.sel.evalString(t, c)
+			if err != nil {
+				return nil, err
+			}
+			items[i].strs[j] = s
+			if specs[j].number {
+				items[i].numbers[j] = xmltree.XPathNumber(s)
+			}
+		}
+	}
+	sort.SliceStable(items, func(a, b int) bool {
+		for j, spec := range specs {
+			var cmp int
+			if spec.number {
+				cmp = compareNumbers(items[a].numbers[j], items[b].numbers[j])
+			} else {
+				cmp = compareText(items[a].strs[j], items[b].strs[j], spec.lowerFirst)
+			}
+			if cmp != 0 {
+				return (cmp < 0) != spec.desc
+			}
+		}
+		return false
+	})
+	result := make([]*xmltree.XPathNode, len(items))
+	for i := range items {
+		result[i] = items[i].n
+	}
+	return result, nil
+}
+
+// NaN sorts before all other numbers.
+func compareNumbers(a, b float64) int {
+	switch {
+	case math.IsNaN(a) && math.IsNaN(b):
+		return 0
+	case math.IsNaN(a):
+		return -1
+	case math.IsNaN(b):
+		return 1
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// compareText compares strings alphabetically, ignoring case except
+// to order strings that differ only in case.
+func compareText(a, b string, lowerFirst bool) int {
+	if cmp := strings.Compare(strings.ToLower(a), strings.ToLower(b)); cmp != 0 {
+		return cmp
+	}
+	cmp := strings.Compare(a, b)
+	if lowerFirst {
+		return -cmp
+	}
+	return cmp
+}
+
+type valueOf struct {
+	sel *expr
+}
+
+func (v *valueOf) exec(t *transformer, ctx *context, out *node) error {
+	s, err := v.sel.evalString(t, ctx)
+	if err != nil {
+		return err
+	}
+	out.addText(s)
+	return nil
+}
+
+type copyOf struct {
+	sel *expr
+}
+
+func (c *copyOf) exec(t *transformer, ctx *context, out *node) error {
+	v, err := c.sel.eval(t, ctx)
+	if err != nil {
+		return err
+	}
+	nodes, ok := v.([]*xmltree.XPathNode)
+	if !ok {
+		out.addText(xmltree.XPathString(v))
+		return nil
+	}
+	for _, n := range nodes {
+		if n.Kind() == xmltree.ElementNode && t.fragments[n.Element()] {
+			// copy the content of a result tree fragment
+			for _, c := range n.Children() {
+				t.copyNode(c, out, true, 0)
+			}
+			continue
+		}
+		t.copyNode(n, out, true, 0)
+	}
+	return nil
+}
+
+// copyNode copies a node from a source document to the result tree.
+// If deep is false, only the node and its namespace nodes are copied,
+// and the copy is returned so that content may be added to it.
+func (t *transformer) copyNode(n *xmltree.XPathNode, out *node, deep bool, depth int) *node {
+	if depth > maxDepth {
+		return nil
+	}
+	switch n.Kind() {
+	case xmltree.RootNode:
+		if deep {
+			for _, c := range n.Children() {
+				t.copyNode(c, out, true, depth+1)
+			}
+		}
+		return out
+	case xmltree.ElementNode:
+		el := n.Element()
+		c := &node{kind: xmltree.ElementNode, name: el.Name}
+		if q := el.Prefix(el.Name); strings.Contains(q, ":") {
+			c.prefix = q[:strings.IndexByte(q, ':')]
+		}
+		for prefix, ns := range el.Namespaces() {
+			if ns != "" {
+				c.ns = append(c.ns, xml.Name{Space: ns, Local: prefix})
+			}
+		}
+		sort.Slice(c.ns, func(i, j int) bool { return c.ns[i].Local < c.ns[j].Local })
+		if deep {
+			for _, a := range n.Attributes() {
+				t.copyNode(a, c, true, depth+1)
+			}
+			for _, child := range n.Children() {
+				t.copyNode(child, c, true, depth+1)
+			}
+		}
+		out.addChild(c)
+		return c
+	case xmltree.AttrNode:
+		name := n.Name()
+		a := &node{kind: xmltree.AttrNode, name: name, data: n.Value()}
+		if name.Space != "" {
+			for prefix, ns := range n.Element().Namespaces() {
+				if ns == name.Space && prefix != "" && (a.prefix == "" || prefix < a.prefix) {
+					a.prefix = prefix
+				}
+			}
+		}
+		out.addAttr(a)
+	case xmltree.TextNode, xmltree.CDATANode:
+		out.addText(n.Value())
+	case xmltree.CommentNode:
+		out.addChild(&node{kind: xmltree.CommentNode, data: n.Value()})
+	case xmltree.ProcInstNode:
+		out.addChild(&node{kind: xmltree.ProcInstNode, name: n.Name(), data: n.Value()})
+	}
+	return nil
+}
+
+type copyInstr struct {
+	useSets []string
+	body    []instruction
+}
+
+func (c *copyInstr) exec(t *transformer, ctx *context, out *node) error {
+	switch ctx.node.Kind() {
+	case xmltree.RootNode:
+		return t.execBody(c.body, ctx, out)
+	case xmltree.ElementNode:
+		el := t.copyNode(ctx.node, out, false, 0)
+		if err := t.useAttributeSets(c.useSets, ctx, el, 0); err != nil {
+			return err
+		}
+		return t.execBody(c.body, ctx, el)
+	}
+	t.copyNode(ctx.node, out, true, 0)
+	return nil
+}
+
+type ifInstr struct {
+	test *expr
+	body []instruction
+}
+
+func (i *ifInstr) exec(t *transformer, ctx *context, out *node) error {
+	v, err := i.test.eval(t, ctx)
+	if err != nil {
+		return err
+	}
+	if xmltree.XPathBool(v) {
+		return t.execBody(i.body, ctx, out)
+	}
+	return nil
+}
+
+type choose struct {
+	when         []*ifInstr
+	otherwise    []instruction
+	hasOtherwise bool
+}
+
+func (ch *choose) exec(t *transformer, ctx *context, out *node) error {
+	for _, w := range ch.when {
+		v, err := w.test.eval(t, ctx)
+		if err != nil {
+			return err
+		}
+		if xmltree.XPathBool(v) {
+			return t.execBody(w.body, ctx, out)
+		}
+	}
+	return t.execBody(ch.otherwise, ctx, out)
+}
+
+type elementInstr struct {
+	name, namespace *avt
+	// the xsl:element instruction, for resolving prefixes
+	scope   *xmltree.Element
+	useSets []string
+	body    []instruction
+}
+
+func (e *elementInstr) exec(t *transformer, ctx *context, out *node) error {
+	name, prefix, err := t.resolveName(e.name, e.namespace, e.scope, ctx, false)
+	if err != nil {
+		return err
+	}
+	el := &node{kind: xmltree.ElementNode, name: name, prefix: prefix}
+	if err := t.useAttributeSets(e.useSets, ctx, el, 0); err != nil {
+		return err
+	}
+	if err := t.execBody(e.body, ctx, el); err != nil {
+		return err
+	}
+	out.addChild(el)
+	return nil
+}
+
+// resolveName computes the name of an element or attribute created
+// by xsl:element or xsl:attribute.
+func (t *transformer) resolveName(nameAVT, nsAVT *avt, scope *xmltree.Element, ctx *context, attr bool) (xml.Name, string, error) {
+	qname, err := nameAVT.eval(t, ctx)
+	if err != nil {
+		return xml.Name{}, "", err
+	}
+	qname = strings.TrimSpace(qname)
+	prefix, local := "", qname
+	if i := strings.IndexByte(qname, ':'); i >= 0 {
+		prefix, local = qname[:i], qname[i+1:]
+	}
+	if !isNCName(local) || (prefix != "" && !isNCName(prefix)) || (attr && qname == "xmlns") {
+		return xml.Name{}, "", fmt.Errorf("xslt: invalid name %q", qname)
+	}
+	if nsAVT != nil {
+		space, err := nsAVT.eval(t, ctx)
+		if err != nil {
+			return xml.Name{}, "", err
+		}
+		return xml.Name{Space: space, Local: local}, prefix, nil
+	}
+	if prefix == "" {
+		if attr {
+			return xml.Name{Local: local}, "", nil
+		}
+		return xml.Name{Space: scope.Namespaces()[""], Local: local}, "", nil
+	}
+	name, ok := scope.ResolveNS(qname)
+	if !ok {
+		return xml.Name{}, "", fmt.Errorf("xslt: undeclared namespace prefix in %q", qname)
+	}
+	return name, prefix, nil
+}
+
+type attributeInstr struct {
+	name, namespace *avt
+	scope           *xmltree.Element
+	body            []instruction
+}
+
+func (a *attributeInstr) exec(t *transformer, ctx *context, out *node) error {
+	name, prefix, err := t.resolveName(a.name, a.namespace, a.scope, ctx, true)
+	if err != nil {
+		return err
+	}
+	content := &node{kind: xmltree.RootNode}
+	if err := t.execBody(a.body, ctx, content); err != nil {
+		return err
+	}
+	out.addAttr(&node{kind: xmltree.AttrNode, name: name, prefix: prefix, data: content.text()})
+	return nil
+}
+
+type commentInstr struct {
+	body []instruction
+}
+
+func (c *commentInstr) exec(t *transformer, ctx *context, out *node) error {
+	content := &node{kind: xmltree.RootNode}
+	if err := t.execBody(c.body, ctx, content); err != nil {
+		return err
+	}
+	text := content.text()
+	// "--" is not allowed in comments, nor "-" at the end.
+	for strings.Contains(text, "--") {
+		text = strings.ReplaceAll(text, "--", "- -")
+	}
+	if strings.HasSuffix(text, "-") {
+		text += " "
+	}
+	out.addChild(&node{kind: xmltree.CommentNode, data: text})
+	return nil
+}
+
+type procInstInstr struct {
+	name *avt
+	body []instruction
+}
+
+func (pi *procInstInstr) exec(t *transformer, ctx *context, out *node) error {
+	target, err := pi.name.eval(t, ctx)
+	if err != nil {
+		return err
+	}
+	target = strings.TrimSpace(target)
+	if target == "" || strings.Contains(target, ":") || strings.EqualFold(target, "xml") {
+		return fmt.Errorf("xslt: invalid processing instruction target %q", target)
+	}
+	content := &node{kind: xmltree.RootNode}
+	if err := t.execBody(pi.body, ctx, content); err != nil {
+		return err
+	}
+	text := strings.ReplaceAll(content.text(), "?>", "? >")
+	out.addChild(&node{kind: xmltree.ProcInstNode, name: xml.Name{Local: target}, data: text})
+	return nil
+}
+
+type message struct {
+	terminate bool
+	body      []instruction
+}
+
+func (m *message) exec(t *transformer, ctx *context, out *node) error {
+	content := &node{kind: xmltree.RootNode}
+	if err := t.execBody(m.body, ctx, content); err != nil {
+		return err
+	}
+	var buf strings.Builder
+	serialize(&buf, &output{method: "xml", omitDecl: true}, content)
+	if m.terminate {
+		return fmt.Errorf("xslt: terminated by xsl:message: %s", buf.String())
+	}
+	if t.s.Message != nil {
+		t.s.Message(buf.String())
+	}
+	return nil
+}
@@ -0,0 +1,571 @@
+package xslt
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/m29h/go-xml/xmltree"
+)
+
+// A numberInstr is an xsl:number instruction.
+type numberInstr struct {
+	level       string
+	count, from *pattern
+	value       *expr
+	format      *avt
+	// grouping-separator and grouping-size; both must be
+	// present for digits to be grouped
+	groupSep, groupSize *avt
+}
+
+func (c *compiler) number(el *xmltree.Element) (instruction, error) {
+	n := &numberInstr{level: strings.TrimSpace(el.Attr("", "level"))}
+	switch n.level {
+	case "":
+		n.level = "single"
+	case "single", "multiple", "any":
+	default:
+		return nil, errorf(el, "invalid level %q", n.level)
+	}
+	var err error
+	if s := el.Attr("", "count"); s != "" {
+		if n.count, err = parsePattern(s, el); err != nil {
+			return nil, errorf(el, "%v", err)
+		}
+	}
+	if s := el.Attr("", "from"); s != "" {
+		if n.from, err = parsePattern(s, el); err != nil {
+			return nil, errorf(el, "%v", err)
+		}
+	}
+	if s := el.Attr("", "value"); s != "" {
+		if n.value, err = compileExpr(s, el); err != nil {
+			return nil, err
+		}
+	}
+	format := el.Attr("", "format")
+	if format == "" {
+		format = "1"
+	}
+	if n.format, err = parseAVT(format, el); err != nil {
+		return nil, err
+	}
+	if hasAttr(el, "grouping-separator") && hasAttr(el, "grouping-size") {
+		if n.groupSep, err = parseAVT(el.Attr("", "grouping-separator"), el); err != nil {
+			return nil, err
+		}
+		if n.groupSize, err = parseAVT(el.Attr("", "grouping-size"), el); err != nil {
+			return nil, err
+		}
+	}
+	return n, nil
+}
+
+func (n *numberInstr) exec(t *transformer, ctx *context, out *node) error {
+	var numbers []int
+	if n.value != nil {
+		v, err := n.value.eval(t, ctx)
+		if err != nil {
+			return err
+		}
+		f := math.Floor(xmltree.XPathNumber(v) + 0.5)
+		if math.IsNaN(f) || math.IsInf(f, 0) || f < 1 {
+			// Numbers that cannot be formatted are
+			// converted to strings.
+			out.addText(xmltree.XPathString(v))
+			return nil
+		}
+		numbers = []int{int(f)}
+	} else {
+		var err error
+		if numbers, err = n.place(t, ctx.node); err != nil {
+			return err
+		}
+	}
+	format, err := n.format.eval(t, ctx)
+	if err != nil {
+		return err
+	}
+	var sep string
+	var size int
+	if n.groupSep != nil {
+		if sep, err = n.groupSep.eval(t, ctx); err != nil {
+			return err
+		}
+		s, err := n.groupSize.eval(t, ctx)
+		if err != nil {
+			return err
+		}
+		size, _ = strconv.Atoi(strings.TrimSpace(s))
+	}
+	out.addText(formatNumbers(numbers, format, sep, size))
+	return nil
+}
+
+// place computes the place of a node in the source tree, as a list of
+// numbers, according to the level, count and from attributes.
+func (n *numberInstr) place(t *transformer, cur *xmltree.XPathNode) ([]int, error) {
+	counted := func(x *xmltree.XPathNode) (bool, error) {
+		if n.count != nil {
+			return n.count.matches(t, x)
+		}
+		// By default, nodes of the same kind and name
+		// as the current node are counted.
+		return x.Kind() == cur.Kind() && x.Name() == cur.Name(), nil
+	}
+	from := func(x *xmltree.XPathNode) (bool, error) {
+		if n.from == nil {
+			return false, nil
+		}
+		return n.from.matches(t, x)
+	}
+	if n.level == "any" {
+		return n.countAny(cur, counted, from)
+	}
+	// Collect the ancestors-or-self of cur that are counted,
+	// up to the first ancestor matching from.
+	var ancestors []*xmltree.XPathNode
+	for x := cur; x != nil; x = x.Parent() {
+		if ok, err := from(x); err != nil {
+			return nil, err
+		} else if ok {
+			break
+		}
+		ok, err := counted(x)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			ancestors = append(ancestors, x)
+			if n.level == "single" {
+				break
+			}
+		}
+	}
+	numbers := make([]int, len(ancestors))
+	for i, x := range ancestors {
+		num := 1
+		if parent := x.Parent(); parent != nil && x.Kind() != xmltree.AttrNode {
+			for _, sibling := range parent.Children() {
+				if sibling.Same(x) {
+					break
+				}
+				ok, err := counted(sibling)
+				if err != nil {
+					return nil, err
+				}
+				if ok {
+					num++
+				}
+			}
+		}
+		numbers[len(ancestors)-1-i] = num
+	}
+	return numbers, nil
+}
+
+// countAny implements level="any", counting the matching nodes that
+// precede cur in document order, including its ancestors.
+func (n *numberInstr) countAny(cur *xmltree.XPathNode, counted, from func(*xmltree.XPathNode) (bool, error)) ([]int, error) {
+	root := cur
+	for root.Parent() != nil {
+		root = root.Parent()
+	}
+	num := 0
+	found := false
+	var visit func(x *xmltree.XPathNode, depth int) error
+	check := func(x *xmltree.XPathNode) error {
+		if ok, err := from(x); err != nil {
+			return err
+		} else if ok {
+			num = 0
+		}
+		ok, err := counted(x)
+		if err != nil {
+			return err
+		}
+		if ok {
+			num++
+		}
+		if x.Same(cur) {
+			found = true
+		}
+		return nil
+	}
+	visit = func(x *xmltree.XPathNode, depth int) error {
+		if depth > maxDepth {
+			return fmt.Errorf("xslt: document nested too deeply")
+		}
+		if err := check(x); err != nil || found {
+			return err
+		}
+		if cur.Kind() == xmltree.AttrNode {
+			for _, a := range x.Attributes() {
+				if err := check(a); err != nil || found {
+					return err
+				}
+			}
+		}
+		for _, c := range x.Children() {
+			if err := visit(c, depth+1); err != nil || found {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := visit(root, 0); err != nil {
+		return nil, err
+	}
+	if num == 0 {
+		return nil, nil
+	}
+	return []int{num}, nil
+}
+
+// formatNumbers formats a list of numbers according to the format
+// attribute of xsl:number.
+func formatNumbers(numbers []int, format, groupSep string, groupSize int) string {
+	// Split the format into alphanumeric tokens and the
+	// separators between them.
+	var tokens, seps []string
+	var prefix, suffix string
+	isAlnum := func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) }
+	rest := format
+	start := strings.IndexFunc(rest, isAlnum)
+	if start < 0 {
+		prefix, rest = rest, ""
+	} else {
+		prefix, rest = rest[:start], rest[start:]
+	}
+	for rest != "" {
+		end := strings.IndexFunc(rest, func(r rune) bool { return !isAlnum(r) })
+		if end < 0 {
+			end = len(rest)
+		}
+		tokens = append(tokens, rest[:end])
+		rest = rest[end:]
+		next := strings.IndexFunc(rest, isAlnum)
+		if next < 0 {
+			suffix, rest = rest, ""
+			break
+		}
+		seps = append(seps, rest[:next])
+		rest = rest[next:]
+	}
+	if len(tokens) == 0 {
+		tokens = []string{"1"}
+	}
+	var buf strings.Builder
+	buf.WriteString(prefix)
+	for i, num := range numbers {
+		if i > 0 {
+			switch {
+			case i-1 < len(seps):
+				buf.WriteString(seps[i-1])
+			case len(seps) > 0:
+				buf.WriteString(seps[len(seps)-1])
+			default:
+				buf.WriteString(".")
+			}
+		}
+		token := tokens[len(tokens)-1]
+		if i < len(tokens) {
+			token = tokens[i]
+		}
+		buf.WriteString(formatToken(num, token, groupSep, groupSize))
+	}
+	buf.WriteString(suffix)
+	return buf.String()
+}
+
+func formatToken(n int, token, groupSep string, groupSize int) string {
+	switch token {
+	case "a", "A":
+		return alphabetic(n, token == "A")
+	case "i":
+		return strings.ToLower(roman(n))
+	case "I":
+		return roman(n)
+	}
+	width := 1
+	if strings.Trim(token, "0") == "1" && strings.HasSuffix(token, "1") {
+		width = len(token)
+	}
+	s := strconv.Itoa(n)
+	for len(s) < width {
+		s = "0" + s
+	}
+	return group(s, groupSep, groupSize)
+}
+
+// group inserts sep between each group of size digits, counting from
+// the right.
+func group(digits, sep string, size int) string {
+	if sep == "" || size <= 0 || len(digits) <= size {
+		return digits
+	}
+	var buf strings.Builder
+	first := len(digits) % size
+	if first == 0 {
+		first = size
+	}
+	buf.WriteString(digits[:first])
+	for i := first; i < len(digits); i += size {
+		buf.WriteString(sep)
+		buf.WriteString(digits[i : i+size])
+	}
+	return buf.String()
+}
+
+func alphabetic(n int, upper bool) string {
+	var b []byte
+	for n > 0 {
+		n--
+		b = append([]byte{byte('a' + n%26)}, b...)
+		n /= 26
+	}
+	if upper {
+		return strings.ToUpper(string(b))
+	}
+	return string(b)
+}
+
+func roman(n int) string {
+	if n >= 4000 {
+		return strconv.Itoa(n)
+	}
+	values := []int{1000, 900, 500, 400, 100, 90, 50, 40, 10, 9, 5, 4, 1}
+	symbols := []string{"M", "CM", "D", "CD", "C", "XC", "L", "XL", "X", "IX", "V", "IV", "I"}
+	var buf strings.Builder
+	for i, v := range values {
+		for n >= v {
+			buf.WriteString(symbols[i])
+			n -= v
+		}
+	}
+	return buf.String()
+}
+
+// A decimalFormat is an xsl:decimal-format element, which controls
+// the interpretation of format patterns by format-number.
+type decimalFormat struct {
+	decimalSep, groupingSep, percent, perMille rune
+	zeroDigit, digit, patternSep, minus        rune
+	infinity, nan                              string
+}
+
+func defaultDecimalFormat() *decimalFormat {
+	return &decimalFormat{
+		decimalSep:  '.',
+		groupingSep: ',',
+		percent:     '%',
+		perMille:    '‰',
+		zeroDigit:   '0',
+		digit:       '#',
+		patternSep:  ';',
+		minus:       '-',
+		infinity:    "Infinity",
+		nan:         "NaN",
+	}
+}
+
+func (c *compiler) decimalFormat(el *xmltree.Element) error {
+	df := defaultDecimalFormat()
+	chars := map[string]*rune{
+		"decimal-separator":  &df.decimalSep,
+		"grouping-separator": &df.groupingSep,
+		"percent":            &df.percent,
+		"per-mille":          &df.perMille,
+		"zero-digit":         &df.zeroDigit,
+		"digit":              &df.digit,
+		"pattern-separator":  &df.patternSep,
+		"minus-sign":         &df.minus,
+	}
+	for _, a := range el.StartElement.Attr {
+		if a.Name.Space != "" {
+			continue
+		}
+		switch a.Name.Local {
+		case "name":
+		case "infinity":
+			df.infinity = a.Value
+		case "NaN":
+			df.nan = a.Value
+		default:
+			dst, ok := chars[a.Name.Local]
+			if !ok {
+				continue
+			}
+			r, size := utf8.DecodeRuneInString(a.Value)
+			if size == 0 || size != len(a.Value) {
+				return errorf(el, "%s must be a single character", a.Name.Local)
+			}
+			*dst = r
+		}
+	}
+	name := expandedName(el, el.Attr("", "name"))
+	if _, ok := c.s.formats[name]; ok {
+		return errorf(el, "duplicate decimal format %q", name)
+	}
+	c.s.formats[name] = df
+	return nil
+}
+
+func (t *transformer) fnFormatNumber(ctx *xmltree.XPathContext, args ...interface{}) (interface{}, error) {
+	if err := checkArgs("format-number", args, 2, 3); err != nil {
+		return nil, err
+	}
+	df := defaultDecimalFormat()
+	name := ""
+	if len(args) == 3 {
+		space, local, err := resolveQName(ctx, xmltree.XPathString(args[2]))
+		if err != nil {
+			return nil, err
+		}
+		name = local
+		if space != "" {
+			name = "{" + space + "}" + local
+		}
+	}
+	if f, ok := t.s.formats[name]; ok {
+		df = f
+	} else if name != "" {
+		return nil, fmt.Errorf("xslt: undefined decimal format %s", name)
+	}
+	return df.format(xmltree.XPathNumber(args[0]), xmltree.XPathString(args[1]))
+}
+
+// A numberPattern is a subpattern of a format-number pattern.
+type numberPattern struct {
+	prefix, suffix   string
+	minInt           int
+	minFrac, maxFrac int
+	groupSize        int
+	multiplier       float64
+}
+
+func (df *decimalFormat) parsePattern(s string) (numberPattern, error) {
+	p := numberPattern{multiplier: 1}
+	isNumeric := func(r rune) bool {
+		return r == df.digit || r == df.zeroDigit || r == df.decimalSep || r == df.groupingSep
+	}
+	runes := []rune(s)
+	i := 0
+	for i < len(runes) && !isNumeric(runes[i]) {
+		i++
+	}
+	j := i
+	for j < len(runes) && isNumeric(runes[j]) {
+		j++
+	}
+	if i == j {
+		return p, fmt.Errorf("xslt: format pattern %q has no digits", s)
+	}
+	p.prefix, p.suffix = string(runes[:i]), string(runes[j:])
+	for _, r := range p.prefix + p.suffix {
+		switch r {
+		case df.percent:
+			p.multiplier = 100
+		case df.perMille:
+			p.multiplier = 1000
+		}
+	}
+	fraction, lastGroup := false, -1
+	for k, r := range runes[i:j] {
+		switch {
+		case r == df.decimalSep:
+			if fraction {
+				return p, fmt.Errorf("xslt: format pattern %q has two decimal separators", s)
+			}
+			fraction = true
+		case r == df.groupingSep:
+			if fraction {
+				return p, fmt.Errorf("xslt: grouping separator after decimal separator in %q", s)
+			}
+			lastGroup = k
+		case fraction:
+			p.maxFrac++
+			if r == df.zeroDigit {
+				p.minFrac++
+			}
+		default:
+			if r == df.zeroDigit {
+				p.minInt++
+			}
+			if lastGroup >= 0 {
+				p.groupSize = k - lastGroup
+			}
+		}
+	}
+	return p, nil
+}
+
+// format implements format-number with a pattern in the syntax of
+// the JDK 1.1 DecimalFormat class.
+func (df *decimalFormat) format(f float64, pattern string) (string, error) {
+	subpatterns := strings.Split(pattern, string(df.patternSep))
+	if len(subpatterns) > 2 {
+		return "", fmt.Errorf("xslt: format pattern %q has more than two subpatterns", pattern)
+	}
+	pos, err := df.parsePattern(subpatterns[0])
+	if err != nil {
+		return "", err
+	}
+	if math.IsNaN(f) {
+		return df.nan, nil
+	}
+	p := pos
+	if f < 0 || (f == 0 && math.Signbit(f)) {
+		if len(subpatterns) == 2 {
+			neg, err := df.parsePattern(subpatterns[1])
+			if err != nil {
+				return "", err
+			}
+			p.prefix, p.suffix = neg.prefix, neg.suffix
+		} else {
+			p.prefix = string(df.minus) + p.prefix
+		}
+		f = -f
+	}
+	if math.IsInf(f, 0) {
+		return p.prefix + df.infinity + p.suffix, nil
+	}
+	s := strconv.FormatFloat(f*p.multiplier, 'f', p.maxFrac, 64)
+	intPart, fracPart := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		intPart, fracPart = s[:i], s[i+1:]
+	}
+	for len(fracPart) > p.minFrac && strings.HasSuffix(fracPart, "0") {
+		fracPart = fracPart[:len(fracPart)-1]
+	}
+	intPart = strings.TrimLeft(intPart, "0")
+	for len(intPart) < p.minInt {
+		intPart = "0" + intPart
+	}
+	if intPart == "" && fracPart == "" {
+		intPart = "0"
+	}
+	var buf strings.Builder
+	buf.WriteString(p.prefix)
+	digits := func(s string) {
+		for _, r := range s {
+			buf.WriteRune(df.zeroDigit + (r - '0'))
+		}
+	}
+	for i := 0; i < len(intPart); i++ {
+		if i > 0 && p.groupSize > 0 && (len(intPart)-i)%p.groupSize == 0 {
+			buf.WriteRune(df.groupingSep)
+		}
+		digits(intPart[i : i+1])
+	}
+	if fracPart != "" {
+		buf.WriteRune(df.decimalSep)
+		digits(fracPart)
+	}
+	buf.WriteString(p.suffix)
+	return buf.String(), nil
+}
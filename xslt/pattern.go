@@ -0,0 +1,246 @@
+package xslt
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/m29h/go-xml/xmltree"
+)
+
+// A pattern is an XSLT pattern, such as the match attribute of a
+// template. A node matches a pattern if it is selected by the pattern,
+// evaluated as an XPath expression, for some possible context; the
+// possible contexts are the node itself and its ancestors.
+type pattern struct {
+	src              string
+	alts             []*patternAlt
+	explicitPriority bool
+}
+
+// A patternAlt is one of the alternatives of a pattern separated by "|".
+type patternAlt struct {
+	src string
+	x   *expr
+	// The result of the expression does not depend on the context
+	// node, as for "/a" or "id('x')".
+	absolute bool
+	// The pattern contains "//", so any ancestor may be the
+	// context.
+	anyAncestor bool
+	// The number of steps in the pattern; if the pattern is not
+	// absolute and contains no "//", the context must be the
+	// ancestor this many levels above the node.
+	steps int
+	last  stepTest
+}
+
+// A stepTest is a summary of the last step of a pattern, used to
+// reject most nodes without evaluating the pattern.
+type stepTest struct {
+	kind xmltree.NodeKind
+	// the local name of an element or attribute test,
+	// or empty for a wildcard
+	local string
+	// the pattern uses node(), which matches any kind
+	anyKind bool
+	// default priority
+	priority float64
+}
+
+func parsePattern(src string, el *xmltree.Element) (*pattern, error) {
+	p := &pattern{src: src}
+	for _, alt := range splitTopLevel(src, '|') {
+		alt = strings.TrimSpace(alt)
+		if alt == "" {
+			return nil, fmt.Errorf("invalid pattern %q", src)
+		}
+		x, err := compileExpr(alt, el)
+		if err != nil {
+			return nil, err
+		}
+		a := &patternAlt{src: alt, x: x}
+		a.absolute = strings.HasPrefix(alt, "/") ||
+			strings.HasPrefix(alt, "id(") || strings.HasPrefix(alt, "key(")
+		steps := splitTopLevel(alt, '/')
+		for i, s := range steps {
+			if strings.TrimSpace(s) == "" && i > 0 && i < len(steps)-1 {
+				a.anyAncestor = true
+			}
+		}
+		for _, s := range steps {
+			if strings.TrimSpace(s) != "" {
+				a.steps++
+			}
+		}
+		a.last = parseStepTest(strings.TrimSpace(steps[len(steps)-1]))
+		if a.steps != 1 || a.absolute || a.anyAncestor || strings.HasPrefix(alt, "//") {
+			a.last.priority = 0.5
+		}
+		if alt == "/" {
+			a.last = stepTest{kind: xmltree.RootNode, priority: 0.5}
+		}
+		p.alts = append(p.alts, a)
+	}
+	return p, nil
+}
+
+func parseStepTest(s string) stepTest {
+	t := stepTest{kind: xmltree.ElementNode}
+	if i := strings.IndexByte(s, '['); i >= 0 {
+		s = strings.TrimSpace(s[:i])
+		t.priority = 0.5
+	}
+	switch {
+	case strings.HasPrefix(s, "@"):
+		t.kind, s = xmltree.AttrNode, strings.TrimSpace(s[1:])
+	case strings.HasPrefix(s, "attribute::"):
+		t.kind, s = xmltree.AttrNode, strings.TrimSpace(s[len("attribute::"):])
+	case strings.HasPrefix(s, "child::"):
+		s = strings.TrimSpace(s[len("child::"):])
+	}
+	prio := func(p float64) {
+		if t.priority == 0 {
+			t.priority = p
+		}
+	}
+	switch {
+	case s == "*":
+		prio(-0.5)
+	case strings.HasSuffix(s, ":*"):
+		prio(-0.25)
+	case strings.HasPrefix(s, "node("):
+		t.anyKind = true
+		prio(-0.5)
+	case strings.HasPrefix(s, "text("):
+		t.kind = xmltree.TextNode
+		prio(-0.5)
+	case strings.HasPrefix(s, "comment("):
+		t.kind = xmltree.CommentNode
+		prio(-0.5)
+	case strings.HasPrefix(s, "processing-instruction("):
+		t.kind = xmltree.ProcInstNode
+		if strings.TrimSpace(s[len("processing-instruction("):]) == ")" {
+			prio(-0.5)
+		}
+	default:
+		if i := strings.IndexByte(s, ':'); i >= 0 {
+			s = s[i+1:]
+		}
+		t.local = s
+	}
+	return t
+}
+
+// split returns a pattern for each alternative of p.
+func (p *pattern) split() []*pattern {
+	if len(p.alts) == 1 {
+		return []*pattern{p}
+	}
+	result := make([]*pattern, 0, len(p.alts))
+	for _, alt := range p.alts {
+		result = append(result, &pattern{src: alt.src, alts: []*patternAlt{alt}, explicitPriority: p.explicitPriority})
+	}
+	return result
+}
+
+func (p *pattern) defaultPriority() float64 {
+	if len(p.alts) == 1 {
+		return p.alts[0].last.priority
+	}
+	return 0.5
+}
+
+// matches reports whether n matches the pattern.
+func (p *pattern) matches(t *transformer, n *xmltree.XPathNode) (bool, error) {
+	for _, alt := range p.alts {
+		ok, err := alt.matches(t, n)
+		if ok || err != nil {
+			return ok, err
+		}
+	}
+	return false, nil
+}
+
+func (a *patternAlt) matches(t *transformer, n *xmltree.XPathNode) (bool, error) {
+	kind := n.Kind()
+	if kind == xmltree.CDATANode {
+		kind = xmltree.TextNode
+	}
+	switch {
+	case a.last.kind == xmltree.RootNode:
+		return kind == xmltree.RootNode, nil
+	case kind == xmltree.RootNode:
+		return false, nil
+	case a.last.anyKind:
+		if kind == xmltree.AttrNode {
+			// node() matches only nodes on the child axis
+			return false, nil
+		}
+	case a.last.kind != kind:
+		return false, nil
+	}
+	if a.last.local != "" && n.Name().Local != a.last.local {
+		return false, nil
+	}
+	var contexts []*xmltree.XPathNode
+	switch {
+	case a.absolute:
+		contexts = []*xmltree.XPathNode{n}
+	case a.anyAncestor:
+		for x := n.Parent(); x != nil; x = x.Parent() {
+			contexts = append(contexts, x)
+		}
+	default:
+		x := n
+		for i := 0; i < a.steps && x != nil; i++ {
+			x = x.Parent()
+		}
+		if x == nil {
+			return false, nil
+		}
+		contexts = []*xmltree.XPathNode{x}
+	}
+	for _, ctx := range contexts {
+		v, err := a.x.eval(t, &context{node: ctx, pos: 1, size: 1})
+		if err != nil {
+			return false, err
+		}
+		nodes, ok := v.([]*xmltree.XPathNode)
+		if !ok {
+			return false, fmt.Errorf("xslt: pattern %s does not select nodes", a.src)
+		}
+		for _, m := range nodes {
+			if m.Same(n) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// splitTopLevel splits s at each occurrence of sep that is not within
+// brackets, parentheses or a string literal.
+func splitTopLevel(s string, sep byte) []string {
+	var parts []string
+	depth, start := 0, 0
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '[' || c == '(':
+			depth++
+		case c == ']' || c == ')':
+			depth--
+		case c == sep && depth == 0:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
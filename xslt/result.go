@@ -0,0 +1,425 @@
+package xslt
+
+import (
+	"bufio"
+	"encoding/xml"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/m29h/go-xml/xmltree"
+)
+
+// A node is a node in a result tree. The result tree is built by the
+// instructions of a stylesheet, and serialized once the transformation
+// is complete.
+type node struct {
+	kind xmltree.NodeKind
+	// The name of elements and attributes. For processing
+	// instructions, the Local field holds the target.
+	name xml.Name
+	// The preferred prefix for the name of an element or attribute.
+	prefix string
+	// Namespace nodes of an element, with the prefix in the Local
+	// field and the namespace in the Space field.
+	ns       []xml.Name
+	attrs    []*node
+	children []*node
+	// character data of text, attribute, comment and processing
+	// instruction nodes
+	data string
+}
+
+func (n *node) addText(s string) {
+	if s == "" {
+		return
+	}
+	if k := len(n.children); k > 0 && n.children[k-1].kind == xmltree.TextNode {
+		n.children[k-1].data += s
+		return
+	}
+	n.children = append(n.children, &node{kind: xmltree.TextNode, data: s})
+}
+
+func (n *node) addChild(c *node) {
+	if c.kind == xmltree.TextNode {
+		n.addText(c.data)
+		return
+	}
+	n.children = append(n.children, c)
+}
+
+// addAttr adds an attribute to an element, replacing any attribute with
+// the same name. Attributes added to an element after its children,
+// or to a node that is not an element, are ignored.
+func (n *node) addAttr(a *node) {
+	if n.kind != xmltree.ElementNode || len(n.children) > 0 {
+		return
+	}
+	for i, b := range n.attrs {
+		if b.name == a.name {
+			n.attrs[i] = a
+			return
+		}
+	}
+	n.attrs = append(n.attrs, a)
+}
+
+// addNS adds a namespace node to an element, unless it already has
+// one for the prefix.
+func (n *node) addNS(prefix, space string) {
+	if n.kind != xmltree.ElementNode || prefix == "xml" {
+		return
+	}
+	for _, ns := range n.ns {
+		if ns.Local == prefix {
+			return
+		}
+	}
+	n.ns = append(n.ns, xml.Name{Space: space, Local: prefix})
+}
+
+// text returns the concatenation of the text nodes in n, which is
+// the value of instructions such as xsl:attribute.
+func (n *node) text() string {
+	var buf strings.Builder
+	for _, c := range n.children {
+		if c.kind == xmltree.TextNode {
+			buf.WriteString(c.data)
+		}
+	}
+	return buf.String()
+}
+
+// A serializer writes a result tree as XML, HTML or text.
+type serializer struct {
+	w      *bufio.Writer
+	out    *output
+	method string
+	err    error
+}
+
+func (s *serializer) write(strs ...string) {
+	for _, str := range strs {
+		if s.err == nil {
+			_, s.err = s.w.WriteString(str)
+		}
+	}
+}
+
+// outputMethod returns the output method for a result tree. If none
+// was specified, html is used when the first element of the result is
+// an html element in no namespace.
+func outputMethod(o *output, root *node) string {
+	if o.method != "" {
+		return o.method
+	}
+	for _, c := range root.children {
+		switch c.kind {
+		case xmltree.TextNode:
+			if strings.TrimSpace(c.data) != "" {
+				return "xml"
+			}
+		case xmltree.ElementNode:
+			if c.name.Space == "" && strings.EqualFold(c.name.Local, "html") {
+				return "html"
+			}
+			return "xml"
+		}
+	}
+	return "xml"
+}
+
+func serialize(w io.Writer, o *output, root *node) error {
+	s := &serializer{w: bufio.NewWriter(w), out: o, method: outputMethod(o, root)}
+	switch s.method {
+	case "text":
+		s.text(root, 0)
+	case "html":
+		s.doctype(root)
+		s.content(root, map[string]string{"": ""}, 0)
+	default:
+		if !o.omitDecl {
+			version := o.version
+			if version == "" {
+				version = "1.0"
+			}
+			s.write(`<?xml version="`, version, `" encoding="UTF-8"`)
+			if o.standalone != "" {
+				s.write(` standalone="`, o.standalone, `"`)
+			}
+			s.write("?>\n")
+		}
+		s.doctype(root)
+		s.content(root, map[string]string{"": ""}, 0)
+	}
+	if s.method != "text" && o.indent {
+		s.write("\n")
+	}
+	if s.err != nil {
+		return s.err
+	}
+	return s.w.Flush()
+}
+
+func (s *serializer) doctype(root *node) {
+	if s.out.doctypeSystem == "" && (s.out.doctypePublic == "" || s.method != "html") {
+		return
+	}
+	var name string
+	for _, c := range root.children {
+		if c.kind == xmltree.ElementNode {
+			name = c.name.Local
+			if c.prefix != "" {
+				name = c.prefix + ":" + name
+			}
+			break
+		}
+	}
+	s.write("<!DOCTYPE ", name)
+	if s.out.doctypePublic != "" {
+		s.write(` PUBLIC "`, s.out.doctypePublic, `"`)
+		if s.out.doctypeSystem != "" {
+			s.write(` "`, s.out.doctypeSystem, `"`)
+		}
+	} else {
+		s.write(` SYSTEM "`, s.out.doctypeSystem, `"`)
+	}
+	s.write(">\n")
+}
+
+func (s *serializer) text(n *node, depth int) {
+	if depth > maxDepth {
+		return
+	}
+	for _, c := range n.children {
+		switch c.kind {
+		case xmltree.TextNode:
+			s.write(c.data)
+		case xmltree.ElementNode:
+			s.text(c, depth+1)
+		}
+	}
+}
+
+// content writes the children of n. If indentation is enabled, each
+// child is placed on its own line, unless n contains text other than
+// white space.
+func (s *serializer) content(n *node, scope map[string]string, depth int) {
+	if depth > maxDepth {
+		return
+	}
+	indent := s.out.indent
+	for _, c := range n.children {
+		if c.kind == xmltree.TextNode && strings.TrimSpace(c.data) != "" {
+			indent = false
+		}
+	}
+	cdata := n.kind == xmltree.ElementNode && s.method == "xml" && s.out.cdataElements[n.name]
+	raw := s.method == "html" && n.name.Space == "" &&
+		(strings.EqualFold(n.name.Local, "script") || strings.EqualFold(n.name.Local, "style"))
+	for i, c := range n.children {
+		if indent && (depth > 0 || i > 0) {
+			if c.kind == xmltree.TextNode {
+				continue
+			}
+			s.write("\n", strings.Repeat("  ", depth))
+		}
+		switch c.kind {
+		case xmltree.TextNode:
+			switch {
+			case cdata:
+				s.write("<![CDATA[", strings.ReplaceAll(c.data, "]]>", "]]]]><![CDATA[>"), "]]>")
+			case raw:
+				s.write(c.data)
+			default:
+				s.write(escapeText(c.data))
+			}
+		case xmltree.ElementNode:
+			s.element(c, scope, depth)
+		case xmltree.CommentNode:
+			s.write("<!--", c.data, "-->")
+		case xmltree.ProcInstNode:
+			s.write("<?", c.name.Local)
+			if c.data != "" {
+				s.write(" ", c.data)
+			}
+			if s.method == "html" {
+				s.write(">")
+			} else {
+				s.write("?>")
+			}
+		}
+	}
+	if indent && depth > 0 && len(n.children) > 0 {
+		s.write("\n", strings.Repeat("  ", depth-1))
+	}
+}
+
+// htmlVoid lists the HTML elements that have no end tag.
+var htmlVoid = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true,
+	"hr": true, "img": true, "input": true, "link": true, "meta": true,
+	"param": true, "source": true, "track": true, "wbr": true,
+}
+
+func (s *serializer) element(n *node, outer map[string]string, depth int) {
+	b := newBinder(outer)
+	qname := qualify(b.bind(n.name.Space, n.prefix, false), n.name.Local)
+	attrNames := make([]string, len(n.attrs))
+	for i, a := range n.attrs {
+		attrNames[i] = qualify(b.bind(a.name.Space, a.prefix, true), a.name.Local)
+	}
+	for _, ns := range n.ns {
+		b.keep(ns.Local, ns.Space)
+	}
+
+	s.write("<", qname)
+	for _, decl := range b.decls {
+		if decl.Local == "" {
+			s.write(` xmlns="`, escapeAttr(decl.Space), `"`)
+		} else {
+			s.write(" xmlns:", decl.Local, `="`, escapeAttr(decl.Space), `"`)
+		}
+	}
+	for i, a := range n.attrs {
+		s.write(" ", attrNames[i], `="`, escapeAttr(a.data), `"`)
+	}
+	html := s.method == "html" && n.name.Space == ""
+	if len(n.children) == 0 {
+		switch {
+		case html && htmlVoid[strings.ToLower(n.name.Local)]:
+			s.write(">")
+			return
+		case !html:
+			s.write("/>")
+			return
+		}
+	}
+	s.write(">")
+	s.content(n, b.scope, depth+1)
+	s.write("</", qname, ">")
+}
+
+// A binder chooses prefixes for the names used by an element, and
+// records the namespace declarations the element needs.
+type binder struct {
+	scope map[string]string
+	// prefixes declared on this element
+	decls []xml.Name
+	// prefixes used by the names of this element
+	used map[string]bool
+}
+
+func newBinder(outer map[string]string) *binder {
+	return &binder{scope: outer, used: make(map[string]bool)}
+}
+
+func (b *binder) declared(prefix string) bool {
+	for _, d := range b.decls {
+		if d.Local == prefix {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *binder) declare(prefix, space string) {
+	if !b.declared(prefix) {
+		scope := make(map[string]string, len(b.scope)+1)
+		for k, v := range b.scope {
+			scope[k] = v
+		}
+		b.scope = scope
+	}
+	b.scope[prefix] = space
+	b.decls = append(b.decls, xml.Name{Space: space, Local: prefix})
+}
+
+// keep declares a namespace node of an element, if it is not already
+// in scope and does not conflict with the names of the element.
+func (b *binder) keep(prefix, space string) {
+	if b.scope[prefix] == space || b.declared(prefix) || b.used[prefix] {
+		return
+	}
+	if prefix != "" && space == "" {
+		// prefixes cannot be undeclared in XML 1.0
+		return
+	}
+	b.declare(prefix, space)
+}
+
+// bind returns the prefix to use for a name in the namespace space,
+// preferring the given prefix.
+func (b *binder) bind(space, prefix string, attr bool) string {
+	p := b.choose(space, prefix, attr)
+	if p != "" || !attr {
+		b.used[p] = true
+	}
+	return p
+}
+
+func (b *binder) choose(space, prefix string, attr bool) string {
+	switch space {
+	case xmlNamespace:
+		return "xml"
+	case "":
+		if !attr && b.scope[""] != "" {
+			b.declare("", "")
+		}
+		return ""
+	}
+	if attr && prefix == "" {
+		prefix = "ns0"
+	}
+	if b.scope[prefix] == space {
+		return prefix
+	}
+	if !b.declared(prefix) && !b.used[prefix] && prefix != "xml" && prefix != "xmlns" {
+		b.declare(prefix, space)
+		return prefix
+	}
+	var candidates []string
+	for p, s := range b.scope {
+		if s == space && p != "" {
+			candidates = append(candidates, p)
+		}
+	}
+	if len(candidates) > 0 {
+		sort.Strings(candidates)
+		return candidates[0]
+	}
+	for i := 0; ; i++ {
+		p := "ns" + strconv.Itoa(i)
+		if _, ok := b.scope[p]; !ok && !b.declared(p) && !b.used[p] {
+			b.declare(p, space)
+			return p
+		}
+	}
+}
+
+// qualify joins a prefix and local name.
+func qualify(prefix, local string) string {
+	if prefix == "" {
+		return local
+	}
+	return prefix + ":" + local
+}
+
+func escapeText(s string) string {
+	if !strings.ContainsAny(s, "&<>\r") {
+		return s
+	}
+	r := strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\r", "&#xD;")
+	return r.Replace(s)
+}
+
+func escapeAttr(s string) string {
+	if !strings.ContainsAny(s, "&<\"\t\n\r") {
+		return s
+	}
+	r := strings.NewReplacer("&", "&amp;", "<", "&lt;", `"`, "&quot;",
+		"\t", "&#x9;", "\n", "&#xA;", "\r", "&#xD;")
+	return r.Replace(s)
+}
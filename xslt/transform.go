@@ -0,0 +1,527 @@
+package xslt
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/m29h/go-xml/xmltree"
+)
+
+// maxDepth limits the nesting of template invocations and of
+// result trees.
+const maxDepth = 3000
+
+// Transform applies the stylesheet to the document whose document
+// element is doc, and writes the result to w, as directed by the
+// stylesheet's xsl:output element. The result is always encoded in
+// UTF-8. Values of the stylesheet's global parameters may be provided
+// in params, keyed by name; they may be of any type accepted by the
+// Variables of an xmltree.XPathEnv.
+func (s *Stylesheet) Transform(w io.Writer, doc *xmltree.Element, params map[string]interface{}) error {
+	root, err := s.run(doc, params)
+	if err != nil {
+		return err
+	}
+	return serialize(w, &s.output, root)
+}
+
+// TransformElement applies the stylesheet to the document whose
+// document element is doc, and returns the document element of the
+// result. An error is returned if the result does not consist of a
+// single element, ignoring white space, comments and processing
+// instructions. The xsl:output element of the stylesheet is ignored.
+func (s *Stylesheet) TransformElement(doc *xmltree.Element, params map[string]interface{}) (*xmltree.Element, error) {
+	root, err := s.run(doc, params)
+	if err != nil {
+		return nil, err
+	}
+	elements := 0
+	for _, c := range root.children {
+		switch c.kind {
+		case xmltree.ElementNode:
+			elements++
+		case xmltree.TextNode:
+			if strings.TrimSpace(c.data) != "" {
+				return nil, fmt.Errorf("xslt: result contains text outside of the document element")
+			}
+		}
+	}
+	if elements != 1 {
+		return nil, fmt.Errorf("xslt: result contains %d elements at the top level, want 1", elements)
+	}
+	result, err := parseResult(root)
+	if err != nil {
+		return nil, err
+	}
+	return result.Root, nil
+}
+
+// parseResult converts a result tree to an xmltree.Document.
+func parseResult(root *node) (*xmltree.Document, error) {
+	var buf bytes.Buffer
+	if err := serialize(&buf, &output{method: "xml", omitDecl: true}, root); err != nil {
+		return nil, err
+	}
+	return xmltree.ParseDocument(buf.Bytes())
+}
+
+// A transformer holds the state of a single transformation.
+type transformer struct {
+	s       *Stylesheet
+	funcs   map[string]xmltree.XPathFunc
+	globals map[string]interface{}
+	// the current node, for the current() function
+	current *xmltree.XPathNode
+	// indexes built for xsl:key, by document and key name
+	keys map[*xmltree.Element]map[string]*keyIndex
+	// the document elements of result tree fragments
+	fragments map[*xmltree.Element]bool
+	// identifiers returned by generate-id
+	ids   map[nodeID]int
+	depth int
+}
+
+// A context is the dynamic context in which an instruction
+// is executed.
+type context struct {
+	node      *xmltree.XPathNode
+	pos, size int
+	vars      map[string]interface{}
+	// the current template rule and mode, for xsl:apply-imports
+	tmpl *template
+	mode string
+}
+
+func (s *Stylesheet) run(doc *xmltree.Element, params map[string]interface{}) (*node, error) {
+	t := &transformer{
+		s:         s,
+		keys:      make(map[*xmltree.Element]map[string]*keyIndex),
+		fragments: make(map[*xmltree.Element]bool),
+	}
+	t.funcs = t.functions()
+	source := s.stripSpace(doc)
+	root := xmltree.NewXPathRoot(source)
+	ctx := &context{node: root, pos: 1, size: 1}
+	if err := t.evalGlobals(ctx, params); err != nil {
+		return nil, err
+	}
+	ctx.vars = t.globals
+	result := &node{kind: xmltree.RootNode}
+	if err := t.applyTemplates([]*xmltree.XPathNode{root}, ctx, "", nil, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// evalGlobals computes the values of the global variables and
+// parameters. Variables that refer to other variables are evaluated
+// after them, regardless of the order in which they are declared.
+func (t *transformer) evalGlobals(ctx *context, params map[string]interface{}) error {
+	byName := make(map[string]*variable, len(t.s.globals))
+	for _, v := range t.s.globals {
+		byName[v.name] = v
+	}
+	t.globals = make(map[string]interface{}, len(byName))
+	const (
+		pending = iota + 1
+		done
+	)
+	state := make(map[string]int, len(byName))
+	var eval func(v *variable) error
+	eval = func(v *variable) error {
+		switch state[v.name] {
+		case pending:
+			return fmt.Errorf("xslt: circular reference to global variable $%s", v.name)
+		case done:
+			return nil
+		}
+		state[v.name] = pending
+		for _, ref := range v.refs {
+			if dep, ok := byName[ref]; ok && dep != v {
+				if err := eval(dep); err != nil {
+					return err
+				}
+			}
+		}
+		if p, ok := params[v.name]; ok && v.param {
+			value, err := paramValue(v.name, p)
+			if err != nil {
+				return err
+			}
+			t.globals[v.name] = value
+		} else {
+			c := *ctx
+			c.vars = t.globals
+			value, err := t.value(v, &c)
+			if err != nil {
+				return err
+			}
+			t.globals[v.name] = value
+		}
+		state[v.name] = done
+		return nil
+	}
+	for _, v := range t.s.globals {
+		if err := eval(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func paramValue(name string, v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case bool, float64, string, []*xmltree.XPathNode:
+		return v, nil
+	case int:
+		return float64(v), nil
+	case *xmltree.Element:
+		return []*xmltree.XPathNode{v.XPathNode()}, nil
+	}
+	return nil, fmt.Errorf("xslt: parameter %s has unsupported type %T", name, v)
+}
+
+// value computes the value of a variable or parameter.
+func (t *transformer) value(v *variable, ctx *context) (interface{}, error) {
+	if v.sel != nil {
+		return v.sel.eval(t, ctx)
+	}
+	if len(v.body) == 0 {
+		return "", nil
+	}
+	frag := &node{kind: xmltree.RootNode}
+	if err := t.execBody(v.body, ctx, frag); err != nil {
+		return nil, err
+	}
+	return t.fragment(frag)
+}
+
+// fragment converts a result tree fragment to a node-set. The nodes of
+// the fragment become the children of an element, which is returned
+// in place of the fragment's root node.
+func (t *transformer) fragment(frag *node) (interface{}, error) {
+	wrapper := &node{kind: xmltree.ElementNode, name: xml.Name{Local: "fragment"}, children: frag.children}
+	doc, err := parseResult(&node{kind: xmltree.RootNode, children: []*node{wrapper}})
+	if err != nil {
+		return nil, err
+	}
+	t.fragments[doc.Root] = true
+	return []*xmltree.XPathNode{doc.Root.XPathNode()}, nil
+}
+
+// bind returns a copy of vars with an additional variable.
+func bind(vars map[string]interface{}, name string, value interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(vars)+1)
+	for k, v := range vars {
+		result[k] = v
+	}
+	result[name] = value
+	return result
+}
+
+// execBody executes a sequence of instructions. Variables bound by
+// xsl:variable are visible to the instructions that follow them.
+func (t *transformer) execBody(body []instruction, ctx *context, out *node) error {
+	for _, instr := range body {
+		if v, ok := instr.(*variableInstr); ok {
+			value, err := t.value(v.v, ctx)
+			if err != nil {
+				return err
+			}
+			c := *ctx
+			c.vars = bind(ctx.vars, v.v.name, value)
+			ctx = &c
+			continue
+		}
+		if err := instr.exec(t, ctx, out); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyTemplates processes each of nodes with the best matching
+// template in the given mode.
+func (t *transformer) applyTemplates(nodes []*xmltree.XPathNode, ctx *context, mode string, params map[string]interface{}, out *node) error {
+	for i, n := range nodes {
+		c := &context{node: n, pos: i + 1, size: len(nodes), vars: ctx.vars, mode: mode}
+		tmpl, err := t.findTemplate(n, mode, nil)
+		if err != nil {
+			return err
+		}
+		if tmpl == nil {
+			if err := t.builtin(c, out); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := t.invoke(tmpl, c, params, out); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// findTemplate returns the template rule for a node. If below is not
+// nil, only templates with a lower import precedence are considered.
+func (t *transformer) findTemplate(n *xmltree.XPathNode, mode string, below *template) (*template, error) {
+	for _, tmpl := range t.s.templates {
+		if tmpl.match == nil || tmpl.mode != mode {
+			continue
+		}
+		if below != nil && tmpl.precedence >= below.precedence {
+			continue
+		}
+		ok, err := tmpl.match.matches(t, n)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return tmpl, nil
+		}
+	}
+	return nil, nil
+}
+
+// builtin applies the built-in template rules.
+func (t *transformer) builtin(ctx *context, out *node) error {
+	switch ctx.node.Kind() {
+	case xmltree.RootNode, xmltree.ElementNode:
+		return t.applyTemplates(ctx.node.Children(), ctx, ctx.mode, nil, out)
+	case xmltree.TextNode, xmltree.CDATANode, xmltree.AttrNode:
+		out.addText(ctx.node.Value())
+	}
+	return nil
+}
+
+// invoke instantiates a template. Parameters of the template that
+// are not in params take their default values.
+func (t *transformer) invoke(tmpl *template, ctx *context, params map[string]interface{}, out *node) error {
+	if t.depth > maxDepth {
+		return fmt.Errorf("xslt: templates nested too deeply")
+	}
+	t.depth++
+	defer func() { t.depth-- }()
+	c := *ctx
+	c.vars = t.globals
+	c.tmpl = tmpl
+	for _, p := range tmpl.params {
+		value, ok := params[p.name]
+		if !ok {
+			var err error
+			if value, err = t.value(p, &c); err != nil {
+				return err
+			}
+		}
+		c.vars = bind(c.vars, p.name, value)
+	}
+	return t.execBody(tmpl.body, &c, out)
+}
+
+// An expr is a compiled XPath expression, along with the namespace
+// bindings in scope where it appears in the stylesheet.
+type expr struct {
+	x  *xmltree.XPath
+	ns map[string]string
+}
+
+func compileExpr(src string, el *xmltree.Element) (*expr, error) {
+	x, err := xmltree.CompileXPath(src)
+	if err != nil {
+		return nil, errorf(el, "%v", err)
+	}
+	ns := el.Namespaces()
+	// The default namespace does not apply to names
+	// in expressions.
+	delete(ns, "")
+	return &expr{x: x, ns: ns}, nil
+}
+
+func (e *expr) eval(t *transformer, ctx *context) (interface{}, error) {
+	prev := t.current
+	t.current = ctx.node
+	defer func() { t.current = prev }()
+	vars := ctx.vars
+	if vars == nil {
+		vars = t.globals
+	}
+	return e.x.EvalContext(xmltree.XPathContext{
+		Node:     ctx.node,
+		Position: ctx.pos,
+		Size:     ctx.size,
+		Env: &xmltree.XPathEnv{
+			Namespaces: e.ns,
+			Variables:  vars,
+			Functions:  t.funcs,
+			// unprefixed names match any namespace; see the
+			// package documentation.
+			AnyNamespace: true,
+		},
+	})
+}
+
+func (e *expr) evalNodes(t *transformer, ctx *context) ([]*xmltree.XPathNode, error) {
+	v, err := e.eval(t, ctx)
+	if err != nil {
+		return nil, err
+	}
+	nodes, ok := v.([]*xmltree.XPathNode)
+	if !ok {
+		return nil, fmt.Errorf("xslt: %s does not select a node-set", e.x)
+	}
+	return nodes, nil
+}
+
+func (e *expr) evalString(t *transformer, ctx *context) (string, error) {
+	v, err := e.eval(t, ctx)
+	if err != nil {
+		return "", err
+	}
+	return xmltree.XPathString(v), nil
+}
+
+// An avt is an attribute value template, such as "{@id}-suffix".
+type avt struct {
+	parts []avtPart
+}
+
+// An avtPart is either literal text or an expression.
+type avtPart struct {
+	text string
+	x    *expr
+}
+
+func parseAVT(s string, el *xmltree.Element) (*avt, error) {
+	a := new(avt)
+	var text strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '{' && i+1 < len(s) && s[i+1] == '{':
+			text.WriteByte('{')
+			i++
+		case c == '}' && i+1 < len(s) && s[i+1] == '}':
+			text.WriteByte('}')
+			i++
+		case c == '}':
+			return nil, errorf(el, "unmatched '}' in attribute value template %q", s)
+		case c == '{':
+			end := -1
+			var quote byte
+			for j := i + 1; j < len(s) && end < 0; j++ {
+				switch {
+				case quote != 0:
+					if s[j] == quote {
+						quote = 0
+					}
+				case s[j] == '\'' || s[j] == '"':
+					quote = s[j]
+				case s[j] == '}':
+					end = j
+				}
+			}
+			if end < 0 {
+				return nil, errorf(el, "unterminated expression in attribute value template %q", s)
+			}
+			x, err := compileExpr(s[i+1:end], el)
+			if err != nil {
+				return nil, err
+			}
+			if text.Len() > 0 {
+				a.parts = append(a.parts, avtPart{text: text.String()})
+				text.Reset()
+			}
+			a.parts = append(a.parts, avtPart{x: x})
+			i = end
+		default:
+			text.WriteByte(c)
+		}
+	}
+	if text.Len() > 0 || len(a.parts) == 0 {
+		a.parts = append(a.parts, avtPart{text: text.String()})
+	}
+	return a, nil
+}
+
+func (a *avt) eval(t *transformer, ctx *context) (string, error) {
+	if len(a.parts) == 1 && a.parts[0].x == nil {
+		return a.parts[0].text, nil
+	}
+	var buf strings.Builder
+	for _, p := range a.parts {
+		if p.x == nil {
+			buf.WriteString(p.text)
+			continue
+		}
+		s, err := p.x.evalString(t, ctx)
+		if err != nil {
+			return "", err
+		}
+		buf.WriteString(s)
+	}
+	return buf.String(), nil
+}
+
+// stripSpace returns a copy of doc with white space text removed from
+// the elements selected by xsl:strip-space. If the stylesheet does not
+// strip space, doc is returned.
+func (s *Stylesheet) stripSpace(doc *xmltree.Element) *xmltree.Element {
+	if len(s.strip) == 0 {
+		return doc
+	}
+	dup := *doc
+	s.stripElement(&dup, false, 0)
+	return &dup
+}
+
+func (s *Stylesheet) stripElement(el *xmltree.Element, inherited bool, depth int) {
+	if depth > maxDepth {
+		return
+	}
+	preserve := inherited
+	switch el.Attr(xmlNamespace, "space") {
+	case "preserve":
+		preserve = true
+	case "default":
+		preserve = false
+	}
+	nodes := el.ContentNodes()
+	if !preserve && s.strips(el.Name) {
+		kept := make([]xmltree.Node, 0, len(nodes))
+		for _, n := range nodes {
+			if (n.Kind == xmltree.TextNode || n.Kind == xmltree.CDATANode) && len(bytes.TrimSpace(n.Data)) == 0 {
+				continue
+			}
+			kept = append(kept, n)
+		}
+		nodes = kept
+	}
+	el.Nodes = nodes
+	if el.Nodes == nil {
+		el.Nodes = []xmltree.Node{}
+	}
+	el.Children = append([]xmltree.Element(nil), el.Children...)
+	for i := range el.Children {
+		s.stripElement(&el.Children[i], preserve, depth+1)
+	}
+}
+
+// strips reports whether white space text is removed from elements
+// with the given name.
+func (s *Stylesheet) strips(name xml.Name) bool {
+	var best *spaceRule
+	for i := range s.strip {
+		r := &s.strip[i]
+		if (r.local != "*" && r.local != name.Local) || (!r.anySpace && r.space != name.Space) {
+			continue
+		}
+		if best == nil || r.precedence > best.precedence ||
+			(r.precedence == best.precedence && r.priority >= best.priority) {
+			best = r
+		}
+	}
+	return best != nil && best.strip
+}
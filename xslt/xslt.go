@@ -0,0 +1,731 @@
+// Package xslt implements an XSLT 1.0 processor for documents parsed
+// with the xmltree package.
+//
+// Stylesheets are compiled once with Parse, ParseFile or Compile, and
+// can then be applied to any number of documents, concurrently if
+// desired. Expressions and patterns are evaluated with the XPath engine
+// of the xmltree package. As with the rest of xmltree, an unprefixed
+// name in an expression or pattern matches elements with that local
+// name in any namespace, so that stylesheets written for documents
+// without namespaces continue to work for documents that use a default
+// namespace.
+//
+// Most of XSLT 1.0 is supported, including templates with modes and
+// priorities, named templates and parameters, variables and result tree
+// fragments, keys, sorting, numbering, attribute sets, xsl:import and
+// xsl:include. The document() function, xsl:namespace-alias and
+// disable-output-escaping are not supported. The node-set function
+// of EXSLT is available, and result tree fragments may also be used
+// directly as node-sets.
+package xslt
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/m29h/go-xml/xmltree"
+)
+
+// Namespace is the XML namespace of XSLT instructions.
+const Namespace = "http://www.w3.org/1999/XSL/Transform"
+
+// The namespace of EXSLT common functions, for exsl:node-set.
+const exsltCommon = "http://exslt.org/common"
+
+const xmlNamespace = "http://www.w3.org/XML/1998/namespace"
+
+// A Stylesheet is a compiled XSLT stylesheet.
+type Stylesheet struct {
+	// If set, Message is called with the content of each
+	// xsl:message instruction that does not terminate the
+	// transformation.
+	Message func(msg string)
+
+	templates  []*template
+	named      map[string]*template
+	globals    []*variable
+	keys       map[string][]*keyDef
+	attrSets   map[string][]*attrSet
+	formats    map[string]*decimalFormat
+	output     output
+	strip      []spaceRule
+	nodeSetFns []string
+}
+
+// A template is an xsl:template element.
+type template struct {
+	match      *pattern
+	name       string
+	mode       string
+	priority   float64
+	precedence int
+	// position in the stylesheet, for conflict resolution
+	order  int
+	params []*variable
+	body   []instruction
+}
+
+// A variable is an xsl:variable, xsl:param or xsl:with-param
+// element.
+type variable struct {
+	name  string
+	param bool
+	// either sel or body is used
+	sel        *expr
+	body       []instruction
+	precedence int
+	// global variables referenced, for ordering their evaluation
+	refs []string
+}
+
+type keyDef struct {
+	match *pattern
+	use   *expr
+}
+
+type attrSet struct {
+	useSets []string
+	attrs   []instruction
+}
+
+// An output holds the attributes of xsl:output.
+type output struct {
+	method         string
+	indent         bool
+	omitDecl       bool
+	standalone     string
+	doctypePublic  string
+	doctypeSystem  string
+	cdataElements  map[xml.Name]bool
+	version        string
+	methodExplicit bool
+}
+
+// A spaceRule is a name test from xsl:strip-space or xsl:preserve-space.
+type spaceRule struct {
+	space, local string
+	// "*" matches any local name; an empty space with
+	// anySpace set matches any namespace
+	anySpace bool
+	strip    bool
+	// more specific tests take priority
+	priority   float64
+	precedence int
+}
+
+// Parse compiles the XSLT stylesheet in data. Stylesheets compiled with
+// Parse cannot use xsl:import or xsl:include; use ParseFile or Compile
+// instead.
+func Parse(data []byte) (*Stylesheet, error) {
+	doc, err := xmltree.ParseDocument(data)
+	if err != nil {
+		return nil, err
+	}
+	return Compile(doc.Root, nil)
+}
+
+// ParseFile compiles the XSLT stylesheet in the named file. Stylesheets
+// referenced by xsl:import and xsl:include are read relative to the
+// directory of the file that refers to them.
+func ParseFile(filename string) (*Stylesheet, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := xmltree.ParseDocument(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	c := newCompiler(func(href, base string) (*xmltree.Element, string, error) {
+		if !filepath.IsAbs(href) {
+			href = filepath.Join(filepath.Dir(base), filepath.FromSlash(href))
+		}
+		data, err := os.ReadFile(href)
+		if err != nil {
+			return nil, "", err
+		}
+		doc, err := xmltree.ParseDocument(data)
+		if err != nil {
+			return nil, "", fmt.Errorf("%s: %v", href, err)
+		}
+		return doc.Root, href, nil
+	})
+	if err := c.module(doc.Root, filename, 0); err != nil {
+		return nil, err
+	}
+	return c.finish()
+}
+
+// Compile compiles a stylesheet that has already been parsed. The
+// element may be an xsl:stylesheet or xsl:transform element, or a
+// literal result element with an xsl:version attribute. The load
+// function is called to retrieve the stylesheets referenced by
+// xsl:import and xsl:include; if it is nil, such references are an
+// error. Whitespace in the stylesheet is best preserved if el was
+// parsed with xmltree.ParseDocument.
+func Compile(el *xmltree.Element, load func(href string) (*xmltree.Element, error)) (*Stylesheet, error) {
+	var loader moduleLoader
+	if load != nil {
+		loader = func(href, _ string) (*xmltree.Element, string, error) {
+			el, err := load(href)
+			return el, href, err
+		}
+	}
+	c := newCompiler(loader)
+	if err := c.module(el, "", 0); err != nil {
+		return nil, err
+	}
+	return c.finish()
+}
+
+type moduleLoader func(href, base string) (el *xmltree.Element, location string, err error)
+
+type compiler struct {
+	s          *Stylesheet
+	load       moduleLoader
+	precedence int
+	order      int
+	// the stylesheet element and literal result elements
+	// enclosing the element being compiled
+	stack []*xmltree.Element
+}
+
+func newCompiler(load moduleLoader) *compiler {
+	return &compiler{
+		load: load,
+		s: &Stylesheet{
+			named:    make(map[string]*template),
+			keys:     make(map[string][]*keyDef),
+			attrSets: make(map[string][]*attrSet),
+			formats:  make(map[string]*decimalFormat),
+		},
+	}
+}
+
+// A compileError describes a problem with an element of a stylesheet.
+type compileError struct {
+	el  *xmltree.Element
+	msg string
+}
+
+func (e *compileError) Error() string {
+	name := e.el.Name.Local
+	if e.el.Name.Space == Namespace {
+		name = "xsl:" + name
+	}
+	if e.el.Start.IsValid() {
+		return fmt.Sprintf("xslt: %s at %s: %s", name, e.el.Start, e.msg)
+	}
+	return fmt.Sprintf("xslt: %s: %s", name, e.msg)
+}
+
+func errorf(el *xmltree.Element, format string, args ...interface{}) error {
+	return &compileError{el, fmt.Sprintf(format, args...)}
+}
+
+func isXSL(el *xmltree.Element, local string) bool {
+	return el.Name.Space == Namespace && el.Name.Local == local
+}
+
+// module compiles a stylesheet module. Imported modules are compiled
+// first, so that they receive a lower import precedence.
+func (c *compiler) module(el *xmltree.Element, location string, depth int) error {
+	if depth > 50 {
+		return errorf(el, "xsl:import or xsl:include nested too deeply")
+	}
+	if !isXSL(el, "stylesheet") && !isXSL(el, "transform") {
+		// A literal result element as stylesheet.
+		if el.Attr(Namespace, "version") == "" {
+			return errorf(el, "not an XSLT stylesheet")
+		}
+		c.precedence++
+		c.nodeSetFunctions(el)
+		lre, err := c.instruction(el)
+		if err != nil {
+			return err
+		}
+		body := []instruction{lre}
+		root, _ := parsePattern("/", el)
+		c.s.templates = append(c.s.templates, &template{
+			match:      root,
+			priority:   0.5,
+			precedence: c.precedence,
+			order:      c.next(),
+			body:       body,
+		})
+		return nil
+	}
+	for i := range el.Children {
+		child := &el.Children[i]
+		if !isXSL(child, "import") {
+			continue
+		}
+		imported, loc, err := c.loadModule(child, location)
+		if err != nil {
+			return err
+		}
+		if err := c.module(imported, loc, depth+1); err != nil {
+			return err
+		}
+	}
+	c.precedence++
+	return c.declarations(el, location, depth)
+}
+
+func (c *compiler) loadModule(el *xmltree.Element, base string) (*xmltree.Element, string, error) {
+	href := el.Attr("", "href")
+	if href == "" {
+		return nil, "", errorf(el, "missing href attribute")
+	}
+	if c.load == nil {
+		return nil, "", errorf(el, "cannot load %q: no loader", href)
+	}
+	loaded, loc, err := c.load(href, base)
+	if err != nil {
+		return nil, "", errorf(el, "%v", err)
+	}
+	return loaded, loc, nil
+}
+
+func (c *compiler) next() int {
+	c.order++
+	return c.order
+}
+
+// declarations compiles the top-level elements of a module, with
+// the current import precedence.
+func (c *compiler) declarations(el *xmltree.Element, location string, depth int) error {
+	c.nodeSetFunctions(el)
+	saved := c.stack
+	c.stack = []*xmltree.Element{el}
+	defer func() { c.stack = saved }()
+	for i := range el.Children {
+		child := &el.Children[i]
+		if child.Name.Space != Namespace {
+			// user-defined data elements are ignored
+			continue
+		}
+		var err error
+		switch child.Name.Local {
+		case "import":
+		case "include":
+			var included *xmltree.Element
+			var loc string
+			if included, loc, err = c.loadModule(child, location); err == nil {
+				if !isXSL(included, "stylesheet") && !isXSL(included, "transform") {
+					err = errorf(child, "%s is not an XSLT stylesheet", loc)
+				} else if depth > 50 {
+					err = errorf(child, "xsl:include nested too deeply")
+				} else {
+					err = c.declarations(included, loc, depth+1)
+				}
+			}
+		case "template":
+			err = c.template(child)
+		case "variable", "param":
+			var v *variable
+			if v, err = c.variable(child); err == nil {
+				v.precedence = c.precedence
+				c.s.globals = append(c.s.globals, v)
+			}
+		case "key":
+			err = c.key(child)
+		case "output":
+			err = c.output(child)
+		case "strip-space", "preserve-space":
+			c.space(child)
+		case "attribute-set":
+			err = c.attributeSet(child)
+		case "decimal-format":
+			err = c.decimalFormat(child)
+		case "namespace-alias":
+			err = errorf(child, "not supported")
+		default:
+			if !forwardsCompatible(el) {
+				err = errorf(child, "unknown top-level element")
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func forwardsCompatible(el *xmltree.Element) bool {
+	v := el.Attr("", "version")
+	if el.Name.Space != Namespace {
+		v = el.Attr(Namespace, "version")
+	}
+	return v != "" && v != "1.0"
+}
+
+// nodeSetFunctions records the names by which the EXSLT node-set
+// function may be called.
+func (c *compiler) nodeSetFunctions(el *xmltree.Element) {
+	for prefix, ns := range el.Namespaces() {
+		if ns == exsltCommon && prefix != "" {
+			c.s.nodeSetFns = append(c.s.nodeSetFns, prefix+":node-set")
+		}
+	}
+}
+
+func (c *compiler) template(el *xmltree.Element) error {
+	t := &template{precedence: c.precedence, order: c.next()}
+	match, name := el.Attr("", "match"), el.Attr("", "name")
+	if match == "" && name == "" {
+		return errorf(el, "either match or name is required")
+	}
+	if name != "" {
+		t.name = expandedName(el, name)
+		if prev, ok := c.s.named[t.name]; ok && prev.precedence == t.precedence {
+			return errorf(el, "duplicate template %s", name)
+		} else if !ok || prev.precedence < t.precedence {
+			c.s.named[t.name] = t
+		}
+	}
+	if match != "" {
+		p, err := parsePattern(match, el)
+		if err != nil {
+			return errorf(el, "%v", err)
+		}
+		t.match = p
+		t.mode = expandedName(el, el.Attr("", "mode"))
+		if s := el.Attr("", "priority"); s != "" {
+			f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+			if err != nil {
+				return errorf(el, "invalid priority %q", s)
+			}
+			t.priority = f
+			t.match.explicitPriority = true
+		}
+	}
+	nodes := contentOf(el, false)
+	for len(nodes) > 0 {
+		n := nodes[0]
+		if n.el == nil || !isXSL(n.el, "param") {
+			break
+		}
+		p, err := c.variable(n.el)
+		if err != nil {
+			return err
+		}
+		t.params = append(t.params, p)
+		nodes = nodes[1:]
+	}
+	body, err := c.compileBody(nodes)
+	if err != nil {
+		return err
+	}
+	t.body = body
+	if t.match != nil {
+		// A pattern with alternatives is treated as a
+		// separate template for each alternative.
+		for _, alt := range t.match.split() {
+			dup := *t
+			dup.match = alt
+			if !alt.explicitPriority {
+				dup.priority = alt.defaultPriority()
+			}
+			c.s.templates = append(c.s.templates, &dup)
+		}
+	}
+	return nil
+}
+
+func (c *compiler) variable(el *xmltree.Element) (*variable, error) {
+	v := &variable{name: el.Attr("", "name"), param: el.Name.Local != "variable"}
+	if v.name == "" {
+		return nil, errorf(el, "missing name attribute")
+	}
+	if sel := el.Attr("", "select"); sel != "" {
+		x, err := compileExpr(sel, el)
+		if err != nil {
+			return nil, err
+		}
+		v.sel = x
+		v.refs = variableRefs(sel)
+		return v, nil
+	}
+	body, err := c.compileBody(contentOf(el, false))
+	if err != nil {
+		return nil, err
+	}
+	v.body = body
+	for _, a := range allAttrValues(el) {
+		v.refs = append(v.refs, variableRefs(a)...)
+	}
+	return v, nil
+}
+
+func (c *compiler) key(el *xmltree.Element) error {
+	name, match, use := el.Attr("", "name"), el.Attr("", "match"), el.Attr("", "use")
+	if name == "" || match == "" || use == "" {
+		return errorf(el, "name, match and use are required")
+	}
+	p, err := parsePattern(match, el)
+	if err != nil {
+		return errorf(el, "%v", err)
+	}
+	x, err := compileExpr(use, el)
+	if err != nil {
+		return err
+	}
+	name = expandedName(el, name)
+	c.s.keys[name] = append(c.s.keys[name], &keyDef{match: p, use: x})
+	return nil
+}
+
+func (c *compiler) output(el *xmltree.Element) error {
+	o := &c.s.output
+	for _, a := range el.StartElement.Attr {
+		if a.Name.Space != "" {
+			continue
+		}
+		v := strings.TrimSpace(a.Value)
+		switch a.Name.Local {
+		case "method":
+			switch v {
+			case "xml", "html", "text":
+			default:
+				return errorf(el, "unsupported output method %q", v)
+			}
+			o.method, o.methodExplicit = v, true
+		case "indent":
+			o.indent = v == "yes"
+		case "omit-xml-declaration":
+			o.omitDecl = v == "yes"
+		case "standalone":
+			o.standalone = v
+		case "doctype-public":
+			o.doctypePublic = v
+		case "doctype-system":
+			o.doctypeSystem = v
+		case "version":
+			o.version = v
+		case "cdata-section-elements":
+			if o.cdataElements == nil {
+				o.cdataElements = make(map[xml.Name]bool)
+			}
+			for _, qname := range strings.Fields(v) {
+				o.cdataElements[el.Resolve(qname)] = true
+			}
+		}
+	}
+	return nil
+}
+
+func (c *compiler) space(el *xmltree.Element) {
+	strip := el.Name.Local == "strip-space"
+	for _, test := range strings.Fields(el.Attr("", "elements")) {
+		r := spaceRule{strip: strip, precedence: c.precedence}
+		switch {
+		case test == "*":
+			r.local, r.anySpace, r.priority = "*", true, -0.5
+		case strings.HasSuffix(test, ":*"):
+			r.space = el.Resolve(strings.TrimSuffix(test, "*") + "x").Space
+			r.local, r.priority = "*", -0.25
+		default:
+			name := el.Resolve(test)
+			if !strings.Contains(test, ":") {
+				// unprefixed names match any namespace,
+				// as they do in patterns
+				name.Space = ""
+				r.anySpace = true
+			}
+			r.space, r.local = name.Space, name.Local
+		}
+		c.s.strip = append(c.s.strip, r)
+	}
+}
+
+func (c *compiler) attributeSet(el *xmltree.Element) error {
+	name := el.Attr("", "name")
+	if name == "" {
+		return errorf(el, "missing name attribute")
+	}
+	set := &attrSet{useSets: qnames(el, el.Attr("", "use-attribute-sets"))}
+	for i := range el.Children {
+		child := &el.Children[i]
+		if !isXSL(child, "attribute") {
+			return errorf(child, "only xsl:attribute is allowed in xsl:attribute-set")
+		}
+		instr, err := c.instruction(child)
+		if err != nil {
+			return err
+		}
+		set.attrs = append(set.attrs, instr)
+	}
+	name = expandedName(el, name)
+	c.s.attrSets[name] = append(c.s.attrSets[name], set)
+	return nil
+}
+
+// finish checks the stylesheet for errors that can only be detected
+// once all modules have been compiled.
+func (c *compiler) finish() (*Stylesheet, error) {
+	s := c.s
+	sort.SliceStable(s.templates, func(i, j int) bool {
+		a, b := s.templates[i], s.templates[j]
+		if a.precedence != b.precedence {
+			return a.precedence > b.precedence
+		}
+		if a.priority != b.priority {
+			return a.priority > b.priority
+		}
+		return a.order > b.order
+	})
+	// Only the global variable with the highest import
+	// precedence is used.
+	byName := make(map[string]*variable)
+	var globals []*variable
+	for _, v := range s.globals {
+		prev, ok := byName[v.name]
+		switch {
+		case !ok:
+			globals = append(globals, v)
+		case prev.precedence == v.precedence:
+			return nil, fmt.Errorf("xslt: duplicate global variable %s", v.name)
+		case prev.precedence > v.precedence:
+			continue
+		default:
+			for i := range globals {
+				if globals[i] == prev {
+					globals[i] = v
+				}
+			}
+		}
+		byName[v.name] = v
+	}
+	s.globals = globals
+	for _, set := range s.attrSets {
+		for _, a := range set {
+			for _, use := range a.useSets {
+				if _, ok := s.attrSets[use]; !ok {
+					return nil, fmt.Errorf("xslt: undefined attribute set %s", use)
+				}
+			}
+		}
+	}
+	return s, nil
+}
+
+// expandedName resolves a QName in a stylesheet to a string of the
+// form {namespace}local, or local if it has no prefix.
+func expandedName(el *xmltree.Element, qname string) string {
+	qname = strings.TrimSpace(qname)
+	if qname == "" || !strings.Contains(qname, ":") {
+		return qname
+	}
+	name := el.Resolve(qname)
+	return "{" + name.Space + "}" + name.Local
+}
+
+func qnames(el *xmltree.Element, list string) []string {
+	var names []string
+	for _, qname := range strings.Fields(list) {
+		names = append(names, expandedName(el, qname))
+	}
+	return names
+}
+
+// A contentNode is an item of content in a stylesheet: either a
+// child element, or text.
+type contentNode struct {
+	el   *xmltree.Element
+	text string
+}
+
+// contentOf returns the content of a stylesheet element. Text
+// consisting only of white space is removed, unless it is within
+// xsl:text or the scope of xml:space="preserve".
+func contentOf(el *xmltree.Element, preserve bool) []contentNode {
+	switch el.Attr(xmlNamespace, "space") {
+	case "preserve":
+		preserve = true
+	case "default":
+		preserve = false
+	}
+	var result []contentNode
+	for _, n := range el.ContentNodes() {
+		switch n.Kind {
+		case xmltree.ElementNode:
+			if n.Child >= 0 && n.Child < len(el.Children) {
+				result = append(result, contentNode{el: &el.Children[n.Child]})
+			}
+		case xmltree.TextNode, xmltree.CDATANode:
+			text := string(n.Data)
+			if !preserve && !isXSL(el, "text") && strings.TrimSpace(text) == "" {
+				continue
+			}
+			if k := len(result); k > 0 && result[k-1].el == nil {
+				result[k-1].text += text
+				continue
+			}
+			result = append(result, contentNode{text: text})
+		}
+	}
+	return result
+}
+
+// allAttrValues returns the values of all attributes in the subtree
+// rooted at el.
+func allAttrValues(el *xmltree.Element) []string {
+	var values []string
+	for _, a := range el.StartElement.Attr {
+		values = append(values, a.Value)
+	}
+	for _, child := range el.Flatten() {
+		for _, a := range child.StartElement.Attr {
+			values = append(values, a.Value)
+		}
+	}
+	return values
+}
+
+// variableRefs returns the names of the variables referenced in an
+// expression. It may return names that are not variable references,
+// such as text in string literals, which is harmless.
+func variableRefs(s string) []string {
+	var refs []string
+	for {
+		i := strings.IndexByte(s, '$')
+		if i < 0 {
+			return refs
+		}
+		s = s[i+1:]
+		j := 0
+		for j < len(s) && isNameChar(s[j]) {
+			j++
+		}
+		if j > 0 {
+			refs = append(refs, s[:j])
+		}
+		s = s[j:]
+	}
+}
+
+// isNCName reports whether s is an XML name without a colon.
+func isNCName(s string) bool {
+	for i, r := range s {
+		switch {
+		case r == '_' || unicode.IsLetter(r):
+		case i > 0 && (r == '-' || r == '.' || unicode.IsDigit(r) ||
+			unicode.Is(unicode.Mn, r) || unicode.Is(unicode.Mc, r)):
+		default:
+			return false
+		}
+	}
+	return s != ""
+}
+
+func isNameChar(c byte) bool {
+	return c == '_' || c == '-' || c == '.' || c == ':' || c >= 0x80 ||
+		('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9')
+}
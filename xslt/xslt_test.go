@@ -0,0 +1,283 @@
+package xslt
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/m29h/go-xml/xmltree"
+)
+
+const catalog = `<?xml version="1.0"?>
+<catalog xmlns="urn:catalog">
+  <book id="b1" lang="en"><title>Go</title><price>30</price><author>Pike</author></book>
+  <book id="b2" lang="de"><title>XML</title><price>12.5</price><author>Bray</author></book>
+  <book id="b3" lang="en"><title>Algorithms</title><price>85</price><author>Knuth</author></book>
+</catalog>`
+
+func stylesheet(body string) string {
+	return `<xsl:stylesheet version="1.0"
+	xmlns:xsl="http://www.w3.org/1999/XSL/Transform"
+	xmlns:c="urn:catalog" exclude-result-prefixes="c">
+<xsl:output method="xml" omit-xml-declaration="yes"/>
+` + body + `
+</xsl:stylesheet>`
+}
+
+func TestTransform(t *testing.T) {
+	tests := []struct {
+		name, xsl string
+		params    map[string]interface{}
+		want      string
+	}{
+		{
+			name: "built-in templates",
+			xsl:  stylesheet(`<xsl:strip-space elements="*"/>`),
+			want: "Go30PikeXML12.5BrayAlgorithms85Knuth",
+		},
+		{
+			name: "apply-templates with modes",
+			xsl: stylesheet(`
+<xsl:template match="/"><list><xsl:apply-templates select="//book" mode="short"/></list></xsl:template>
+<xsl:template match="book" mode="short"><item ref="{@id}"><xsl:value-of select="title"/></item></xsl:template>
+<xsl:template match="book"><wrong/></xsl:template>`),
+			want: `<list><item ref="b1">Go</item><item ref="b2">XML</item><item ref="b3">Algorithms</item></list>`,
+		},
+		{
+			name: "for-each with sort",
+			xsl: stylesheet(`
+<xsl:template match="/">
+  <xsl:for-each select="c:catalog/c:book">
+    <xsl:sort select="price" data-type="number" order="descending"/>
+    <xsl:value-of select="title"/><xsl:if test="position() != last()">,</xsl:if>
+  </xsl:for-each>
+</xsl:template>`),
+			want: "Algorithms,Go,XML",
+		},
+		{
+			name: "variables and result tree fragments",
+			xsl: stylesheet(`
+<xsl:variable name="total" select="sum(//price)"/>
+<xsl:variable name="names"><n>a</n><n>b</n></xsl:variable>
+<xsl:template match="/">
+  <xsl:variable name="count" select="count(//book)"/>
+  <r total="{$total}" avg="{$total div $count}" n="{count($names/n)}"><xsl:copy-of select="$names"/></r>
+</xsl:template>`),
+			want: `<r total="127.5" avg="42.5" n="2"><n>a</n><n>b</n></r>`,
+		},
+		{
+			name: "keys",
+			xsl: stylesheet(`
+<xsl:key name="by-lang" match="book" use="@lang"/>
+<xsl:template match="/">
+  <xsl:for-each select="key('by-lang', 'en')"><xsl:value-of select="@id"/>;</xsl:for-each>
+</xsl:template>`),
+			want: "b1;b3;",
+		},
+		{
+			name: "named templates and parameters",
+			xsl: stylesheet(`
+<xsl:param name="currency" select="'EUR'"/>
+<xsl:template match="/">
+  <xsl:call-template name="price">
+    <xsl:with-param name="amount" select="//book[1]/price"/>
+  </xsl:call-template>
+</xsl:template>
+<xsl:template name="price">
+  <xsl:param name="amount" select="0"/>
+  <xsl:value-of select="format-number($amount, '#,##0.00')"/>
+  <xsl:text> </xsl:text>
+  <xsl:value-of select="$currency"/>
+</xsl:template>`),
+			params: map[string]interface{}{"currency": "USD"},
+			want:   "30.00 USD",
+		},
+		{
+			name: "choose",
+			xsl: stylesheet(`
+<xsl:template match="book">
+  <xsl:choose>
+    <xsl:when test="price &gt; 50">expensive </xsl:when>
+    <xsl:when test="price &gt; 20">normal </xsl:when>
+    <xsl:otherwise>cheap </xsl:otherwise>
+  </xsl:choose>
+</xsl:template>
+<xsl:template match="text()"/>`),
+			want: "normal cheap expensive",
+		},
+		{
+			name: "number",
+			xsl: stylesheet(`
+<xsl:template match="book">
+  <xsl:number format="(a) "/><xsl:number value="count(preceding-sibling::book) + 1" format="I "/>
+</xsl:template>
+<xsl:template match="text()"/>`),
+			want: "(a) I (b) II (c) III",
+		},
+		{
+			name: "element and attribute",
+			xsl: stylesheet(`
+<xsl:template match="/">
+  <xsl:element name="{local-name(*)}" namespace="urn:out">
+    <xsl:attribute name="count"><xsl:value-of select="count(//book)"/></xsl:attribute>
+    <xsl:comment>generated</xsl:comment>
+  </xsl:element>
+</xsl:template>`),
+			want: `<catalog xmlns="urn:out" count="3"><!--generated--></catalog>`,
+		},
+		{
+			name: "copy",
+			xsl: stylesheet(`
+<xsl:template match="@*|node()"><xsl:copy><xsl:apply-templates select="@*|node()"/></xsl:copy></xsl:template>
+<xsl:template match="c:book[@lang='de']"/>
+<xsl:template match="text()[normalize-space()='']"/>`),
+			want: `<catalog xmlns="urn:catalog"><book id="b1" lang="en"><title>Go</title><price>30</price><author>Pike</author></book><book id="b3" lang="en"><title>Algorithms</title><price>85</price><author>Knuth</author></book></catalog>`,
+		},
+		{
+			name: "priority",
+			xsl: stylesheet(`
+<xsl:template match="c:book" priority="2">high </xsl:template>
+<xsl:template match="book[@lang='en']">predicate </xsl:template>
+<xsl:template match="text()"/>`),
+			want: "high high high",
+		},
+		{
+			name: "text output",
+			xsl: `<xsl:stylesheet version="1.0" xmlns:xsl="http://www.w3.org/1999/XSL/Transform">
+<xsl:output method="text"/>
+<xsl:template match="/"><a>x &amp; y</a></xsl:template>
+</xsl:stylesheet>`,
+			want: "x & y",
+		},
+		{
+			name: "literal result element as stylesheet",
+			xsl:  `<out xsl:version="1.0" xmlns:xsl="http://www.w3.org/1999/XSL/Transform"><xsl:value-of select="count(//book)"/></out>`,
+			want: `<?xml version="1.0" encoding="UTF-8"?>
+<out>3</out>`,
+		},
+	}
+	doc, err := xmltree.ParseDocument([]byte(catalog))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := Parse([]byte(tt.xsl))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			if err := s.Transform(&buf, doc.Root, tt.params); err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.TrimSpace(buf.String()); got != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTransformElement(t *testing.T) {
+	s, err := Parse([]byte(stylesheet(`
+<xsl:template match="/c:catalog">
+  <prices xmlns="urn:prices">
+    <xsl:for-each select="c:book"><price book="{@id}"><xsl:value-of select="c:price"/></price></xsl:for-each>
+  </prices>
+</xsl:template>`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := xmltree.ParseDocument([]byte(catalog))
+	if err != nil {
+		t.Fatal(err)
+	}
+	el, err := s.TransformElement(doc.Root, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if el.Name.Space != "urn:prices" || el.Name.Local != "prices" {
+		t.Errorf("got document element %v", el.Name)
+	}
+	prices := el.Search("urn:prices", "price")
+	if len(prices) != 3 || string(prices[1].Content) != "12.5" || prices[1].Attr("", "book") != "b2" {
+		t.Errorf("unexpected result %s", xmltree.MarshalIndent(el, "", "  "))
+	}
+}
+
+func TestErrors(t *testing.T) {
+	tests := []struct {
+		name, xsl string
+	}{
+		{"unknown instruction", stylesheet(`<xsl:template match="/"><xsl:frobnicate/></xsl:template>`)},
+		{"missing select", stylesheet(`<xsl:template match="/"><xsl:value-of/></xsl:template>`)},
+		{"bad expression", stylesheet(`<xsl:template match="/"><xsl:value-of select="1 +"/></xsl:template>`)},
+		{"not a stylesheet", `<a/>`},
+	}
+	for _, tt := range tests {
+		if _, err := Parse([]byte(tt.xsl)); err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+	}
+	s, err := Parse([]byte(stylesheet(`
+<xsl:template match="/"><xsl:message terminate="yes">stop</xsl:message></xsl:template>`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, _ := xmltree.ParseDocument([]byte(catalog))
+	var buf bytes.Buffer
+	if err := s.Transform(&buf, doc.Root, nil); err == nil || !strings.Contains(err.Error(), "stop") {
+		t.Errorf("got error %v, want xsl:message text", err)
+	}
+
+	// Computed names must be QNames.
+	for _, body := range []string{
+		`<xsl:element name="{'bad name'}"/>`,
+		`<xsl:element name="{'1x'}"/>`,
+		`<xsl:element name="{'p:'}"/>`,
+		`<e><xsl:attribute name="{'1 x'}">v</xsl:attribute></e>`,
+		`<e><xsl:attribute name="{'a:b:c'}">v</xsl:attribute></e>`,
+	} {
+		s, err := Parse([]byte(stylesheet(`<xsl:template match="/">` + body + `</xsl:template>`)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf.Reset()
+		if err := s.Transform(&buf, doc.Root, nil); err == nil || !strings.Contains(err.Error(), "invalid name") {
+			t.Errorf("%s: got error %v and output %s, want an invalid name error", body, err, buf.Bytes())
+		}
+	}
+}
+
+func TestImport(t *testing.T) {
+	modules := map[string]string{
+		"base.xsl": stylesheet(`
+<xsl:template match="book">[<xsl:value-of select="@id"/>]</xsl:template>
+<xsl:template match="text()"/>`),
+		"main.xsl": stylesheet(`
+<xsl:import href="base.xsl"/>
+<xsl:template match="book[@lang='en']">en<xsl:apply-imports/></xsl:template>`),
+	}
+	load := func(href string) (*xmltree.Element, error) {
+		doc, err := xmltree.ParseDocument([]byte(modules[href]))
+		if err != nil {
+			return nil, err
+		}
+		return doc.Root, nil
+	}
+	main, err := load("main.xsl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := Compile(main, load)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, _ := xmltree.ParseDocument([]byte(catalog))
+	var buf bytes.Buffer
+	if err := s.Transform(&buf, doc.Root, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := buf.String(), "en[b1][b2]en[b3]"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}